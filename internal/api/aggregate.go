@@ -0,0 +1,301 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// truncUnits are the date_trunc units accepted in the group parameter.
+var truncUnits = map[string]bool{
+	"second": true, "minute": true, "hour": true, "day": true,
+	"week": true, "month": true, "quarter": true, "year": true,
+}
+
+// aggFuncs are the aggregate functions accepted in the agg parameter.
+var aggFuncs = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+}
+
+// callPattern matches a function call such as "sum(amount)" or "count()".
+var callPattern = regexp.MustCompile(`^([A-Za-z_]+)\(([^()]*)\)$`)
+
+// aggExpr is one output column of an aggregate query.
+type aggExpr struct {
+	sql   string // SQL expression
+	alias string // output key
+}
+
+// parseGroup parses the group parameter: a comma-separated list of columns or
+// date_trunc(unit,column) calls. date_trunc outputs are named "column_unit".
+func parseGroup(tbl *schema.Table, param string) ([]aggExpr, error) {
+	var exprs []aggExpr
+	for _, item := range splitTopLevel(param) {
+		if m := callPattern.FindStringSubmatch(item); m != nil {
+			if strings.ToLower(m[1]) != "date_trunc" {
+				return nil, fmt.Errorf("unsupported group function: %s", m[1])
+			}
+			args := strings.Split(m[2], ",")
+			if len(args) != 2 {
+				return nil, fmt.Errorf("date_trunc takes a unit and a column")
+			}
+			unit := strings.ToLower(strings.TrimSpace(args[0]))
+			name := strings.TrimSpace(args[1])
+			if !truncUnits[unit] {
+				return nil, fmt.Errorf("unsupported date_trunc unit: %s", unit)
+			}
+			col := tbl.ColumnByName(name)
+			if col == nil {
+				return nil, fmt.Errorf("unknown column: %s", name)
+			}
+			if !isTemporalColumn(col) {
+				return nil, fmt.Errorf("date_trunc requires a date or timestamp column: %s", name)
+			}
+			exprs = append(exprs, aggExpr{
+				sql:   fmt.Sprintf("date_trunc('%s', %s)", unit, quoteIdent(name)),
+				alias: name + "_" + unit,
+			})
+			continue
+		}
+
+		if tbl.ColumnByName(item) == nil {
+			return nil, fmt.Errorf("unknown column: %s", item)
+		}
+		exprs = append(exprs, aggExpr{sql: quoteIdent(item), alias: item})
+	}
+	return exprs, nil
+}
+
+// parseAggs parses the agg parameter: a comma-separated list of count(),
+// count(col), sum(col), avg(col), min(col) and max(col). Outputs are named
+// "count" for count() and "func_column" otherwise.
+func parseAggs(tbl *schema.Table, param string) ([]aggExpr, error) {
+	var exprs []aggExpr
+	for _, item := range splitTopLevel(param) {
+		m := callPattern.FindStringSubmatch(item)
+		if m == nil {
+			return nil, fmt.Errorf("invalid aggregate: %s", item)
+		}
+		fn, name := strings.ToLower(m[1]), strings.TrimSpace(m[2])
+		if !aggFuncs[fn] {
+			return nil, fmt.Errorf("unsupported aggregate function: %s", fn)
+		}
+
+		if name == "" {
+			if fn != "count" {
+				return nil, fmt.Errorf("%s requires a column", fn)
+			}
+			exprs = append(exprs, aggExpr{sql: "COUNT(*)", alias: "count"})
+			continue
+		}
+
+		col := tbl.ColumnByName(name)
+		if col == nil {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		switch fn {
+		case "sum", "avg":
+			if !isNumericColumn(col) {
+				return nil, fmt.Errorf("%s requires a numeric column: %s", fn, name)
+			}
+		case "min", "max":
+			if !isNumericColumn(col) && !isTemporalColumn(col) && !isTextColumn(col) && !col.IsEnum {
+				return nil, fmt.Errorf("%s is not supported on column %s", fn, name)
+			}
+		}
+		exprs = append(exprs, aggExpr{
+			sql:   fmt.Sprintf("%s(%s)", strings.ToUpper(fn), quoteIdent(name)),
+			alias: fn + "_" + name,
+		})
+	}
+	return exprs, nil
+}
+
+// splitTopLevel splits s on commas that are not inside parentheses, trimming
+// whitespace and dropping empty items.
+func splitTopLevel(s string) []string {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	add := func(p string) {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	for i, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	add(s[start:])
+	return parts
+}
+
+func isNumericColumn(col *schema.Column) bool {
+	return !col.IsArray && (col.JSONType == "integer" || col.JSONType == "number")
+}
+
+func isTemporalColumn(col *schema.Column) bool {
+	t := strings.ToLower(col.TypeName)
+	return !col.IsArray && (t == "date" || strings.HasPrefix(t, "timestamp"))
+}
+
+func isTextColumn(col *schema.Column) bool {
+	t := strings.ToLower(col.TypeName)
+	return !col.IsArray && (t == "text" || strings.HasPrefix(t, "character") || strings.HasPrefix(t, "varchar"))
+}
+
+// aggOutputTable describes the columns produced by an aggregate query, so that
+// having and sort can be parsed with the regular filter and sort parsers.
+func aggOutputTable(exprs []aggExpr) (*schema.Table, error) {
+	tbl := &schema.Table{Name: "agg"}
+	for _, e := range exprs {
+		if tbl.ColumnByName(e.alias) != nil {
+			return nil, fmt.Errorf("duplicate output column: %s", e.alias)
+		}
+		tbl.Columns = append(tbl.Columns, &schema.Column{Name: e.alias})
+	}
+	return tbl, nil
+}
+
+// buildAggregate builds the aggregate query. The grouped query is wrapped in a
+// subquery so that having can refer to output names; having placeholders must
+// be numbered after the filter's.
+func buildAggregate(tbl *schema.Table, groups, aggs []aggExpr, filterSQL string, filterArgs []any, havingSQL string, havingArgs []any, orderSQL string) (string, []any) {
+	selects := make([]string, 0, len(groups)+len(aggs))
+	for _, e := range append(append([]aggExpr{}, groups...), aggs...) {
+		selects = append(selects, e.sql+" AS "+quoteIdent(e.alias))
+	}
+
+	inner := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), tableRef(tbl))
+	if filterSQL != "" {
+		inner += " WHERE " + filterSQL
+	}
+	if len(groups) > 0 {
+		ordinals := make([]string, len(groups))
+		for i := range groups {
+			ordinals[i] = fmt.Sprint(i + 1)
+		}
+		inner += " GROUP BY " + strings.Join(ordinals, ", ")
+	}
+
+	q := "SELECT * FROM (" + inner + ") AS " + quoteIdent("agg")
+	if havingSQL != "" {
+		q += " WHERE " + havingSQL
+	}
+	if orderSQL != "" {
+		q += " ORDER BY " + orderSQL
+	}
+	return q, append(append([]any{}, filterArgs...), havingArgs...)
+}
+
+// handleAggregate handles GET /collections/{table}/aggregate
+func (h *Handler) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	tbl := h.resolveTable(w, r)
+	if tbl == nil {
+		return
+	}
+
+	q := r.URL.Query()
+
+	groups, err := parseGroup(tbl, q.Get("group"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid group: "+err.Error())
+		return
+	}
+
+	aggParam := q.Get("agg")
+	if aggParam == "" {
+		aggParam = "count()"
+	}
+	aggs, err := parseAggs(tbl, aggParam)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid agg: "+err.Error())
+		return
+	}
+
+	out, err := aggOutputTable(append(append([]aggExpr{}, groups...), aggs...))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var filterSQL string
+	var filterArgs []any
+	if filterStr := q.Get("filter"); filterStr != "" {
+		filterSQL, filterArgs, err = parseFilterExpr(r.Context(), h.schemaFor(r), tbl, filterStr, 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid filter: "+err.Error())
+			return
+		}
+	}
+	filterSQL, filterArgs, err = withRule(h.schemaFor(r), tbl, ruleList, requestVars(r.Context(), nil), filterSQL, filterArgs)
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+
+	var havingSQL string
+	var havingArgs []any
+	if havingStr := q.Get("having"); havingStr != "" {
+		havingSQL, havingArgs, err = parseFilterExpr(r.Context(), nil, out, havingStr, len(filterArgs))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid having: "+err.Error())
+			return
+		}
+	}
+
+	// Sort by output names; default to the group keys.
+	orderSQL := parseSortSQL(out, q.Get("sort"))
+	if orderSQL == "" && len(groups) > 0 {
+		keys := make([]sortField, len(groups))
+		for i, g := range groups {
+			keys[i] = sortField{column: g.alias}
+		}
+		orderSQL = sortSQL(keys)
+	}
+
+	query, args := buildAggregate(tbl, groups, aggs, filterSQL, filterArgs, havingSQL, havingArgs, orderSQL)
+
+	querier, done, err := h.withRLS(r)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	rows, err := querier.Query(r.Context(), query, args...)
+	if err != nil {
+		done(err)
+		if !mapPGError(w, err) {
+			h.logger.Error("aggregate error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	defer rows.Close()
+
+	items, err := scanRows(rows)
+	if err != nil {
+		done(err)
+		h.logger.Error("scan error", "error", err, "table", tbl.Name)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	done(nil)
+	writeJSON(w, http.StatusOK, AggregateResponse{Items: items})
+}
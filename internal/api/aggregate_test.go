@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func aggTestTable() *schema.Table {
+	return &schema.Table{
+		Schema: "public",
+		Name:   "orders",
+		Kind:   "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", JSONType: "integer", IsPrimaryKey: true},
+			{Name: "status", TypeName: "text", JSONType: "string"},
+			{Name: "amount", TypeName: "numeric(10,2)", JSONType: "number"},
+			{Name: "score", TypeName: "integer", JSONType: "integer"},
+			{Name: "created_at", TypeName: "timestamp with time zone", JSONType: "string"},
+			{Name: "meta", TypeName: "jsonb", JSONType: "object", IsJSON: true},
+		},
+		PrimaryKey: []string{"id"},
+	}
+}
+
+func TestSplitTopLevel(t *testing.T) {
+	parts := splitTopLevel(" status, date_trunc(day, created_at) ,,count() ")
+	testutil.SliceLen(t, parts, 3)
+	testutil.Equal(t, parts[0], "status")
+	testutil.Equal(t, parts[1], "date_trunc(day, created_at)")
+	testutil.Equal(t, parts[2], "count()")
+}
+
+func TestParseGroup(t *testing.T) {
+	tbl := aggTestTable()
+
+	exprs, err := parseGroup(tbl, "status,date_trunc(day,created_at)")
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, exprs, 2)
+	testutil.Equal(t, exprs[0].sql, `"status"`)
+	testutil.Equal(t, exprs[0].alias, "status")
+	testutil.Equal(t, exprs[1].sql, `date_trunc('day', "created_at")`)
+	testutil.Equal(t, exprs[1].alias, "created_at_day")
+}
+
+func TestParseGroupErrors(t *testing.T) {
+	tbl := aggTestTable()
+
+	tests := []struct {
+		param   string
+		wantErr string
+	}{
+		{"nope", "unknown column"},
+		{"lower(status)", "unsupported group function"},
+		{"date_trunc(day)", "unit and a column"},
+		{"date_trunc(fortnight,created_at)", "unsupported date_trunc unit"},
+		{"date_trunc(day,status)", "date or timestamp column"},
+		{"date_trunc('day'); DROP TABLE x;--,created_at)", "unknown column"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			_, err := parseGroup(tbl, tt.param)
+			testutil.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestParseAggs(t *testing.T) {
+	tbl := aggTestTable()
+
+	exprs, err := parseAggs(tbl, "count(),sum(amount),AVG(score),max(created_at),count(status)")
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, exprs, 5)
+	testutil.Equal(t, exprs[0].sql, "COUNT(*)")
+	testutil.Equal(t, exprs[0].alias, "count")
+	testutil.Equal(t, exprs[1].sql, `SUM("amount")`)
+	testutil.Equal(t, exprs[1].alias, "sum_amount")
+	testutil.Equal(t, exprs[2].sql, `AVG("score")`)
+	testutil.Equal(t, exprs[2].alias, "avg_score")
+	testutil.Equal(t, exprs[3].alias, "max_created_at")
+	testutil.Equal(t, exprs[4].sql, `COUNT("status")`)
+}
+
+func TestParseAggsErrors(t *testing.T) {
+	tbl := aggTestTable()
+
+	tests := []struct {
+		param   string
+		wantErr string
+	}{
+		{"amount", "invalid aggregate"},
+		{"median(amount)", "unsupported aggregate function"},
+		{"sum()", "requires a column"},
+		{"sum(nope)", "unknown column"},
+		{"sum(status)", "numeric column"},
+		{"max(meta)", "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			_, err := parseAggs(tbl, tt.param)
+			testutil.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestBuildAggregate(t *testing.T) {
+	tbl := aggTestTable()
+	groups, _ := parseGroup(tbl, "status")
+	aggs, _ := parseAggs(tbl, "count(),sum(amount)")
+	out, err := aggOutputTable(append(groups, aggs...))
+	testutil.NoError(t, err)
+
+	havingSQL, havingArgs, err := parseFilterExpr(context.Background(), nil, out, "count > 5", 1)
+	testutil.NoError(t, err)
+
+	q, args := buildAggregate(tbl, groups, aggs, `"score" > $1`, []any{int64(3)}, havingSQL, havingArgs, `"count" DESC`)
+	testutil.Equal(t, q, `SELECT * FROM (SELECT "status" AS "status", COUNT(*) AS "count", SUM("amount") AS "sum_amount" `+
+		`FROM "public"."orders" WHERE "score" > $1 GROUP BY 1) AS "agg" WHERE "count" > $2 ORDER BY "count" DESC`)
+	testutil.SliceLen(t, args, 2)
+	testutil.Equal(t, args[1].(int64), int64(5))
+}
+
+func TestBuildAggregateWithoutGroups(t *testing.T) {
+	tbl := aggTestTable()
+	aggs, _ := parseAggs(tbl, "count()")
+
+	q, args := buildAggregate(tbl, nil, aggs, "", nil, "", nil, "")
+	testutil.Equal(t, q, `SELECT * FROM (SELECT COUNT(*) AS "count" FROM "public"."orders") AS "agg"`)
+	testutil.SliceLen(t, args, 0)
+}
+
+func TestAggOutputTableDuplicate(t *testing.T) {
+	_, err := aggOutputTable([]aggExpr{{alias: "count"}, {alias: "count"}})
+	testutil.ErrorContains(t, err, "duplicate output column")
+}
+
+func TestAggregateHandlerErrors(t *testing.T) {
+	h := testHandler(testSchema())
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		msg    string
+	}{
+		{"unknown table", "/collections/nope/aggregate", http.StatusNotFound, "collection not found"},
+		{"bad group", "/collections/users/aggregate?group=bogus", http.StatusBadRequest, "invalid group"},
+		{"bad agg", "/collections/users/aggregate?agg=sum(email)", http.StatusBadRequest, "invalid agg"},
+		{"bad filter", "/collections/users/aggregate?filter=((", http.StatusBadRequest, "invalid filter"},
+		{"bad having", "/collections/users/aggregate?group=email&having=email_count>1", http.StatusBadRequest, "invalid having"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(h, "GET", tt.path, "")
+			testutil.Equal(t, tt.status, w.Code)
+			testutil.Contains(t, decodeError(t, w).Message, tt.msg)
+		})
+	}
+}
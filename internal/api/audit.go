@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/jackc/pgx/v5"
+)
+
+// AuditEntry is one recorded change to a row of an audited table. Old is nil
+// for creates and New is nil for hard deletes.
+type AuditEntry struct {
+	ID        int64          `json:"id"`
+	Schema    string         `json:"schema"`
+	Table     string         `json:"table"`
+	RecordID  string         `json:"recordId,omitempty"`
+	Action    string         `json:"action"`
+	Old       map[string]any `json:"old"`
+	New       map[string]any `json:"new"`
+	UserID    string         `json:"userId,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// auditFilter selects entries of the audit log. Empty fields match anything.
+type auditFilter struct {
+	schema   string
+	table    string
+	recordID string
+	userID   string
+	action   string
+	since    time.Time
+	until    time.Time
+}
+
+// buildAuditQueries builds the statements that count and fetch a page of the
+// entries matching f, newest first.
+func buildAuditQueries(f auditFilter, page, perPage int) (countQuery, dataQuery string, args []any) {
+	var conds []string
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.schema != "" {
+		add("table_schema = $%d", f.schema)
+	}
+	if f.table != "" {
+		add("table_name = $%d", f.table)
+	}
+	if f.recordID != "" {
+		add("record_id = $%d", f.recordID)
+	}
+	if f.userID != "" {
+		add("user_id = $%d", f.userID)
+	}
+	if f.action != "" {
+		add("action = $%d", f.action)
+	}
+	if !f.since.IsZero() {
+		add("created_at >= $%d", f.since)
+	}
+	if !f.until.IsZero() {
+		add("created_at < $%d", f.until)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	countQuery = "SELECT count(*) FROM _ayb_audit" + where
+	dataQuery = fmt.Sprintf(`SELECT id, table_schema, table_name, record_id, action, old_data, new_data, user_id, created_at
+		FROM _ayb_audit%s ORDER BY id DESC LIMIT %d OFFSET %d`, where, perPage, (page-1)*perPage)
+	return countQuery, dataQuery, args
+}
+
+// queryAudit returns a page of the audit log. It reads _ayb_audit as the
+// server, since API roles have no access to it.
+func (h *Handler) queryAudit(ctx context.Context, f auditFilter, page, perPage int) (*AuditResponse, error) {
+	countQuery, dataQuery, args := buildAuditQueries(f, page, perPage)
+
+	resp := &AuditResponse{Page: page, PerPage: perPage, Items: []AuditEntry{}}
+	if err := h.pool.QueryRow(ctx, countQuery, args...).Scan(&resp.TotalItems); err != nil {
+		return nil, err
+	}
+	resp.TotalPages = int(math.Ceil(float64(resp.TotalItems) / float64(perPage)))
+
+	rows, err := h.pool.Query(ctx, dataQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AuditEntry
+		var recordID, userID *string
+		if err := rows.Scan(&e.ID, &e.Schema, &e.Table, &recordID, &e.Action, &e.Old, &e.New, &userID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if recordID != nil {
+			e.RecordID = *recordID
+		}
+		if userID != nil {
+			e.UserID = *userID
+		}
+		resp.Items = append(resp.Items, e)
+	}
+	return resp, rows.Err()
+}
+
+// handleHistory handles GET /collections/{table}/{id}/history, which lists the
+// recorded changes to a record, newest first. Callers who may view the record
+// see its history without the columns hidden from them; admins see the
+// history of any record, including deleted ones.
+func (h *Handler) handleHistory(w http.ResponseWriter, r *http.Request) {
+	tbl := h.resolveTable(w, r)
+	if tbl == nil {
+		return
+	}
+	if !tbl.Audited {
+		writeError(w, http.StatusBadRequest, "audit is not enabled for "+tbl.Name)
+		return
+	}
+	if !requirePK(w, tbl) {
+		return
+	}
+
+	pkValues := extractPK(w, r, tbl)
+	if pkValues == nil {
+		return
+	}
+
+	admin := h.isAdmin != nil && h.isAdmin(r)
+	if !admin {
+		ok, err := h.recordVisible(r, tbl, pkValues)
+		if err != nil {
+			h.writeRuleError(w, tbl, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, "record not found")
+			return
+		}
+	}
+
+	page, perPage := parsePagination(r.URL.Query())
+	f := auditFilter{schema: tbl.Schema, table: tbl.Name, recordID: strings.Join(pkValues, ",")}
+	resp, err := h.queryAudit(r.Context(), f, page, perPage)
+	if err != nil {
+		h.logger.Error("history error", "error", err, "table", tbl.Name)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !admin && tbl.HasHiddenColumns() {
+		for i := range resp.Items {
+			resp.Items[i].Old = visibleColumns(tbl, resp.Items[i].Old)
+			resp.Items[i].New = visibleColumns(tbl, resp.Items[i].New)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// recordVisible reports whether the request may view the record with the
+// given primary key, under RLS and the view rule.
+func (h *Handler) recordVisible(r *http.Request, tbl *schema.Table, pkValues []string) (bool, error) {
+	where, args := buildPKWhere(tbl, pkValues)
+	ruleSQL, ruleArgs, err := ruleFilter(h.schemaFor(r), tbl, ruleView, requestVars(r.Context(), nil), len(args))
+	if err != nil {
+		return false, err
+	}
+	query := "SELECT 1 FROM " + tableRef(tbl) + " WHERE " + where
+	if ruleSQL != "" {
+		query += " AND (" + ruleSQL + ")"
+		args = append(args, ruleArgs...)
+	}
+
+	q, done, err := h.withRLS(r)
+	if err != nil {
+		return false, err
+	}
+	var one int
+	err = q.QueryRow(r.Context(), query, args...).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		done(nil)
+		return false, nil
+	}
+	done(err)
+	return err == nil, err
+}
+
+// visibleColumns returns a copy of a recorded row without the columns that
+// are not in tbl.
+func visibleColumns(tbl *schema.Table, row map[string]any) map[string]any {
+	if row == nil {
+		return nil
+	}
+	visible := make(map[string]any, len(row))
+	for k, v := range row {
+		if tbl.ColumnByName(k) != nil {
+			visible[k] = v
+		}
+	}
+	return visible
+}
+
+// HandleAudit serves GET /api/admin/audit, the audit log of every audited
+// table, newest first. The table, recordId, userId and action query
+// parameters filter it, as do since and until, which take RFC 3339
+// timestamps. The caller must only route admin requests here.
+func (h *Handler) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := auditFilter{recordID: q.Get("recordId"), userID: q.Get("userId"), action: q.Get("action")}
+	if t := q.Get("table"); t != "" {
+		if schemaName, name, ok := strings.Cut(t, "."); ok {
+			f.schema, f.table = schemaName, name
+		} else {
+			f.table = t
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.since}, {"until", &f.until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+p.name+": must be an RFC 3339 timestamp")
+			return
+		}
+		*p.dst = t
+	}
+
+	page, perPage := parsePagination(q)
+	resp, err := h.queryAudit(r.Context(), f, page, perPage)
+	if err != nil {
+		h.logger.Error("audit query error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestBuildAuditQueries(t *testing.T) {
+	count, data, args := buildAuditQueries(auditFilter{}, 1, 20)
+	testutil.Equal(t, count, "SELECT count(*) FROM _ayb_audit")
+	testutil.Contains(t, data, "FROM _ayb_audit ORDER BY id DESC LIMIT 20 OFFSET 0")
+	testutil.SliceLen(t, args, 0)
+
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := auditFilter{schema: "public", table: "posts", recordID: "5", userID: "u1", action: "update", since: since}
+	count, data, args = buildAuditQueries(f, 3, 10)
+	where := " WHERE table_schema = $1 AND table_name = $2 AND record_id = $3 AND user_id = $4 AND action = $5 AND created_at >= $6"
+	testutil.Equal(t, count, "SELECT count(*) FROM _ayb_audit"+where)
+	testutil.Contains(t, data, "FROM _ayb_audit"+where+" ORDER BY id DESC LIMIT 10 OFFSET 20")
+	testutil.SliceLen(t, args, 6)
+	testutil.Equal(t, args[5], any(since))
+}
+
+func TestVisibleColumns(t *testing.T) {
+	tbl := &schema.Table{Columns: []*schema.Column{{Name: "id"}, {Name: "title"}}}
+	row := visibleColumns(tbl, map[string]any{"id": 1, "title": "Hi", "secret": "x"})
+	testutil.MapLen(t, row, 2)
+	testutil.Equal(t, row["title"], any("Hi"))
+	testutil.True(t, visibleColumns(tbl, nil) == nil, "nil rows stay nil")
+}
+
+func TestHistoryNotAudited(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "GET", "/collections/users/123/history", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "audit is not enabled")
+}
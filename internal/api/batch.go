@@ -0,0 +1,418 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/httputil"
+	"github.com/allyourbase/ayb/internal/realtime"
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxBatchOperations caps the number of operations in a single batch request.
+const maxBatchOperations = 100
+
+// BatchRequest is the body of POST /batch.
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is a single step of a batch request.
+//
+// String values in Body and ID of the form "${N.field}" are replaced with the
+// value of field from the result of operation N (zero-based), which must come
+// earlier in the batch. "${N}" references the whole result.
+type BatchOperation struct {
+	Method   string         `json:"method"` // create, update, delete, rpc
+	Table    string         `json:"table,omitempty"`
+	ID       any            `json:"id,omitempty"`
+	Function string         `json:"function,omitempty"`
+	Body     map[string]any `json:"body,omitempty"`
+}
+
+// BatchResult is the outcome of a single batch operation.
+type BatchResult struct {
+	Status int `json:"status"`
+	Body   any `json:"body,omitempty"`
+}
+
+// BatchResponse is the envelope returned by POST /batch.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// batchError is a client error tied to a specific operation in the batch.
+type batchError struct {
+	index   int
+	status  int
+	message string
+	fields  fieldErrors // per-field detail, for validation errors
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.index, e.message)
+}
+
+// batchRefPattern matches a whole-value reference to an earlier result.
+var batchRefPattern = regexp.MustCompile(`^\$\{(\d+)(?:\.([^}]+))?\}$`)
+
+// handleBatch handles POST /batch. All operations run in a single transaction
+// under the caller's RLS context; either all of them commit or none do.
+// Realtime events are published only after a successful commit.
+func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	sc := h.schemaFor(r)
+	if sc == nil {
+		writeError(w, http.StatusServiceUnavailable, "schema cache not ready")
+		return
+	}
+
+	var req BatchRequest
+	r.Body = http.MaxBytesReader(w, r.Body, httputil.MaxBodySize)
+	if err := decodeJSONNumbers(r.Body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.Operations) == 0 {
+		writeError(w, http.StatusBadRequest, "no operations in batch")
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		writeError(w, http.StatusBadRequest, "too many operations in batch: max "+strconv.Itoa(maxBatchOperations))
+		return
+	}
+
+	// Validate everything that doesn't need the database before opening a tx.
+	for i := range req.Operations {
+		if err := validateBatchOp(sc, &req.Operations[i], i); err != nil {
+			writeBatchError(w, err)
+			return
+		}
+	}
+
+	tx, err := h.beginTx(r)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	defer tx.Rollback(r.Context()) // no-op after commit
+
+	results := make([]BatchResult, 0, len(req.Operations))
+	var events []*realtime.Event
+	strict := strictBody(r)
+	for i := range req.Operations {
+		result, event, err := runBatchOp(r.Context(), tx, sc, &req.Operations[i], i, results, strict)
+		if err != nil {
+			var be *batchError
+			if errors.As(err, &be) {
+				writeBatchError(w, be)
+				return
+			}
+			if status, resp, ok := pgErrorResponse(err); ok {
+				resp.Message = fmt.Sprintf("operation %d: %s", i, resp.Message)
+				writeJSON(w, status, resp)
+				return
+			}
+			h.logger.Error("batch error", "error", err, "operation", i)
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		results = append(results, result)
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		if !mapPGError(w, err) {
+			h.logger.Error("batch commit error", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, BatchResponse{Results: results})
+	for _, e := range events {
+		h.publishEvent(e.Action, e.Table, e.Record)
+	}
+}
+
+func writeBatchError(w http.ResponseWriter, err error) {
+	var be *batchError
+	if errors.As(err, &be) {
+		writeJSON(w, be.status, httputil.ErrorResponse{Code: be.status, Message: be.Error(), Data: be.fields})
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// validateBatchOp checks an operation's method and target without touching the database.
+func validateBatchOp(sc *schema.SchemaCache, op *BatchOperation, index int) error {
+	fail := func(status int, msg string) error {
+		return &batchError{index: index, status: status, message: msg}
+	}
+
+	switch op.Method {
+	case "rpc":
+		if sc.FunctionByName(op.Function) == nil {
+			return fail(http.StatusNotFound, "function not found: "+op.Function)
+		}
+		return nil
+	case "create", "update", "delete":
+	default:
+		return fail(http.StatusBadRequest, "unsupported method: "+op.Method)
+	}
+
+	tbl := sc.TableByName(op.Table)
+	if tbl == nil {
+		return fail(http.StatusNotFound, "collection not found: "+op.Table)
+	}
+	if tbl.Kind != "table" && tbl.Kind != "partitioned_table" {
+		return fail(http.StatusMethodNotAllowed, "write operations not allowed on "+tbl.Kind)
+	}
+
+	if op.Method != "delete" {
+		if len(op.Body) == 0 {
+			return fail(http.StatusBadRequest, "empty request body")
+		}
+		if countKnownColumns(tbl, op.Body) == 0 {
+			return fail(http.StatusBadRequest, "no recognized columns in request body")
+		}
+		if countWritableColumns(tbl, op.Body, op.Method == "create") == 0 {
+			return fail(http.StatusBadRequest, "no writable columns in request body")
+		}
+	}
+	if op.Method != "create" {
+		if len(tbl.PrimaryKey) == 0 {
+			return fail(http.StatusBadRequest, "table has no primary key")
+		}
+		if op.ID == nil {
+			return fail(http.StatusBadRequest, "id is required for "+op.Method)
+		}
+	}
+	return nil
+}
+
+// runBatchOp executes a single validated operation inside the batch transaction.
+// prior holds the results of the operations that ran before it. Bodies are
+// checked against the table once their references are resolved; strict is as
+// for validateBody.
+func runBatchOp(ctx context.Context, tx pgx.Tx, sc *schema.SchemaCache, op *BatchOperation, index int, prior []BatchResult, strict bool) (BatchResult, *realtime.Event, error) {
+	body, err := resolveBatchRefs(op.Body, prior)
+	if err != nil {
+		return BatchResult{}, nil, &batchError{index: index, status: http.StatusBadRequest, message: err.Error()}
+	}
+	data, _ := body.(map[string]any)
+
+	if op.Method == "rpc" {
+		return runBatchRPC(ctx, tx, sc.FunctionByName(op.Function), data, index)
+	}
+
+	tbl := sc.TableByName(op.Table)
+	if op.Method != "delete" {
+		errs := fieldErrors{}
+		validateBody(errs, "", tbl, data, op.Method == "create", strict)
+		if len(errs) > 0 {
+			return BatchResult{}, nil, &batchError{index: index, status: http.StatusBadRequest, message: "validation failed", fields: errs}
+		}
+	}
+
+	var pkValues []string
+	if op.Method != "create" {
+		id, err := resolveBatchRefs(op.ID, prior)
+		if err != nil {
+			return BatchResult{}, nil, &batchError{index: index, status: http.StatusBadRequest, message: err.Error()}
+		}
+		pkValues = parsePKValues(formatPKValue(id), len(tbl.PrimaryKey))
+		if len(pkValues) != len(tbl.PrimaryKey) {
+			return BatchResult{}, nil, &batchError{index: index, status: http.StatusBadRequest,
+				message: "invalid primary key: expected " + strconv.Itoa(len(tbl.PrimaryKey)) + " values"}
+		}
+	}
+
+	notFound := &batchError{index: index, status: http.StatusNotFound, message: "record not found"}
+
+	// Records that the update or delete rule does not match are not found, as
+	// for single requests.
+	if op.Method != "create" {
+		ok, err := matchesRule(ctx, tx, sc, tbl, op.Method, requestVars(ctx, data), pkValues)
+		if err != nil {
+			return BatchResult{}, nil, err
+		}
+		if !ok {
+			return BatchResult{}, nil, notFound
+		}
+	}
+
+	switch op.Method {
+	case "create":
+		query, args := buildInsert(tbl, data)
+		record, err := queryOne(ctx, tx, query, args)
+		if err != nil {
+			return BatchResult{}, nil, err
+		}
+		if err := checkCreated(ctx, tx, sc, tbl, []map[string]any{record}, []map[string]any{data}); err != nil {
+			if errors.Is(err, errCreateDenied) {
+				return BatchResult{}, nil, &batchError{index: index, status: http.StatusForbidden, message: err.Error()}
+			}
+			return BatchResult{}, nil, err
+		}
+		return BatchResult{Status: http.StatusCreated, Body: record},
+			&realtime.Event{Action: "create", Table: sc.CollectionName(tbl), Record: record}, nil
+
+	case "update":
+		query, args := buildUpdate(tbl, data, pkValues, nil)
+		record, err := queryOne(ctx, tx, query, args)
+		if err != nil {
+			return BatchResult{}, nil, err
+		}
+		if record == nil {
+			return BatchResult{}, nil, notFound
+		}
+		delete(record, etagColumn)
+		return BatchResult{Status: http.StatusOK, Body: record},
+			&realtime.Event{Action: "update", Table: sc.CollectionName(tbl), Record: record}, nil
+
+	default: // delete
+		query, args := buildDelete(tbl, pkValues, nil)
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return BatchResult{}, nil, err
+		}
+		if tag.RowsAffected() == 0 {
+			return BatchResult{}, nil, notFound
+		}
+		record := make(map[string]any, len(tbl.PrimaryKey))
+		for i, pk := range tbl.PrimaryKey {
+			record[pk] = pkValues[i]
+		}
+		return BatchResult{Status: http.StatusNoContent},
+			&realtime.Event{Action: "delete", Table: sc.CollectionName(tbl), Record: record}, nil
+	}
+}
+
+// runBatchRPC calls a function inside the batch transaction.
+func runBatchRPC(ctx context.Context, tx pgx.Tx, fn *schema.Function, args map[string]any, index int) (BatchResult, *realtime.Event, error) {
+	query, queryArgs, err := buildRPCCall(fn, args)
+	if err != nil {
+		return BatchResult{}, nil, &batchError{index: index, status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	if fn.IsVoid {
+		if _, err := tx.Exec(ctx, query, queryArgs...); err != nil {
+			return BatchResult{}, nil, err
+		}
+		return BatchResult{Status: http.StatusNoContent}, nil, nil
+	}
+
+	rows, err := tx.Query(ctx, query, queryArgs...)
+	if err != nil {
+		return BatchResult{}, nil, err
+	}
+	defer rows.Close()
+
+	if fn.ReturnsSet {
+		items, err := scanRows(rows)
+		if err != nil {
+			return BatchResult{}, nil, err
+		}
+		return BatchResult{Status: http.StatusOK, Body: items}, nil, nil
+	}
+
+	record, err := scanRow(rows)
+	if err != nil {
+		return BatchResult{}, nil, err
+	}
+	return BatchResult{Status: http.StatusOK, Body: unwrapRPCResult(record)}, nil, nil
+}
+
+// queryOne runs a query and scans at most one row. Returns nil if no row matched.
+func queryOne(ctx context.Context, q Querier, query string, args []any) (map[string]any, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRow(rows)
+}
+
+// resolveBatchRefs returns a copy of v with every "${N.field}" string replaced by
+// the referenced value from prior results. Maps and slices are walked recursively.
+func resolveBatchRefs(v any, prior []BatchResult) (any, error) {
+	switch val := v.(type) {
+	case string:
+		m := batchRefPattern.FindStringSubmatch(val)
+		if m == nil {
+			return val, nil
+		}
+		idx, _ := strconv.Atoi(m[1])
+		if idx >= len(prior) {
+			return nil, fmt.Errorf("reference %s points to an operation that has not run yet", val)
+		}
+		target := prior[idx].Body
+		if m[2] == "" {
+			return target, nil
+		}
+		rec, ok := target.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("reference %s: result of operation %d is not a record", val, idx)
+		}
+		field, ok := rec[m[2]]
+		if !ok {
+			return nil, fmt.Errorf("reference %s: field %q not found", val, m[2])
+		}
+		return field, nil
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			resolved, err := resolveBatchRefs(item, prior)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			resolved, err := resolveBatchRefs(item, prior)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// formatPKValue renders a primary key value (from JSON or a scanned row) in the
+// same form accepted in the URL id segment.
+func formatPKValue(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case json.Number:
+		return val.String()
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", val[0:4], val[4:6], val[6:8], val[8:10], val[10:16])
+	case []any:
+		parts := make([]string, len(val))
+		for i, p := range val {
+			parts[i] = formatPKValue(p)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(val)
+	}
+}
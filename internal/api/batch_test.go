@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestBatchSchemaCacheNotReady(t *testing.T) {
+	h := testHandler(nil)
+	w := doRequest(h, "POST", "/batch", `{"operations":[]}`)
+	testutil.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestBatchInvalidJSON(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/batch", `{broken`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "invalid JSON body")
+}
+
+func TestBatchNoOperations(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/batch", `{"operations":[]}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "no operations")
+}
+
+func TestBatchTooManyOperations(t *testing.T) {
+	h := testHandler(testSchema())
+	ops := make([]string, maxBatchOperations+1)
+	for i := range ops {
+		ops[i] = `{"method":"create","table":"users","body":{"email":"a"}}`
+	}
+	w := doRequest(h, "POST", "/batch", `{"operations":[`+strings.Join(ops, ",")+`]}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "too many operations")
+}
+
+func TestBatchValidationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      string
+		status  int
+		message string
+	}{
+		{"unknown method", `{"method":"upsert","table":"users"}`, http.StatusBadRequest, "unsupported method"},
+		{"unknown table", `{"method":"create","table":"nope","body":{"a":1}}`, http.StatusNotFound, "collection not found"},
+		{"view", `{"method":"create","table":"logs","body":{"message":"x"}}`, http.StatusMethodNotAllowed, "write operations not allowed"},
+		{"empty body", `{"method":"create","table":"users"}`, http.StatusBadRequest, "empty request body"},
+		{"unknown columns", `{"method":"create","table":"users","body":{"bogus":1}}`, http.StatusBadRequest, "no recognized columns"},
+		{"no pk", `{"method":"delete","table":"nopk","id":"1"}`, http.StatusBadRequest, "no primary key"},
+		{"missing id", `{"method":"update","table":"users","body":{"name":"x"}}`, http.StatusBadRequest, "id is required"},
+		{"unknown function", `{"method":"rpc","function":"nope"}`, http.StatusNotFound, "function not found"},
+	}
+
+	h := testHandler(testSchema())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"operations":[{"method":"create","table":"users","body":{"email":"a"}},` + tt.op + `]}`
+			w := doRequest(h, "POST", "/batch", body)
+			testutil.Equal(t, tt.status, w.Code)
+			resp := decodeError(t, w)
+			testutil.Contains(t, resp.Message, "operation 1")
+			testutil.Contains(t, resp.Message, tt.message)
+		})
+	}
+}
+
+func TestResolveBatchRefs(t *testing.T) {
+	prior := []BatchResult{
+		{Status: 201, Body: map[string]any{"id": int64(7), "name": "order"}},
+		{Status: 200, Body: int64(42)},
+	}
+
+	got, err := resolveBatchRefs(map[string]any{
+		"order_id": "${0.id}",
+		"total":    "${1}",
+		"note":     "literal ${0.id} text",
+		"nested":   []any{"${0.name}", 3.0},
+	}, prior)
+	testutil.NoError(t, err)
+
+	m := got.(map[string]any)
+	testutil.Equal(t, m["order_id"].(int64), int64(7))
+	testutil.Equal(t, m["total"].(int64), int64(42))
+	testutil.Equal(t, m["note"].(string), "literal ${0.id} text")
+	testutil.Equal(t, m["nested"].([]any)[0].(string), "order")
+}
+
+func TestResolveBatchRefsErrors(t *testing.T) {
+	prior := []BatchResult{
+		{Status: 201, Body: map[string]any{"id": int64(7)}},
+		{Status: 200, Body: int64(42)},
+	}
+
+	_, err := resolveBatchRefs("${2.id}", prior)
+	testutil.ErrorContains(t, err, "has not run yet")
+
+	_, err = resolveBatchRefs("${0.missing}", prior)
+	testutil.ErrorContains(t, err, "not found")
+
+	_, err = resolveBatchRefs("${1.id}", prior)
+	testutil.ErrorContains(t, err, "not a record")
+}
+
+func TestFormatPKValue(t *testing.T) {
+	testutil.Equal(t, formatPKValue("abc"), "abc")
+	testutil.Equal(t, formatPKValue(float64(12)), "12")
+	testutil.Equal(t, formatPKValue(int64(5)), "5")
+	testutil.Equal(t, formatPKValue([]any{float64(1), "x"}), "1,x")
+
+	uuid := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	testutil.Equal(t, formatPKValue(uuid), "12345678-9abc-def0-1234-56789abcdef0")
+}
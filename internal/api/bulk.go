@@ -0,0 +1,289 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/allyourbase/ayb/internal/httputil"
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+const (
+	// maxBulkRows caps the number of rows in a single bulk insert.
+	maxBulkRows = 1000
+	// maxQueryParams is PostgreSQL's limit on bind parameters per statement.
+	maxQueryParams = 65535
+)
+
+// decodeCreateBody reads the body of a create request, which may be a single
+// JSON object or an array of objects (bulk insert). Exactly one of data or rows
+// is non-nil on success. Field errors in bulk inserts are keyed by the row's
+// index and the field, as in "2.email". On failure, writes an error response
+// and returns false.
+func decodeCreateBody(w http.ResponseWriter, r *http.Request, tbl *schema.Table) (data map[string]any, rows []map[string]any, ok bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, httputil.MaxBodySize)
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return nil, nil, false
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		if err := decodeJSONNumbers(bytes.NewReader(raw), &data); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return nil, nil, false
+		}
+		if len(data) == 0 {
+			writeError(w, http.StatusBadRequest, "empty request body")
+			return nil, nil, false
+		}
+		if countKnownColumns(tbl, data) == 0 {
+			writeError(w, http.StatusBadRequest, "no recognized columns in request body")
+			return nil, nil, false
+		}
+		if countWritableColumns(tbl, data, true) == 0 {
+			writeError(w, http.StatusBadRequest, "no writable columns in request body")
+			return nil, nil, false
+		}
+		errs := fieldErrors{}
+		validateBody(errs, "", tbl, data, true, strictBody(r))
+		if len(errs) > 0 {
+			writeValidationError(w, errs)
+			return nil, nil, false
+		}
+		return data, nil, true
+	}
+
+	if err := decodeJSONNumbers(bytes.NewReader(raw), &rows); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: expected an object or an array of objects")
+		return nil, nil, false
+	}
+	if len(rows) == 0 {
+		writeError(w, http.StatusBadRequest, "empty request body")
+		return nil, nil, false
+	}
+	if len(rows) > maxBulkRows {
+		writeError(w, http.StatusBadRequest, "too many rows: max "+strconv.Itoa(maxBulkRows))
+		return nil, nil, false
+	}
+	params := 0
+	errs := fieldErrors{}
+	strict := strictBody(r)
+	for i, row := range rows {
+		known := countKnownColumns(tbl, row)
+		if known == 0 {
+			writeError(w, http.StatusBadRequest, "row "+strconv.Itoa(i)+": no recognized columns")
+			return nil, nil, false
+		}
+		if countWritableColumns(tbl, row, true) == 0 {
+			writeError(w, http.StatusBadRequest, "row "+strconv.Itoa(i)+": no writable columns")
+			return nil, nil, false
+		}
+		validateBody(errs, strconv.Itoa(i)+".", tbl, row, true, strict)
+		params += known
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return nil, nil, false
+	}
+	if params > maxQueryParams {
+		writeError(w, http.StatusBadRequest, "too many values in bulk insert: max "+strconv.Itoa(maxQueryParams))
+		return nil, nil, false
+	}
+	return nil, rows, true
+}
+
+// createMany inserts every row for POST /collections/{table} with an array body.
+func (h *Handler) createMany(w http.ResponseWriter, r *http.Request, tbl *schema.Table, rows []map[string]any) {
+	q, done, err := h.withRLSFor(r, tbl, ruleCreate)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	items, err := insertRows(r.Context(), q, h.schemaFor(r), tbl, rows)
+	done(err)
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, BulkResponse{Count: len(items), Items: items})
+	h.publishEvents("create", tbl, items)
+}
+
+// insertRows inserts rows and checks the created records against tbl's create
+// rule. Without a rule they are inserted in a single statement. With one, each
+// row is inserted by its own statement and checked with its own body, as
+// INSERT ... RETURNING does not promise to return rows in the order given.
+func insertRows(ctx context.Context, q Querier, sc *schema.SchemaCache, tbl *schema.Table, rows []map[string]any) ([]map[string]any, error) {
+	batches := [][]map[string]any{rows}
+	if tableRule(tbl, ruleCreate) != "" {
+		batches = make([][]map[string]any, len(rows))
+		for i := range rows {
+			batches[i] = rows[i : i+1]
+		}
+	}
+
+	var items []map[string]any
+	for _, batch := range batches {
+		query, args := buildBulkInsert(tbl, batch)
+		res, err := q.Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		created, err := scanRows(res)
+		res.Close()
+		if err == nil {
+			err = checkCreated(ctx, q, sc, tbl, created, batch)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, created...)
+	}
+	return items, nil
+}
+
+// handleBulkUpdate handles PATCH /collections/{table}?filter=...
+func (h *Handler) handleBulkUpdate(w http.ResponseWriter, r *http.Request) {
+	tbl := h.resolveTable(w, r)
+	if tbl == nil {
+		return
+	}
+	if !requireWritable(w, tbl) {
+		return
+	}
+
+	filterSQL, filterArgs, ok := h.parseRequiredFilter(w, r, tbl)
+	if !ok {
+		return
+	}
+
+	data, ok := decodeAndValidateBody(w, r, tbl)
+	if !ok {
+		return
+	}
+
+	filterSQL, filterArgs, err := withRule(h.schemaFor(r), tbl, ruleUpdate, requestVars(r.Context(), data), filterSQL, filterArgs)
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+	query, args := buildBulkUpdate(tbl, data, filterSQL, filterArgs)
+
+	q, done, err := h.withRLS(r)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	items, ok := h.queryBulk(w, r, q, done, tbl, query, args, nil, "bulk update error")
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, BulkResponse{Count: len(items), Items: items})
+	h.publishEvents("update", tbl, items)
+}
+
+// handleBulkDelete handles DELETE /collections/{table}?filter=...
+func (h *Handler) handleBulkDelete(w http.ResponseWriter, r *http.Request) {
+	tbl := h.resolveTable(w, r)
+	if tbl == nil {
+		return
+	}
+	if !requireWritable(w, tbl) {
+		return
+	}
+
+	filterSQL, filterArgs, ok := h.parseRequiredFilter(w, r, tbl)
+	if !ok {
+		return
+	}
+
+	filterSQL, filterArgs, err := withRule(h.schemaFor(r), tbl, ruleDelete, requestVars(r.Context(), nil), filterSQL, filterArgs)
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+	query, args := buildBulkDelete(tbl, filterSQL, filterArgs)
+
+	q, done, err := h.withRLS(r)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	items, ok := h.queryBulk(w, r, q, done, tbl, query, args, nil, "bulk delete error")
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, BulkResponse{Count: len(items)})
+	h.publishEvents("delete", tbl, items)
+}
+
+// queryBulk runs a bulk statement and scans every returned row. If check is
+// set, it is called with the rows before committing, to apply access rules.
+// On failure it finishes the transaction, writes an error response, and
+// returns false. On success the transaction is committed.
+func (h *Handler) queryBulk(w http.ResponseWriter, r *http.Request, q Querier, done func(error), tbl *schema.Table, query string, args []any, check func([]map[string]any) error, logMsg string) ([]map[string]any, bool) {
+	rows, err := q.Query(r.Context(), query, args...)
+	if err != nil {
+		done(err)
+		if !mapPGError(w, err) {
+			h.logger.Error(logMsg, "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return nil, false
+	}
+	defer rows.Close()
+
+	items, err := scanRows(rows)
+	if err != nil {
+		done(err)
+		if !mapPGError(w, err) {
+			h.logger.Error("scan error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return nil, false
+	}
+	if check != nil {
+		rows.Close()
+		if err := check(items); err != nil {
+			done(err)
+			h.writeRuleError(w, tbl, err)
+			return nil, false
+		}
+	}
+
+	done(nil)
+	return items, true
+}
+
+// parseRequiredFilter parses the filter query parameter for bulk update and delete.
+// A filter is mandatory so a missing parameter can't touch every row in the table.
+func (h *Handler) parseRequiredFilter(w http.ResponseWriter, r *http.Request, tbl *schema.Table) (string, []any, bool) {
+	filterStr := r.URL.Query().Get("filter")
+	if filterStr == "" {
+		writeError(w, http.StatusBadRequest, "filter parameter is required for bulk operations")
+		return "", nil, false
+	}
+	filterSQL, filterArgs, err := parseFilterExpr(r.Context(), h.schemaFor(r), tbl, filterStr, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid filter: "+err.Error())
+		return "", nil, false
+	}
+	if filterSQL == "" {
+		writeError(w, http.StatusBadRequest, "filter parameter is required for bulk operations")
+		return "", nil, false
+	}
+	return filterSQL, filterArgs, true
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestBulkCreateEmptyArray(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/collections/users", `[]`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "empty request body")
+}
+
+func TestBulkCreateRowWithoutKnownColumns(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/collections/users", `[{"email":"a"},{"bogus":1}]`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "row 1: no recognized columns")
+}
+
+func TestBulkCreateInvalidElements(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/collections/users", `[1, 2]`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "invalid JSON body")
+}
+
+func TestBulkCreateTooManyRows(t *testing.T) {
+	h := testHandler(testSchema())
+	rows := make([]string, maxBulkRows+1)
+	for i := range rows {
+		rows[i] = `{"email":"a"}`
+	}
+	w := doRequest(h, "POST", "/collections/users", "["+strings.Join(rows, ",")+"]")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "too many rows")
+}
+
+func TestBulkCreateOnViewNotAllowed(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/collections/logs", `[{"message":"a"}]`)
+	testutil.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestBulkUpdateRequiresFilter(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "PATCH", "/collections/users", `{"name":"x"}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "filter parameter is required")
+}
+
+func TestBulkUpdateInvalidFilter(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "PATCH", "/collections/users?filter=((broken", `{"name":"x"}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "invalid filter")
+}
+
+func TestBulkUpdateEmptyBody(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "PATCH", "/collections/users?filter=name%3D'x'", `{}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "empty request body")
+}
+
+func TestBulkDeleteRequiresFilter(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "DELETE", "/collections/users", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "filter parameter is required")
+}
+
+func TestBulkDeleteOnViewNotAllowed(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "DELETE", "/collections/logs?filter=id%3D1", "")
+	testutil.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Records have one JSON form, whether Postgres renders them (see
+// recordSelect) or they are scanned into maps: each column is selected
+// through outputSQL, which converts the types pgx would decode into something
+// else than their JSON into a value that scans and encodes to it. Request
+// bodies are read back with inputArg, so that what a record reads as can be
+// written again:
+//
+//   - bigint and numeric are numbers with every digit, and money is a number
+//     without currency symbol. With NumericStrings (see schema.Exposure) all
+//     three are strings, as their JSONType says.
+//   - real and double precision are numbers, or "NaN", "Infinity" and
+//     "-Infinity", as in Postgres's to_json.
+//   - timestamptz is RFC 3339 in UTC, as in "2026-02-07T10:00:00.5Z".
+//   - date, timestamp, time, interval, uuid, bytea (as "\x" hex), network
+//     addresses, ranges and other scalar types are strings in the form
+//     Postgres's to_json gives them, which Postgres also reads back.
+//   - Composite types are objects of their attributes.
+//   - Arrays are arrays of their elements' forms.
+
+// plainTypes are the types pgx decodes into Go values that encoding/json
+// encodes as Postgres's to_json does, given the fixes of jsonValue.
+var plainTypes = map[string]bool{
+	"boolean": true, "bool": true,
+	"smallint": true, "integer": true, "bigint": true, "int2": true, "int4": true, "int8": true, "oid": true,
+	"real": true, "double precision": true, "float4": true, "float8": true, "numeric": true, "decimal": true,
+	"text": true, "character varying": true, "varchar": true, "character": true, "char": true, "bpchar": true, "name": true,
+	"json": true, "jsonb": true,
+}
+
+// baseType returns a type name from format_type() lowercased and without its
+// modifiers, and the modifiers, as in "character varying" and "255" for
+// "character varying(255)".
+func baseType(typeName string) (base, modifier string) {
+	base = strings.ToLower(typeName)
+	if m := typeModifierPattern.FindStringSubmatch(base); m != nil {
+		modifier = strings.TrimSpace(m[1])
+		base = typeModifierPattern.ReplaceAllString(base, "")
+	}
+	return base, modifier
+}
+
+// fieldColumn returns the column or computed field name of tbl, the latter
+// described as a column, or nil if there is none.
+func fieldColumn(tbl *schema.Table, name string) *schema.Column {
+	if col := tbl.ColumnByName(name); col != nil {
+		return col
+	}
+	if cf := tbl.ComputedFieldByName(name); cf != nil {
+		return computedColumn(cf)
+	}
+	return nil
+}
+
+// outputField returns the select list item for field name of tbl, whose
+// value is expr, in its JSON form.
+func outputField(tbl *schema.Table, name, expr string) string {
+	col := fieldColumn(tbl, name)
+	if col == nil {
+		return expr
+	}
+	if out := outputSQL(col, expr); out != expr {
+		return out + " AS " + quoteIdent(name)
+	}
+	return expr
+}
+
+// outputSQL returns the expression for the value of col in expr that pgx
+// scans into the Go value of its JSON form, or expr if that is what it
+// scans into already.
+func outputSQL(col *schema.Column, expr string) string {
+	base, _ := baseType(col.TypeName)
+	switch {
+	case base == "":
+		return expr
+	case col.IsArray || strings.HasSuffix(base, "[]"):
+		return arrayOutputSQL(strings.TrimSuffix(base, "[]"), expr)
+	case col.IsEnum || col.IsJSON:
+		return expr
+	case col.JSONType == "string" && schema.IsNumericString(col.TypeName):
+		return "(" + expr + ")::numeric::text"
+	}
+	if out, ok := scalarOutputSQL(base, expr); ok {
+		return out
+	}
+	if col.IsComposite || col.JSONType == "object" {
+		return "to_json(" + expr + ")"
+	}
+	return "(to_json(" + expr + ") #>> '{}')"
+}
+
+// scalarOutputSQL returns the expression for a value of the built-in type base
+// in expr, if that type needs no more than the plain to_json string.
+func scalarOutputSQL(base, expr string) (string, bool) {
+	switch {
+	case base == "money":
+		return "(" + expr + ")::numeric", true
+	case base == "timestamp with time zone" || base == "timestamptz":
+		// to_json renders the zone's offset, and infinity has none.
+		return fmt.Sprintf("(to_json((%s) AT TIME ZONE 'UTC') #>> '{}' || CASE WHEN isfinite(%s) THEN 'Z' ELSE '' END)", expr, expr), true
+	case plainTypes[base]:
+		return expr, true
+	}
+	return "", false
+}
+
+// arrayOutputSQL returns the expression for an array of elemType in expr.
+// Arrays of plain types are decoded by pgx, and others are rendered by
+// to_json, except for the element types to_json does not render in their
+// JSON form: those are rendered element by element, which flattens
+// multidimensional arrays.
+func arrayOutputSQL(elemType, expr string) string {
+	if plainTypes[elemType] {
+		return expr
+	}
+	elem := quoteIdent("_ayb_e")
+	out, ok := scalarOutputSQL(elemType, elem+".v")
+	if !ok || out == elem+".v" {
+		return "to_json(" + expr + ")"
+	}
+	return fmt.Sprintf("(CASE WHEN (%s) IS NULL THEN NULL ELSE coalesce((SELECT json_agg(%s ORDER BY %s.n) FROM unnest(%s) WITH ORDINALITY AS %s (v, n)), '[]') END)",
+		expr, out, elem, expr, elem)
+}
+
+// jsonValue converts a value scanned by pgx whose Go value encoding/json
+// would not encode, or not as Postgres does, into one it does.
+func jsonValue(v any) any {
+	switch val := v.(type) {
+	case float64:
+		return floatValue(val)
+	case float32:
+		if f := float64(val); math.IsNaN(f) || math.IsInf(f, 0) {
+			return floatValue(f)
+		}
+	case pgtype.Numeric:
+		switch val.InfinityModifier {
+		case pgtype.Infinity:
+			return "Infinity"
+		case pgtype.NegativeInfinity:
+			return "-Infinity"
+		}
+	case [16]byte:
+		return formatPKValue(val)
+	case []any:
+		for i, e := range val {
+			val[i] = jsonValue(e)
+		}
+	}
+	return v
+}
+
+// floatValue returns f, or the string Postgres renders it as if it is not a
+// JSON number.
+func floatValue(f float64) any {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return f
+}
+
+// inputArg converts v, the value of col in a request body, into the argument
+// that sets col to it, and returns the SQL that reads that argument from
+// placeholder. Strings go to Postgres as text, which it parses as col's type,
+// so the string forms of outputSQL are read back as they are.
+func inputArg(col *schema.Column, v any, placeholder string) (string, any) {
+	if raw, ok := v.(json.RawMessage); ok {
+		// A value copied from an earlier result, as by batch references.
+		v = nil
+		if err := decodeJSONNumbers(bytes.NewReader(raw), &v); err != nil {
+			return placeholder, string(raw)
+		}
+	}
+	switch val := v.(type) {
+	case nil:
+		return placeholder, nil
+	case map[string]any:
+		if col.IsComposite {
+			doc, _ := json.Marshal(val)
+			return "json_populate_record(NULL::" + col.TypeName + ", " + placeholder + "::json)", string(doc)
+		}
+	case []any:
+		if col.IsArray {
+			base, _ := baseType(col.TypeName)
+			return placeholder, jsonArrayLiteral(strings.TrimSuffix(base, "[]"), val)
+		}
+	case json.Number:
+		if !col.IsJSON {
+			base, _ := baseType(col.TypeName)
+			return placeholder, numberText(base, val)
+		}
+	}
+	return placeholder, v
+}
+
+// numberText returns n as text for a value of type base. Integers written
+// with a fraction or an exponent, as in 1.0 or 1e3, are written out, since
+// Postgres reads neither as an integer.
+func numberText(base string, n json.Number) string {
+	if schema.JSONTypeOf(base) != "integer" {
+		return n.String()
+	}
+	if r, ok := new(big.Rat).SetString(n.String()); ok && r.IsInt() {
+		return r.Num().String()
+	}
+	return n.String()
+}
+
+// jsonArrayLiteral renders a JSON array as a Postgres array literal of elemType,
+// which Postgres parses element by element as it parses text input.
+func jsonArrayLiteral(elemType string, items []any) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, item := range items {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		switch val := item.(type) {
+		case nil:
+			b.WriteString("NULL")
+		case []any:
+			b.WriteString(jsonArrayLiteral(elemType, val))
+		case json.Number:
+			b.WriteString(numberText(elemType, val))
+		case bool:
+			b.WriteString(strconv.FormatBool(val))
+		case string:
+			b.WriteString(quoteArrayElement(val))
+		case map[string]any:
+			doc, _ := json.Marshal(val)
+			b.WriteString(quoteArrayElement(string(doc)))
+		default:
+			b.WriteString(quoteArrayElement(fmt.Sprint(val)))
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var arrayElementEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func quoteArrayElement(s string) string {
+	return `"` + arrayElementEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestOutputSQL(t *testing.T) {
+	col := func(typeName string) *schema.Column {
+		return &schema.Column{Name: "c", TypeName: typeName, JSONType: schema.JSONTypeOf(typeName), IsArray: len(typeName) > 2 && typeName[len(typeName)-2:] == "[]"}
+	}
+	tests := []struct {
+		name string
+		col  *schema.Column
+		want string
+	}{
+		{"integer", col("integer"), `v`},
+		{"bigint", col("bigint"), `v`},
+		{"numeric", col("numeric(12,2)"), `v`},
+		{"varchar", col("character varying(20)"), `v`},
+		{"money", col("money"), `(v)::numeric`},
+		{"numeric string", &schema.Column{TypeName: "numeric", JSONType: "string"}, `(v)::numeric::text`},
+		{"money string", &schema.Column{TypeName: "money", JSONType: "string"}, `(v)::numeric::text`},
+		{"timestamptz", col("timestamp(3) with time zone"), `(to_json((v) AT TIME ZONE 'UTC') #>> '{}' || CASE WHEN isfinite(v) THEN 'Z' ELSE '' END)`},
+		{"uuid", col("uuid"), `(to_json(v) #>> '{}')`},
+		{"bytea", col("bytea"), `(to_json(v) #>> '{}')`},
+		{"interval", col("interval"), `(to_json(v) #>> '{}')`},
+		{"range", col("int4range"), `(to_json(v) #>> '{}')`},
+		{"composite", &schema.Column{TypeName: "geo_point", JSONType: "object", IsComposite: true}, `to_json(v)`},
+		{"enum", &schema.Column{TypeName: "status", JSONType: "string", IsEnum: true}, `v`},
+		{"jsonb", &schema.Column{TypeName: "jsonb", JSONType: "object", IsJSON: true}, `v`},
+		{"integer array", col("integer[]"), `v`},
+		{"uuid array", col("uuid[]"), `to_json(v)`},
+		{"money array", col("money[]"), `(CASE WHEN (v) IS NULL THEN NULL ELSE coalesce((SELECT json_agg(("_ayb_e".v)::numeric ORDER BY "_ayb_e".n) ` +
+			`FROM unnest(v) WITH ORDINALITY AS "_ayb_e" (v, n)), '[]') END)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equal(t, outputSQL(tt.col, "v"), tt.want)
+		})
+	}
+}
+
+func TestOutputField(t *testing.T) {
+	tbl := &schema.Table{
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "bigint", JSONType: "integer"},
+			{Name: "price", TypeName: "money", JSONType: "number"},
+		},
+	}
+	testutil.Equal(t, outputField(tbl, "id", `r."id"`), `r."id"`)
+	testutil.Equal(t, outputField(tbl, "price", `r."price"`), `(r."price")::numeric AS "price"`)
+	testutil.Equal(t, outputField(tbl, "missing", `r."missing"`), `r."missing"`)
+	testutil.True(t, needsOutput(tbl, nil))
+	testutil.False(t, needsOutput(tbl, []string{"id"}))
+}
+
+func TestInputArg(t *testing.T) {
+	bigint := &schema.Column{Name: "id", TypeName: "bigint", JSONType: "integer"}
+	numeric := &schema.Column{Name: "amount", TypeName: "numeric(30,20)", JSONType: "number"}
+	meta := &schema.Column{Name: "meta", TypeName: "jsonb", JSONType: "object", IsJSON: true}
+	tags := &schema.Column{Name: "ids", TypeName: "bigint[]", JSONType: "array", IsArray: true}
+	point := &schema.Column{Name: "at", TypeName: "public.geo_point", JSONType: "object", IsComposite: true}
+
+	sql, arg := inputArg(bigint, json.Number("9007199254740993"), "$1")
+	testutil.Equal(t, sql, "$1")
+	testutil.Equal(t, arg, any("9007199254740993"))
+
+	_, arg = inputArg(bigint, json.Number("1e3"), "$1")
+	testutil.Equal(t, arg, any("1000"))
+
+	_, arg = inputArg(numeric, json.Number("0.10000000000000000001"), "$1")
+	testutil.Equal(t, arg, any("0.10000000000000000001"))
+
+	_, arg = inputArg(meta, json.Number("1"), "$1")
+	testutil.Equal(t, arg, any(json.Number("1")))
+
+	_, arg = inputArg(tags, []any{json.Number("1"), nil, json.Number("9007199254740993")}, "$1")
+	testutil.Equal(t, arg, any("{1,NULL,9007199254740993}"))
+
+	sql, arg = inputArg(point, map[string]any{"x": json.Number("1.5"), "y": json.Number("2")}, "$2")
+	testutil.Equal(t, sql, "json_populate_record(NULL::public.geo_point, $2::json)")
+	testutil.Equal(t, arg, any(`{"x":1.5,"y":2}`))
+
+	// A map is written to a non-composite column as before.
+	_, arg = inputArg(meta, map[string]any{"a": "b"}, "$1")
+	testutil.True(t, reflect.DeepEqual(arg, map[string]any{"a": "b"}), "got %#v", arg)
+
+	_, arg = inputArg(bigint, json.RawMessage(`42`), "$1")
+	testutil.Equal(t, arg, any("42"))
+
+	_, arg = inputArg(bigint, nil, "$1")
+	testutil.Nil(t, arg)
+}
+
+func TestJSONArrayLiteral(t *testing.T) {
+	items := []any{"a", `say "hi"`, `back\slash`, nil, true, json.Number("2.50"), []any{"x"}, map[string]any{"k": "v"}}
+	testutil.Equal(t, jsonArrayLiteral("text", items),
+		`{"a","say \"hi\"","back\\slash",NULL,true,2.50,{"x"},"{\"k\":\"v\"}"}`)
+	testutil.Equal(t, jsonArrayLiteral("integer", []any{json.Number("1.0"), json.Number("2e2")}), `{1,200}`)
+	testutil.Equal(t, jsonArrayLiteral("integer", []any{}), `{}`)
+}
+
+func TestJSONValue(t *testing.T) {
+	testutil.Equal(t, jsonValue(math.NaN()), any("NaN"))
+	testutil.Equal(t, jsonValue(math.Inf(1)), any("Infinity"))
+	testutil.Equal(t, jsonValue(float32(math.Inf(-1))), any("-Infinity"))
+	testutil.Equal(t, jsonValue(float32(1.5)), any(float32(1.5)))
+	testutil.Equal(t, jsonValue(1.5), any(1.5))
+	testutil.Equal(t, jsonValue(pgtype.Numeric{Valid: true, InfinityModifier: pgtype.Infinity}), any("Infinity"))
+	testutil.Equal(t, jsonValue([16]byte{0x5f, 0x0c, 0x6a, 0x3e, 0x8a, 0x7b, 0x4d, 0x9e, 0x9c, 0x1f, 0x2b, 0x3a, 0x4c, 0x5d, 0x6e, 0x7f}),
+		any("5f0c6a3e-8a7b-4d9e-9c1f-2b3a4c5d6e7f"))
+
+	got := jsonValue([]any{math.NaN(), int64(1), nil})
+	testutil.True(t, reflect.DeepEqual(got, []any{"NaN", int64(1), nil}), "got %#v", got)
+}
+
+func TestNumberText(t *testing.T) {
+	testutil.Equal(t, numberText("bigint", json.Number("-12e2")), "-1200")
+	testutil.Equal(t, numberText("integer", json.Number("1.5")), "1.5") // rejected by Postgres
+	testutil.Equal(t, numberText("numeric", json.Number("1e-20")), "1e-20")
+	testutil.Equal(t, numberText("real", json.Number("3.25")), "3.25")
+}
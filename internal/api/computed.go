@@ -0,0 +1,21 @@
+package api
+
+import "github.com/allyourbase/ayb/internal/schema"
+
+// computedFieldSQL calls a computed field's function on the row referenced by
+// rowRef: the quoted table name for the outer table, or a subquery alias.
+func computedFieldSQL(cf *schema.ComputedField, rowRef string) string {
+	return quoteIdent(cf.FunctionSchema) + "." + quoteIdent(cf.Name) + "(" + rowRef + ")"
+}
+
+// computedColumn describes a computed field as a column, so that filters can
+// treat it like one.
+func computedColumn(cf *schema.ComputedField) *schema.Column {
+	return &schema.Column{
+		Name:     cf.Name,
+		TypeName: cf.TypeName,
+		JSONType: cf.JSONType,
+		IsJSON:   cf.IsJSON,
+		IsArray:  cf.IsArray,
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+// computedTestSchema adds computed fields to relatedTestSchema: posts.word_count
+// and authors.display_name.
+func computedTestSchema() *schema.SchemaCache {
+	sc := relatedTestSchema()
+	sc.Tables["public.posts"].ComputedFields = []*schema.ComputedField{
+		{Name: "word_count", FunctionSchema: "public", TypeName: "integer", JSONType: "integer"},
+	}
+	sc.Tables["public.authors"].ComputedFields = []*schema.ComputedField{
+		{Name: "display_name", FunctionSchema: "app", TypeName: "text", JSONType: "string"},
+	}
+	return sc
+}
+
+func TestBuildColumnListComputed(t *testing.T) {
+	tbl := computedTestSchema().Tables["public.posts"]
+
+	testutil.Equal(t, buildColumnList(tbl, []string{"id", "word_count"}),
+		`"id", "public"."word_count"("posts") AS "word_count"`)
+	testutil.Equal(t, buildColumnList(tbl, []string{"*", "word_count"}),
+		`*, "public"."word_count"("posts") AS "word_count"`)
+	testutil.Equal(t, buildColumnList(tbl, []string{"nope"}), "*")
+}
+
+func TestFilterComputedField(t *testing.T) {
+	sc := computedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, args, err := parseFilterExpr(context.Background(), sc, tbl, "word_count>100", 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `"public"."word_count"("posts") > $1`)
+	testutil.SliceLen(t, args, 1)
+}
+
+func TestFilterRelatedComputedField(t *testing.T) {
+	sc := computedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, _, err := parseFilterExpr(context.Background(), sc, tbl, "author.display_name='Ann'", 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `EXISTS (SELECT 1 FROM "public"."authors" AS "r1" WHERE "r1"."id" = "public"."posts"."author_id" AND "app"."display_name"("r1") = $1)`)
+}
+
+func TestSortComputedField(t *testing.T) {
+	sc := computedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	fields := parseSort(sc, tbl, "-word_count,author.display_name")
+	testutil.SliceLen(t, fields, 2)
+	_, err := sortRules(sc, fields, nil, 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sortSQL(fields),
+		`"public"."word_count"("posts") DESC, (SELECT "app"."display_name"("s1") FROM "public"."authors" AS "s1" WHERE "s1"."id" = "public"."posts"."author_id") ASC`)
+
+	_, err = parseCursor(tbl, fields[:1], "")
+	testutil.ErrorContains(t, err, "cannot sort by word_count")
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// cursorPage describes a keyset-paginated list request. The ordering is the
+// requested sort with the primary key appended as a tiebreaker, so every row
+// has a unique position.
+type cursorPage struct {
+	fields   []sortField
+	values   []any // position to continue from; nil for the first page
+	backward bool  // fetch the page before values instead of after
+}
+
+// cursorToken is the decoded form of the opaque cursor parameter.
+type cursorToken struct {
+	Sort     string `json:"s"`
+	Values   []any  `json:"v"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// parseCursor builds the keyset for a list request from the sort fields and the
+// cursor parameter. An empty cursor starts at the first page.
+func parseCursor(tbl *schema.Table, sort []sortField, cursor string) (*cursorPage, error) {
+	if len(tbl.PrimaryKey) == 0 {
+		return nil, fmt.Errorf("cursor pagination requires a primary key")
+	}
+
+	for _, f := range sort {
+		if f.expr != "" || len(f.hops) > 0 || f.column == rankSort {
+			return nil, fmt.Errorf("cursor pagination cannot sort by %s", f.column)
+		}
+	}
+
+	fields := append([]sortField{}, sort...)
+	for _, pk := range tbl.PrimaryKey {
+		if !hasSortColumn(fields, pk) {
+			fields = append(fields, sortField{column: pk})
+		}
+	}
+	cp := &cursorPage{fields: fields}
+	if cursor == "" {
+		return cp, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var tok cursorToken
+	if err := dec.Decode(&tok); err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	if tok.Sort != cp.signature() || len(tok.Values) != len(fields) {
+		return nil, fmt.Errorf("cursor does not match sort")
+	}
+	for i, v := range tok.Values {
+		// Numbers go to Postgres as text so large integers and numerics keep their precision.
+		if n, ok := v.(json.Number); ok {
+			tok.Values[i] = n.String()
+		}
+	}
+	cp.values = tok.Values
+	cp.backward = tok.Backward
+	return cp, nil
+}
+
+func hasSortColumn(fields []sortField, col string) bool {
+	for _, f := range fields {
+		if f.column == col {
+			return true
+		}
+	}
+	return false
+}
+
+// signature identifies the ordering a cursor was issued for.
+func (c *cursorPage) signature() string {
+	parts := make([]string, len(c.fields))
+	for i, f := range c.fields {
+		if f.desc {
+			parts[i] = "-" + f.column
+		} else {
+			parts[i] = f.column
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// orderSQL returns the ORDER BY list, reversed when paging backward.
+func (c *cursorPage) orderSQL() string {
+	fields := make([]sortField, len(c.fields))
+	for i, f := range c.fields {
+		fields[i] = sortField{column: f.column, desc: f.desc != c.backward}
+	}
+	return sortSQL(fields)
+}
+
+// whereSQL returns the keyset predicate selecting rows strictly after the cursor
+// position in the (possibly reversed) ordering, with placeholders numbered from
+// argOffset+1. Returns "" on the first page.
+//
+// Nulls follow Postgres defaults: last in ascending order, first in descending.
+func (c *cursorPage) whereSQL(argOffset int) (string, []any) {
+	if c.values == nil {
+		return "", nil
+	}
+
+	var args []any
+	param := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", argOffset+len(args))
+	}
+
+	var (
+		branches []string
+		equal    []string
+	)
+	for i, f := range c.fields {
+		col := quoteIdent(f.column)
+		v := c.values[i]
+		desc := f.desc != c.backward
+
+		var after string
+		switch {
+		case v == nil && desc:
+			after = col + " IS NOT NULL"
+		case v == nil:
+			after = "" // nothing sorts after NULL ascending
+		case desc:
+			after = col + " < " + param(v)
+		default:
+			after = "(" + col + " > " + param(v) + " OR " + col + " IS NULL)"
+		}
+		if after != "" {
+			branches = append(branches, "("+strings.Join(append(append([]string{}, equal...), after), " AND ")+")")
+		}
+
+		if i == len(c.fields)-1 {
+			break
+		}
+		if v == nil {
+			equal = append(equal, col+" IS NULL")
+		} else {
+			equal = append(equal, col+" = "+param(v))
+		}
+	}
+	if len(branches) == 0 {
+		return "FALSE", args
+	}
+	return "(" + strings.Join(branches, " OR ") + ")", args
+}
+
+// position returns the record position described by the values of the
+// keyset columns, in order.
+func (c *cursorPage) position(values []any) map[string]any {
+	pos := make(map[string]any, len(c.fields))
+	for i, f := range c.fields {
+		pos[f.column] = values[i]
+	}
+	return pos
+}
+
+// links returns the cursors of the pages around a page that starts at first
+// and ends at last, in display order. hasMore tells that records follow the
+// page in the direction it was fetched.
+func (c *cursorPage) links(first, last map[string]any, hasMore bool) (next, prev string) {
+	if c.backward {
+		next = c.encode(last, false)
+		if hasMore {
+			prev = c.encode(first, true)
+		}
+		return next, prev
+	}
+	if hasMore {
+		next = c.encode(last, false)
+	}
+	if c.values != nil {
+		prev = c.encode(first, true)
+	}
+	return next, prev
+}
+
+// encode builds the cursor for the position of record.
+func (c *cursorPage) encode(record map[string]any, backward bool) string {
+	values := make([]any, len(c.fields))
+	for i, f := range c.fields {
+		v := record[f.column]
+		if b, ok := v.([16]byte); ok {
+			v = formatPKValue(b)
+		}
+		values[i] = v
+	}
+	raw, err := json.Marshal(cursorToken{Sort: c.signature(), Values: values, Backward: backward})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// columns returns the keyset columns, which must be selected to build cursors.
+func (c *cursorPage) columns() []string {
+	cols := make([]string, len(c.fields))
+	for i, f := range c.fields {
+		cols[i] = f.column
+	}
+	return cols
+}
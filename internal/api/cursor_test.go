@@ -0,0 +1,160 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestParseCursorAppendsPrimaryKey(t *testing.T) {
+	tbl := testTable()
+
+	cp, err := parseCursor(tbl, []sortField{{column: "age", desc: true}}, "")
+	testutil.NoError(t, err)
+	testutil.Equal(t, cp.signature(), "-age,id")
+	testutil.True(t, cp.values == nil, "empty cursor starts at the first page")
+
+	where, args := cp.whereSQL(0)
+	testutil.Equal(t, where, "")
+	testutil.SliceLen(t, args, 0)
+}
+
+func TestParseCursorKeepsExplicitPrimaryKeySort(t *testing.T) {
+	tbl := testTable()
+
+	cp, err := parseCursor(tbl, []sortField{{column: "id", desc: true}}, "")
+	testutil.NoError(t, err)
+	testutil.Equal(t, cp.signature(), "-id")
+}
+
+func TestParseCursorRequiresPrimaryKey(t *testing.T) {
+	tbl := testTable()
+	tbl.PrimaryKey = nil
+
+	_, err := parseCursor(tbl, nil, "")
+	testutil.ErrorContains(t, err, "requires a primary key")
+}
+
+func TestParseCursorErrors(t *testing.T) {
+	tbl := testTable()
+
+	_, err := parseCursor(tbl, nil, "!!!")
+	testutil.ErrorContains(t, err, "malformed cursor")
+
+	cp, _ := parseCursor(tbl, []sortField{{column: "name"}}, "")
+	token := cp.encode(map[string]any{"name": "Ann", "id": int64(1)}, false)
+
+	_, err = parseCursor(tbl, []sortField{{column: "age"}}, token)
+	testutil.ErrorContains(t, err, "does not match sort")
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tbl := testTable()
+	sort := []sortField{{column: "name"}}
+
+	cp, _ := parseCursor(tbl, sort, "")
+	token := cp.encode(map[string]any{"name": "Ann", "id": int64(9007199254740993)}, true)
+
+	got, err := parseCursor(tbl, sort, token)
+	testutil.NoError(t, err)
+	testutil.True(t, got.backward, "backward flag should survive the round trip")
+	testutil.Equal(t, got.values[0].(string), "Ann")
+	testutil.Equal(t, got.values[1].(string), "9007199254740993") // no float precision loss
+}
+
+func TestCursorEncodesUUID(t *testing.T) {
+	tbl := testTable()
+	cp, _ := parseCursor(tbl, nil, "")
+
+	uuid := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	got, err := parseCursor(tbl, nil, cp.encode(map[string]any{"id": uuid}, false))
+	testutil.NoError(t, err)
+	testutil.Equal(t, got.values[0].(string), "12345678-9abc-def0-1234-56789abcdef0")
+}
+
+func TestCursorWhereSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		cursor   cursorPage
+		wantSQL  string
+		wantArgs int
+	}{
+		{
+			"ascending",
+			cursorPage{fields: []sortField{{column: "id"}}, values: []any{"5"}},
+			`((("id" > $1 OR "id" IS NULL)))`, 1,
+		},
+		{
+			"descending",
+			cursorPage{fields: []sortField{{column: "id", desc: true}}, values: []any{"5"}},
+			`(("id" < $1))`, 1,
+		},
+		{
+			"backward flips direction",
+			cursorPage{fields: []sortField{{column: "id"}}, values: []any{"5"}, backward: true},
+			`(("id" < $1))`, 1,
+		},
+		{
+			"null ascending",
+			cursorPage{fields: []sortField{{column: "name"}, {column: "id"}}, values: []any{nil, "5"}},
+			`(("name" IS NULL AND ("id" > $1 OR "id" IS NULL)))`, 1,
+		},
+		{
+			"null descending",
+			cursorPage{fields: []sortField{{column: "name", desc: true}, {column: "id"}}, values: []any{nil, "5"}},
+			`(("name" IS NOT NULL) OR ("name" IS NULL AND ("id" > $1 OR "id" IS NULL)))`, 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.cursor.whereSQL(0)
+			testutil.Equal(t, sql, tt.wantSQL)
+			testutil.SliceLen(t, args, tt.wantArgs)
+		})
+	}
+}
+
+func TestCursorLinks(t *testing.T) {
+	pos := func(id int) map[string]any { return map[string]any{"id": id} }
+	fields := []sortField{{column: "id"}}
+
+	// First page with more rows available.
+	cp := &cursorPage{fields: fields}
+	next, prev := cp.links(pos(1), pos(2), true)
+	testutil.True(t, next != "", "expected next cursor")
+	testutil.Equal(t, prev, "")
+
+	// Last page reached going forward.
+	cp = &cursorPage{fields: fields, values: []any{"2"}}
+	next, prev = cp.links(pos(3), pos(3), false)
+	testutil.Equal(t, next, "")
+	testutil.True(t, prev != "", "expected prev cursor")
+
+	// Going backward, the next page always exists and the previous one only
+	// if more rows were fetched.
+	cp = &cursorPage{fields: fields, values: []any{"5"}, backward: true}
+	next, prev = cp.links(pos(3), pos(4), true)
+	testutil.True(t, next != "", "expected next cursor")
+	testutil.True(t, prev != "", "expected prev cursor")
+	_, prev = cp.links(pos(1), pos(4), false)
+	testutil.Equal(t, prev, "")
+
+	// Cursors point just past the page's edges.
+	got, err := parseCursor(testTable(), nil, next)
+	testutil.NoError(t, err)
+	testutil.Equal(t, got.values[0], any("4"))
+	testutil.False(t, got.backward, "next cursor should go forward")
+}
+
+func TestListInvalidCursor(t *testing.T) {
+	h := testHandler(testSchema())
+
+	w := doRequest(h, "GET", "/collections/users?cursor=garbage!", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "invalid cursor")
+
+	w = doRequest(h, "GET", "/collections/logs?cursor=", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "requires a primary key")
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// etagColumn is an extra column carrying a row's version for its ETag. It is
+// stripped before records are returned.
+const etagColumn = "_ayb_etag"
+
+// hasVersion reports whether rows of tbl have an xmin system column. Postgres
+// sets xmin to the writing transaction's ID whenever a row is inserted or
+// updated, so it identifies the row's version. Plain views have no xmin.
+func hasVersion(tbl *schema.Table) bool {
+	return tbl.Kind != "view"
+}
+
+// versionSelect returns the select-list entry that reads a row's version into
+// etagColumn.
+func versionSelect() string {
+	return "xmin::text AS " + quoteIdent(etagColumn)
+}
+
+// recordETag removes etagColumn from record and returns the record's strong
+// ETag: the row's version and a hash of the record, or the hash alone for rows
+// without a version. The hash tells apart representations of one version that
+// differ in their fields, computed fields or the columns the role can see.
+func recordETag(record map[string]any) string {
+	var version string
+	if v, ok := record[etagColumn]; ok {
+		delete(record, etagColumn)
+		version, _ = v.(string)
+	}
+	b, _ := json.Marshal(record)
+	sum := sha256.Sum256(b)
+	if version != "" {
+		return `"` + version + "-" + hex.EncodeToString(sum[:8]) + `"`
+	}
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// parseETags splits an If-Match or If-None-Match header into its entity tags.
+// star is true if the header is "*".
+func parseETags(header string) (tags []string, star bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		switch tag {
+		case "":
+		case "*":
+			star = true
+		default:
+			tags = append(tags, tag)
+		}
+	}
+	return tags, star
+}
+
+// notModified reports whether the If-None-Match header matches etag. Matching
+// is weak, so W/ prefixes are ignored.
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	tags, star := parseETags(header)
+	if star {
+		return true
+	}
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIfMatch returns the row versions listed in the If-Match header, or nil
+// when the header is absent or "*", in which case any version may be written.
+// Only the version part of each tag is kept, so a tag from any representation
+// of the row matches.
+// Weak tags never match under the strong comparison If-Match requires, so they
+// are dropped; a header with only weak tags yields an empty, non-nil list that
+// matches nothing.
+func parseIfMatch(r *http.Request) []string {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	tags, star := parseETags(header)
+	if star {
+		return nil
+	}
+	versions := []string{}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		v, _, _ := strings.Cut(strings.Trim(tag, `"`), "-")
+		if !slices.Contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// versionCondition returns a condition matching rows whose version is one of
+// the If-Match versions, bound to placeholder n.
+func versionCondition(n int) string {
+	return fmt.Sprintf("xmin::text = ANY($%d::text[])", n)
+}
+
+// recordExists reports whether a row with the given primary key is visible.
+func recordExists(ctx context.Context, q Querier, tbl *schema.Table, pkValues []string) (bool, error) {
+	where, args := buildPKWhere(tbl, pkValues)
+	var exists bool
+	err := q.QueryRow(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s)", tableRef(tbl), where), args...).Scan(&exists)
+	return exists, err
+}
+
+// writeNoMatch responds to a single-record update or delete that matched no
+// row: 412 if the row exists but If-Match named another version, 404 otherwise.
+// Returns the error from checking, if any, so the caller can roll back.
+func (h *Handler) writeNoMatch(w http.ResponseWriter, r *http.Request, q Querier, tbl *schema.Table, pkValues, ifMatch []string) error {
+	if ifMatch != nil {
+		exists, err := recordExists(r.Context(), q, tbl, pkValues)
+		if err != nil {
+			if !mapPGError(w, err) {
+				h.logger.Error("query error", "error", err, "table", tbl.Name)
+				writeError(w, http.StatusInternalServerError, "internal error")
+			}
+			return err
+		}
+		if exists {
+			writeError(w, http.StatusPreconditionFailed, "record has been modified: If-Match does not match the current version")
+			return nil
+		}
+	}
+	writeError(w, http.StatusNotFound, "record not found")
+	return nil
+}
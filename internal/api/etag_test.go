@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestRecordETag(t *testing.T) {
+	record := map[string]any{"id": 1, etagColumn: "741"}
+	tag := recordETag(record)
+	testutil.True(t, strings.HasPrefix(tag, `"741-`), "got %s", tag)
+	testutil.Equal(t, len(tag), 22)
+	_, ok := record[etagColumn]
+	testutil.False(t, ok, "etag column should be stripped")
+
+	// Other fields of the same version get another tag.
+	testutil.Equal(t, recordETag(map[string]any{"id": 1, etagColumn: "741"}), tag)
+	testutil.NotEqual(t, recordETag(map[string]any{"id": 1, "name": "Alice", etagColumn: "741"}), tag)
+
+	// Without a version, the tag is a hash of the record.
+	a := recordETag(map[string]any{"id": 1, "name": "Alice"})
+	b := recordETag(map[string]any{"name": "Alice", "id": 1})
+	c := recordETag(map[string]any{"id": 1, "name": "Alicia"})
+	testutil.Equal(t, a, b)
+	testutil.NotEqual(t, a, c)
+	testutil.Equal(t, len(a), 34)
+}
+
+func TestBuildSelectOneView(t *testing.T) {
+	tbl := testTable()
+	tbl.Kind = "view"
+	q, _ := buildSelectOne(tbl, []string{"id"}, []string{"1"})
+	testutil.Equal(t, q, `SELECT "id" FROM "public"."users" WHERE "id" = $1 LIMIT 1`)
+
+	tbl.Kind = "materialized_view"
+	q, _ = buildSelectOne(tbl, []string{"id"}, []string{"1"})
+	testutil.Equal(t, q, `SELECT "id", xmin::text AS "_ayb_etag" FROM "public"."users" WHERE "id" = $1 LIMIT 1`)
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", nil},
+		{"*", nil},
+		{`"741"`, []string{"741"}},
+		{`"741", "742" ,"741"`, []string{"741", "742"}},
+		{`W/"741"`, []string{}},
+		{`W/"741", "742"`, []string{"742"}},
+		{`"741-0a1b2c3d4e5f6a7b", "741-ffffffffffffffff"`, []string{"741"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			got := parseIfMatch(r)
+			testutil.Equal(t, got == nil, tt.want == nil)
+			testutil.SliceLen(t, got, len(tt.want))
+			for i := range tt.want {
+				testutil.Equal(t, got[i], tt.want[i])
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"741"`, true},
+		{`W/"741"`, true},
+		{`"740", "741"`, true},
+		{`"742"`, false},
+		{"*", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("If-None-Match", tt.header)
+			}
+			testutil.Equal(t, notModified(r, `"741"`), tt.want)
+		})
+	}
+}
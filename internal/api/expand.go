@@ -3,7 +3,8 @@ package api
 import (
 	"context"
 	"fmt"
-	"log/slog"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/allyourbase/ayb/internal/schema"
@@ -11,201 +12,428 @@ import (
 
 const maxExpandDepth = 2
 
-// expandRecords populates the "expand" key on each record for the given expand parameter.
-// Supports comma-separated relations and dot-notation for nested expansion (depth limit 2).
-func expandRecords(ctx context.Context, pool Querier, sc *schema.SchemaCache, tbl *schema.Table, records []map[string]any, expandParam string, logger *slog.Logger) {
-	if len(records) == 0 || expandParam == "" {
-		return
-	}
+// Extra columns selected by expand queries. They are stripped before records
+// are returned.
+const (
+	// expandKeyColumn carries the parent key each related row belongs to.
+	expandKeyColumn = "_ayb_expand_key"
+	// expandRowColumn numbers related rows per parent, for limit.
+	expandRowColumn = "_ayb_expand_row"
+)
 
-	relations := strings.Split(expandParam, ",")
-	for _, rel := range relations {
-		rel = strings.TrimSpace(rel)
-		if rel == "" {
-			continue
-		}
+// expandOptions narrows an expanded relation, e.g.
+// comments(filter=approved=true,sort=-created_at,limit=5,fields=id,body).
+type expandOptions struct {
+	filter string
+	sort   string
+	limit  int // per parent record; 0 means no limit
+	fields []string
+}
+
+// expandStep is one resolved relation in an expand path.
+type expandStep struct {
+	rel   *schema.Relationship
+	table *schema.Table // the related table
+	opts  expandOptions
+}
 
+// parseExpand parses the expand parameter: comma-separated relation paths, with
+// dot-notation for nested expansion (depth limit 2) and optional parenthesized
+// options on each relation. Unknown relations are skipped, as are the parts of
+// a path after them. Options are validated against the related table.
+func parseExpand(sc *schema.SchemaCache, tbl *schema.Table, param string) ([][]expandStep, error) {
+	var paths [][]expandStep
+	for _, item := range splitExpand(param, ',') {
 		// Split on dot for nested expansion.
-		parts := strings.SplitN(rel, ".", maxExpandDepth+1)
+		parts := splitExpand(item, '.')
 		if len(parts) > maxExpandDepth {
 			parts = parts[:maxExpandDepth]
 		}
 
-		expandRelation(ctx, pool, sc, tbl, records, parts, 0, logger)
+		var path []expandStep
+		cur := tbl
+		for _, part := range parts {
+			name, opts, err := parseExpandItem(part)
+			if err != nil {
+				return nil, err
+			}
+			rel := findRelationship(cur, name)
+			if rel == nil {
+				break
+			}
+			relTable := sc.Tables[rel.ToSchema+"."+rel.ToTable]
+			if relTable == nil {
+				break
+			}
+			if err := validateExpandOptions(sc, rel, relTable, opts); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			path = append(path, expandStep{rel: rel, table: relTable, opts: opts})
+			cur = relTable
+		}
+		if len(path) > 0 {
+			paths = append(paths, path)
+		}
 	}
+	return paths, nil
 }
 
-// expandRelation expands a single relation (possibly nested) on the given records.
-func expandRelation(ctx context.Context, pool Querier, sc *schema.SchemaCache, tbl *schema.Table, records []map[string]any, relPath []string, depth int, logger *slog.Logger) {
-	if depth >= maxExpandDepth || len(relPath) == 0 {
-		return
+// splitExpand splits s on sep outside parentheses and quoted strings, trimming
+// whitespace and dropping empty parts.
+func splitExpand(s string, sep byte) []string {
+	var parts []string
+	add := func(p string) {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
 	}
 
-	relName := relPath[0]
+	depth, start := 0, 0
+	inString := false
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case inString:
+			if ch == '\\' {
+				i++
+			} else if ch == '\'' {
+				inString = false
+			}
+		case ch == '\'':
+			inString = true
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == sep && depth == 0:
+			add(s[start:i])
+			start = i + 1
+		}
+	}
+	add(s[start:])
+	return parts
+}
 
-	// Find the relationship in the table's schema.
-	// Matches on FieldName (e.g., "author") or FK column name (e.g., "author_id").
-	var rel *schema.Relationship
-	for _, r := range tbl.Relationships {
-		if r.FieldName == relName {
-			rel = r
-			break
+// parseExpandItem splits a path segment such as "comments(limit=5)" into the
+// relation name and its options.
+func parseExpandItem(item string) (string, expandOptions, error) {
+	var opts expandOptions
+	open := strings.IndexByte(item, '(')
+	if open < 0 {
+		return item, opts, nil
+	}
+	if !strings.HasSuffix(item, ")") {
+		return "", opts, fmt.Errorf("expected ')' to close options of %s", item[:open])
+	}
+	name := strings.TrimSpace(item[:open])
+
+	// Option values may contain commas (fields=id,body), so a part that does
+	// not start a new option continues the previous one.
+	var key string
+	values := map[string]string{}
+	for _, part := range splitExpand(item[open+1:len(item)-1], ',') {
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.TrimSpace(k)
+		if ok && (k == "filter" || k == "sort" || k == "limit" || k == "fields") {
+			if _, dup := values[k]; dup {
+				return "", opts, fmt.Errorf("duplicate expand option %s", k)
+			}
+			key = k
+			values[k] = strings.TrimSpace(v)
+			continue
 		}
-		if r.Type == "many-to-one" && len(r.FromColumns) == 1 && r.FromColumns[0] == relName {
-			rel = r
-			break
+		if key == "" {
+			return "", opts, fmt.Errorf("unknown expand option: %s", part)
 		}
-	}
-	if rel == nil {
-		return
+		values[key] += "," + part
 	}
 
-	// Find the related table.
-	relTableKey := rel.ToSchema + "." + rel.ToTable
-	relTable := sc.Tables[relTableKey]
-	if relTable == nil {
-		return
+	opts.filter = values["filter"]
+	opts.sort = values["sort"]
+	if v, ok := values["limit"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return "", opts, fmt.Errorf("invalid expand limit: %s", v)
+		}
+		opts.limit = n
 	}
-
-	switch rel.Type {
-	case "many-to-one":
-		expandManyToOne(ctx, pool, sc, relTable, records, rel, relPath, depth, logger)
-	case "one-to-many":
-		expandOneToMany(ctx, pool, sc, relTable, records, rel, relPath, depth, logger)
+	if v, ok := values["fields"]; ok {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				opts.fields = append(opts.fields, f)
+			}
+		}
 	}
+	return name, opts, nil
 }
 
-// collectUniqueValues collects unique non-nil values for a given column from a set of records.
-func collectUniqueValues(records []map[string]any, col string) []any {
-	seen := make(map[any]bool)
-	var values []any
-	for _, rec := range records {
-		v, ok := rec[col]
-		if !ok || v == nil {
-			continue
+// validateExpandOptions checks options against the related table, so that a
+// bad filter is reported as a 400 instead of an empty expansion.
+func validateExpandOptions(sc *schema.SchemaCache, rel *schema.Relationship, relTable *schema.Table, opts expandOptions) error {
+	if rel.Type == "many-to-one" && (opts.sort != "" || opts.limit > 0) {
+		return fmt.Errorf("sort and limit require a to-many relation")
+	}
+	if opts.filter != "" {
+		// Only checked here; it runs with the request's rules when the expansion does.
+		if _, _, err := parseFilterExpr(context.Background(), sc, relTable, opts.filter, 0); err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
 		}
-		if !seen[v] {
-			seen[v] = true
-			values = append(values, v)
+	}
+	for _, f := range opts.fields {
+		if relTable.ColumnByName(f) == nil && relTable.ComputedFieldByName(f) == nil {
+			return fmt.Errorf("unknown field: %s", f)
 		}
 	}
-	return values
+	return nil
 }
 
-// fetchRelated runs a batch SELECT * FROM relTable WHERE targetCol IN (...values).
-// Returns the matching rows, or nil on error (errors are logged, not returned).
-func fetchRelated(ctx context.Context, pool Querier, relTable *schema.Table, targetCol string, values []any, logger *slog.Logger, relName string) []map[string]any {
-	placeholders := make([]string, len(values))
-	for i := range values {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-	}
-
-	query := fmt.Sprintf("SELECT * FROM %s WHERE %s IN (%s)",
-		tableRef(relTable),
-		quoteIdent(targetCol),
-		strings.Join(placeholders, ", "),
-	)
-
-	rows, err := pool.Query(ctx, query, values...)
-	if err != nil {
-		logger.Error("expand query error", "error", err, "relation", relName)
+// expandRelation expands the first relation of path on the given records with a
+// single batch query, then the rest of the path on the related records.
+func expandRelation(ctx context.Context, pool Querier, sc *schema.SchemaCache, records []map[string]any, path []expandStep) error {
+	step := path[0]
+	rel := step.rel
+	if len(rel.FromColumns) == 0 || len(rel.ToColumns) == 0 {
 		return nil
 	}
-	defer rows.Close()
 
-	related, err := scanRows(rows)
-	if err != nil {
-		logger.Error("expand scan error", "error", err, "relation", relName)
+	fromCol := rel.FromColumns[0]
+	keys := collectUniqueValues(records, fromCol)
+	if len(keys) == 0 {
 		return nil
 	}
-	return related
-}
 
-// expandManyToOne expands a many-to-one relationship (e.g., post.author_id → user).
-// Collects unique FK values, does a single batch query, and attaches results.
-func expandManyToOne(ctx context.Context, pool Querier, sc *schema.SchemaCache, relTable *schema.Table, records []map[string]any, rel *schema.Relationship, relPath []string, depth int, logger *slog.Logger) {
-	if len(rel.FromColumns) == 0 || len(rel.ToColumns) == 0 {
-		return
+	// Nested expansion needs the related rows' join columns even if fields
+	// leaves them out.
+	var extra []string
+	if len(path) > 1 && len(step.opts.fields) > 0 {
+		for _, col := range path[1].rel.FromColumns {
+			if !slices.Contains(step.opts.fields, col) && !slices.Contains(extra, col) {
+				extra = append(extra, col)
+			}
+		}
 	}
 
-	fkCol := rel.FromColumns[0]
-	targetCol := rel.ToColumns[0]
-
-	fkValues := collectUniqueValues(records, fkCol)
-	if len(fkValues) == 0 {
-		return
+	query, args, err := buildExpandQuery(ctx, sc, step, extra, keys)
+	if err != nil {
+		return err
+	}
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	related, err := scanRows(rows)
+	rows.Close()
+	if err != nil {
+		return err
 	}
-
-	related := fetchRelated(ctx, pool, relTable, targetCol, fkValues, logger, rel.FieldName)
 	if len(related) == 0 {
-		return
+		return nil
 	}
 
-	// Nested expansion on the related records.
-	if len(relPath) > 1 {
-		expandRelation(ctx, pool, sc, relTable, related, relPath[1:], depth+1, logger)
+	// Group by parent key, keeping query order.
+	groups := make(map[any][]map[string]any)
+	for _, r := range related {
+		key := r[expandKeyColumn]
+		delete(r, expandKeyColumn)
+		delete(r, expandRowColumn)
+		groups[key] = append(groups[key], r)
 	}
 
-	// Index by target column value.
-	index := make(map[any]map[string]any, len(related))
-	for _, r := range related {
-		index[r[targetCol]] = r
+	// Nested expansion.
+	if len(path) > 1 {
+		if err := expandRelation(ctx, pool, sc, related, path[1:]); err != nil {
+			return err
+		}
+		for _, r := range related {
+			for _, col := range extra {
+				delete(r, col)
+			}
+		}
 	}
 
 	// Attach to each record under "expand" key.
 	for _, rec := range records {
-		fkVal := rec[fkCol]
-		if fkVal == nil {
+		ourVal := rec[fromCol]
+		if ourVal == nil {
 			continue
 		}
-		if related, ok := index[fkVal]; ok {
-			expand := getOrCreateExpand(rec)
-			expand[rel.FieldName] = related
+		group, ok := groups[ourVal]
+		if !ok {
+			continue
+		}
+		expand := getOrCreateExpand(rec)
+		if rel.Type == "many-to-one" {
+			expand[rel.FieldName] = group[0]
+		} else {
+			expand[rel.FieldName] = group
 		}
 	}
+	return nil
 }
 
-// expandOneToMany expands a one-to-many relationship (e.g., user → posts).
-func expandOneToMany(ctx context.Context, pool Querier, sc *schema.SchemaCache, relTable *schema.Table, records []map[string]any, rel *schema.Relationship, relPath []string, depth int, logger *slog.Logger) {
-	if len(rel.FromColumns) == 0 || len(rel.ToColumns) == 0 {
-		return
+// buildExpandQuery builds the batch query for one expand step: the related rows
+// for the given parent keys, each tagged with its key in expandKeyColumn.
+// Many-to-many rows are reached through the junction table, which is read in a
+// subquery so that its columns cannot clash with the filter's. A limit is
+// applied per parent with row_number(). Related rows are limited by the
+// related table's list rule.
+func buildExpandQuery(ctx context.Context, sc *schema.SchemaCache, step expandStep, extra []string, keys []any) (string, []any, error) {
+	rel, relTable, opts := step.rel, step.table, step.opts
+
+	placeholders := make([]string, len(keys))
+	for i := range keys {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
 	}
+	args := append([]any{}, keys...)
+	in := " IN (" + strings.Join(placeholders, ", ") + ")"
 
-	fromCol := rel.FromColumns[0]
-	targetCol := rel.ToColumns[0]
+	var from, keyExpr, where string
+	var keyCol *schema.Column
+	switch rel.Type {
+	case "many-to-many":
+		if len(rel.JunctionFromColumns) == 0 {
+			return "", nil, fmt.Errorf("relationship %s has no junction columns", rel.Name)
+		}
+		junction := quoteIdent("_ayb_junction")
+		selects := []string{quoteIdent(rel.JunctionFromColumns[0]) + " AS " + quoteIdent(expandKeyColumn)}
+		refs := make([]string, len(rel.JunctionToColumns))
+		for i, col := range rel.JunctionToColumns {
+			refs[i] = fmt.Sprintf("_ayb_to_%d", i)
+			selects = append(selects, quoteIdent(col)+" AS "+quoteIdent(refs[i]))
+		}
+		from = fmt.Sprintf("%s JOIN (SELECT %s FROM %s.%s WHERE %s%s) AS %s ON %s",
+			tableRef(relTable),
+			strings.Join(selects, ", "),
+			quoteIdent(rel.JunctionSchema), quoteIdent(rel.JunctionTable),
+			quoteIdent(rel.JunctionFromColumns[0]), in,
+			junction,
+			joinColumns(junction, refs, tableRef(relTable), rel.ToColumns),
+		)
+		keyExpr = junction + "." + quoteIdent(expandKeyColumn)
+		if parent := sc.Tables[rel.FromSchema+"."+rel.FromTable]; parent != nil {
+			keyCol = parent.ColumnByName(rel.FromColumns[0])
+		}
+	default:
+		from = tableRef(relTable)
+		keyExpr = tableRef(relTable) + "." + quoteIdent(rel.ToColumns[0])
+		where = keyExpr + in
+		keyCol = relTable.ColumnByName(rel.ToColumns[0])
+	}
 
-	ourValues := collectUniqueValues(records, fromCol)
-	if len(ourValues) == 0 {
-		return
+	if opts.filter != "" {
+		filterSQL, filterArgs, err := parseFilterExpr(ctx, sc, relTable, opts.filter, len(args))
+		if err != nil {
+			return "", nil, err
+		}
+		if where != "" {
+			where += " AND "
+		}
+		where += "(" + filterSQL + ")"
+		args = append(args, filterArgs...)
+	}
+	ruleSQL, ruleArgs, err := ruleFilter(sc, relTable, ruleList, requestVars(ctx, nil), len(args))
+	if err != nil {
+		return "", nil, err
+	}
+	if ruleSQL != "" {
+		if where != "" {
+			where += " AND "
+		}
+		where += "(" + ruleSQL + ")"
+		args = append(args, ruleArgs...)
 	}
 
-	related := fetchRelated(ctx, pool, relTable, targetCol, ourValues, logger, rel.FieldName)
-	if len(related) == 0 {
-		return
+	ref := tableRef(relTable)
+	sel := ref + ".*"
+	if relTable.HasHiddenColumns() || needsOutput(relTable, nil) {
+		cols := make([]string, len(relTable.Columns))
+		for i, col := range relTable.Columns {
+			cols[i] = outputField(relTable, col.Name, ref+"."+quoteIdent(col.Name))
+		}
+		sel = strings.Join(cols, ", ")
 	}
+	if len(opts.fields) > 0 {
+		cols := make([]string, 0, len(opts.fields)+len(extra))
+		for _, f := range append(append([]string{}, opts.fields...), extra...) {
+			if cf := relTable.ComputedFieldByName(f); cf != nil {
+				expr := computedFieldSQL(cf, ref)
+				if out := outputField(relTable, f, expr); out != expr {
+					cols = append(cols, out)
+				} else {
+					cols = append(cols, expr+" AS "+quoteIdent(f))
+				}
+			} else {
+				cols = append(cols, outputField(relTable, f, ref+"."+quoteIdent(f)))
+			}
+		}
+		sel = strings.Join(cols, ", ")
+	}
+	// The key is matched against the parent's value of the column, which is
+	// in its JSON form.
+	key := keyExpr
+	if keyCol != nil {
+		key = outputSQL(keyCol, keyExpr)
+	}
+	sel += ", " + key + " AS " + quoteIdent(expandKeyColumn)
 
-	// Nested expansion.
-	if len(relPath) > 1 {
-		expandRelation(ctx, pool, sc, relTable, related, relPath[1:], depth+1, logger)
+	sorts := parseSort(sc, relTable, opts.sort)
+	sortArgs, err := sortRules(sc, sorts, requestVars(ctx, nil), len(args))
+	if err != nil {
+		return "", nil, err
+	}
+	args = append(args, sortArgs...)
+	if len(sorts) == 0 && opts.limit > 0 && len(relTable.PrimaryKey) > 0 {
+		for _, col := range relTable.PrimaryKey {
+			sorts = append(sorts, sortField{column: col})
+		}
 	}
+	// Columns are sorted by as stored, not by the JSON form selected under
+	// their name.
+	for i, f := range sorts {
+		if f.expr == "" && f.column != rankSort {
+			sorts[i].expr = ref + "." + quoteIdent(f.column)
+		}
+	}
+	orderSQL := sortSQL(sorts)
 
-	// Group by target column value.
-	groups := make(map[any][]map[string]any)
-	for _, r := range related {
-		groups[r[targetCol]] = append(groups[r[targetCol]], r)
+	if opts.limit > 0 {
+		over := "PARTITION BY " + keyExpr
+		if orderSQL != "" {
+			over += " ORDER BY " + orderSQL
+		}
+		sel += ", row_number() OVER (" + over + ") AS " + quoteIdent(expandRowColumn)
+	}
+
+	q := "SELECT " + sel + " FROM " + from
+	if where != "" {
+		q += " WHERE " + where
 	}
 
-	// Attach to each record.
+	if opts.limit > 0 {
+		args = append(args, opts.limit)
+		return fmt.Sprintf("SELECT * FROM (%s) AS %s WHERE %s <= $%d ORDER BY %s",
+			q, quoteIdent("_ayb_expand"), quoteIdent(expandRowColumn), len(args), quoteIdent(expandRowColumn)), args, nil
+	}
+	if orderSQL != "" {
+		q += " ORDER BY " + orderSQL
+	}
+	return q, args, nil
+}
+
+// collectUniqueValues collects unique non-nil values for a given column from a set of records.
+func collectUniqueValues(records []map[string]any, col string) []any {
+	seen := make(map[any]bool)
+	var values []any
 	for _, rec := range records {
-		ourVal := rec[fromCol]
-		if ourVal == nil {
+		v, ok := rec[col]
+		if !ok || v == nil {
 			continue
 		}
-		if group, ok := groups[ourVal]; ok {
-			expand := getOrCreateExpand(rec)
-			expand[rel.FieldName] = group
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
 		}
 	}
+	return values
 }
 
 func getOrCreateExpand(rec map[string]any) map[string]any {
@@ -218,3 +446,29 @@ func getOrCreateExpand(rec map[string]any) map[string]any {
 	rec["expand"] = m
 	return m
 }
+
+// expandNode is a relation to expand, along with the relations to expand on
+// its records in turn.
+type expandNode struct {
+	expandStep
+	children []*expandNode
+}
+
+// expandTree merges the parsed expand paths into a tree, so that paths that
+// share a relation expand it once. A relation named more than once takes the
+// options of its first mention.
+func expandTree(paths [][]expandStep) []*expandNode {
+	var roots []*expandNode
+	for _, path := range paths {
+		level := &roots
+		for _, step := range path {
+			i := slices.IndexFunc(*level, func(n *expandNode) bool { return n.rel.FieldName == step.rel.FieldName })
+			if i < 0 {
+				*level = append(*level, &expandNode{expandStep: step})
+				i = len(*level) - 1
+			}
+			level = &(*level)[i].children
+		}
+	}
+	return roots
+}
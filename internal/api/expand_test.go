@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"testing"
 
 	"github.com/allyourbase/ayb/internal/schema"
@@ -154,3 +155,100 @@ func TestCountKnownColumns(t *testing.T) {
 		})
 	}
 }
+
+func TestParseExpandItem(t *testing.T) {
+	name, opts, err := parseExpandItem("comments(filter=approved=true && id IN (1,2),sort=-created_at,id,limit=5,fields=id,body)")
+	testutil.NoError(t, err)
+	testutil.Equal(t, name, "comments")
+	testutil.Equal(t, opts.filter, "approved=true && id IN (1,2)")
+	testutil.Equal(t, opts.sort, "-created_at,id")
+	testutil.Equal(t, opts.limit, 5)
+	testutil.SliceLen(t, opts.fields, 2)
+	testutil.Equal(t, opts.fields[1], "body")
+
+	name, opts, err = parseExpandItem("author")
+	testutil.NoError(t, err)
+	testutil.Equal(t, name, "author")
+	testutil.Equal(t, opts.limit, 0)
+
+	// Commas and parentheses inside quoted filter values are literal.
+	_, opts, err = parseExpandItem("comments(filter=body='a, b)',limit=1)")
+	testutil.NoError(t, err)
+	testutil.Equal(t, opts.filter, "body='a, b)'")
+	testutil.Equal(t, opts.limit, 1)
+}
+
+func TestParseExpandItemErrors(t *testing.T) {
+	tests := []struct {
+		item string
+		want string
+	}{
+		{"comments(limit=5", "expected ')'"},
+		{"comments(bogus=1)", "unknown expand option"},
+		{"comments(limit=0)", "invalid expand limit"},
+		{"comments(limit=x)", "invalid expand limit"},
+		{"comments(limit=1,limit=2)", "duplicate expand option"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.item, func(t *testing.T) {
+			_, _, err := parseExpandItem(tt.item)
+			testutil.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestParseExpand(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	paths, err := parseExpand(sc, tbl, "comments(limit=2,fields=id),author.org,nope,tags")
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, paths, 3)
+	testutil.Equal(t, paths[0][0].rel.FieldName, "comments")
+	testutil.Equal(t, paths[0][0].opts.limit, 2)
+	testutil.SliceLen(t, paths[1], 2)
+	testutil.Equal(t, paths[1][1].table.Name, "orgs")
+	testutil.Equal(t, paths[2][0].rel.Type, "many-to-many")
+
+	_, err = parseExpand(sc, tbl, "comments(filter=nope=1)")
+	testutil.ErrorContains(t, err, "comments: invalid filter")
+	_, err = parseExpand(sc, tbl, "comments(fields=id,nope)")
+	testutil.ErrorContains(t, err, "unknown field: nope")
+	_, err = parseExpand(sc, tbl, "author(limit=1)")
+	testutil.ErrorContains(t, err, "require a to-many relation")
+}
+
+func TestBuildExpandQuery(t *testing.T) {
+	sc := relatedTestSchema()
+	posts := sc.Tables["public.posts"]
+	keys := []any{int64(1), int64(2)}
+
+	paths, err := parseExpand(sc, posts, "author")
+	testutil.NoError(t, err)
+	q, args, err := buildExpandQuery(context.Background(), sc, paths[0][0], nil, keys)
+	testutil.NoError(t, err)
+	testutil.Equal(t, q, `SELECT "public"."authors".*, "public"."authors"."id" AS "_ayb_expand_key" FROM "public"."authors" `+
+		`WHERE "public"."authors"."id" IN ($1, $2)`)
+	testutil.SliceLen(t, args, 2)
+
+	paths, err = parseExpand(sc, posts, "comments(filter=approved=true,sort=-id,limit=5,fields=id)")
+	testutil.NoError(t, err)
+	q, args, err = buildExpandQuery(context.Background(), sc, paths[0][0], []string{"post_id"}, keys)
+	testutil.NoError(t, err)
+	testutil.Equal(t, q, `SELECT * FROM (SELECT "public"."comments"."id", "public"."comments"."post_id", `+
+		`"public"."comments"."post_id" AS "_ayb_expand_key", `+
+		`row_number() OVER (PARTITION BY "public"."comments"."post_id" ORDER BY "public"."comments"."id" DESC) AS "_ayb_expand_row" `+
+		`FROM "public"."comments" WHERE "public"."comments"."post_id" IN ($1, $2) AND ("approved" = $3)) AS "_ayb_expand" `+
+		`WHERE "_ayb_expand_row" <= $4 ORDER BY "_ayb_expand_row"`)
+	testutil.SliceLen(t, args, 4)
+	testutil.Equal(t, args[2], any(true))
+	testutil.Equal(t, args[3], any(5))
+
+	paths, err = parseExpand(sc, posts, "tags(sort=name)")
+	testutil.NoError(t, err)
+	q, _, err = buildExpandQuery(context.Background(), sc, paths[0][0], nil, keys)
+	testutil.NoError(t, err)
+	testutil.Equal(t, q, `SELECT "public"."tags".*, "_ayb_junction"."_ayb_expand_key" AS "_ayb_expand_key" `+
+		`FROM "public"."tags" JOIN (SELECT "post_id" AS "_ayb_expand_key", "tag_id" AS "_ayb_to_0" FROM "public"."post_tags" WHERE "post_id" IN ($1, $2)) AS "_ayb_junction" `+
+		`ON "_ayb_junction"."_ayb_to_0" = "public"."tags"."id" ORDER BY "public"."tags"."name" ASC`)
+}
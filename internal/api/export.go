@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// exportFlushRows is how many rows are buffered between flushes to the client.
+const exportFlushRows = 500
+
+// exportFormats maps the format parameter to its content type and file extension.
+var exportFormats = map[string]struct{ contentType, ext string }{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+	"json":   {"application/json", "json"},
+}
+
+// exportColumns returns the columns to export: the requested fields that exist,
+// in request order, or every column in table order.
+func exportColumns(tbl *schema.Table, fields []string) []string {
+	var cols []string
+	for _, f := range fields {
+		if tbl.ColumnByName(f) != nil {
+			cols = append(cols, f)
+		}
+	}
+	if len(cols) > 0 {
+		return cols
+	}
+	for _, col := range tbl.Columns {
+		cols = append(cols, col.Name)
+	}
+	return cols
+}
+
+// buildExport builds the export query. Every row comes back as a single text
+// value rendered by Postgres, so rows can be written out as they arrive: one
+// text column per field for CSV, or one JSON object for the JSON formats.
+func buildExport(tbl *schema.Table, format string, columns []string, filterSQL string, filterArgs []any, orderSQL string) (string, []any) {
+	inner := fmt.Sprintf("SELECT %s FROM %s", quoteIdents(columns), tableRef(tbl))
+	if filterSQL != "" {
+		inner += " WHERE " + filterSQL
+	}
+	if orderSQL != "" {
+		inner += " ORDER BY " + orderSQL
+	}
+
+	var q string
+	if format == "csv" {
+		casts := make([]string, len(columns))
+		for i, col := range columns {
+			casts[i] = quoteIdent(col) + "::text"
+		}
+		q = fmt.Sprintf("SELECT %s FROM (%s) AS %s", strings.Join(casts, ", "), inner, quoteIdent("export"))
+	} else {
+		// Records have the JSON form they have in list responses.
+		obj := "row_to_json(" + quoteIdent("export") + ")"
+		if needsOutput(tbl, columns) {
+			obj = rowJSON(tbl, quoteIdent("export"), columns, "")
+		}
+		q = fmt.Sprintf("SELECT %s::text FROM (%s) AS %s", obj, inner, quoteIdent("export"))
+	}
+	return q, filterArgs
+}
+
+// handleExport handles GET /collections/{table}/export. Rows are streamed from
+// the database cursor to the response without a page limit, so memory use does
+// not grow with the result size.
+func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	tbl := h.resolveTable(w, r)
+	if tbl == nil {
+		return
+	}
+
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	ft, ok := exportFormats[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid format: must be csv, ndjson or json")
+		return
+	}
+
+	sc := h.schemaFor(r)
+
+	var filterSQL string
+	var filterArgs []any
+	if filterStr := q.Get("filter"); filterStr != "" {
+		var err error
+		filterSQL, filterArgs, err = parseFilterExpr(r.Context(), sc, tbl, filterStr, 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid filter: "+err.Error())
+			return
+		}
+	}
+	filterSQL, filterArgs, err := withRule(sc, tbl, ruleList, requestVars(r.Context(), nil), filterSQL, filterArgs)
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+
+	sorts := parseSort(sc, tbl, q.Get("sort"))
+	sortArgs, err := sortRules(sc, sorts, requestVars(r.Context(), nil), len(filterArgs))
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+
+	columns := exportColumns(tbl, parseFields(r))
+	query, args := buildExport(tbl, format, columns, filterSQL, append(filterArgs, sortArgs...), sortSQL(sorts))
+
+	querier, done, err := h.withRLS(r)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	rows, err := querier.Query(r.Context(), query, args...)
+	if err != nil {
+		done(err)
+		if !mapPGError(w, err) {
+			h.logger.Error("export error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	defer rows.Close()
+
+	// Fetch the first row before committing to a 200, so that query errors
+	// still get a proper error response.
+	hasRow := rows.Next()
+	if !hasRow && rows.Err() != nil {
+		err := rows.Err()
+		done(err)
+		if !mapPGError(w, err) {
+			h.logger.Error("export error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", ft.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", tbl.Name+"."+ft.ext))
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+
+	var (
+		values = make([]*string, len(columns))
+		ptrs   = make([]any, len(columns))
+		record = make([]string, len(columns))
+		line   string
+		n      int
+	)
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	switch format {
+	case "csv":
+		err = cw.Write(columns)
+	case "json":
+		_, err = bw.WriteString("[")
+	}
+
+	for ; hasRow && err == nil; hasRow = rows.Next() {
+		switch format {
+		case "csv":
+			if err = rows.Scan(ptrs...); err != nil {
+				break
+			}
+			for i, v := range values {
+				record[i] = ""
+				if v != nil {
+					record[i] = *v
+				}
+			}
+			err = cw.Write(record)
+		case "ndjson":
+			if err = rows.Scan(&line); err != nil {
+				break
+			}
+			_, err = bw.WriteString(line + "\n")
+		case "json":
+			if err = rows.Scan(&line); err != nil {
+				break
+			}
+			if n > 0 {
+				line = "," + line
+			}
+			_, err = bw.WriteString(line)
+		}
+
+		n++
+		if err == nil && n%exportFlushRows == 0 {
+			cw.Flush()
+			if err = bw.Flush(); err == nil {
+				_ = rc.Flush()
+			}
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil && format == "json" {
+		_, err = bw.WriteString("]\n")
+	}
+	if err == nil {
+		cw.Flush()
+		if err = cw.Error(); err == nil {
+			err = bw.Flush()
+		}
+	}
+
+	if err != nil {
+		// Headers are already sent; the client sees a truncated body.
+		rows.Close()
+		done(err)
+		h.logger.Error("export stream error", "error", err, "table", tbl.Name, "rows", n)
+		return
+	}
+	done(nil)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestExportColumns(t *testing.T) {
+	tbl := testTable()
+	testutil.Equal(t, quoteIdents(exportColumns(tbl, nil)), `"id", "name", "email", "age"`)
+	testutil.Equal(t, quoteIdents(exportColumns(tbl, []string{"email", "bogus", "id"})), `"email", "id"`)
+	// Only unknown fields: fall back to every column.
+	testutil.Equal(t, len(exportColumns(tbl, []string{"bogus"})), 4)
+}
+
+func TestBuildExportCSV(t *testing.T) {
+	tbl := testTable()
+	q, args := buildExport(tbl, "csv", []string{"id", "name"}, `"age" > $1`, []any{21}, `"name" ASC`)
+	testutil.Equal(t, q, `SELECT "id"::text, "name"::text FROM (SELECT "id", "name" FROM "public"."users" WHERE "age" > $1 ORDER BY "name" ASC) AS "export"`)
+	testutil.SliceLen(t, args, 1)
+}
+
+func TestBuildExportJSON(t *testing.T) {
+	tbl := testTable()
+	for _, format := range []string{"json", "ndjson"} {
+		q, args := buildExport(tbl, format, []string{"id"}, "", nil, "")
+		testutil.Equal(t, q, `SELECT row_to_json("export")::text FROM (SELECT "id" FROM "public"."users") AS "export"`)
+		testutil.SliceLen(t, args, 0)
+	}
+}
+
+func TestExportHandlerErrors(t *testing.T) {
+	h := testHandler(testSchema())
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		msg    string
+	}{
+		{"unknown table", "/collections/nope/export", http.StatusNotFound, "collection not found"},
+		{"bad format", "/collections/users/export?format=xml", http.StatusBadRequest, "invalid format"},
+		{"bad filter", "/collections/users/export?format=csv&filter=((", http.StatusBadRequest, "invalid filter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(h, "GET", tt.path, "")
+			testutil.Equal(t, tt.status, w.Code)
+			testutil.Contains(t, decodeError(t, w).Message, tt.msg)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -12,6 +14,26 @@ import (
 // parseFilter parses a filter expression string and returns parameterized SQL.
 // Example: "status='active' && age>25" → ("status" = $1 AND "age" > $2), ["active", 25]
 func parseFilter(tbl *schema.Table, input string) (string, []any, error) {
+	return parseFilterExpr(context.Background(), nil, tbl, input, 0)
+}
+
+// parseFilterExpr is parseFilter with two extensions. With a schema cache, dotted
+// paths such as "author.name" are resolved through relationships into EXISTS
+// subqueries, which only see the related rows the request may list. Placeholders
+// are numbered from argOffset+1, for filters embedded in a statement that
+// already has argOffset parameters.
+func parseFilterExpr(ctx context.Context, sc *schema.SchemaCache, tbl *schema.Table, input string, argOffset int) (string, []any, error) {
+	return runParser(&parser{tbl: tbl, sc: sc, argOffset: argOffset, reader: requestVars(ctx, nil)}, input)
+}
+
+// parseExpr parses a filter expression. The @request variables of access rules
+// are only allowed when vars is set.
+func parseExpr(sc *schema.SchemaCache, tbl *schema.Table, input string, argOffset int, vars *ruleVars) (string, []any, error) {
+	return runParser(&parser{tbl: tbl, sc: sc, argOffset: argOffset, vars: vars}, input)
+}
+
+// runParser parses input with p.
+func runParser(p *parser, input string) (string, []any, error) {
 	tokens, err := tokenize(input)
 	if err != nil {
 		return "", nil, err
@@ -19,13 +41,8 @@ func parseFilter(tbl *schema.Table, input string) (string, []any, error) {
 	if len(tokens) == 0 {
 		return "", nil, nil
 	}
-
-	p := &parser{
-		tokens: tokens,
-		pos:    0,
-		tbl:    tbl,
-		args:   make([]any, 0),
-	}
+	p.tokens = tokens
+	p.args = make([]any, 0)
 
 	node, err := p.parseExpression()
 	if err != nil {
@@ -44,18 +61,24 @@ func parseFilter(tbl *schema.Table, input string) (string, []any, error) {
 type tokenKind int
 
 const (
-	tokIdent  tokenKind = iota // column name
-	tokString                  // 'quoted string'
-	tokNumber                  // 123, 45.6
-	tokBool                    // true, false
-	tokNull                    // null
-	tokOp                      // =, !=, >, >=, <, <=, ~, !~
-	tokAnd                     // &&, AND
-	tokOr                      // ||, OR
-	tokIn                      // IN
-	tokLParen                  // (
-	tokRParen                  // )
-	tokComma                   // ,
+	tokIdent   tokenKind = iota // column name
+	tokString                   // 'quoted string'
+	tokNumber                   // 123, 45.6
+	tokBool                     // true, false
+	tokNull                     // null
+	tokOp                       // =, !=, >, >=, <, <=, ~, !~, ~*, !~*, ?-prefixed "any" variants, @>, <@, ?, ->, ->>
+	tokAnd                      // &&, AND
+	tokOr                       // ||, OR
+	tokIn                       // IN
+	tokNot                      // NOT, ! before a parenthesis
+	tokIs                       // IS
+	tokBetween                  // BETWEEN
+	tokLike                     // LIKE, ILIKE
+	tokArith                    // + and - in date arithmetic
+	tokLParen                   // (
+	tokRParen                   // )
+	tokComma                    // ,
+	tokVar                      // @request.auth.id, @request.body.x
 )
 
 type token struct {
@@ -112,10 +135,64 @@ func tokenize(input string) ([]token, error) {
 			continue
 		}
 
+		// "Any" operators (?=, ?!=, ?>, ...) match when at least one related row
+		// or array element does. A bare ? tests for a JSON key.
+		if ch == '?' {
+			rest := string(runes[i+1:])
+			matched := ""
+			for _, op := range []string{"!~*", "!=", ">=", "<=", "!~", "~*", "=", ">", "<", "~"} {
+				if strings.HasPrefix(rest, op) {
+					matched = op
+					break
+				}
+			}
+			tokens = append(tokens, token{tokOp, "?" + matched})
+			i += 1 + len(matched)
+			continue
+		}
+
+		// Negated group: !(...).
+		if ch == '!' {
+			j := i + 1
+			for j < len(runes) && unicode.IsSpace(runes[j]) {
+				j++
+			}
+			if j < len(runes) && runes[j] == '(' {
+				tokens = append(tokens, token{tokNot, "!"})
+				i++
+				continue
+			}
+		}
+
+		// Request variables, e.g. @request.auth.id.
+		if ch == '@' && i+1 < len(runes) && unicode.IsLetter(runes[i+1]) {
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokVar, string(runes[i:j])})
+			i = j
+			continue
+		}
+
+		// Three-char operators.
+		if i+2 < len(runes) {
+			three := string(runes[i : i+3])
+			if three == "->>" || three == "!~*" {
+				tokens = append(tokens, token{tokOp, three})
+				i += 3
+				continue
+			}
+		}
+
 		// Two-char operators.
 		if i+1 < len(runes) {
 			two := string(runes[i : i+2])
 			switch two {
+			case "->", "@>", "<@", "~*":
+				tokens = append(tokens, token{tokOp, two})
+				i += 2
+				continue
 			case "&&":
 				tokens = append(tokens, token{tokAnd, "&&"})
 				i += 2
@@ -164,6 +241,13 @@ func tokenize(input string) ([]token, error) {
 			continue
 		}
 
+		// Date arithmetic, e.g. now() - interval '7 days'.
+		if ch == '+' || ch == '-' {
+			tokens = append(tokens, token{tokArith, string(ch)})
+			i++
+			continue
+		}
+
 		// Identifiers and keywords.
 		if unicode.IsLetter(ch) || ch == '_' {
 			j := i
@@ -180,6 +264,14 @@ func tokenize(input string) ([]token, error) {
 				tokens = append(tokens, token{tokOr, "OR"})
 			case "IN":
 				tokens = append(tokens, token{tokIn, "IN"})
+			case "NOT":
+				tokens = append(tokens, token{tokNot, "NOT"})
+			case "IS":
+				tokens = append(tokens, token{tokIs, "IS"})
+			case "BETWEEN":
+				tokens = append(tokens, token{tokBetween, "BETWEEN"})
+			case "LIKE", "ILIKE":
+				tokens = append(tokens, token{tokLike, upper})
 			case "TRUE", "FALSE":
 				tokens = append(tokens, token{tokBool, strings.ToLower(word)})
 			case "NULL":
@@ -231,10 +323,47 @@ func (n *comparisonNode) toSQL() string {
 type inNode struct {
 	column    string
 	paramRefs []string
+	negate    bool
 }
 
 func (n *inNode) toSQL() string {
-	return n.column + " IN (" + strings.Join(n.paramRefs, ", ") + ")"
+	op := " IN ("
+	if n.negate {
+		op = " NOT IN ("
+	}
+	return n.column + op + strings.Join(n.paramRefs, ", ") + ")"
+}
+
+type betweenNode struct {
+	column string
+	low    string
+	high   string
+	negate bool
+}
+
+func (n *betweenNode) toSQL() string {
+	op := " BETWEEN "
+	if n.negate {
+		op = " NOT BETWEEN "
+	}
+	return n.column + op + n.low + " AND " + n.high
+}
+
+type notNode struct {
+	inner filterNode
+}
+
+func (n *notNode) toSQL() string {
+	return "NOT (" + n.inner.toSQL() + ")"
+}
+
+// rawNode is a condition already rendered to SQL, such as a relation subquery.
+type rawNode struct {
+	sql string
+}
+
+func (n *rawNode) toSQL() string {
+	return n.sql
 }
 
 type isNullNode struct {
@@ -251,10 +380,17 @@ func (n *isNullNode) toSQL() string {
 
 // parser is a recursive descent parser for filter expressions.
 type parser struct {
-	tokens []token
-	pos    int
-	tbl    *schema.Table
-	args   []any
+	tokens    []token
+	pos       int
+	tbl       *schema.Table
+	sc        *schema.SchemaCache // resolves relation paths; nil disables them
+	args      []any
+	argOffset int       // placeholders start at $argOffset+1
+	aliases   int       // subquery aliases handed out so far
+	vars      *ruleVars // values of @request variables; nil outside access rules
+	// reader is the request whose list rules limit the rows relation paths
+	// reach. Access rules, written by admins, see every row.
+	reader *ruleVars
 }
 
 func (p *parser) peek() *token {
@@ -272,7 +408,7 @@ func (p *parser) advance() token {
 
 func (p *parser) addArg(val any) string {
 	p.args = append(p.args, val)
-	return fmt.Sprintf("$%d", len(p.args))
+	return fmt.Sprintf("$%d", p.argOffset+len(p.args))
 }
 
 // expression = and_expr
@@ -326,7 +462,7 @@ func (p *parser) parseAndExpr() (filterNode, error) {
 	return left, nil
 }
 
-// primary = comparison | "(" expression ")"
+// primary = comparison | "(" expression ")" | ("NOT" | "!") primary | "true" | "false"
 func (p *parser) parsePrimary() (filterNode, error) {
 	t := p.peek()
 	if t == nil {
@@ -348,101 +484,469 @@ func (p *parser) parsePrimary() (filterNode, error) {
 		return node, nil
 	}
 
+	// Negated primary: NOT (...) or !(...).
+	if t.kind == tokNot {
+		p.advance()
+		inner, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+	}
+
+	// A bare boolean, as in a rule that allows or denies everything.
+	if t.kind == tokBool {
+		p.advance()
+		return &rawNode{sql: strings.ToUpper(t.value)}, nil
+	}
+
 	// Must be a comparison: identifier op value
 	return p.parseComparison()
 }
 
-// comparison = identifier op value | identifier "IN" "(" value ("," value)* ")"
+// operand is the left-hand side of a condition: a column, optionally followed
+// by a JSON path.
+type operand struct {
+	sql      string // SQL expression
+	name     string // as written, for error messages
+	json     bool   // jsonb-valued: a JSON column or a -> path into one
+	array    bool   // a Postgres array column
+	typeName string // the array column's type, e.g. "text[]"
+}
+
+// sqlExpr is a value rendered as SQL rather than bound as a parameter, such as
+// now() or now() - $1::interval.
+type sqlExpr string
+
+// comparison = path op value
+//
+//	| path ["NOT"] "IN" "(" value ("," value)* ")"
+//	| path ["NOT"] "BETWEEN" value "AND" value
+//	| path ["NOT"] ("LIKE" | "ILIKE") value
+//	| path "IS" ["NOT"] "NULL"
+//
+// path       = identifier (("->" | "->>") key)* | variable
 func (p *parser) parseComparison() (filterNode, error) {
 	t := p.peek()
+	if t != nil && t.kind == tokVar {
+		return p.parseVarComparison()
+	}
 	if t == nil || t.kind != tokIdent {
 		return nil, fmt.Errorf("expected column name, got %v", t)
 	}
 	ident := p.advance()
 
-	// Validate column against schema.
-	col := p.tbl.ColumnByName(ident.value)
-	if col == nil {
-		return nil, fmt.Errorf("unknown column: %s", ident.value)
+	// Validate column against schema, following relation paths.
+	col, quotedCol, hops, err := resolvePath(p.sc, p.tbl, ident.value, "r", &p.aliases)
+	if err != nil {
+		return nil, err
+	}
+	if p.reader != nil {
+		for i := range hops {
+			ruleSQL, ruleArgs, err := ruleFilter(p.sc, hops[i].table, ruleList, p.reader, p.argOffset+len(p.args))
+			if err != nil {
+				return nil, err
+			}
+			hops[i].where = ruleSQL
+			p.args = append(p.args, ruleArgs...)
+		}
+	}
+
+	lhs := operand{sql: quotedCol, name: ident.value, json: col.IsJSON, array: col.IsArray, typeName: col.TypeName}
+	if col.IsJSON && strings.EqualFold(col.TypeName, "json") {
+		// json has no comparison or containment operators; jsonb does.
+		lhs.sql += "::jsonb"
+	}
+	if err := p.parseJSONPath(&lhs); err != nil {
+		return nil, err
 	}
-	quotedCol := quoteIdent(ident.value)
 
-	// Check for IN.
-	next := p.peek()
-	if next != nil && next.kind == tokIn {
-		p.advance() // consume IN
+	node, anyMatch, err := p.parseCondition(lhs)
+	if err != nil {
+		return nil, err
+	}
+	if len(hops) > 0 {
+		return &rawNode{sql: wrapRelated(hops, node.toSQL(), anyMatch)}, nil
+	}
+	return node, nil
+}
 
-		lp := p.peek()
-		if lp == nil || lp.kind != tokLParen {
-			return nil, fmt.Errorf("expected '(' after IN")
+// parseVarComparison parses a condition on a request variable, such as
+// @request.body.status = 'draft'. The variable's value is bound as a parameter,
+// cast to the SQL type matching its JSON type.
+func (p *parser) parseVarComparison() (filterNode, error) {
+	name := p.advance().value
+	val, err := p.varValue(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := val.(sqlExpr); ok {
+		val = nil // unset
+	}
+	ref := p.addArg(val)
+	switch val.(type) {
+	case int64:
+		ref += "::bigint"
+	case float64:
+		ref += "::float8"
+	case bool:
+		ref += "::boolean"
+	default:
+		ref += "::text"
+	}
+	node, _, err := p.parseCondition(operand{sql: ref, name: name})
+	return node, err
+}
+
+// varValue returns the value of a request variable. A variable without a value,
+// such as a field missing from the body, is SQL NULL, so comparisons with it
+// are never true.
+func (p *parser) varValue(name string) (any, error) {
+	if p.vars == nil {
+		return nil, fmt.Errorf("%s is only allowed in access rules", name)
+	}
+	val, err := p.vars.lookup(name)
+	if err != nil || val != nil {
+		return val, err
+	}
+	return sqlExpr("NULL"), nil
+}
+
+// parseJSONPath applies any -> and ->> steps following a column. Keys are
+// strings for object fields or integers for array elements, and are bound as
+// parameters. ->> yields text and ends the path.
+func (p *parser) parseJSONPath(lhs *operand) error {
+	for {
+		t := p.peek()
+		if t == nil || t.kind != tokOp || (t.value != "->" && t.value != "->>") {
+			return nil
 		}
-		p.advance()
+		if !lhs.json {
+			return fmt.Errorf("%s requires a JSON column: %s", t.value, lhs.name)
+		}
+		op := p.advance().value
 
-		var paramRefs []string
-		for {
-			val, err := p.parseValue()
+		key := p.peek()
+		var ref string
+		switch {
+		case key != nil && key.kind == tokString:
+			p.advance()
+			ref = p.addArg(key.value) + "::text"
+		case key != nil && key.kind == tokNumber && !strings.Contains(key.value, "."):
+			p.advance()
+			n, err := strconv.ParseInt(key.value, 10, 32)
 			if err != nil {
-				return nil, err
+				return fmt.Errorf("invalid JSON array index: %s", key.value)
 			}
-			ref := p.addArg(val)
-			paramRefs = append(paramRefs, ref)
+			ref = p.addArg(n) + "::int"
+		default:
+			return fmt.Errorf("expected key or index after %s", op)
+		}
 
-			next := p.peek()
-			if next == nil {
-				return nil, fmt.Errorf("expected ')' to close IN list")
-			}
-			if next.kind == tokRParen {
-				p.advance()
-				break
-			}
-			if next.kind != tokComma {
-				return nil, fmt.Errorf("expected ',' or ')' in IN list")
-			}
+		lhs.sql = "(" + lhs.sql + " " + op + " " + ref + ")"
+		lhs.name += op
+		lhs.json = op == "->"
+	}
+}
+
+// parseCondition parses the operator and value(s) following a column reference.
+// anyMatch reports whether a ?-prefixed operator was used.
+func (p *parser) parseCondition(lhs operand) (node filterNode, anyMatch bool, err error) {
+	next := p.peek()
+	if next == nil {
+		return nil, false, fmt.Errorf("expected operator after column %s", lhs.name)
+	}
+
+	// IS [NOT] NULL.
+	if next.kind == tokIs {
+		p.advance()
+		isNull := true
+		if t := p.peek(); t != nil && t.kind == tokNot {
 			p.advance()
+			isNull = false
+		}
+		if t := p.peek(); t == nil || t.kind != tokNull {
+			return nil, false, fmt.Errorf("expected NULL after IS")
+		}
+		p.advance()
+		return &isNullNode{column: lhs.sql, isNull: isNull}, false, nil
+	}
+
+	negate := false
+	if next.kind == tokNot {
+		p.advance()
+		negate = true
+		next = p.peek()
+		if next == nil || (next.kind != tokIn && next.kind != tokBetween && next.kind != tokLike) {
+			return nil, false, fmt.Errorf("expected IN, BETWEEN, LIKE or ILIKE after NOT")
+		}
+	}
+
+	switch next.kind {
+	case tokIn:
+		p.advance() // consume IN
+		vals, err := p.parseValueList("IN")
+		if err != nil {
+			return nil, false, err
+		}
+		paramRefs := make([]string, len(vals))
+		for i, val := range vals {
+			paramRefs[i] = p.valueSQL(lhs, val)
+		}
+		return &inNode{column: lhs.sql, paramRefs: paramRefs, negate: negate}, false, nil
+
+	case tokBetween:
+		p.advance()
+		low, err := p.parseValue()
+		if err != nil {
+			return nil, false, err
 		}
+		if t := p.peek(); t == nil || t.kind != tokAnd {
+			return nil, false, fmt.Errorf("expected AND in BETWEEN")
+		}
+		p.advance()
+		high, err := p.parseValue()
+		if err != nil {
+			return nil, false, err
+		}
+		if low == nil || high == nil {
+			return nil, false, fmt.Errorf("BETWEEN bounds cannot be null")
+		}
+		return &betweenNode{column: lhs.sql, low: p.valueSQL(lhs, low), high: p.valueSQL(lhs, high), negate: negate}, false, nil
 
-		return &inNode{column: quotedCol, paramRefs: paramRefs}, nil
+	case tokLike:
+		op := p.advance().value
+		if negate {
+			op = "NOT " + op
+		}
+		return p.parseMatch(lhs, op, false)
 	}
 
-	// Regular comparison operator.
-	opTok := p.peek()
-	if opTok == nil || opTok.kind != tokOp {
-		return nil, fmt.Errorf("expected operator after column %s", ident.value)
+	// Array overlap: && directly after a column is an operator, not AND.
+	if next.kind == tokAnd && next.value == "&&" {
+		p.advance()
+		return p.parseContainment(lhs, "&&")
+	}
+
+	if next.kind != tokOp {
+		return nil, false, fmt.Errorf("expected operator after column %s", lhs.name)
 	}
 	op := p.advance()
+	opValue := op.value
+
+	switch opValue {
+	case "@>", "<@":
+		return p.parseContainment(lhs, opValue)
+	case "?":
+		if !lhs.json {
+			return nil, false, fmt.Errorf("? requires a JSON column: %s", lhs.name)
+		}
+		key := p.peek()
+		if key == nil || key.kind != tokString {
+			return nil, false, fmt.Errorf("expected key after ?")
+		}
+		p.advance()
+		return &comparisonNode{column: lhs.sql, op: "?", paramRef: p.addArg(key.value) + "::text"}, false, nil
+	case "->", "->>":
+		return nil, false, fmt.Errorf("unexpected %s after ->>", opValue)
+	}
+
+	if strings.HasPrefix(opValue, "?") {
+		anyMatch = true
+		opValue = opValue[1:]
+	}
+
+	// Map ~ and !~ to LIKE/NOT LIKE (PocketBase compatibility), ~* and !~* to
+	// their case-insensitive forms.
+	switch opValue {
+	case "~":
+		return p.parseMatch(lhs, "LIKE", anyMatch)
+	case "!~":
+		return p.parseMatch(lhs, "NOT LIKE", anyMatch)
+	case "~*":
+		return p.parseMatch(lhs, "ILIKE", anyMatch)
+	case "!~*":
+		return p.parseMatch(lhs, "NOT ILIKE", anyMatch)
+	}
 
 	// Parse value.
 	val, err := p.parseValue()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// Handle null comparisons specially.
 	if val == nil {
-		switch op.value {
+		switch opValue {
 		case "=":
-			return &isNullNode{column: quotedCol, isNull: true}, nil
+			return &isNullNode{column: lhs.sql, isNull: true}, anyMatch, nil
 		case "!=":
-			return &isNullNode{column: quotedCol, isNull: false}, nil
+			return &isNullNode{column: lhs.sql, isNull: false}, anyMatch, nil
 		default:
-			return nil, fmt.Errorf("null can only be compared with = or !=")
+			return nil, false, fmt.Errorf("null can only be compared with = or !=")
 		}
 	}
 
-	// Map ~ and !~ to LIKE/NOT LIKE (PocketBase compatibility).
-	sqlOp := op.value
-	switch op.value {
-	case "~":
-		sqlOp = "LIKE"
-	case "!~":
-		sqlOp = "NOT LIKE"
+	if lhs.array {
+		if !anyMatch {
+			return nil, false, fmt.Errorf("operator %s is not supported on array column %s; use ?%s to match any element", opValue, lhs.name, opValue)
+		}
+		// value <op> ANY(column), with the operator mirrored so that it still
+		// reads element <op> value.
+		return &comparisonNode{column: p.valueSQL(operand{}, val), op: mirroredOps[opValue], paramRef: "ANY(" + lhs.sql + ")"}, true, nil
 	}
 
-	ref := p.addArg(val)
-	return &comparisonNode{column: quotedCol, op: sqlOp, paramRef: ref}, nil
+	return &comparisonNode{column: lhs.sql, op: opValue, paramRef: p.valueSQL(lhs, val)}, anyMatch, nil
+}
+
+// mirroredOps maps a comparison operator to the one with its operands swapped.
+var mirroredOps = map[string]string{
+	"=": "=", "!=": "!=", ">": "<", ">=": "<=", "<": ">", "<=": ">=",
+}
+
+// parseMatch parses the pattern of a LIKE-family operator. On an array column,
+// a ?-prefixed match tests each element.
+func (p *parser) parseMatch(lhs operand, op string, anyMatch bool) (filterNode, bool, error) {
+	val, err := p.parseValue()
+	if err != nil {
+		return nil, false, err
+	}
+	pattern, ok := val.(string)
+	if !ok {
+		return nil, false, fmt.Errorf("%s requires a string pattern", op)
+	}
+	if lhs.json {
+		return nil, false, fmt.Errorf("%s requires a text value; use ->> to compare JSON as text: %s", op, lhs.name)
+	}
+	if lhs.array && !anyMatch {
+		return nil, false, fmt.Errorf("%s is not supported on array column %s; use ?~ to match any element", op, lhs.name)
+	}
+	ref := p.addArg(pattern)
+	if lhs.array {
+		return &rawNode{sql: fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(%s) AS e(v) WHERE v::text %s %s)", lhs.sql, op, ref)}, true, nil
+	}
+	return &comparisonNode{column: lhs.sql, op: op, paramRef: ref}, anyMatch, nil
+}
+
+// parseContainment parses the value of @>, <@ or &&. Array columns take a
+// parenthesized list (or a single value) bound as an array literal; JSON
+// operands of @> and <@ take a JSON document as a string.
+func (p *parser) parseContainment(lhs operand, op string) (filterNode, bool, error) {
+	switch {
+	case lhs.array:
+		var vals []any
+		if t := p.peek(); t != nil && t.kind == tokLParen {
+			p.advance()
+			var err error
+			if vals, err = p.parseValues(op); err != nil {
+				return nil, false, err
+			}
+		} else {
+			val, err := p.parseValue()
+			if err != nil {
+				return nil, false, err
+			}
+			vals = []any{val}
+		}
+		lit, err := arrayLiteral(vals)
+		if err != nil {
+			return nil, false, err
+		}
+		ref := p.addArg(lit)
+		if lhs.typeName != "" {
+			ref += "::" + lhs.typeName
+		}
+		return &comparisonNode{column: lhs.sql, op: op, paramRef: ref}, false, nil
+
+	case lhs.json && op != "&&":
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, false, err
+		}
+		doc, ok := val.(string)
+		if !ok || !json.Valid([]byte(doc)) {
+			return nil, false, fmt.Errorf("%s requires a JSON document string", op)
+		}
+		return &comparisonNode{column: lhs.sql, op: op, paramRef: p.addArg(doc) + "::jsonb"}, false, nil
+	}
+
+	if op == "&&" {
+		return nil, false, fmt.Errorf("&& requires an array column: %s", lhs.name)
+	}
+	return nil, false, fmt.Errorf("%s requires an array or JSON column: %s", op, lhs.name)
+}
+
+// parseValueList parses a parenthesized, comma-separated list of values
+// following the named operator.
+func (p *parser) parseValueList(op string) ([]any, error) {
+	lp := p.peek()
+	if lp == nil || lp.kind != tokLParen {
+		return nil, fmt.Errorf("expected '(' after %s", op)
+	}
+	p.advance()
+	return p.parseValues(op)
 }
 
-// parseValue parses a literal value token.
+// parseValues parses values up to and including the closing parenthesis of a list.
+func (p *parser) parseValues(op string) ([]any, error) {
+	var vals []any
+	for {
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+
+		next := p.peek()
+		if next == nil {
+			return nil, fmt.Errorf("expected ')' to close %s list", op)
+		}
+		if next.kind == tokRParen {
+			p.advance()
+			return vals, nil
+		}
+		if next.kind != tokComma {
+			return nil, fmt.Errorf("expected ',' or ')' in %s list", op)
+		}
+		p.advance()
+	}
+}
+
+// valueSQL returns the SQL for a value compared with lhs: the expression
+// itself for a date function, otherwise a new placeholder. Values compared
+// with JSON are bound as JSON documents, so 'red' matches the string "red".
+func (p *parser) valueSQL(lhs operand, val any) string {
+	if expr, ok := val.(sqlExpr); ok {
+		return string(expr)
+	}
+	if lhs.json {
+		doc, _ := json.Marshal(val)
+		return p.addArg(string(doc)) + "::jsonb"
+	}
+	return p.addArg(val)
+}
+
+// arrayLiteral renders values as a Postgres array literal such as {"a","b"},
+// so the whole list binds to one parameter cast to the column's array type.
+func arrayLiteral(vals []any) (string, error) {
+	elems := make([]string, len(vals))
+	for i, v := range vals {
+		switch v := v.(type) {
+		case nil:
+			elems[i] = "NULL"
+		case string:
+			elems[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		case sqlExpr:
+			return "", fmt.Errorf("functions are not allowed in array values")
+		default:
+			elems[i] = fmt.Sprint(v)
+		}
+	}
+	return "{" + strings.Join(elems, ",") + "}", nil
+}
+
+// parseValue parses a literal value token, or a date function:
+// now() [("+" | "-") interval 'text'].
 func (p *parser) parseValue() (any, error) {
 	t := p.peek()
 	if t == nil {
@@ -473,7 +977,45 @@ func (p *parser) parseValue() (any, error) {
 	case tokNull:
 		p.advance()
 		return nil, nil
+	case tokVar:
+		p.advance()
+		return p.varValue(t.value)
+	case tokIdent:
+		if strings.EqualFold(t.value, "now") {
+			return p.parseNow()
+		}
+		return nil, fmt.Errorf("expected value, got %s", t.value)
 	default:
 		return nil, fmt.Errorf("expected value, got %s", t.value)
 	}
 }
+
+// parseNow parses now() with an optional interval offset. The interval text is
+// bound as a parameter.
+func (p *parser) parseNow() (any, error) {
+	p.advance() // now
+	if t := p.peek(); t == nil || t.kind != tokLParen {
+		return nil, fmt.Errorf("expected '(' after now")
+	}
+	p.advance()
+	if t := p.peek(); t == nil || t.kind != tokRParen {
+		return nil, fmt.Errorf("now() takes no arguments")
+	}
+	p.advance()
+
+	op := p.peek()
+	if op == nil || op.kind != tokArith {
+		return sqlExpr("now()"), nil
+	}
+	p.advance()
+	if t := p.peek(); t == nil || t.kind != tokIdent || !strings.EqualFold(t.value, "interval") {
+		return nil, fmt.Errorf("expected interval after now() %s", op.value)
+	}
+	p.advance()
+	iv := p.peek()
+	if iv == nil || iv.kind != tokString {
+		return nil, fmt.Errorf("expected quoted interval, e.g. interval '7 days'")
+	}
+	p.advance()
+	return sqlExpr("(now() " + op.value + " " + p.addArg(iv.value) + "::interval)"), nil
+}
@@ -119,6 +119,14 @@ func TestTokenizeOperators(t *testing.T) {
 		{"a<=1", "<="},
 		{"a~'x'", "~"},
 		{"a!~'x'", "!~"},
+		{"a~*'x'", "~*"},
+		{"a!~*'x'", "!~*"},
+		{"a@>'x'", "@>"},
+		{"a<@'x'", "<@"},
+		{"a->'x'", "->"},
+		{"a->>'x'", "->>"},
+		{"a?'x'", "?"},
+		{"a?~*'x'", "?~*"},
 	}
 
 	for _, tc := range tests {
@@ -129,6 +137,35 @@ func TestTokenizeOperators(t *testing.T) {
 	}
 }
 
+func TestTokenizeKeywords(t *testing.T) {
+	tokens, err := tokenize("NOT a IS null AND b between 1 and 2 OR c ilike 'x'")
+	testutil.NoError(t, err)
+	testutil.Equal(t, tokens[0].kind, tokNot)
+	testutil.Equal(t, tokens[2].kind, tokIs)
+	testutil.Equal(t, tokens[6].kind, tokBetween)
+	testutil.Equal(t, tokens[12].kind, tokLike)
+	testutil.Equal(t, tokens[12].value, "ILIKE")
+}
+
+func TestTokenizeNegatedGroup(t *testing.T) {
+	tokens, err := tokenize("!(a=1)")
+	testutil.NoError(t, err)
+	testutil.Equal(t, tokens[0].kind, tokNot)
+	testutil.Equal(t, tokens[1].kind, tokLParen)
+
+	_, err = tokenize("a ! 1")
+	testutil.True(t, err != nil, "expected error for bare !")
+}
+
+func TestTokenizeDateArithmetic(t *testing.T) {
+	tokens, err := tokenize("created_at>now()-interval '7 days'")
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, tokens, 8)
+	testutil.Equal(t, tokens[5].kind, tokArith)
+	testutil.Equal(t, tokens[5].value, "-")
+	testutil.Equal(t, tokens[7].value, "7 days")
+}
+
 func TestTokenizeFloat(t *testing.T) {
 	tokens, err := tokenize("age>3.14")
 	testutil.NoError(t, err)
@@ -319,6 +356,109 @@ func TestParseFilterOperatorPrecedence(t *testing.T) {
 	testutil.SliceLen(t, args, 3)
 }
 
+func advancedFilterTable() *schema.Table {
+	return &schema.Table{
+		Schema: "public",
+		Name:   "items",
+		Kind:   "table",
+		Columns: []*schema.Column{
+			{Name: "id", Position: 1, TypeName: "integer", IsPrimaryKey: true},
+			{Name: "name", Position: 2, TypeName: "text"},
+			{Name: "meta", Position: 3, TypeName: "jsonb", IsJSON: true},
+			{Name: "legacy", Position: 4, TypeName: "json", IsJSON: true},
+			{Name: "tags", Position: 5, TypeName: "text[]", IsArray: true},
+			{Name: "scores", Position: 6, TypeName: "integer[]", IsArray: true},
+			{Name: "created_at", Position: 7, TypeName: "timestamp with time zone"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+}
+
+func TestParseFilterAdvanced(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		sql   string
+		args  []any
+	}{
+		{"between", "id BETWEEN 1 AND 10", `"id" BETWEEN $1 AND $2`, []any{int64(1), int64(10)}},
+		{"not between", "id not between 1 and 10", `"id" NOT BETWEEN $1 AND $2`, []any{int64(1), int64(10)}},
+		{"between then and", "id BETWEEN 1 AND 10 AND name='a'", `("id" BETWEEN $1 AND $2 AND "name" = $3)`, []any{int64(1), int64(10), "a"}},
+		{"is null", "name IS NULL", `"name" IS NULL`, nil},
+		{"is not null", "name is not null", `"name" IS NOT NULL`, nil},
+		{"ilike operator", "name~*'al%'", `"name" ILIKE $1`, []any{"al%"}},
+		{"not ilike operator", "name!~*'al%'", `"name" NOT ILIKE $1`, []any{"al%"}},
+		{"like keyword", "name LIKE 'a%'", `"name" LIKE $1`, []any{"a%"}},
+		{"not ilike keyword", "name NOT ILIKE 'a%'", `"name" NOT ILIKE $1`, []any{"a%"}},
+		{"not in", "id NOT IN (1, 2)", `"id" NOT IN ($1, $2)`, []any{int64(1), int64(2)}},
+		{"not group", "NOT (id=1 || name='a')", `NOT (("id" = $1 OR "name" = $2))`, []any{int64(1), "a"}},
+		{"bang group", "!(id=1) && name='a'", `(NOT ("id" = $1) AND "name" = $2)`, []any{int64(1), "a"}},
+		{"json text path", "meta->>'color'='red'", `("meta" ->> $1::text) = $2`, []any{"color", "red"}},
+		{"json nested path", "meta->'dims'->>0 > '5'", `(("meta" -> $1::text) ->> $2::int) > $3`, []any{"dims", int64(0), "5"}},
+		{"json path value", "meta->'count'=5", `("meta" -> $1::text) = $2::jsonb`, []any{"count", `5`}},
+		{"json path string value", "meta->'color'='red'", `("meta" -> $1::text) = $2::jsonb`, []any{"color", `"red"`}},
+		{"json column cast", "legacy->>'a' IS NULL", `("legacy"::jsonb ->> $1::text) IS NULL`, []any{"a"}},
+		{"json contains", `meta@>'{"a":1}'`, `"meta" @> $1::jsonb`, []any{`{"a":1}`}},
+		{"json key exists", "meta ? 'color'", `"meta" ? $1::text`, []any{"color"}},
+		{"json path key exists", "meta->'dims' ? 'w'", `("meta" -> $1::text) ? $2::text`, []any{"dims", "w"}},
+		{"array contains list", "tags @> ('a', 'b\"c')", `"tags" @> $1::text[]`, []any{`{"a","b\"c"}`}},
+		{"array contains single", "scores @> 5", `"scores" @> $1::integer[]`, []any{`{5}`}},
+		{"array contained by", "tags <@ ('a', 'b')", `"tags" <@ $1::text[]`, []any{`{"a","b"}`}},
+		{"array overlap", "tags && ('a', 'b') && id=1", `("tags" && $1::text[] AND "id" = $2)`, []any{`{"a","b"}`, int64(1)}},
+		{"array any", "tags ?= 'go'", `$1 = ANY("tags")`, []any{"go"}},
+		{"array any mirrored", "scores ?> 5", `$1 < ANY("scores")`, []any{int64(5)}},
+		{"array any like", "tags ?~ 'g%'", `EXISTS (SELECT 1 FROM unnest("tags") AS e(v) WHERE v::text LIKE $1)`, []any{"g%"}},
+		{"now", "created_at < now()", `"created_at" < now()`, nil},
+		{"now minus interval", "created_at > now() - interval '7 days'", `"created_at" > (now() - $1::interval)`, []any{"7 days"}},
+		{"between dates", "created_at BETWEEN now()-interval '1 day' AND now()", `"created_at" BETWEEN (now() - $1::interval) AND now()`, []any{"1 day"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sql, args, err := parseFilter(advancedFilterTable(), tc.input)
+			testutil.NoError(t, err)
+			testutil.Equal(t, sql, tc.sql)
+			testutil.SliceLen(t, args, len(tc.args))
+			for i := range tc.args {
+				testutil.Equal(t, args[i], tc.args[i])
+			}
+		})
+	}
+}
+
+func TestParseFilterAdvancedErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"path on text", "name->>'a'='b'", "requires a JSON column"},
+		{"key exists on text", "name ? 'a'", "requires a JSON column"},
+		{"contains on text", "name @> 'a'", "requires an array or JSON column"},
+		{"overlap on json", "meta && ('a')", "requires an array column"},
+		{"invalid json document", "meta @> 'nope'", "requires a JSON document"},
+		{"like on jsonb", "meta->'a' ~ 'x'", "use ->>"},
+		{"scalar op on array", "tags = 'a'", "not supported on array column"},
+		{"like on array", "tags ~ 'a%'", "not supported on array column"},
+		{"is without null", "name IS 'a'", "expected NULL"},
+		{"not without operator", "name NOT = 'a'", "after NOT"},
+		{"between missing and", "id BETWEEN 1 10", "expected AND"},
+		{"between null", "id BETWEEN null AND 1", "cannot be null"},
+		{"interval without now", "created_at > interval '1 day'", "expected value"},
+		{"now with args", "created_at > now(1)", "no arguments"},
+		{"now missing interval", "created_at > now() - '1 day'", "expected interval"},
+		{"path missing key", "meta->", "expected key"},
+		{"bad array index", "meta->1.5", "expected key"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := parseFilter(advancedFilterTable(), tc.input)
+			testutil.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
 // --- parseSortSQL tests ---
 
 func TestParseSortSQLEmpty(t *testing.T) {
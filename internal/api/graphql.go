@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/allyourbase/ayb/internal/httputil"
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// gqlRequest is a GraphQL request, sent as a JSON body or as query parameters.
+type gqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// gqlResponse is a GraphQL response. Data is omitted when the request failed
+// before execution, and null when execution failed.
+type gqlResponse struct {
+	Data   any         `json:"data,omitempty"`
+	Errors []*gqlError `json:"errors,omitempty"`
+}
+
+// graphQLSchemaCache holds the GraphQL schemas generated from one schema
+// cache, one for each role that columns are restricted for.
+type graphQLSchemaCache struct {
+	sc      *schema.SchemaCache // unrestricted
+	schemas sync.Map            // *schema.SchemaCache for a role -> *gqlSchema
+}
+
+// graphQLSchema returns the GraphQL schema for sc, generating it again when
+// the schema cache has been reloaded.
+func (h *Handler) graphQLSchema(sc *schema.SchemaCache) *gqlSchema {
+	cached := h.graphql.Load()
+	if cached == nil || cached.sc != sc.Unrestricted() {
+		cached = &graphQLSchemaCache{sc: sc.Unrestricted()}
+		h.graphql.Store(cached)
+	}
+	if s, ok := cached.schemas.Load(sc); ok {
+		return s.(*gqlSchema)
+	}
+	s, _ := cached.schemas.LoadOrStore(sc, buildGraphQLSchema(sc))
+	return s.(*gqlSchema)
+}
+
+// handleGraphQL handles POST /graphql and GET /graphql?query=...
+// Queries run under one withRLS querier. A mutation's fields run in order in a
+// single transaction: if any fails, none is applied, and realtime events are
+// published only after it commits.
+func (h *Handler) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	sc := h.schemaFor(r)
+	if sc == nil {
+		writeError(w, http.StatusServiceUnavailable, "schema cache not ready")
+		return
+	}
+
+	var req gqlRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := decodeJSONNumbers(strings.NewReader(v), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables: must be a JSON object")
+				return
+			}
+		}
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, httputil.MaxBodySize)
+		if err := decodeJSONNumbers(r.Body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		writeGraphQLErrors(w, err)
+		return
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		writeGraphQLErrors(w, err)
+		return
+	}
+	switch {
+	case op.kind == "subscription":
+		writeGraphQLErrors(w, errors.New("subscriptions are not supported: use the realtime endpoint"))
+		return
+	case op.kind == "mutation" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusMethodNotAllowed, gqlResponse{Errors: []*gqlError{{Message: "mutations must be sent with POST"}}})
+		return
+	}
+
+	e := &gqlExecutor{h: h, ctx: r.Context(), sc: sc, s: h.graphQLSchema(sc), doc: doc}
+	if err := e.coerceVariables(op, req.Variables); err != nil {
+		writeGraphQLErrors(w, err)
+		return
+	}
+	if op.kind == "mutation" {
+		e.open = func() (Querier, func(error) error, error) {
+			tx, err := h.beginTx(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			return tx, func(err error) error {
+				if err != nil {
+					_ = tx.Rollback(r.Context())
+					return nil
+				}
+				return tx.Commit(r.Context())
+			}, nil
+		}
+	} else {
+		e.open = func() (Querier, func(error) error, error) {
+			q, done, err := h.withRLS(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			return q, func(err error) error { done(err); return nil }, nil
+		}
+	}
+
+	data, err := e.execute(op)
+	if commitErr := e.finish(err); err == nil && commitErr != nil {
+		h.logger.Error("graphql commit error", "error", commitErr)
+		err = &gqlError{Message: "internal error"}
+	}
+	if err != nil {
+		var gerr *gqlError
+		if !errors.As(err, &gerr) {
+			gerr = &gqlError{Message: err.Error()}
+		}
+		writeJSON(w, http.StatusOK, gqlResponse{Data: json.RawMessage("null"), Errors: []*gqlError{gerr}})
+		return
+	}
+
+	for _, ev := range e.events {
+		h.publishEvents(ev.action, ev.table, ev.records)
+	}
+	writeJSON(w, http.StatusOK, gqlResponse{Data: data})
+}
+
+// decodeJSONNumbers decodes JSON keeping numbers as json.Number, so that
+// integers and numerics in variables and request bodies keep their precision.
+func decodeJSONNumbers(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// writeGraphQLErrors responds to a request that could not be executed.
+func writeGraphQLErrors(w http.ResponseWriter, err error) {
+	gerr := &gqlError{Message: err.Error()}
+	var syntaxErr *gqlSyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		gerr.Message = "syntax error: " + syntaxErr.msg
+		gerr.Locations = []gqlLocation{{Line: syntaxErr.pos.line, Column: syntaxErr.pos.column}}
+	default:
+		errors.As(err, &gerr)
+	}
+	writeJSON(w, http.StatusBadRequest, gqlResponse{Errors: []*gqlError{gerr}})
+}
+
+// selectOperation returns the operation to execute: the one named, or the
+// only one in the document.
+func selectOperation(doc *gqlDocument, name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, errors.New("operationName is required for documents with several operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// coerceVariables checks the provided variables against the operation's
+// definitions and fills in defaults.
+func (e *gqlExecutor) coerceVariables(op *gqlOperation, provided map[string]any) error {
+	e.declared = make(map[string]bool, len(op.variables))
+	e.vars = make(map[string]any, len(op.variables))
+	for _, def := range op.variables {
+		if e.declared[def.name] {
+			return &gqlError{Message: fmt.Sprintf("variable $%s is defined more than once", def.name)}
+		}
+		e.declared[def.name] = true
+
+		typ, err := e.inputType(def.typ)
+		if err != nil {
+			return &gqlError{Message: fmt.Sprintf("variable $%s: %s", def.name, err)}
+		}
+		v, ok := provided[def.name]
+		if !ok && def.defaultValue != nil {
+			if v, err = e.literal(def.defaultValue); err != nil {
+				return err
+			}
+			ok = true
+		}
+		if !ok {
+			if typ.kind == gqlKindNonNull {
+				return &gqlError{Message: fmt.Sprintf("variable $%s of required type %s was not provided", def.name, typ)}
+			}
+			continue
+		}
+		// Variables are checked here and coerced where they are used, like
+		// literals.
+		if _, err := coerceInput(v, typ); err != nil {
+			return &gqlError{Message: fmt.Sprintf("variable $%s: %s", def.name, err)}
+		}
+		e.vars[def.name] = v
+	}
+	return nil
+}
+
+// inputType resolves a variable's declared type, which must be an input type.
+func (e *gqlExecutor) inputType(ref *gqlTypeRef) (*gqlType, error) {
+	var t *gqlType
+	if ref.elem != nil {
+		elem, err := e.inputType(ref.elem)
+		if err != nil {
+			return nil, err
+		}
+		t = gqlListOf(elem)
+	} else {
+		t = e.s.types[ref.name]
+		if t == nil {
+			return nil, fmt.Errorf("unknown type %s", ref.name)
+		}
+		if t.kind == gqlKindObject {
+			return nil, fmt.Errorf("%s is not an input type", ref.name)
+		}
+	}
+	if ref.nonNull {
+		t = gqlNonNull(t)
+	}
+	return t, nil
+}
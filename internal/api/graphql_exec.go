@@ -0,0 +1,1181 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// maxGraphQLDepth limits how deeply relationship fields may nest.
+const maxGraphQLDepth = 5
+
+// gqlResult is a response object. Its fields serialize in selection order.
+type gqlResult []gqlResultField
+
+type gqlResultField struct {
+	key   string
+	value any
+}
+
+func (r gqlResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// gqlError is an entry in a response's errors list.
+type gqlError struct {
+	Message    string         `json:"message"`
+	Locations  []gqlLocation  `json:"locations,omitempty"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e *gqlError) Error() string { return e.Message }
+
+// gqlLocation is a line and column in the request document.
+type gqlLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// gqlEvent is a realtime event to publish once a mutation commits.
+type gqlEvent struct {
+	action  string
+	table   *schema.Table
+	records []map[string]any
+}
+
+// gqlExecutor executes one operation. Every database query of the operation
+// runs on the same querier: a withRLS querier for queries, and a single
+// transaction for mutations, so that their fields are applied atomically.
+type gqlExecutor struct {
+	h        *Handler
+	ctx      context.Context
+	sc       *schema.SchemaCache
+	s        *gqlSchema
+	doc      *gqlDocument
+	declared map[string]bool // declared variables
+	vars     map[string]any  // provided variables and defaults
+	events   []gqlEvent
+
+	open func() (Querier, func(error) error, error)
+	q    Querier
+	done func(error) error // finishes q; nil until it is opened
+}
+
+// fieldError returns an error located at field f.
+func fieldError(f *gqlField, path []any, format string, args ...any) *gqlError {
+	return &gqlError{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []gqlLocation{{Line: f.pos.line, Column: f.pos.column}},
+		Path:      slices.Clone(path),
+	}
+}
+
+// dbError converts a database error into a field error, exposing the same
+// messages as the REST API and hiding unrecognized errors.
+func (e *gqlExecutor) dbError(err error, f *gqlField, path []any) *gqlError {
+	if _, resp, ok := pgErrorResponse(err); ok {
+		gerr := fieldError(f, path, "%s", resp.Message)
+		gerr.Extensions = map[string]any{"status": resp.Code}
+		if resp.Data != nil {
+			gerr.Extensions["data"] = resp.Data
+		}
+		return gerr
+	}
+	e.h.logger.Error("graphql query error", "error", err, "field", f.name)
+	return fieldError(f, path, "internal error")
+}
+
+// execute runs op's root fields in order and returns the data object.
+func (e *gqlExecutor) execute(op *gqlOperation) (gqlResult, error) {
+	root := e.s.query
+	if op.kind == "mutation" {
+		if e.s.mutation == nil {
+			return nil, &gqlError{Message: "schema has no mutations"}
+		}
+		root = e.s.mutation
+	}
+
+	fields, err := e.collectFields(root.name, op.selection)
+	if err != nil {
+		return nil, err
+	}
+	data := make(gqlResult, 0, len(fields))
+	for _, f := range fields {
+		key := f.responseKey()
+		value, err := e.resolveRoot(root, f, []any{key})
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, gqlResultField{key: key, value: value})
+	}
+	return data, nil
+}
+
+// collectFields flattens a selection set for an object type, expanding
+// fragments that apply to it, dropping fields excluded by @skip or @include and
+// merging fields with the same response key. Each named fragment is expanded
+// once per selection set, as in the spec's CollectFields, so that repeated
+// spreads cost nothing.
+func (e *gqlExecutor) collectFields(typeName string, sels []gqlSelection) ([]*gqlField, error) {
+	var fields []*gqlField
+	byKey := map[string]*gqlField{}
+	spread := map[string]bool{}
+	// stack holds the fragments being expanded, to detect cycles.
+	var stack []string
+	var collect func(sels []gqlSelection) error
+	collect = func(sels []gqlSelection) error {
+		for _, sel := range sels {
+			switch sel := sel.(type) {
+			case *gqlField:
+				ok, err := e.included(sel.directives)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+				key := sel.responseKey()
+				prev := byKey[key]
+				if prev == nil {
+					f := *sel
+					byKey[key] = &f
+					fields = append(fields, &f)
+					continue
+				}
+				if prev.name != sel.name {
+					return fieldError(sel, nil, "fields %q and %q conflict because they are both returned as %q", prev.name, sel.name, key)
+				}
+				prev.selection = mergeSelections(prev.selection, sel.selection)
+			case *gqlFragmentSpread:
+				ok, err := e.included(sel.directives)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+				frag := e.doc.fragments[sel.name]
+				if frag == nil {
+					return &gqlError{Message: fmt.Sprintf("unknown fragment %q", sel.name), Locations: []gqlLocation{{Line: sel.pos.line, Column: sel.pos.column}}}
+				}
+				if slices.Contains(stack, sel.name) {
+					return &gqlError{Message: fmt.Sprintf("fragment %q spreads itself", sel.name)}
+				}
+				if spread[sel.name] || frag.typeCondition != typeName {
+					continue
+				}
+				if ok, err = e.included(frag.directives); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+				spread[sel.name] = true
+				stack = append(stack, sel.name)
+				err = collect(frag.selection)
+				stack = stack[:len(stack)-1]
+				if err != nil {
+					return err
+				}
+			case *gqlInlineFragment:
+				ok, err := e.included(sel.directives)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+				if sel.typeCondition != "" && sel.typeCondition != typeName {
+					continue
+				}
+				if err := collect(sel.selection); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := collect(sels); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// mergeSelections returns the sub-selections of two fields merged into one
+// response key. Fields without directives that share a response key and name
+// are merged recursively, and a fragment spread already present is not
+// repeated, so that merging the same fields again does not grow the result.
+// The parsed selections are not modified.
+func mergeSelections(into, from []gqlSelection) []gqlSelection {
+	merged := slices.Clip(into)
+	for _, sel := range from {
+		switch sel := sel.(type) {
+		case *gqlField:
+			if i := slices.IndexFunc(merged, func(s gqlSelection) bool {
+				f, ok := s.(*gqlField)
+				return ok && f.responseKey() == sel.responseKey() && f.name == sel.name &&
+					len(f.directives) == 0 && len(sel.directives) == 0
+			}); i >= 0 {
+				prev := merged[i].(*gqlField)
+				if prev == sel {
+					continue
+				}
+				f := *prev
+				f.selection = mergeSelections(prev.selection, sel.selection)
+				merged = slices.Clone(merged)
+				merged[i] = &f
+				continue
+			}
+		case *gqlFragmentSpread:
+			if slices.ContainsFunc(merged, func(s gqlSelection) bool {
+				f, ok := s.(*gqlFragmentSpread)
+				return ok && f.name == sel.name && len(f.directives) == 0 && len(sel.directives) == 0
+			}) {
+				continue
+			}
+		}
+		merged = append(merged, sel)
+	}
+	return merged
+}
+
+// included evaluates @skip and @include.
+func (e *gqlExecutor) included(dirs []*gqlDirective) (bool, error) {
+	for _, d := range dirs {
+		if d.name != "skip" && d.name != "include" {
+			return false, &gqlError{Message: fmt.Sprintf("unknown directive @%s", d.name)}
+		}
+		if len(d.arguments) != 1 || d.arguments[0].name != "if" {
+			return false, &gqlError{Message: fmt.Sprintf("directive @%s requires a single if argument", d.name)}
+		}
+		v, err := e.literal(d.arguments[0].value)
+		if err != nil {
+			return false, err
+		}
+		cond, ok := v.(bool)
+		if !ok {
+			return false, &gqlError{Message: fmt.Sprintf("directive @%s: if must be a Boolean", d.name)}
+		}
+		if cond == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// querier returns the operation's querier, opening it on first use so that
+// introspection-only requests do not touch the database.
+func (e *gqlExecutor) querier() (Querier, error) {
+	if e.q == nil {
+		q, done, err := e.open()
+		if err != nil {
+			e.h.logger.Error("rls setup error", "error", err)
+			return nil, &gqlError{Message: "internal error"}
+		}
+		e.q, e.done = q, done
+	}
+	return e.q, nil
+}
+
+// finish commits the operation's queries, or rolls them back if err is set.
+func (e *gqlExecutor) finish(err error) error {
+	if e.done == nil {
+		return nil
+	}
+	return e.done(err)
+}
+
+// resolveRoot resolves a root field of the query or mutation type.
+func (e *gqlExecutor) resolveRoot(root *gqlType, f *gqlField, path []any) (any, error) {
+	switch f.name {
+	case "__typename":
+		return root.name, nil
+	case "__schema":
+		if root == e.s.query {
+			return e.completeStatic(e.s.introspection, f.selection, path)
+		}
+	case "__type":
+		if root == e.s.query {
+			if len(f.arguments) != 1 || f.arguments[0].name != "name" {
+				return nil, fieldError(f, path, "__type requires a single name argument")
+			}
+			v, err := e.literal(f.arguments[0].value)
+			if err != nil {
+				return nil, err
+			}
+			name, _ := v.(string)
+			for _, t := range e.s.introspection["types"].([]any) {
+				if t.(map[string]any)["name"] == name {
+					return e.completeStatic(t, f.selection, path)
+				}
+			}
+			return nil, nil
+		}
+	}
+
+	def := root.field(f.name)
+	if def == nil {
+		return nil, fieldError(f, path, "cannot query field %q on type %q", f.name, root.name)
+	}
+	if err := checkSelection(def, f, path); err != nil {
+		return nil, err
+	}
+	args, err := e.arguments(def, f, path)
+	if err != nil {
+		return nil, err
+	}
+	tbl := def.table
+	var t *gqlType
+	if tbl != nil {
+		t = def.typ.named()
+		if err := e.validateSelection(t, f.selection, path, 0); err != nil {
+			return nil, err
+		}
+	}
+	q, err := e.querier()
+	if err != nil {
+		return nil, err
+	}
+
+	switch def.op {
+	case gqlOpList:
+		opts, err := e.listOpts(tbl, args, f, path)
+		if err != nil {
+			return nil, err
+		}
+		if opts.fields, err = e.recordFields(t, f.selection); err != nil {
+			return nil, err
+		}
+		query, queryArgs, _, _ := buildList(tbl, opts)
+		records, err := e.queryRecords(q, f, path, query, queryArgs)
+		if err != nil {
+			return nil, err
+		}
+		return e.completeRecords(t, records, f.selection, path, 0)
+
+	case gqlOpCount:
+		opts, err := e.listOpts(tbl, args, f, path)
+		if err != nil {
+			return nil, err
+		}
+		opts.skipTotal = false
+		_, _, countQuery, countArgs := buildList(tbl, opts)
+		var count int
+		if err := q.QueryRow(e.ctx, countQuery, countArgs...).Scan(&count); err != nil {
+			return nil, e.dbError(err, f, path)
+		}
+		return count, nil
+
+	case gqlOpByPK:
+		fields, err := e.recordFields(t, f.selection)
+		if err != nil {
+			return nil, err
+		}
+		pk := pkArgValues(tbl, args)
+		if ok, err := e.matchesRule(q, tbl, ruleView, nil, pk, f, path); !ok {
+			return nil, err
+		}
+		query, queryArgs := buildSelectOne(tbl, fields, pk)
+		return e.completeOne(q, t, f, path, query, queryArgs, "")
+
+	case gqlOpInsert:
+		objects, _ := args["objects"].([]any)
+		rows := make([]map[string]any, len(objects))
+		for i, obj := range objects {
+			rows[i] = obj.(map[string]any)
+			if len(rows[i]) == 0 {
+				return nil, fieldError(f, path, "objects[%d] sets no columns", i)
+			}
+		}
+		if len(rows) == 0 {
+			return []gqlResult{}, nil
+		}
+		records, err := insertRows(e.ctx, q, e.sc, tbl, rows)
+		if err != nil {
+			return nil, e.ruleError(err, f, path)
+		}
+		e.events = append(e.events, gqlEvent{action: "create", table: tbl, records: records})
+		return e.completeRecords(t, records, f.selection, path, 0)
+
+	case gqlOpInsertOne:
+		obj := args["object"].(map[string]any)
+		if len(obj) == 0 {
+			return nil, fieldError(f, path, "object sets no columns")
+		}
+		query, queryArgs := buildInsert(tbl, obj)
+		records, err := e.queryRecords(q, f, path, query, queryArgs)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCreated(e.ctx, q, e.sc, tbl, records, []map[string]any{obj}); err != nil {
+			return nil, e.ruleError(err, f, path)
+		}
+		e.events = append(e.events, gqlEvent{action: "create", table: tbl, records: records})
+		results, err := e.completeRecords(t, records, f.selection, path, 0)
+		if err != nil || len(results) == 0 {
+			return nil, err
+		}
+		return results[0], nil
+
+	case gqlOpUpdate, gqlOpDelete:
+		filterSQL, filterArgs, err := parseFilterExpr(e.ctx, e.sc, tbl, args["filter"].(string), 0)
+		if err != nil {
+			return nil, fieldError(f, path, "invalid filter: %s", err)
+		}
+		if filterSQL == "" {
+			return nil, fieldError(f, path, "filter is required")
+		}
+		action := ruleDelete
+		set, _ := args["set"].(map[string]any)
+		if def.op == gqlOpUpdate {
+			if len(set) == 0 {
+				return nil, fieldError(f, path, "set changes no columns")
+			}
+			action = ruleUpdate
+		}
+		filterSQL, filterArgs, err = withRule(e.sc, tbl, action, requestVars(e.ctx, set), filterSQL, filterArgs)
+		if err != nil {
+			return nil, e.ruleError(err, f, path)
+		}
+		query, queryArgs := buildBulkDelete(tbl, filterSQL, filterArgs)
+		if def.op == gqlOpUpdate {
+			query, queryArgs = buildBulkUpdate(tbl, set, filterSQL, filterArgs)
+		}
+		records, err := e.queryRecords(q, f, path, query, queryArgs)
+		if err != nil {
+			return nil, err
+		}
+		e.events = append(e.events, gqlEvent{action: action, table: tbl, records: records})
+		return e.completeRecords(t, records, f.selection, path, 0)
+
+	case gqlOpUpdateByPK:
+		set := args["set"].(map[string]any)
+		if len(set) == 0 {
+			return nil, fieldError(f, path, "set changes no columns")
+		}
+		pk := pkArgValues(tbl, args)
+		if ok, err := e.matchesRule(q, tbl, ruleUpdate, set, pk, f, path); !ok {
+			return nil, err
+		}
+		query, queryArgs := buildUpdate(tbl, set, pk, nil)
+		return e.completeOne(q, t, f, path, query, queryArgs, "update")
+
+	case gqlOpDeleteByPK:
+		pk := pkArgValues(tbl, args)
+		if ok, err := e.matchesRule(q, tbl, ruleDelete, nil, pk, f, path); !ok {
+			return nil, err
+		}
+		query, queryArgs := buildDelete(tbl, pk, nil)
+		return e.completeOne(q, t, f, path, query+" RETURNING "+buildColumnList(tbl, nil), queryArgs, "delete")
+
+	case gqlOpFunction:
+		return e.callFunction(q, def, t, args, f, path)
+	}
+	return nil, fieldError(f, path, "cannot query field %q on type %q", f.name, root.name)
+}
+
+// checkSelection checks that f has a selection set exactly when its type is
+// an object type.
+func checkSelection(def *gqlFieldDef, f *gqlField, path []any) error {
+	if def.typ.isLeaf() && len(f.selection) > 0 {
+		return fieldError(f, path, "field %q of type %s must not have a selection", f.name, def.typ)
+	}
+	if !def.typ.isLeaf() && len(f.selection) == 0 {
+		return fieldError(f, path, "field %q of type %s must have a selection", f.name, def.typ)
+	}
+	return nil
+}
+
+// pkArgValues returns the primary key arguments in the form the query builders
+// take.
+func pkArgValues(tbl *schema.Table, args map[string]any) []string {
+	values := make([]string, len(tbl.PrimaryKey))
+	for i, col := range tbl.PrimaryKey {
+		values[i] = formatPKValue(args[col])
+	}
+	return values
+}
+
+// listOpts builds the list options for a list or count field from its filter,
+// search, sort and pagination arguments.
+func (e *gqlExecutor) listOpts(tbl *schema.Table, args map[string]any, f *gqlField, path []any) (listOpts, error) {
+	opts := listOpts{page: 1, perPage: 20, skipTotal: true}
+	if v, ok := args["page"].(int64); ok && v > 1 {
+		opts.page = int(v)
+	}
+	if v, ok := args["perPage"].(int64); ok && v >= 1 {
+		opts.perPage = int(min(v, 500))
+	}
+
+	if filter, _ := args["filter"].(string); filter != "" {
+		var err error
+		opts.filterSQL, opts.filterArgs, err = parseFilterExpr(e.ctx, e.sc, tbl, filter, 0)
+		if err != nil {
+			return opts, fieldError(f, path, "invalid filter: %s", err)
+		}
+	}
+	var err error
+	opts.filterSQL, opts.filterArgs, err = withRule(e.sc, tbl, ruleList, requestVars(e.ctx, nil), opts.filterSQL, opts.filterArgs)
+	if err != nil {
+		return opts, e.ruleError(err, f, path)
+	}
+
+	var search *textSearch
+	if term, _ := args["search"].(string); term != "" {
+		searchFields, _ := args["searchFields"].(string)
+		var err error
+		search, err = parseSearch(tbl, searchFields, len(opts.filterArgs)+1)
+		if err != nil {
+			return opts, fieldError(f, path, "invalid search: %s", err)
+		}
+		if opts.filterSQL == "" {
+			opts.filterSQL = search.whereSQL()
+		} else {
+			opts.filterSQL = "(" + opts.filterSQL + ") AND " + search.whereSQL()
+		}
+		opts.filterArgs = append(opts.filterArgs, term)
+	}
+
+	sortParam, _ := args["sort"].(string)
+	sortFields := parseSort(e.sc, tbl, sortParam)
+	for i := range sortFields {
+		if sortFields[i].column != rankSort {
+			continue
+		}
+		if search == nil {
+			return opts, fieldError(f, path, "sorting by @rank requires search")
+		}
+		sortFields[i].expr = search.rankSQL()
+	}
+	sortArgs, err := sortRules(e.sc, sortFields, requestVars(e.ctx, nil), len(opts.filterArgs))
+	if err != nil {
+		return opts, e.ruleError(err, f, path)
+	}
+	opts.sortSQL, opts.sortArgs = sortSQL(sortFields), sortArgs
+	return opts, nil
+}
+
+// matchesRule applies tbl's rule for action to the record with the given
+// primary key. Records that do not match resolve to null, as if they did not
+// exist.
+func (e *gqlExecutor) matchesRule(q Querier, tbl *schema.Table, action string, body map[string]any, pk []string, f *gqlField, path []any) (bool, error) {
+	ok, err := matchesRule(e.ctx, q, e.sc, tbl, action, requestVars(e.ctx, body), pk)
+	if err != nil {
+		return false, e.ruleError(err, f, path)
+	}
+	return ok, nil
+}
+
+// ruleError converts an error from applying an access rule into a field error.
+func (e *gqlExecutor) ruleError(err error, f *gqlField, path []any) *gqlError {
+	var ire *invalidRuleError
+	switch {
+	case errors.Is(err, errCreateDenied):
+		gerr := fieldError(f, path, "%s", err)
+		gerr.Extensions = map[string]any{"status": http.StatusForbidden}
+		return gerr
+	case errors.As(err, &ire):
+		e.h.logger.Error("invalid access rule", "error", err, "field", f.name)
+		return fieldError(f, path, "invalid access rule")
+	}
+	return e.dbError(err, f, path)
+}
+
+// queryRecords runs a query returning table rows.
+func (e *gqlExecutor) queryRecords(q Querier, f *gqlField, path []any, query string, args []any) ([]map[string]any, error) {
+	rows, err := q.Query(e.ctx, query, args...)
+	if err != nil {
+		return nil, e.dbError(err, f, path)
+	}
+	defer rows.Close()
+	records, err := scanRows(rows)
+	if err != nil {
+		return nil, e.dbError(err, f, path)
+	}
+	return records, nil
+}
+
+// completeOne runs a query returning at most one row and completes it, or
+// returns nil if there is no row. Unless action is empty, a realtime event is
+// queued for the row.
+func (e *gqlExecutor) completeOne(q Querier, t *gqlType, f *gqlField, path []any, query string, args []any, action string) (any, error) {
+	record, err := queryOne(e.ctx, q, query, args)
+	if err != nil {
+		return nil, e.dbError(err, f, path)
+	}
+	if record == nil {
+		return nil, nil
+	}
+	delete(record, etagColumn)
+	if action != "" {
+		e.events = append(e.events, gqlEvent{action: action, table: t.table, records: []map[string]any{record}})
+	}
+	results, err := e.completeRecords(t, []map[string]any{record}, f.selection, path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// callFunction calls a function field. Functions returning a table's row type
+// are selected from, so their rows can be completed like the table's records.
+func (e *gqlExecutor) callFunction(q Querier, def *gqlFieldDef, t *gqlType, args map[string]any, f *gqlField, path []any) (any, error) {
+	fn := def.fn
+	if t != nil && !fn.ReturnsSet {
+		rowFn := *fn
+		rowFn.ReturnsSet = true
+		fn = &rowFn
+	}
+	query, queryArgs, err := buildRPCCall(fn, args)
+	if err != nil {
+		return nil, fieldError(f, path, "%s", err)
+	}
+
+	if fn.IsVoid {
+		if _, err := q.Exec(e.ctx, query, queryArgs...); err != nil {
+			return nil, e.dbError(err, f, path)
+		}
+		return true, nil
+	}
+
+	records, err := e.queryRecords(q, f, path, query, queryArgs)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t != nil && def.fn.ReturnsSet:
+		return e.completeRecords(t, records, f.selection, path, 0)
+	case t != nil:
+		// A function returning a single row yields one row of nulls for NULL.
+		if len(records) == 0 || allNull(records[0]) {
+			return nil, nil
+		}
+		results, err := e.completeRecords(t, records[:1], f.selection, path, 0)
+		if err != nil {
+			return nil, err
+		}
+		return results[0], nil
+	case fn.ReturnsSet:
+		items := make([]any, len(records))
+		for i, rec := range records {
+			items[i] = unwrapRPCResult(rec)
+		}
+		return items, nil
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return serializeLeaf(unwrapRPCResult(records[0]), def.typ), nil
+}
+
+func allNull(record map[string]any) bool {
+	for _, v := range record {
+		if v != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// recordFields returns the columns and computed fields to select for records of
+// t: those the selection asks for, plus the keys its relationship fields join on.
+func (e *gqlExecutor) recordFields(t *gqlType, sel []gqlSelection) ([]string, error) {
+	fields, err := e.collectFields(t.name, sel)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	add := func(name string) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, f := range fields {
+		def := t.field(f.name)
+		switch {
+		case def == nil:
+		case def.rel != nil:
+			add(def.rel.FromColumns[0])
+		default:
+			add(def.name)
+		}
+	}
+	if len(names) == 0 {
+		// Only __typename was selected: any column will do.
+		if len(t.table.PrimaryKey) > 0 {
+			add(t.table.PrimaryKey[0])
+		} else {
+			add(t.table.Columns[0].Name)
+		}
+	}
+	return names, nil
+}
+
+// validateSelection checks a selection on records of t before any query runs:
+// that its fields exist, have selections exactly when they are objects, have
+// valid arguments and do not nest relationships too deeply.
+func (e *gqlExecutor) validateSelection(t *gqlType, sel []gqlSelection, path []any, depth int) error {
+	fields, err := e.collectFields(t.name, sel)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.name == "__typename" {
+			continue
+		}
+		def := t.field(f.name)
+		if def == nil {
+			return fieldError(f, path, "cannot query field %q on type %q", f.name, t.name)
+		}
+		if err := checkSelection(def, f, path); err != nil {
+			return err
+		}
+		if _, err := e.arguments(def, f, path); err != nil {
+			return err
+		}
+		if def.rel == nil {
+			continue
+		}
+		if depth+1 > maxGraphQLDepth {
+			return fieldError(f, path, "relationships may be nested at most %d levels deep", maxGraphQLDepth)
+		}
+		if err := e.validateSelection(def.typ.named(), f.selection, append(path, f.responseKey()), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gqlLoaded holds a relationship field's related records for a set of parents.
+type gqlLoaded struct {
+	indexes [][]int     // per parent, indexes into results
+	results []gqlResult // completed related records
+}
+
+// completeRecords completes the selection on records of t. Each relationship
+// field is loaded for all of the records with one batched expand query, then
+// completed recursively on the related records.
+func (e *gqlExecutor) completeRecords(t *gqlType, records []map[string]any, sel []gqlSelection, path []any, depth int) ([]gqlResult, error) {
+	fields, err := e.collectFields(t.name, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	// The selection has been validated, so every field exists.
+	loaded := map[string]*gqlLoaded{}
+	for _, f := range fields {
+		def := t.field(f.name)
+		if def == nil || def.rel == nil {
+			continue
+		}
+		args, err := e.arguments(def, f, path)
+		if err != nil {
+			return nil, err
+		}
+		key := f.responseKey()
+		if loaded[key], err = e.loadRelation(def, args, records, f, append(path, key), depth); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]gqlResult, len(records))
+	for i, rec := range records {
+		obj := make(gqlResult, 0, len(fields))
+		for _, f := range fields {
+			key := f.responseKey()
+			var value any
+			switch def := t.field(f.name); {
+			case f.name == "__typename":
+				value = t.name
+			case def.rel == nil:
+				value = serializeLeaf(rec[def.name], def.typ)
+			case def.rel.Type == "many-to-one":
+				if idx := loaded[key].indexes[i]; len(idx) > 0 {
+					value = loaded[key].results[idx[0]]
+				}
+			default:
+				related := make([]gqlResult, len(loaded[key].indexes[i]))
+				for j, idx := range loaded[key].indexes[i] {
+					related[j] = loaded[key].results[idx]
+				}
+				value = related
+			}
+			obj = append(obj, gqlResultField{key: key, value: value})
+		}
+		results[i] = obj
+	}
+	return results, nil
+}
+
+// loadRelation loads a relationship field's records for records.
+func (e *gqlExecutor) loadRelation(def *gqlFieldDef, args map[string]any, records []map[string]any, f *gqlField, path []any, depth int) (*gqlLoaded, error) {
+	relType := def.typ.named()
+	fields, err := e.recordFields(relType, f.selection)
+	if err != nil {
+		return nil, err
+	}
+	opts := expandOptions{fields: fields}
+	opts.filter, _ = args["filter"].(string)
+	opts.sort, _ = args["sort"].(string)
+	if limit, ok := args["limit"].(int64); ok {
+		if limit < 1 {
+			return nil, fieldError(f, path, "limit must be positive")
+		}
+		opts.limit = int(limit)
+	}
+	if err := validateExpandOptions(e.sc, def.rel, def.table, opts); err != nil {
+		return nil, fieldError(f, path, "%s", err)
+	}
+
+	q, err := e.querier()
+	if err != nil {
+		return nil, err
+	}
+	step := expandStep{rel: def.rel, table: def.table, opts: opts}
+	if err := expandRelation(e.ctx, q, e.sc, records, []expandStep{step}); err != nil {
+		return nil, e.dbError(err, f, path)
+	}
+
+	// Take the related records back out of "expand". Related rows are shared
+	// between parents, so each parent gets its own copy to complete.
+	l := &gqlLoaded{indexes: make([][]int, len(records))}
+	var related []map[string]any
+	for i, rec := range records {
+		expand, _ := rec["expand"].(map[string]any)
+		switch v := expand[def.rel.FieldName].(type) {
+		case map[string]any:
+			l.indexes[i] = []int{len(related)}
+			related = append(related, maps.Clone(v))
+		case []map[string]any:
+			for _, r := range v {
+				l.indexes[i] = append(l.indexes[i], len(related))
+				related = append(related, maps.Clone(r))
+			}
+		}
+		if expand != nil {
+			delete(expand, def.rel.FieldName)
+			if len(expand) == 0 {
+				delete(rec, "expand")
+			}
+		}
+	}
+	if l.results, err = e.completeRecords(relType, related, f.selection, path, depth+1); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// serializeLeaf converts a scanned value to its output form: UUIDs become
+// strings, and everything else is serialized as the REST API does.
+func serializeLeaf(v any, t *gqlType) any {
+	switch val := v.(type) {
+	case [16]byte:
+		return formatPKValue(val)
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = serializeLeaf(item, t)
+		}
+		return out
+	}
+	return v
+}
+
+// completeStatic completes a selection on a static value: the introspection
+// maps, which carry their type name under "__typename".
+func (e *gqlExecutor) completeStatic(v any, sel []gqlSelection, path []any) (any, error) {
+	switch val := v.(type) {
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			completed, err := e.completeStatic(item, sel, append(path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = completed
+		}
+		return out, nil
+	case map[string]any:
+		typeName, _ := val["__typename"].(string)
+		fields, err := e.collectFields(typeName, sel)
+		if err != nil {
+			return nil, err
+		}
+		obj := make(gqlResult, 0, len(fields))
+		for _, f := range fields {
+			key := f.responseKey()
+			fv, ok := val[f.name]
+			if !ok {
+				return nil, fieldError(f, path, "cannot query field %q on type %q", f.name, typeName)
+			}
+			if len(f.selection) > 0 {
+				if fv, err = e.completeStatic(fv, f.selection, append(path, key)); err != nil {
+					return nil, err
+				}
+			} else if _, isObject := fv.(map[string]any); isObject {
+				return nil, fieldError(f, path, "field %q must have a selection", f.name)
+			}
+			obj = append(obj, gqlResultField{key: key, value: fv})
+		}
+		return obj, nil
+	}
+	return v, nil
+}
+
+// arguments coerces a field's arguments to Go values. Arguments given as
+// variables that were not provided are left out.
+func (e *gqlExecutor) arguments(def *gqlFieldDef, f *gqlField, path []any) (map[string]any, error) {
+	args := make(map[string]any, len(f.arguments))
+	for _, a := range f.arguments {
+		argDef := def.arg(a.name)
+		if argDef == nil {
+			return nil, fieldError(f, path, "unknown argument %q on field %q", a.name, f.name)
+		}
+		if a.value.kind == gqlVariable && e.declared[a.value.raw] {
+			if _, ok := e.vars[a.value.raw]; !ok {
+				continue
+			}
+		}
+		v, err := e.literal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		if args[a.name], err = coerceInput(v, argDef.typ); err != nil {
+			return nil, fieldError(f, path, "argument %q: %s", a.name, err)
+		}
+	}
+	for _, argDef := range def.args {
+		if _, ok := args[argDef.name]; !ok && argDef.typ.kind == gqlKindNonNull {
+			return nil, fieldError(f, path, "argument %q of type %s is required", argDef.name, argDef.typ)
+		}
+	}
+	return args, nil
+}
+
+// gqlEnumValue is an enum literal, kept apart from strings so String inputs
+// can reject it.
+type gqlEnumValue string
+
+// literal converts a document value to a Go value, substituting variables.
+// Numbers become json.Number, as variables decoded from JSON are.
+func (e *gqlExecutor) literal(v *gqlValue) (any, error) {
+	switch v.kind {
+	case gqlVariable:
+		if !e.declared[v.raw] {
+			return nil, &gqlError{Message: fmt.Sprintf("variable $%s is not defined", v.raw)}
+		}
+		return e.vars[v.raw], nil
+	case gqlInt, gqlFloat:
+		return json.Number(v.raw), nil
+	case gqlString:
+		return v.raw, nil
+	case gqlBoolean:
+		return v.raw == "true", nil
+	case gqlNull:
+		return nil, nil
+	case gqlEnum:
+		return gqlEnumValue(v.raw), nil
+	case gqlList:
+		out := make([]any, len(v.list))
+		for i, item := range v.list {
+			val, err := e.literal(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	case gqlObject:
+		out := make(map[string]any, len(v.fields))
+		for _, field := range v.fields {
+			if field.value.kind == gqlVariable && e.declared[field.value.raw] {
+				if _, ok := e.vars[field.value.raw]; !ok {
+					continue
+				}
+			}
+			val, err := e.literal(field.value)
+			if err != nil {
+				return nil, err
+			}
+			out[field.name] = val
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown value kind %d", v.kind)
+}
+
+// coerceInput checks v against an input type and converts it to the value
+// passed to Postgres: int64 for integers, float64 for floats, and plain JSON
+// values for the JSON scalar.
+func coerceInput(v any, t *gqlType) (any, error) {
+	if t.kind == gqlKindNonNull {
+		if v == nil {
+			return nil, fmt.Errorf("expected a non-null %s", t.ofType)
+		}
+		return coerceInput(v, t.ofType)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t.kind {
+	case gqlKindList:
+		items, ok := v.([]any)
+		if !ok {
+			items = []any{v}
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			val, err := coerceInput(item, t.ofType)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = val
+		}
+		return out, nil
+
+	case gqlKindInputObject:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an object of type %s", t.name)
+		}
+		out := make(map[string]any, len(obj))
+		for name, val := range obj {
+			field := t.inputField(name)
+			if field == nil {
+				return nil, fmt.Errorf("unknown field %q of %s", name, t.name)
+			}
+			coerced, err := coerceInput(val, field.typ)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			out[name] = coerced
+		}
+		for _, field := range t.inputFields {
+			if _, ok := obj[field.name]; !ok && field.typ.kind == gqlKindNonNull {
+				return nil, fmt.Errorf("missing required field %q of %s", field.name, t.name)
+			}
+		}
+		return out, nil
+
+	case gqlKindEnum:
+		name, ok := v.(gqlEnumValue)
+		if !ok {
+			s, isString := v.(string)
+			if !isString {
+				return nil, fmt.Errorf("expected a %s value", t.name)
+			}
+			name = gqlEnumValue(s)
+		}
+		if !slices.Contains(t.enumValues, string(name)) {
+			return nil, fmt.Errorf("%q is not a %s value", name, t.name)
+		}
+		return string(name), nil
+	}
+
+	switch t.name {
+	case "Int", "BigInt":
+		var n json.Number
+		switch val := v.(type) {
+		case json.Number:
+			n = val
+		case string:
+			if t.name == "BigInt" {
+				n = json.Number(val)
+			}
+		}
+		i, err := n.Int64()
+		if err != nil || t.name == "Int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return nil, fmt.Errorf("expected an %s", t.name)
+		}
+		return i, nil
+	case "Float":
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected a Float")
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("expected a Float")
+		}
+		return f, nil
+	case "String":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a String")
+		}
+		return s, nil
+	case "ID":
+		switch val := v.(type) {
+		case string:
+			return val, nil
+		case json.Number:
+			if _, err := val.Int64(); err == nil {
+				return val.String(), nil
+			}
+		}
+		return nil, fmt.Errorf("expected an ID")
+	case "Boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a Boolean")
+		}
+		return b, nil
+	}
+	return plainJSON(v), nil
+}
+
+// plainJSON converts a JSON scalar's value to the types encoding/json decodes
+// to, with whole numbers as int64.
+func plainJSON(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case gqlEnumValue:
+		return string(val)
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = plainJSON(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = plainJSON(item)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,806 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// gqlDocument is a parsed GraphQL request document.
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+// gqlOperation is a query, mutation or subscription definition.
+type gqlOperation struct {
+	kind      string // query, mutation or subscription
+	name      string
+	variables []*gqlVariableDef
+	selection []gqlSelection
+}
+
+// gqlVariableDef declares an operation variable.
+type gqlVariableDef struct {
+	name         string
+	typ          *gqlTypeRef
+	defaultValue *gqlValue
+}
+
+// gqlTypeRef is a type as written in a variable definition, e.g. [Int!]!.
+type gqlTypeRef struct {
+	name    string      // named type; empty for lists
+	elem    *gqlTypeRef // list element type
+	nonNull bool
+}
+
+func (t *gqlTypeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// gqlFragment is a named fragment definition.
+type gqlFragment struct {
+	name          string
+	typeCondition string
+	directives    []*gqlDirective
+	selection     []gqlSelection
+}
+
+// gqlSelection is a field, fragment spread or inline fragment.
+type gqlSelection interface{ isSelection() }
+
+// gqlField is a field selection.
+type gqlField struct {
+	alias      string
+	name       string
+	arguments  []*gqlArgument
+	directives []*gqlDirective
+	selection  []gqlSelection
+	pos        gqlPos
+}
+
+// responseKey returns the key the field's result is stored under.
+func (f *gqlField) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// gqlFragmentSpread is a "...Name" selection.
+type gqlFragmentSpread struct {
+	name       string
+	directives []*gqlDirective
+	pos        gqlPos
+}
+
+// gqlInlineFragment is a "... on Type { }" selection.
+type gqlInlineFragment struct {
+	typeCondition string
+	directives    []*gqlDirective
+	selection     []gqlSelection
+}
+
+func (*gqlField) isSelection()          {}
+func (*gqlFragmentSpread) isSelection() {}
+func (*gqlInlineFragment) isSelection() {}
+
+// gqlArgument is a named argument of a field or directive.
+type gqlArgument struct {
+	name  string
+	value *gqlValue
+}
+
+// gqlDirective is a directive such as @include(if: $flag).
+type gqlDirective struct {
+	name      string
+	arguments []*gqlArgument
+}
+
+// Kinds of gqlValue.
+const (
+	gqlVariable = iota
+	gqlInt
+	gqlFloat
+	gqlString
+	gqlBoolean
+	gqlNull
+	gqlEnum
+	gqlList
+	gqlObject
+)
+
+// gqlValue is a literal or variable in a document.
+type gqlValue struct {
+	kind   int
+	raw    string // variable name, enum name, or number/string/boolean text
+	list   []*gqlValue
+	fields []*gqlArgument // object fields
+}
+
+// gqlPos is a line and column in the document, both starting at 1.
+type gqlPos struct {
+	line, column int
+}
+
+// gqlSyntaxError is a document syntax error.
+type gqlSyntaxError struct {
+	msg string
+	pos gqlPos
+}
+
+func (e *gqlSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error: %s (line %d, column %d)", e.msg, e.pos.line, e.pos.column)
+}
+
+// Token kinds.
+const (
+	gqlTokEOF = iota
+	gqlTokPunct
+	gqlTokName
+	gqlTokInt
+	gqlTokFloat
+	gqlTokString
+)
+
+type gqlToken struct {
+	kind  int
+	value string
+	pos   gqlPos
+}
+
+// gqlLexer splits a document into tokens. Commas, whitespace and comments are
+// insignificant and skipped.
+type gqlLexer struct {
+	src       string
+	i         int
+	line      int
+	lineStart int
+}
+
+func (l *gqlLexer) pos() gqlPos {
+	return gqlPos{line: l.line, column: l.i - l.lineStart + 1}
+}
+
+func (l *gqlLexer) errorf(pos gqlPos, format string, args ...any) error {
+	return &gqlSyntaxError{msg: fmt.Sprintf(format, args...), pos: pos}
+}
+
+func (l *gqlLexer) newline() {
+	l.line++
+	l.lineStart = l.i
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	for l.i < len(l.src) {
+		switch c := l.src[l.i]; {
+		case c == '\n':
+			l.i++
+			l.newline()
+		case c == '\r':
+			l.i++
+			if l.i < len(l.src) && l.src[l.i] == '\n' {
+				l.i++
+			}
+			l.newline()
+		case c == ' ' || c == '\t' || c == ',':
+			l.i++
+		case c == '#':
+			for l.i < len(l.src) && l.src[l.i] != '\n' && l.src[l.i] != '\r' {
+				l.i++
+			}
+		case strings.HasPrefix(l.src[l.i:], "\ufeff"):
+			l.i += len("\ufeff")
+		default:
+			return l.token()
+		}
+	}
+	return gqlToken{kind: gqlTokEOF, pos: l.pos()}, nil
+}
+
+func (l *gqlLexer) token() (gqlToken, error) {
+	pos := l.pos()
+	c := l.src[l.i]
+	switch {
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		l.i++
+		return gqlToken{kind: gqlTokPunct, value: string(c), pos: pos}, nil
+	case c == '.':
+		if strings.HasPrefix(l.src[l.i:], "...") {
+			l.i += 3
+			return gqlToken{kind: gqlTokPunct, value: "...", pos: pos}, nil
+		}
+		return gqlToken{}, l.errorf(pos, "unexpected %q", ".")
+	case c == '_' || isLetter(c):
+		start := l.i
+		for l.i < len(l.src) && (l.src[l.i] == '_' || isLetter(l.src[l.i]) || isDigit(l.src[l.i])) {
+			l.i++
+		}
+		return gqlToken{kind: gqlTokName, value: l.src[start:l.i], pos: pos}, nil
+	case c == '-' || isDigit(c):
+		return l.number(pos)
+	case c == '"':
+		if strings.HasPrefix(l.src[l.i:], `"""`) {
+			return l.blockString(pos)
+		}
+		return l.string(pos)
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.i:])
+	return gqlToken{}, l.errorf(pos, "unexpected character %q", r)
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+func (l *gqlLexer) number(pos gqlPos) (gqlToken, error) {
+	start := l.i
+	if l.src[l.i] == '-' {
+		l.i++
+	}
+	digits := func() bool {
+		n := l.i
+		for l.i < len(l.src) && isDigit(l.src[l.i]) {
+			l.i++
+		}
+		return l.i > n
+	}
+	if !digits() {
+		return gqlToken{}, l.errorf(pos, "invalid number")
+	}
+	if l.src[start] == '0' && l.i-start > 1 || l.src[start] == '-' && l.i-start > 2 && l.src[start+1] == '0' {
+		return gqlToken{}, l.errorf(pos, "invalid number: leading zero")
+	}
+	kind := gqlTokInt
+	if l.i < len(l.src) && l.src[l.i] == '.' {
+		l.i++
+		kind = gqlTokFloat
+		if !digits() {
+			return gqlToken{}, l.errorf(pos, "invalid number")
+		}
+	}
+	if l.i < len(l.src) && (l.src[l.i] == 'e' || l.src[l.i] == 'E') {
+		l.i++
+		kind = gqlTokFloat
+		if l.i < len(l.src) && (l.src[l.i] == '+' || l.src[l.i] == '-') {
+			l.i++
+		}
+		if !digits() {
+			return gqlToken{}, l.errorf(pos, "invalid number")
+		}
+	}
+	if l.i < len(l.src) && (l.src[l.i] == '_' || l.src[l.i] == '.' || isLetter(l.src[l.i])) {
+		return gqlToken{}, l.errorf(pos, "invalid number")
+	}
+	return gqlToken{kind: kind, value: l.src[start:l.i], pos: pos}, nil
+}
+
+func (l *gqlLexer) string(pos gqlPos) (gqlToken, error) {
+	l.i++ // opening quote
+	var sb strings.Builder
+	for l.i < len(l.src) {
+		c := l.src[l.i]
+		switch {
+		case c == '"':
+			l.i++
+			return gqlToken{kind: gqlTokString, value: sb.String(), pos: pos}, nil
+		case c == '\n' || c == '\r':
+			return gqlToken{}, l.errorf(pos, "unterminated string")
+		case c == '\\':
+			if l.i+1 >= len(l.src) {
+				return gqlToken{}, l.errorf(pos, "unterminated string")
+			}
+			esc := l.src[l.i+1]
+			l.i += 2
+			switch esc {
+			case '"', '\\', '/':
+				sb.WriteByte(esc)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if l.i+4 > len(l.src) {
+					return gqlToken{}, l.errorf(pos, "invalid unicode escape")
+				}
+				n, err := strconv.ParseUint(l.src[l.i:l.i+4], 16, 32)
+				if err != nil {
+					return gqlToken{}, l.errorf(pos, "invalid unicode escape")
+				}
+				sb.WriteRune(rune(n))
+				l.i += 4
+			default:
+				return gqlToken{}, l.errorf(pos, "invalid escape \\%c", esc)
+			}
+		default:
+			sb.WriteByte(c)
+			l.i++
+		}
+	}
+	return gqlToken{}, l.errorf(pos, "unterminated string")
+}
+
+func (l *gqlLexer) blockString(pos gqlPos) (gqlToken, error) {
+	l.i += 3
+	var sb strings.Builder
+	for l.i < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.i:], `"""`):
+			l.i += 3
+			return gqlToken{kind: gqlTokString, value: blockStringValue(sb.String()), pos: pos}, nil
+		case strings.HasPrefix(l.src[l.i:], `\"""`):
+			sb.WriteString(`"""`)
+			l.i += 4
+		default:
+			c := l.src[l.i]
+			sb.WriteByte(c)
+			l.i++
+			if c == '\n' {
+				l.newline()
+			}
+		}
+	}
+	return gqlToken{}, l.errorf(pos, "unterminated block string")
+}
+
+// blockStringValue removes the common indentation and the leading and trailing
+// blank lines of a block string.
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// gqlParser is a recursive-descent parser for executable GraphQL documents.
+type gqlParser struct {
+	lex *gqlLexer
+	tok gqlToken
+}
+
+// parseGraphQL parses an executable document: operations and fragments.
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{lex: &gqlLexer{src: src, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &gqlDocument{fragments: map[string]*gqlFragment{}}
+	for p.tok.kind != gqlTokEOF {
+		switch {
+		case p.peek(gqlTokPunct, "{"):
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selection: sel})
+		case p.peek(gqlTokName, "query"), p.peek(gqlTokName, "mutation"), p.peek(gqlTokName, "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek(gqlTokName, "fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if doc.fragments[frag.name] != nil {
+				return nil, fmt.Errorf("duplicate fragment %q", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document contains no operations")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *gqlParser) peek(kind int, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.tok.kind == gqlTokEOF {
+		return p.lex.errorf(p.tok.pos, "unexpected end of document")
+	}
+	return p.lex.errorf(p.tok.pos, "unexpected %q", p.tok.value)
+}
+
+// skip consumes the token if it matches and reports whether it did.
+func (p *gqlParser) skip(kind int, value string) (bool, error) {
+	if !p.peek(kind, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *gqlParser) expect(value string) error {
+	if !p.peek(gqlTokPunct, value) {
+		if p.tok.kind == gqlTokEOF {
+			return p.lex.errorf(p.tok.pos, "expected %q, found end of document", value)
+		}
+		return p.lex.errorf(p.tok.pos, "expected %q, found %q", value, p.tok.value)
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.tok.kind != gqlTokName {
+		if p.tok.kind == gqlTokEOF {
+			return "", p.lex.errorf(p.tok.pos, "expected name, found end of document")
+		}
+		return "", p.lex.errorf(p.tok.pos, "expected name, found %q", p.tok.value)
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{kind: p.tok.value}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == gqlTokName {
+		op.name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek(gqlTokPunct, "(") {
+		vars, err := p.variableDefs()
+		if err != nil {
+			return nil, err
+		}
+		op.variables = vars
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selection = sel
+	return op, nil
+}
+
+func (p *gqlParser) variableDefs() ([]*gqlVariableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []*gqlVariableDef
+	for !p.peek(gqlTokPunct, ")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		def := &gqlVariableDef{name: name, typ: typ}
+		if ok, err := p.skip(gqlTokPunct, "="); err != nil {
+			return nil, err
+		} else if ok {
+			if def.defaultValue, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.directives(); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.advance()
+}
+
+func (p *gqlParser) typeRef() (*gqlTypeRef, error) {
+	var t *gqlTypeRef
+	if ok, err := p.skip(gqlTokPunct, "["); err != nil {
+		return nil, err
+	} else if ok {
+		elem, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		t = &gqlTypeRef{elem: elem}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		t = &gqlTypeRef{name: name}
+	}
+	ok, err := p.skip(gqlTokPunct, "!")
+	t.nonNull = ok
+	return t, err
+}
+
+func (p *gqlParser) fragment() (*gqlFragment, error) {
+	if err := p.advance(); err != nil { // "fragment"
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.lex.errorf(p.tok.pos, "fragment cannot be named \"on\"")
+	}
+	if !p.peek(gqlTokName, "on") {
+		return nil, p.lex.errorf(p.tok.pos, "expected \"on\"")
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	typeCond, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &gqlFragment{name: name, typeCondition: typeCond, directives: dirs, selection: sel}, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []gqlSelection
+	for !p.peek(gqlTokPunct, "}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, p.lex.errorf(p.tok.pos, "empty selection set")
+	}
+	return sels, p.advance()
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	if p.peek(gqlTokPunct, "...") {
+		pos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == gqlTokName && p.tok.value != "on" {
+			spread := &gqlFragmentSpread{name: p.tok.value, pos: pos}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			dirs, err := p.directives()
+			spread.directives = dirs
+			return spread, err
+		}
+		frag := &gqlInlineFragment{}
+		if ok, err := p.skip(gqlTokName, "on"); err != nil {
+			return nil, err
+		} else if ok {
+			if frag.typeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if frag.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		frag.selection, err = p.selectionSet()
+		return frag, err
+	}
+
+	f := &gqlField{pos: p.tok.pos}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(gqlTokPunct, ":"); err != nil {
+		return nil, err
+	} else if ok {
+		f.alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	f.name = name
+	if p.peek(gqlTokPunct, "(") {
+		if f.arguments, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(gqlTokPunct, "{") {
+		if f.selection, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *gqlParser) arguments(constant bool) ([]*gqlArgument, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []*gqlArgument
+	for !p.peek(gqlTokPunct, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		val, err := p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range args {
+			if a.name == name {
+				return nil, fmt.Errorf("duplicate argument %q", name)
+			}
+		}
+		args = append(args, &gqlArgument{name: name, value: val})
+	}
+	if len(args) == 0 {
+		return nil, p.lex.errorf(p.tok.pos, "empty argument list")
+	}
+	return args, p.advance()
+}
+
+func (p *gqlParser) directives() ([]*gqlDirective, error) {
+	var dirs []*gqlDirective
+	for p.peek(gqlTokPunct, "@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		d := &gqlDirective{name: name}
+		if p.peek(gqlTokPunct, "(") {
+			if d.arguments, err = p.arguments(false); err != nil {
+				return nil, err
+			}
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs, nil
+}
+
+// value parses a value. Variables are not allowed in constant values such as
+// variable defaults.
+func (p *gqlParser) value(constant bool) (*gqlValue, error) {
+	tok := p.tok
+	switch tok.kind {
+	case gqlTokPunct:
+		switch tok.value {
+		case "$":
+			if constant {
+				return nil, p.lex.errorf(tok.pos, "unexpected variable in constant value")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			return &gqlValue{kind: gqlVariable, raw: name}, err
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v := &gqlValue{kind: gqlList, list: []*gqlValue{}}
+			for !p.peek(gqlTokPunct, "]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.list = append(v.list, item)
+			}
+			return v, p.advance()
+		case "{":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v := &gqlValue{kind: gqlObject, fields: []*gqlArgument{}}
+			for !p.peek(gqlTokPunct, "}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				field, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.fields = append(v.fields, &gqlArgument{name: name, value: field})
+			}
+			return v, p.advance()
+		}
+	case gqlTokInt:
+		return &gqlValue{kind: gqlInt, raw: tok.value}, p.advance()
+	case gqlTokFloat:
+		return &gqlValue{kind: gqlFloat, raw: tok.value}, p.advance()
+	case gqlTokString:
+		return &gqlValue{kind: gqlString, raw: tok.value}, p.advance()
+	case gqlTokName:
+		v := &gqlValue{kind: gqlEnum, raw: tok.value}
+		switch tok.value {
+		case "true", "false":
+			v.kind = gqlBoolean
+		case "null":
+			v.kind = gqlNull
+		}
+		return v, p.advance()
+	}
+	return nil, p.unexpected()
+}
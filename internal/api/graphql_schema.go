@@ -0,0 +1,743 @@
+package api
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// Type kinds, as reported by introspection.
+const (
+	gqlKindScalar      = "SCALAR"
+	gqlKindObject      = "OBJECT"
+	gqlKindInputObject = "INPUT_OBJECT"
+	gqlKindEnum        = "ENUM"
+	gqlKindList        = "LIST"
+	gqlKindNonNull     = "NON_NULL"
+)
+
+// Root field operations.
+const (
+	gqlOpList       = "list"
+	gqlOpByPK       = "by_pk"
+	gqlOpCount      = "count"
+	gqlOpInsert     = "insert"
+	gqlOpInsertOne  = "insert_one"
+	gqlOpUpdate     = "update"
+	gqlOpUpdateByPK = "update_by_pk"
+	gqlOpDelete     = "delete"
+	gqlOpDeleteByPK = "delete_by_pk"
+	gqlOpFunction   = "function"
+)
+
+// gqlType is a type in the generated GraphQL schema. Named types are shared;
+// LIST and NON_NULL wrap ofType.
+type gqlType struct {
+	kind        string
+	name        string
+	description string
+	fields      []*gqlFieldDef   // OBJECT
+	inputFields []*gqlInputValue // INPUT_OBJECT
+	enumValues  []string         // ENUM
+	ofType      *gqlType         // LIST, NON_NULL
+	table       *schema.Table    // OBJECT types generated for tables
+}
+
+// field returns the object field with the given name, or nil.
+func (t *gqlType) field(name string) *gqlFieldDef {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// inputField returns the input object field with the given name, or nil.
+func (t *gqlType) inputField(name string) *gqlInputValue {
+	for _, f := range t.inputFields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// named returns the named type inside any LIST and NON_NULL wrappers.
+func (t *gqlType) named() *gqlType {
+	for t.ofType != nil {
+		t = t.ofType
+	}
+	return t
+}
+
+// isLeaf reports whether values of the type are scalars or enums.
+func (t *gqlType) isLeaf() bool {
+	k := t.named().kind
+	return k == gqlKindScalar || k == gqlKindEnum
+}
+
+func (t *gqlType) String() string {
+	switch t.kind {
+	case gqlKindList:
+		return "[" + t.ofType.String() + "]"
+	case gqlKindNonNull:
+		return t.ofType.String() + "!"
+	}
+	return t.name
+}
+
+func gqlNonNull(t *gqlType) *gqlType { return &gqlType{kind: gqlKindNonNull, ofType: t} }
+func gqlListOf(t *gqlType) *gqlType  { return &gqlType{kind: gqlKindList, ofType: t} }
+
+// gqlFieldDef is a field of an object type, with what it resolves to.
+type gqlFieldDef struct {
+	name        string
+	description string
+	args        []*gqlInputValue
+	typ         *gqlType
+
+	// Root fields.
+	op    string
+	table *schema.Table
+	fn    *schema.Function
+
+	// Table fields: exactly one is set.
+	column   *schema.Column
+	computed *schema.ComputedField
+	rel      *schema.Relationship
+}
+
+// arg returns the argument with the given name, or nil.
+func (f *gqlFieldDef) arg(name string) *gqlInputValue {
+	for _, a := range f.args {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// gqlInputValue is an argument or input object field.
+type gqlInputValue struct {
+	name         string
+	description  string
+	typ          *gqlType
+	defaultValue string // GraphQL literal; empty when there is none
+}
+
+// gqlDirectiveDef is a directive the executor supports.
+type gqlDirectiveDef struct {
+	name        string
+	description string
+	locations   []string
+	args        []*gqlInputValue
+}
+
+// gqlSchema is the GraphQL schema generated from a schema cache.
+type gqlSchema struct {
+	types      map[string]*gqlType
+	typeNames  []string // in introspection order
+	query      *gqlType
+	mutation   *gqlType // nil when nothing is writable
+	directives []*gqlDirectiveDef
+
+	// introspection is the __schema value, built once.
+	introspection map[string]any
+}
+
+// gqlNamePattern matches valid GraphQL names. Names starting with "__" are
+// reserved for introspection.
+var gqlNamePattern = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+func validGraphQLName(name string) bool {
+	return gqlNamePattern.MatchString(name) && !strings.HasPrefix(name, "__")
+}
+
+// gqlBuilder accumulates the types of a schema under construction.
+type gqlBuilder struct {
+	sc     *schema.SchemaCache
+	s      *gqlSchema
+	tables map[*schema.Table]*gqlType
+}
+
+// buildGraphQLSchema generates the GraphQL schema for the tables, relationships
+// and functions in sc. Every collection becomes an object type named after the
+// table, with a list, a by-primary-key and a count query, and, unless it is a
+// view, insert, update and delete mutations. Functions become mutations.
+// Tables, columns and functions whose names are not valid GraphQL names, or
+// that collide with a name already taken, are left out.
+func buildGraphQLSchema(sc *schema.SchemaCache) *gqlSchema {
+	b := &gqlBuilder{
+		sc:     sc,
+		s:      &gqlSchema{types: map[string]*gqlType{}},
+		tables: map[*schema.Table]*gqlType{},
+	}
+	b.addScalars()
+	b.addIntrospectionTypes()
+
+	query := &gqlType{kind: gqlKindObject, name: "Query", description: "Reads from the database's collections."}
+	mutation := &gqlType{kind: gqlKindObject, name: "Mutation", description: "Writes to the database's collections and calls its functions."}
+	b.add(query)
+
+	var tables []*schema.Table
+	for _, tbl := range sc.Tables {
+		if sc.TableByName(tbl.Name) == tbl {
+			tables = append(tables, tbl)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+
+	// Declare every table type first so relationships can refer to them.
+	for _, tbl := range tables {
+		if !validGraphQLName(tbl.Name) || b.s.types[tbl.Name] != nil || tbl.Name == "Mutation" {
+			continue
+		}
+		t := &gqlType{kind: gqlKindObject, name: tbl.Name, description: tbl.Comment, table: tbl}
+		b.add(t)
+		b.tables[tbl] = t
+	}
+	for _, tbl := range tables {
+		if t := b.tables[tbl]; t != nil {
+			b.addTableFields(t)
+		}
+	}
+	for _, tbl := range tables {
+		if t := b.tables[tbl]; t != nil {
+			b.addQueryFields(query, t)
+			b.addMutationFields(mutation, t)
+		}
+	}
+
+	var fns []*schema.Function
+	for _, fn := range sc.Functions {
+		if sc.FunctionByName(fn.Name) == fn {
+			fns = append(fns, fn)
+		}
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].Name < fns[j].Name })
+	for _, fn := range fns {
+		b.addFunction(mutation, fn)
+	}
+
+	b.s.query = query
+	if len(mutation.fields) > 0 {
+		b.add(mutation)
+		b.s.mutation = mutation
+	}
+	b.s.introspection = introspectSchema(b.s)
+	return b.s
+}
+
+func (b *gqlBuilder) add(t *gqlType) {
+	b.s.types[t.name] = t
+	b.s.typeNames = append(b.s.typeNames, t.name)
+}
+
+func (b *gqlBuilder) scalar(name string) *gqlType { return b.s.types[name] }
+
+func (b *gqlBuilder) addScalars() {
+	for _, s := range []struct{ name, description string }{
+		{"Int", "A signed 32-bit integer."},
+		{"Float", "A signed double-precision floating-point value."},
+		{"String", "A UTF-8 character sequence."},
+		{"Boolean", "true or false."},
+		{"ID", "A unique identifier, serialized as a string."},
+		{"BigInt", "A signed 64-bit integer."},
+		{"JSON", "Any JSON value."},
+	} {
+		b.add(&gqlType{kind: gqlKindScalar, name: s.name, description: s.description})
+	}
+}
+
+// scalarFor returns the scalar type for values of a Postgres type.
+func (b *gqlBuilder) scalarFor(jsonType, typeName string) *gqlType {
+	base := strings.ToLower(typeName)
+	if i := strings.Index(base, "("); i > 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	switch jsonType {
+	case "integer":
+		switch base {
+		case "bigint", "int8", "bigserial", "serial8":
+			return b.scalar("BigInt")
+		}
+		return b.scalar("Int")
+	case "number":
+		return b.scalar("Float")
+	case "boolean":
+		return b.scalar("Boolean")
+	case "string":
+		return b.scalar("String")
+	}
+	return b.scalar("JSON")
+}
+
+// valueType returns the type of a column or computed field's values.
+func (b *gqlBuilder) valueType(typeName, jsonType string, isJSON, isArray bool) *gqlType {
+	if isJSON {
+		return b.scalar("JSON")
+	}
+	if isArray {
+		elem := strings.TrimSuffix(typeName, "[]")
+		return gqlListOf(b.scalarFor(schema.JSONTypeOf(elem), elem))
+	}
+	return b.scalarFor(jsonType, typeName)
+}
+
+func (b *gqlBuilder) columnType(col *schema.Column) *gqlType {
+	if col.IsEnum {
+		return b.scalar("String")
+	}
+	return b.valueType(col.TypeName, col.JSONType, col.IsJSON, col.IsArray)
+}
+
+func (b *gqlBuilder) addTableFields(t *gqlType) {
+	tbl := t.table
+	taken := map[string]bool{"__typename": true}
+	for _, col := range tbl.Columns {
+		if !validGraphQLName(col.Name) {
+			continue
+		}
+		typ := b.columnType(col)
+		if !col.IsNullable {
+			typ = gqlNonNull(typ)
+		}
+		t.fields = append(t.fields, &gqlFieldDef{name: col.Name, description: col.Comment, typ: typ, column: col})
+		taken[col.Name] = true
+	}
+	for _, cf := range tbl.ComputedFields {
+		if !validGraphQLName(cf.Name) || taken[cf.Name] {
+			continue
+		}
+		t.fields = append(t.fields, &gqlFieldDef{
+			name:        cf.Name,
+			description: cf.Comment,
+			typ:         b.valueType(cf.TypeName, cf.JSONType, cf.IsJSON, cf.IsArray),
+			computed:    cf,
+		})
+		taken[cf.Name] = true
+	}
+	for _, rel := range tbl.Relationships {
+		relTable := b.sc.Tables[rel.ToSchema+"."+rel.ToTable]
+		relType := b.tables[relTable]
+		if relType == nil || !validGraphQLName(rel.FieldName) || taken[rel.FieldName] {
+			continue
+		}
+		if len(rel.FromColumns) == 0 || tbl.ColumnByName(rel.FromColumns[0]) == nil || !validGraphQLName(rel.FromColumns[0]) {
+			continue
+		}
+		f := &gqlFieldDef{name: rel.FieldName, rel: rel, table: relTable}
+		if rel.Type == "many-to-one" {
+			f.typ = relType
+		} else {
+			f.typ = gqlNonNull(gqlListOf(gqlNonNull(relType)))
+			f.args = []*gqlInputValue{
+				{name: "filter", description: "Filter expression, as in the REST filter parameter.", typ: b.scalar("String")},
+				{name: "sort", description: "Sort fields, as in the REST sort parameter.", typ: b.scalar("String")},
+				{name: "limit", description: "Maximum number of related records per parent.", typ: b.scalar("Int")},
+			}
+		}
+		t.fields = append(t.fields, f)
+		taken[rel.FieldName] = true
+	}
+}
+
+// pkArgs returns the primary key columns as required arguments, or nil if the
+// table has no primary key usable in GraphQL.
+func (b *gqlBuilder) pkArgs(tbl *schema.Table) []*gqlInputValue {
+	if len(tbl.PrimaryKey) == 0 {
+		return nil
+	}
+	args := make([]*gqlInputValue, 0, len(tbl.PrimaryKey))
+	for _, name := range tbl.PrimaryKey {
+		col := tbl.ColumnByName(name)
+		if col == nil || !validGraphQLName(name) {
+			return nil
+		}
+		args = append(args, &gqlInputValue{name: name, typ: gqlNonNull(b.columnType(col))})
+	}
+	return args
+}
+
+// addRoot adds a root field unless its name is taken.
+func (b *gqlBuilder) addRoot(root *gqlType, f *gqlFieldDef) {
+	if root.field(f.name) != nil {
+		return
+	}
+	root.fields = append(root.fields, f)
+}
+
+func (b *gqlBuilder) addQueryFields(query *gqlType, t *gqlType) {
+	tbl := t.table
+	str := b.scalar("String")
+	integer := b.scalar("Int")
+	filter := &gqlInputValue{name: "filter", description: "Filter expression, as in the REST filter parameter.", typ: str}
+
+	b.addRoot(query, &gqlFieldDef{
+		name:        tbl.Name,
+		description: "Lists " + tbl.Name + " records.",
+		typ:         gqlNonNull(gqlListOf(gqlNonNull(t))),
+		op:          gqlOpList,
+		table:       tbl,
+		args: []*gqlInputValue{
+			filter,
+			{name: "sort", description: "Sort fields, as in the REST sort parameter.", typ: str},
+			{name: "search", description: "Full-text search term.", typ: str},
+			{name: "searchFields", description: "Comma-separated columns to search.", typ: str},
+			{name: "page", description: "Page number, starting at 1.", typ: integer, defaultValue: "1"},
+			{name: "perPage", description: "Records per page, at most 500.", typ: integer, defaultValue: "20"},
+		},
+	})
+	if args := b.pkArgs(tbl); args != nil {
+		b.addRoot(query, &gqlFieldDef{
+			name:        tbl.Name + "_by_pk",
+			description: "Reads a " + tbl.Name + " record by primary key.",
+			typ:         t,
+			op:          gqlOpByPK,
+			table:       tbl,
+			args:        args,
+		})
+	}
+	b.addRoot(query, &gqlFieldDef{
+		name:        tbl.Name + "_count",
+		description: "Counts " + tbl.Name + " records.",
+		typ:         gqlNonNull(integer),
+		op:          gqlOpCount,
+		table:       tbl,
+		args:        []*gqlInputValue{filter},
+	})
+}
+
+func (b *gqlBuilder) addMutationFields(mutation *gqlType, t *gqlType) {
+	tbl := t.table
+	if tbl.Kind != "table" && tbl.Kind != "partitioned_table" {
+		return
+	}
+
+	insert := &gqlType{kind: gqlKindInputObject, name: tbl.Name + "_insert_input", description: "Values for a new " + tbl.Name + " record."}
+	set := &gqlType{kind: gqlKindInputObject, name: tbl.Name + "_set_input", description: "Values to change on " + tbl.Name + " records."}
+	named := 0
+	for _, col := range tbl.Columns {
+		if !validGraphQLName(col.Name) {
+			continue
+		}
+		named++
+		typ := b.columnType(col)
+		if tbl.CanInsert(col.Name) {
+			insertType := typ
+			if !col.IsNullable && !col.HasDefault() {
+				insertType = gqlNonNull(typ)
+			}
+			insert.inputFields = append(insert.inputFields, &gqlInputValue{name: col.Name, description: col.Comment, typ: insertType})
+		}
+		if tbl.CanUpdate(col.Name) {
+			set.inputFields = append(set.inputFields, &gqlInputValue{name: col.Name, description: col.Comment, typ: typ})
+		}
+	}
+	if named == 0 || b.s.types[insert.name] != nil || b.s.types[set.name] != nil {
+		return
+	}
+
+	filter := &gqlInputValue{name: "filter", description: "Filter expression selecting the records.", typ: gqlNonNull(b.scalar("String"))}
+	records := gqlNonNull(gqlListOf(gqlNonNull(t)))
+
+	// Input objects need at least one field, so columns that are all
+	// read-only leave out the mutations that would set them.
+	if len(insert.inputFields) > 0 {
+		b.add(insert)
+		b.addRoot(mutation, &gqlFieldDef{
+			name:        "insert_" + tbl.Name,
+			description: "Inserts " + tbl.Name + " records.",
+			typ:         records,
+			op:          gqlOpInsert,
+			table:       tbl,
+			args:        []*gqlInputValue{{name: "objects", typ: gqlNonNull(gqlListOf(gqlNonNull(insert)))}},
+		})
+		b.addRoot(mutation, &gqlFieldDef{
+			name:        "insert_" + tbl.Name + "_one",
+			description: "Inserts a " + tbl.Name + " record.",
+			typ:         gqlNonNull(t),
+			op:          gqlOpInsertOne,
+			table:       tbl,
+			args:        []*gqlInputValue{{name: "object", typ: gqlNonNull(insert)}},
+		})
+	}
+	if len(set.inputFields) > 0 {
+		b.add(set)
+		b.addRoot(mutation, &gqlFieldDef{
+			name:        "update_" + tbl.Name,
+			description: "Updates the " + tbl.Name + " records matching filter.",
+			typ:         records,
+			op:          gqlOpUpdate,
+			table:       tbl,
+			args:        []*gqlInputValue{filter, {name: "set", typ: gqlNonNull(set)}},
+		})
+	}
+	b.addRoot(mutation, &gqlFieldDef{
+		name:        "delete_" + tbl.Name,
+		description: "Deletes the " + tbl.Name + " records matching filter.",
+		typ:         records,
+		op:          gqlOpDelete,
+		table:       tbl,
+		args:        []*gqlInputValue{filter},
+	})
+	if pk := b.pkArgs(tbl); pk != nil {
+		if len(set.inputFields) > 0 {
+			b.addRoot(mutation, &gqlFieldDef{
+				name:        "update_" + tbl.Name + "_by_pk",
+				description: "Updates a " + tbl.Name + " record by primary key. Returns null if there is none.",
+				typ:         t,
+				op:          gqlOpUpdateByPK,
+				table:       tbl,
+				args:        append(slices.Clone(pk), &gqlInputValue{name: "set", typ: gqlNonNull(set)}),
+			})
+		}
+		b.addRoot(mutation, &gqlFieldDef{
+			name:        "delete_" + tbl.Name + "_by_pk",
+			description: "Deletes a " + tbl.Name + " record by primary key. Returns null if there is none.",
+			typ:         t,
+			op:          gqlOpDeleteByPK,
+			table:       tbl,
+			args:        pk,
+		})
+	}
+}
+
+// addFunction adds a mutation calling fn. Functions with unnamed parameters
+// cannot be called by name and are left out.
+func (b *gqlBuilder) addFunction(mutation *gqlType, fn *schema.Function) {
+	if !validGraphQLName(fn.Name) || mutation.field(fn.Name) != nil {
+		return
+	}
+	f := &gqlFieldDef{name: fn.Name, description: fn.Comment, op: gqlOpFunction, fn: fn}
+	for _, p := range fn.Parameters {
+		if !validGraphQLName(p.Name) {
+			return
+		}
+		f.args = append(f.args, &gqlInputValue{name: p.Name, typ: b.typeFor(p.Type)})
+	}
+
+	ret := strings.TrimPrefix(fn.ReturnType, "SETOF ")
+	switch {
+	case fn.IsVoid:
+		f.typ = b.scalar("Boolean")
+	case b.rowType(ret) != nil:
+		f.typ = b.rowType(ret)
+		f.table = f.typ.table
+		if fn.ReturnsSet {
+			f.typ = gqlNonNull(gqlListOf(gqlNonNull(f.typ)))
+		}
+	case fn.ReturnsSet:
+		f.typ = gqlNonNull(gqlListOf(b.scalar("JSON")))
+	default:
+		f.typ = b.typeFor(ret)
+	}
+	mutation.fields = append(mutation.fields, f)
+}
+
+// rowType returns the object type of the table whose row type is typeName.
+func (b *gqlBuilder) rowType(typeName string) *gqlType {
+	name := typeName
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return b.tables[b.sc.TableByName(strings.Trim(name, `"`))]
+}
+
+// typeFor returns the type of a function parameter or scalar result.
+func (b *gqlBuilder) typeFor(typeName string) *gqlType {
+	if elem, ok := strings.CutSuffix(typeName, "[]"); ok {
+		return gqlListOf(b.typeFor(elem))
+	}
+	for _, e := range b.sc.Enums {
+		if e.Name == typeName || e.Schema+"."+e.Name == typeName {
+			return b.scalar("String")
+		}
+	}
+	return b.scalarFor(schema.JSONTypeOf(typeName), typeName)
+}
+
+// addIntrospectionTypes adds the types of the introspection system.
+func (b *gqlBuilder) addIntrospectionTypes() {
+	str, boolean := b.scalar("String"), b.scalar("Boolean")
+	nnStr, nnBool := gqlNonNull(str), gqlNonNull(boolean)
+	field := func(name string, typ *gqlType, args ...*gqlInputValue) *gqlFieldDef {
+		return &gqlFieldDef{name: name, typ: typ, args: args}
+	}
+	includeDeprecated := &gqlInputValue{name: "includeDeprecated", typ: boolean, defaultValue: "false"}
+
+	typeKind := &gqlType{kind: gqlKindEnum, name: "__TypeKind", description: "The kinds of types.",
+		enumValues: []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"}}
+	location := &gqlType{kind: gqlKindEnum, name: "__DirectiveLocation", description: "Where a directive can be used.",
+		enumValues: []string{"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT", "VARIABLE_DEFINITION",
+			"SCHEMA", "SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INTERFACE", "UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION"}}
+	typ := &gqlType{kind: gqlKindObject, name: "__Type", description: "A type in the schema."}
+	fieldType := &gqlType{kind: gqlKindObject, name: "__Field", description: "A field of an object type."}
+	inputValue := &gqlType{kind: gqlKindObject, name: "__InputValue", description: "An argument or input object field."}
+	enumValue := &gqlType{kind: gqlKindObject, name: "__EnumValue", description: "A value of an enum type."}
+	directive := &gqlType{kind: gqlKindObject, name: "__Directive", description: "A directive the server supports."}
+	schemaType := &gqlType{kind: gqlKindObject, name: "__Schema", description: "The schema's types, root types and directives."}
+
+	list := func(t *gqlType) *gqlType { return gqlNonNull(gqlListOf(gqlNonNull(t))) }
+	schemaType.fields = []*gqlFieldDef{
+		field("description", str),
+		field("types", list(typ)),
+		field("queryType", gqlNonNull(typ)),
+		field("mutationType", typ),
+		field("subscriptionType", typ),
+		field("directives", list(directive)),
+	}
+	typ.fields = []*gqlFieldDef{
+		field("kind", gqlNonNull(typeKind)),
+		field("name", str),
+		field("description", str),
+		field("specifiedByURL", str),
+		field("fields", gqlListOf(gqlNonNull(fieldType)), includeDeprecated),
+		field("interfaces", gqlListOf(gqlNonNull(typ))),
+		field("possibleTypes", gqlListOf(gqlNonNull(typ))),
+		field("enumValues", gqlListOf(gqlNonNull(enumValue)), includeDeprecated),
+		field("inputFields", gqlListOf(gqlNonNull(inputValue)), includeDeprecated),
+		field("ofType", typ),
+	}
+	fieldType.fields = []*gqlFieldDef{
+		field("name", nnStr),
+		field("description", str),
+		field("args", list(inputValue), includeDeprecated),
+		field("type", gqlNonNull(typ)),
+		field("isDeprecated", nnBool),
+		field("deprecationReason", str),
+	}
+	inputValue.fields = []*gqlFieldDef{
+		field("name", nnStr),
+		field("description", str),
+		field("type", gqlNonNull(typ)),
+		field("defaultValue", str),
+		field("isDeprecated", nnBool),
+		field("deprecationReason", str),
+	}
+	enumValue.fields = []*gqlFieldDef{
+		field("name", nnStr),
+		field("description", str),
+		field("isDeprecated", nnBool),
+		field("deprecationReason", str),
+	}
+	directive.fields = []*gqlFieldDef{
+		field("name", nnStr),
+		field("description", str),
+		field("locations", list(location)),
+		field("args", list(inputValue), includeDeprecated),
+		field("isRepeatable", nnBool),
+	}
+	for _, t := range []*gqlType{schemaType, typ, fieldType, inputValue, enumValue, directive, typeKind, location} {
+		b.add(t)
+	}
+
+	for _, name := range []string{"include", "skip"} {
+		b.s.directives = append(b.s.directives, &gqlDirectiveDef{
+			name:        name,
+			description: "Directs the executor to " + name + " this field or fragment only when the if argument is true.",
+			locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+			args:        []*gqlInputValue{{name: "if", typ: nnBool}},
+		})
+	}
+}
+
+// introspectSchema builds the __schema value. Named types are built once and
+// shared, so the value may contain cycles; it is only ever walked as far as
+// a query's selections reach.
+func introspectSchema(s *gqlSchema) map[string]any {
+	named := make(map[string]map[string]any, len(s.types))
+	for name, t := range s.types {
+		named[name] = map[string]any{"__typename": "__Type", "kind": t.kind, "name": name, "description": gqlDescription(t.description), "specifiedByURL": nil}
+	}
+
+	var typeRef func(t *gqlType) map[string]any
+	typeRef = func(t *gqlType) map[string]any {
+		if t.name != "" {
+			return named[t.name]
+		}
+		return map[string]any{
+			"__typename": "__Type", "kind": t.kind, "name": nil, "description": nil, "specifiedByURL": nil,
+			"fields": nil, "interfaces": nil, "possibleTypes": nil, "enumValues": nil, "inputFields": nil,
+			"ofType": typeRef(t.ofType),
+		}
+	}
+	inputValues := func(values []*gqlInputValue) []any {
+		out := make([]any, len(values))
+		for i, v := range values {
+			var def any
+			if v.defaultValue != "" {
+				def = v.defaultValue
+			}
+			out[i] = map[string]any{
+				"__typename": "__InputValue", "name": v.name, "description": gqlDescription(v.description),
+				"type": typeRef(v.typ), "defaultValue": def, "isDeprecated": false, "deprecationReason": nil,
+			}
+		}
+		return out
+	}
+
+	types := make([]any, 0, len(s.typeNames))
+	for _, name := range s.typeNames {
+		t, m := s.types[name], named[name]
+		m["fields"], m["interfaces"], m["possibleTypes"], m["enumValues"], m["inputFields"], m["ofType"] = nil, nil, nil, nil, nil, nil
+		switch t.kind {
+		case gqlKindObject:
+			fields := make([]any, len(t.fields))
+			for i, f := range t.fields {
+				fields[i] = map[string]any{
+					"__typename": "__Field", "name": f.name, "description": gqlDescription(f.description),
+					"args": inputValues(f.args), "type": typeRef(f.typ), "isDeprecated": false, "deprecationReason": nil,
+				}
+			}
+			m["fields"], m["interfaces"] = fields, []any{}
+		case gqlKindInputObject:
+			m["inputFields"] = inputValues(t.inputFields)
+		case gqlKindEnum:
+			values := make([]any, len(t.enumValues))
+			for i, v := range t.enumValues {
+				values[i] = map[string]any{"__typename": "__EnumValue", "name": v, "description": nil, "isDeprecated": false, "deprecationReason": nil}
+			}
+			m["enumValues"] = values
+		}
+		types = append(types, m)
+	}
+
+	directives := make([]any, len(s.directives))
+	for i, d := range s.directives {
+		locations := make([]any, len(d.locations))
+		for j, l := range d.locations {
+			locations[j] = l
+		}
+		directives[i] = map[string]any{
+			"__typename": "__Directive", "name": d.name, "description": gqlDescription(d.description),
+			"locations": locations, "args": inputValues(d.args), "isRepeatable": false,
+		}
+	}
+
+	var mutationType any
+	if s.mutation != nil {
+		mutationType = named[s.mutation.name]
+	}
+	return map[string]any{
+		"__typename":       "__Schema",
+		"description":      nil,
+		"types":            types,
+		"queryType":        named[s.query.name],
+		"mutationType":     mutationType,
+		"subscriptionType": nil,
+		"directives":       directives,
+	}
+}
+
+// gqlDescription returns nil for an empty description so it serializes as null.
+func gqlDescription(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,545 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func graphQLTestSchema() *schema.SchemaCache {
+	sc := relatedTestSchema()
+	for _, tbl := range sc.Tables {
+		for _, col := range tbl.Columns {
+			col.JSONType = schema.JSONTypeOf(col.TypeName)
+			col.IsNullable = !col.IsPrimaryKey && col.Name != "title"
+			if col.IsPrimaryKey {
+				col.DefaultExpr = "nextval('" + tbl.Name + "_id_seq'::regclass)"
+			}
+		}
+	}
+	sc.Tables["public.posts"].Columns = append(sc.Tables["public.posts"].Columns,
+		&schema.Column{Name: "views", TypeName: "bigint", JSONType: "integer", DefaultExpr: "0"},
+		&schema.Column{Name: "labels", TypeName: "text[]", JSONType: "array", IsArray: true, IsNullable: true},
+		&schema.Column{Name: "meta", TypeName: "jsonb", JSONType: "object", IsJSON: true, IsNullable: true},
+	)
+	sc.Tables["public.post_stats"] = &schema.Table{
+		Schema: "public", Name: "post_stats", Kind: "view",
+		Columns: []*schema.Column{{Name: "post_id", TypeName: "integer", JSONType: "integer"}},
+	}
+	sc.Functions = map[string]*schema.Function{
+		"public.publish": {Schema: "public", Name: "publish", ReturnType: "posts", RowTable: "",
+			Parameters: []*schema.FuncParam{{Name: "post_id", Type: "integer", Position: 1}}},
+		"public.cleanup": {Schema: "public", Name: "cleanup", ReturnType: "void", IsVoid: true},
+	}
+	return sc
+}
+
+// doGraphQL posts a GraphQL request and decodes the response.
+func doGraphQL(t *testing.T, h http.Handler, query string, variables map[string]any) (int, map[string]any) {
+	t.Helper()
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	testutil.NoError(t, err)
+	w := doRequest(h, "POST", "/graphql", string(body))
+	var resp map[string]any
+	testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+// gqlErrorMessage returns the first error message of a GraphQL response.
+func gqlErrorMessage(t *testing.T, resp map[string]any) string {
+	t.Helper()
+	errs, ok := resp["errors"].([]any)
+	testutil.True(t, ok && len(errs) > 0, "expected errors, got %v", resp)
+	return errs[0].(map[string]any)["message"].(string)
+}
+
+func TestParseGraphQLDocument(t *testing.T) {
+	doc, err := parseGraphQL(`
+		# Fetch posts.
+		query Posts($limit: Int = 5, $ids: [Int!]!) @cached {
+			items: posts(filter: "title != 'x'", perPage: $limit) {
+				id, title
+				...PostFields @include(if: true)
+				... on posts { author { name } }
+				... @skip(if: false) { id }
+			}
+		}
+		fragment PostFields on posts {
+			comments(limit: 2, sort: "-id") { id }
+			meta(value: {a: [1, 2.5, "s", null, true, RED], b: """
+				block
+				  string
+			"""})
+		}`)
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, doc.operations, 1)
+
+	op := doc.operations[0]
+	testutil.Equal(t, op.kind, "query")
+	testutil.Equal(t, op.name, "Posts")
+	testutil.SliceLen(t, op.variables, 2)
+	testutil.Equal(t, op.variables[0].typ.String(), "Int")
+	testutil.Equal(t, op.variables[0].defaultValue.raw, "5")
+	testutil.Equal(t, op.variables[1].typ.String(), "[Int!]!")
+
+	items := op.selection[0].(*gqlField)
+	testutil.Equal(t, items.alias, "items")
+	testutil.Equal(t, items.name, "posts")
+	testutil.Equal(t, items.responseKey(), "items")
+	testutil.SliceLen(t, items.arguments, 2)
+	testutil.Equal(t, items.arguments[0].value.raw, "title != 'x'")
+	testutil.Equal(t, items.arguments[1].value.kind, gqlVariable)
+	testutil.SliceLen(t, items.selection, 5)
+
+	spread := items.selection[2].(*gqlFragmentSpread)
+	testutil.Equal(t, spread.name, "PostFields")
+	testutil.Equal(t, spread.directives[0].name, "include")
+	testutil.Equal(t, items.selection[3].(*gqlInlineFragment).typeCondition, "posts")
+	testutil.Equal(t, items.selection[4].(*gqlInlineFragment).typeCondition, "")
+
+	frag := doc.fragments["PostFields"]
+	testutil.NotNil(t, frag)
+	testutil.Equal(t, frag.typeCondition, "posts")
+	meta := frag.selection[1].(*gqlField)
+	obj := meta.arguments[0].value
+	testutil.Equal(t, obj.kind, gqlObject)
+	list := obj.fields[0].value.list
+	testutil.SliceLen(t, list, 6)
+	testutil.Equal(t, list[0].kind, gqlInt)
+	testutil.Equal(t, list[1].kind, gqlFloat)
+	testutil.Equal(t, list[2].kind, gqlString)
+	testutil.Equal(t, list[3].kind, gqlNull)
+	testutil.Equal(t, list[4].kind, gqlBoolean)
+	testutil.Equal(t, list[5].kind, gqlEnum)
+	testutil.Equal(t, obj.fields[1].value.raw, "block\n  string")
+}
+
+func TestParseGraphQLShorthandAndStrings(t *testing.T) {
+	doc, err := parseGraphQL(`{ posts(filter: "a\"b\\cé\n") { id } }`)
+	testutil.NoError(t, err)
+	testutil.Equal(t, doc.operations[0].kind, "query")
+	f := doc.operations[0].selection[0].(*gqlField)
+	testutil.Equal(t, f.arguments[0].value.raw, "a\"b\\cé\n")
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"empty", ``, "no operations"},
+		{"unclosed selection", `{ posts { id }`, "end of document"},
+		{"empty selection", `{ posts { } }`, "empty selection set"},
+		{"bad character", `{ posts ? }`, "unexpected character"},
+		{"unterminated string", `{ posts(filter: "abc) { id } }`, "unterminated string"},
+		{"leading zero", `{ posts(page: 01) { id } }`, "leading zero"},
+		{"variable in default", `query ($a: Int = $b) { posts { id } }`, "unexpected variable"},
+		{"duplicate argument", `{ posts(page: 1, page: 2) { id } }`, "duplicate argument"},
+		{"duplicate fragment", `{ posts { ...F } } fragment F on posts { id } fragment F on posts { id }`, "duplicate fragment"},
+		{"missing on", `fragment F posts { id }`, `expected "on"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGraphQL(tt.doc)
+			testutil.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestParseGraphQLErrorLocation(t *testing.T) {
+	_, err := parseGraphQL("{\n  posts {\n    id %\n  }\n}")
+	var syntaxErr *gqlSyntaxError
+	testutil.True(t, errors.As(err, &syntaxErr), "expected a syntax error, got %v", err)
+	testutil.Equal(t, syntaxErr.pos.line, 3)
+	testutil.Equal(t, syntaxErr.pos.column, 8)
+}
+
+func TestBuildGraphQLSchemaTypes(t *testing.T) {
+	s := buildGraphQLSchema(graphQLTestSchema())
+
+	posts := s.types["posts"]
+	testutil.NotNil(t, posts)
+	testutil.Equal(t, posts.kind, gqlKindObject)
+	testutil.Equal(t, posts.field("id").typ.String(), "Int!")
+	testutil.Equal(t, posts.field("title").typ.String(), "String!")
+	testutil.Equal(t, posts.field("author_id").typ.String(), "Int")
+	testutil.Equal(t, posts.field("views").typ.String(), "BigInt!")
+	testutil.Equal(t, posts.field("labels").typ.String(), "[String]")
+	testutil.Equal(t, posts.field("meta").typ.String(), "JSON")
+
+	// Relationships: many-to-one is a single object, the others lists with
+	// filter, sort and limit arguments.
+	author := posts.field("author")
+	testutil.Equal(t, author.typ.String(), "authors")
+	testutil.SliceLen(t, author.args, 0)
+	comments := posts.field("comments")
+	testutil.Equal(t, comments.typ.String(), "[comments!]!")
+	testutil.NotNil(t, comments.arg("filter"))
+	testutil.NotNil(t, comments.arg("limit"))
+	testutil.Equal(t, posts.field("tags").typ.String(), "[tags!]!")
+	testutil.Equal(t, s.types["authors"].field("org").typ.String(), "orgs")
+}
+
+func TestBuildGraphQLSchemaRootFields(t *testing.T) {
+	s := buildGraphQLSchema(graphQLTestSchema())
+
+	list := s.query.field("posts")
+	testutil.Equal(t, list.op, gqlOpList)
+	testutil.Equal(t, list.typ.String(), "[posts!]!")
+	for _, arg := range []string{"filter", "sort", "search", "searchFields", "page", "perPage"} {
+		testutil.NotNil(t, list.arg(arg))
+	}
+	byPK := s.query.field("posts_by_pk")
+	testutil.Equal(t, byPK.typ.String(), "posts")
+	testutil.Equal(t, byPK.arg("id").typ.String(), "Int!")
+	testutil.Equal(t, s.query.field("posts_count").typ.String(), "Int!")
+
+	// Views are read-only and tables without a primary key have no _by_pk fields.
+	testutil.NotNil(t, s.query.field("post_stats"))
+	testutil.True(t, s.query.field("post_stats_by_pk") == nil, "expected no post_stats_by_pk field")
+	testutil.True(t, s.mutation.field("insert_post_stats") == nil, "expected no mutations on a view")
+
+	for _, name := range []string{"insert_posts", "insert_posts_one", "update_posts", "update_posts_by_pk", "delete_posts", "delete_posts_by_pk"} {
+		testutil.NotNil(t, s.mutation.field(name))
+	}
+	testutil.Equal(t, s.mutation.field("insert_posts").arg("objects").typ.String(), "[posts_insert_input!]!")
+	testutil.Equal(t, s.mutation.field("update_posts").arg("filter").typ.String(), "String!")
+	testutil.Equal(t, s.mutation.field("update_posts_by_pk").arg("set").typ.String(), "posts_set_input!")
+
+	// Insert inputs require NOT NULL columns without a default.
+	insert := s.types["posts_insert_input"]
+	testutil.Equal(t, insert.kind, gqlKindInputObject)
+	testutil.Equal(t, insert.inputField("title").typ.String(), "String!")
+	testutil.Equal(t, insert.inputField("views").typ.String(), "BigInt")
+	testutil.Equal(t, s.types["posts_set_input"].inputField("title").typ.String(), "String")
+
+	// Functions are mutations; a table row type result is that table's type.
+	publish := s.mutation.field("publish")
+	testutil.Equal(t, publish.op, gqlOpFunction)
+	testutil.Equal(t, publish.typ.String(), "posts")
+	testutil.Equal(t, publish.arg("post_id").typ.String(), "Int")
+	testutil.Equal(t, s.mutation.field("cleanup").typ.String(), "Boolean")
+}
+
+func TestBuildGraphQLSchemaSkipsInvalidNames(t *testing.T) {
+	sc := graphQLTestSchema()
+	sc.Tables["public.my-table"] = &schema.Table{
+		Schema: "public", Name: "my-table", Kind: "table",
+		Columns: []*schema.Column{{Name: "id", TypeName: "integer", JSONType: "integer"}},
+	}
+	sc.Tables["public.posts"].Columns = append(sc.Tables["public.posts"].Columns,
+		&schema.Column{Name: "has space", TypeName: "text", JSONType: "string"})
+	sc.Functions["public.bad"] = &schema.Function{Schema: "public", Name: "bad", ReturnType: "integer",
+		Parameters: []*schema.FuncParam{{Name: "", Type: "integer", Position: 1}}}
+
+	s := buildGraphQLSchema(sc)
+	testutil.True(t, s.types["my-table"] == nil, "expected no my-table type")
+	testutil.True(t, s.types["posts"].field("has space") == nil, "expected no has space field")
+	testutil.True(t, s.mutation.field("bad") == nil, "expected no bad mutation")
+}
+
+func TestBuildGraphQLSchemaReadOnly(t *testing.T) {
+	s := buildGraphQLSchema(&schema.SchemaCache{Tables: map[string]*schema.Table{
+		"public.logs": testSchema().Tables["public.logs"],
+	}})
+	testutil.NotNil(t, s.query.field("logs"))
+	testutil.True(t, s.mutation == nil, "expected no mutation type")
+	testutil.True(t, s.types["Mutation"] == nil, "expected no Mutation type")
+}
+
+func TestGraphQLSchemaFollowsReloads(t *testing.T) {
+	ch := testCacheHolder(graphQLTestSchema())
+	h := NewHandler(nil, ch, slog.Default(), nil)
+
+	first := h.graphQLSchema(ch.Get())
+	testutil.True(t, first == h.graphQLSchema(ch.Get()), "expected the schema to be reused")
+
+	ch.SetForTesting(testSchema())
+	second := h.graphQLSchema(ch.Get())
+	testutil.True(t, first != second, "expected the schema to be rebuilt")
+	testutil.NotNil(t, second.types["users"])
+	testutil.True(t, second.types["posts"] == nil, "expected no posts type after reload")
+}
+
+func TestGraphQLSchemaNotReady(t *testing.T) {
+	h := testHandler(nil)
+	w := doRequest(h, "POST", "/graphql", `{"query":"{ __typename }"}`)
+	testutil.Equal(t, w.Code, http.StatusServiceUnavailable)
+}
+
+func TestGraphQLRequestErrors(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+
+	w := doRequest(h, "POST", "/graphql", `not json`)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+	testutil.Contains(t, decodeError(t, w).Message, "invalid JSON body")
+
+	w = doRequest(h, "POST", "/graphql", `{}`)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+	testutil.Contains(t, decodeError(t, w).Message, "query is required")
+
+	code, resp := doGraphQL(t, h, "{ posts { id }", nil)
+	testutil.Equal(t, code, http.StatusBadRequest)
+	testutil.Contains(t, gqlErrorMessage(t, resp), "syntax error")
+	_, hasData := resp["data"]
+	testutil.False(t, hasData, "expected no data for a document that cannot be executed")
+
+	code, resp = doGraphQL(t, h, "query A { __typename } query B { __typename }", nil)
+	testutil.Equal(t, code, http.StatusBadRequest)
+	testutil.Contains(t, gqlErrorMessage(t, resp), "operationName is required")
+
+	code, resp = doGraphQL(t, h, "subscription { posts { id } }", nil)
+	testutil.Equal(t, code, http.StatusBadRequest)
+	testutil.Contains(t, gqlErrorMessage(t, resp), "subscriptions are not supported")
+
+	w = doRequest(h, "GET", "/graphql?query="+strings.ReplaceAll("mutation { cleanup }", " ", "+"), "")
+	testutil.Equal(t, w.Code, http.StatusMethodNotAllowed)
+}
+
+func TestGraphQLVariableErrors(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+
+	_, resp := doGraphQL(t, h, "query ($id: Int!) { posts_by_pk(id: $id) { id } }", nil)
+	testutil.Contains(t, gqlErrorMessage(t, resp), "variable $id of required type Int! was not provided")
+
+	_, resp = doGraphQL(t, h, "query ($id: Int!) { posts_by_pk(id: $id) { id } }", map[string]any{"id": "one"})
+	testutil.Contains(t, gqlErrorMessage(t, resp), "variable $id: expected an Int")
+
+	_, resp = doGraphQL(t, h, "query ($p: posts) { __typename }", nil)
+	testutil.Contains(t, gqlErrorMessage(t, resp), "posts is not an input type")
+
+	_, resp = doGraphQL(t, h, "{ posts_by_pk(id: $missing) { id } }", nil)
+	testutil.Contains(t, gqlErrorMessage(t, resp), "variable $missing is not defined")
+}
+
+func TestGraphQLValidationErrors(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+
+	tests := []struct {
+		name, query, want string
+	}{
+		{"unknown root field", "{ nope { id } }", `cannot query field "nope" on type "Query"`},
+		{"unknown field", "{ posts { nope } }", `cannot query field "nope" on type "posts"`},
+		{"missing selection", "{ posts }", `must have a selection`},
+		{"selection on leaf", "{ posts { id { x } } }", `must not have a selection`},
+		{"unknown argument", "{ posts(nope: 1) { id } }", `unknown argument "nope"`},
+		{"missing argument", "{ posts_by_pk { id } }", `argument "id" of type Int! is required`},
+		{"wrong argument type", `{ posts(page: "one") { id } }`, `argument "page": expected an Int`},
+		{"int out of range", `{ posts(page: 3000000000) { id } }`, `argument "page": expected an Int`},
+		{"unknown input field", `mutation { insert_posts_one(object: {nope: 1}) { id } }`, `unknown field "nope" of posts_insert_input`},
+		{"missing input field", `mutation { insert_posts_one(object: {author_id: 1}) { id } }`, `missing required field "title"`},
+		{"unknown fragment", "{ posts { ...Nope } }", `unknown fragment "Nope"`},
+		{"unknown directive", "{ posts @nope { id } }", `unknown directive @nope`},
+		{"conflicting aliases", "{ posts { x: id x: title } }", `conflict`},
+		{"schema on mutation", "mutation { __schema { types { name } } }", `cannot query field "__schema" on type "Mutation"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := doGraphQL(t, h, tt.query, nil)
+			testutil.Equal(t, code, http.StatusOK)
+			testutil.Contains(t, gqlErrorMessage(t, resp), tt.want)
+			data, hasData := resp["data"]
+			testutil.True(t, hasData && data == nil, "expected data to be null, got %v", resp)
+		})
+	}
+}
+
+func TestGraphQLErrorPathAndLocation(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+	_, resp := doGraphQL(t, h, "{\n  list: posts {\n    nope\n  }\n}", nil)
+	gerr := resp["errors"].([]any)[0].(map[string]any)
+	testutil.True(t, reflect.DeepEqual(gerr["path"], []any{"list"}), "path: %v", gerr["path"])
+	testutil.True(t, reflect.DeepEqual(gerr["locations"], []any{map[string]any{"line": 3.0, "column": 5.0}}), "locations: %v", gerr["locations"])
+}
+
+func TestGraphQLTypename(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+	code, resp := doGraphQL(t, h, "{ __typename t: __typename @skip(if: true) }", nil)
+	testutil.Equal(t, code, http.StatusOK)
+	testutil.True(t, reflect.DeepEqual(resp["data"], map[string]any{"__typename": "Query"}), "data: %v", resp["data"])
+}
+
+func TestGraphQLIntrospection(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+	code, resp := doGraphQL(t, h, `{
+		__schema {
+			queryType { name }
+			mutationType { name }
+			subscriptionType { name }
+			types { name kind }
+			directives { name locations }
+		}
+	}`, nil)
+	testutil.Equal(t, code, http.StatusOK)
+	s := resp["data"].(map[string]any)["__schema"].(map[string]any)
+	testutil.True(t, reflect.DeepEqual(s["queryType"], map[string]any{"name": "Query"}), "queryType: %v", s["queryType"])
+	testutil.True(t, reflect.DeepEqual(s["mutationType"], map[string]any{"name": "Mutation"}), "mutationType: %v", s["mutationType"])
+	testutil.Nil(t, s["subscriptionType"])
+
+	kinds := map[string]string{}
+	for _, typ := range s["types"].([]any) {
+		m := typ.(map[string]any)
+		kinds[m["name"].(string)] = m["kind"].(string)
+	}
+	testutil.Equal(t, kinds["posts"], "OBJECT")
+	testutil.Equal(t, kinds["posts_insert_input"], "INPUT_OBJECT")
+	testutil.Equal(t, kinds["JSON"], "SCALAR")
+	testutil.Equal(t, kinds["__TypeKind"], "ENUM")
+	testutil.Equal(t, kinds["__Schema"], "OBJECT")
+	testutil.SliceLen(t, s["directives"].([]any), 2)
+}
+
+func TestGraphQLIntrospectType(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+	code, resp := doGraphQL(t, h, `query ($name: String!) {
+		__type(name: $name) {
+			name
+			kind
+			...Fields
+		}
+		missing: __type(name: "nope") { name }
+	}
+	fragment Fields on __Type {
+		fields { name type { kind name ofType { name } } args { name defaultValue } }
+	}`, map[string]any{"name": "posts"})
+	testutil.Equal(t, code, http.StatusOK)
+	data := resp["data"].(map[string]any)
+	testutil.Nil(t, data["missing"])
+
+	typ := data["__type"].(map[string]any)
+	testutil.Equal(t, typ["name"].(string), "posts")
+	testutil.Equal(t, typ["kind"].(string), "OBJECT")
+	fields := map[string]map[string]any{}
+	for _, f := range typ["fields"].([]any) {
+		m := f.(map[string]any)
+		fields[m["name"].(string)] = m
+	}
+	id := fields["id"]["type"].(map[string]any)
+	testutil.Equal(t, id["kind"].(string), "NON_NULL")
+	testutil.Equal(t, id["ofType"].(map[string]any)["name"].(string), "Int")
+	testutil.Equal(t, fields["author"]["type"].(map[string]any)["name"].(string), "authors")
+	testutil.SliceLen(t, fields["comments"]["args"].([]any), 3)
+}
+
+func TestGraphQLIntrospectionKeepsOrder(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+	w := doRequest(h, "POST", "/graphql", `{"query":"{ __type(name: \"orgs\") { name kind } }"}`)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, strings.TrimSpace(w.Body.String()), `{"data":{"__type":{"name":"orgs","kind":"OBJECT"}}}`)
+}
+
+func TestGraphQLRepeatedFragments(t *testing.T) {
+	h := testHandler(graphQLTestSchema())
+
+	// Each fragment spreads the previous one ten times and selects the same
+	// nested fields again. Expanded naively, that is 10^30 spreads.
+	var b strings.Builder
+	b.WriteString("{ ...F30 }\nfragment F0 on Query { __typename __type(name: \"posts\") { name fields { name } } }\n")
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&b, "fragment F%d on Query { __type(name: \"posts\") { fields { name } }", i)
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&b, " ...F%d", i-1)
+		}
+		b.WriteString(" }\n")
+	}
+
+	start := time.Now()
+	code, resp := doGraphQL(t, h, b.String(), nil)
+	testutil.True(t, time.Since(start) < 5*time.Second, "took %s", time.Since(start))
+	testutil.Equal(t, code, http.StatusOK)
+	data := resp["data"].(map[string]any)
+	testutil.Equal(t, data["__typename"].(string), "Query")
+	typ := data["__type"].(map[string]any)
+	testutil.Equal(t, typ["name"].(string), "posts")
+	testutil.True(t, len(typ["fields"].([]any)) > 0, "fields: %v", typ["fields"])
+
+	_, resp = doGraphQL(t, h, "{ ...A } fragment A on Query { ...B } fragment B on Query { ...A }", nil)
+	testutil.Contains(t, gqlErrorMessage(t, resp), `fragment "A" spreads itself`)
+}
+
+func TestMergeSelections(t *testing.T) {
+	name := &gqlField{name: "name"}
+	fields := &gqlField{name: "fields", selection: []gqlSelection{name}}
+	spread := &gqlFragmentSpread{name: "F"}
+	into := []gqlSelection{fields, spread}
+
+	// Merging the same or equivalent selections again adds nothing.
+	merged := mergeSelections(into, []gqlSelection{fields, &gqlField{name: "fields", selection: []gqlSelection{&gqlField{name: "name"}}}, &gqlFragmentSpread{name: "F"}})
+	testutil.SliceLen(t, merged, 2)
+	testutil.SliceLen(t, merged[0].(*gqlField).selection, 1)
+
+	// New sub-selections are merged into the field of the same key.
+	merged = mergeSelections(into, []gqlSelection{&gqlField{name: "fields", selection: []gqlSelection{&gqlField{name: "kind"}}}, &gqlField{alias: "f", name: "fields"}})
+	testutil.SliceLen(t, merged, 3)
+	testutil.SliceLen(t, merged[0].(*gqlField).selection, 2)
+	testutil.SliceLen(t, fields.selection, 1)
+	testutil.True(t, into[0] == fields, "parsed selections must not be modified")
+}
+
+func TestCoerceInput(t *testing.T) {
+	s := buildGraphQLSchema(graphQLTestSchema())
+	intType := s.types["Int"]
+
+	v, err := coerceInput(json.Number("42"), gqlNonNull(intType))
+	testutil.NoError(t, err)
+	testutil.Equal(t, v.(int64), int64(42))
+
+	_, err = coerceInput(nil, gqlNonNull(intType))
+	testutil.ErrorContains(t, err, "expected a non-null Int")
+
+	_, err = coerceInput(json.Number("1.5"), intType)
+	testutil.ErrorContains(t, err, "expected an Int")
+
+	v, err = coerceInput("9007199254740993", s.types["BigInt"])
+	testutil.NoError(t, err)
+	testutil.Equal(t, v.(int64), int64(9007199254740993))
+
+	// A single value is accepted for a list.
+	v, err = coerceInput(json.Number("7"), gqlListOf(intType))
+	testutil.NoError(t, err)
+	testutil.True(t, reflect.DeepEqual(v, []any{int64(7)}), "got %v", v)
+
+	_, err = coerceInput(gqlEnumValue("RED"), s.types["String"])
+	testutil.ErrorContains(t, err, "expected a String")
+
+	v, err = coerceInput(map[string]any{"a": []any{json.Number("1"), json.Number("2.5"), gqlEnumValue("X")}}, s.types["JSON"])
+	testutil.NoError(t, err)
+	testutil.True(t, reflect.DeepEqual(v, map[string]any{"a": []any{int64(1), 2.5, "X"}}), "got %v", v)
+
+	v, err = coerceInput(map[string]any{"title": "t", "views": json.Number("3")}, s.types["posts_insert_input"])
+	testutil.NoError(t, err)
+	testutil.True(t, reflect.DeepEqual(v, map[string]any{"title": "t", "views": int64(3)}), "got %v", v)
+}
+
+func TestGraphQLResultMarshalOrder(t *testing.T) {
+	b, err := json.Marshal(gqlResult{{key: "z", value: 1}, {key: "a", value: gqlResult{{key: "y", value: nil}}}, {key: "m", value: []gqlResult{}}})
+	testutil.NoError(t, err)
+	testutil.Equal(t, string(b), `{"z":1,"a":{"y":null},"m":[]}`)
+}
+
+func TestGraphQLRecordFields(t *testing.T) {
+	s := buildGraphQLSchema(graphQLTestSchema())
+	doc, err := parseGraphQL(`{ posts { __typename title author { name } comments { id } } }`)
+	testutil.NoError(t, err)
+	e := &gqlExecutor{s: s, doc: doc}
+	sel := doc.operations[0].selection[0].(*gqlField).selection
+
+	fields, err := e.recordFields(s.types["posts"], sel)
+	testutil.NoError(t, err)
+	// Relationship fields select the column they join on.
+	testutil.True(t, reflect.DeepEqual(fields, []string{"title", "author_id", "id"}), "fields: %v", fields)
+
+	doc, err = parseGraphQL(`{ posts { __typename } }`)
+	testutil.NoError(t, err)
+	fields, err = e.recordFields(s.types["posts"], doc.operations[0].selection[0].(*gqlField).selection)
+	testutil.NoError(t, err)
+	testutil.True(t, reflect.DeepEqual(fields, []string{"id"}), "fields: %v", fields)
+}
@@ -3,11 +3,14 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/allyourbase/ayb/internal/auth"
 	"github.com/allyourbase/ayb/internal/httputil"
@@ -16,6 +19,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -32,6 +36,12 @@ type Handler struct {
 	schema *schema.CacheHolder
 	logger *slog.Logger
 	hub    *realtime.Hub // nil when realtime is unused
+
+	// isAdmin reports whether a request is made by an admin; nil if none is.
+	isAdmin func(*http.Request) bool
+
+	// graphql memoizes the GraphQL schema for the current schema cache.
+	graphql atomic.Pointer[graphQLSchemaCache]
 }
 
 // NewHandler creates a new API handler.
@@ -44,19 +54,38 @@ func NewHandler(pool *pgxpool.Pool, schemaCache *schema.CacheHolder, logger *slo
 	}
 }
 
+// SetAdminCheck sets the function that reports whether a request is made by
+// an admin, who may see soft-deleted records with ?withDeleted=true and the
+// history of any record, with every column. fn must report false when admin
+// auth is not configured, since then no request is known to be an admin's.
+func (h *Handler) SetAdminCheck(fn func(*http.Request) bool) {
+	h.isAdmin = fn
+}
+
 // Routes returns a chi.Router with all CRUD routes mounted.
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
+	r.Use(h.withDeletedParam)
 
 	r.Route("/collections/{table}", func(r chi.Router) {
 		r.Get("/", h.handleList)
 		r.Post("/", h.handleCreate)
+		r.Patch("/", h.handleBulkUpdate)
+		r.Delete("/", h.handleBulkDelete)
+		r.Get("/aggregate", h.handleAggregate)
+		r.Get("/export", h.handleExport)
+		r.Post("/import", h.HandleImport)
 		r.Get("/{id}", h.handleRead)
 		r.Patch("/{id}", h.handleUpdate)
 		r.Delete("/{id}", h.handleDelete)
+		r.Post("/{id}/restore", h.handleRestore)
+		r.Get("/{id}/history", h.handleHistory)
 	})
 
 	r.Post("/rpc/{function}", h.handleRPC)
+	r.Post("/batch", h.handleBatch)
+	r.Get("/graphql", h.handleGraphQL)
+	r.Post("/graphql", h.handleGraphQL)
 
 	return r
 }
@@ -67,21 +96,20 @@ func (h *Handler) Routes() chi.Router {
 // function when done (commits the tx on success, rolls back on error).
 // When no claims are present, returns the pool directly with a no-op cleanup.
 func (h *Handler) withRLS(r *http.Request) (Querier, func(error), error) {
-	claims := auth.ClaimsFromContext(r.Context())
-	if claims == nil {
+	if auth.ClaimsFromContext(r.Context()) == nil {
 		return h.pool, func(error) {}, nil
 	}
+	return h.withTx(r)
+}
 
-	tx, err := h.pool.Begin(r.Context())
+// withTx is withRLS, but always begins a transaction, for statements that must
+// be atomic with the checks made before or after them.
+func (h *Handler) withTx(r *http.Request) (Querier, func(error), error) {
+	tx, err := h.beginTx(r)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if err := auth.SetRLSContext(r.Context(), tx, claims); err != nil {
-		_ = tx.Rollback(r.Context())
-		return nil, nil, err
-	}
-
 	done := func(queryErr error) {
 		if queryErr != nil {
 			_ = tx.Rollback(r.Context())
@@ -92,9 +120,37 @@ func (h *Handler) withRLS(r *http.Request) (Querier, func(error), error) {
 	return tx, done, nil
 }
 
-// resolveTable looks up the table in the schema cache and validates it exists.
-func (h *Handler) resolveTable(w http.ResponseWriter, r *http.Request) *schema.Table {
+// beginTx always begins a transaction, setting RLS session variables when JWT
+// claims are present. Used by operations that must be atomic even for
+// unauthenticated requests. The caller owns the tx and must commit or roll back.
+func (h *Handler) beginTx(r *http.Request) (pgx.Tx, error) {
+	tx, err := h.pool.Begin(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := auth.SetRLSContext(r.Context(), tx, auth.ClaimsFromContext(r.Context())); err != nil {
+		_ = tx.Rollback(r.Context())
+		return nil, err
+	}
+	return tx, nil
+}
+
+// schemaFor returns the schema cache as seen by the role of the request, so
+// that columns hidden from the role can be neither read nor written. It
+// returns nil when the cache is not ready.
+func (h *Handler) schemaFor(r *http.Request) *schema.SchemaCache {
 	sc := h.schema.Get()
+	if sc == nil {
+		return nil
+	}
+	return sc.ForRole(auth.RoleOf(auth.ClaimsFromContext(r.Context())))
+}
+
+// resolveTable looks up the table in the schema cache, as seen by the role of
+// the request, and validates it exists.
+func (h *Handler) resolveTable(w http.ResponseWriter, r *http.Request) *schema.Table {
+	sc := h.schemaFor(r)
 	if sc == nil {
 		writeError(w, http.StatusServiceUnavailable, "schema cache not ready")
 		return nil
@@ -140,7 +196,8 @@ func extractPK(w http.ResponseWriter, r *http.Request, tbl *schema.Table) []stri
 	return pkValues
 }
 
-// handleRead handles GET /collections/{table}/{id}
+// handleRead handles GET /collections/{table}/{id}. The response carries an
+// ETag, and If-None-Match is answered with 304 when the row is unchanged.
 func (h *Handler) handleRead(w http.ResponseWriter, r *http.Request) {
 	tbl := h.resolveTable(w, r)
 	if tbl == nil {
@@ -156,7 +213,16 @@ func (h *Handler) handleRead(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fields := parseFields(r)
-	query, args := buildSelectOne(tbl, fields, pkValues)
+
+	sc := h.schemaFor(r)
+	var expand [][]expandStep
+	if expandParam := r.URL.Query().Get("expand"); expandParam != "" && sc != nil {
+		var err error
+		if expand, err = parseExpand(sc, tbl, expandParam); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expand: "+err.Error())
+			return
+		}
+	}
 
 	q, done, err := h.withRLS(r)
 	if err != nil {
@@ -164,6 +230,18 @@ func (h *Handler) handleRead(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	if !h.checkRecordRule(w, r, q, done, tbl, ruleView, nil, pkValues) {
+		return
+	}
+
+	// Expanded records have versions of their own, so the row's ETag does not
+	// describe the response, and the record is rendered by Postgres.
+	if len(expand) > 0 {
+		h.readExpanded(w, r, q, done, sc, tbl, fields, expand, pkValues)
+		return
+	}
+
+	query, args := buildSelectOne(tbl, fields, pkValues)
 
 	rows, err := q.Query(r.Context(), query, args...)
 	if err != nil {
@@ -191,24 +269,58 @@ func (h *Handler) handleRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Handle expand if requested.
-	if expandParam := r.URL.Query().Get("expand"); expandParam != "" {
-		sc := h.schema.Get()
-		if sc != nil {
-			expandRecords(r.Context(), q, sc, tbl, []map[string]any{record}, expandParam, h.logger)
-		}
+	etag := recordETag(record)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		done(nil)
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
 	done(nil)
 	writeJSON(w, http.StatusOK, record)
 }
 
+// readExpanded writes the record with the given primary key and its expanded
+// relations, rendered as JSON by Postgres. It finishes the transaction.
+func (h *Handler) readExpanded(w http.ResponseWriter, r *http.Request, q Querier, done func(error), sc *schema.SchemaCache, tbl *schema.Table, fields []string, expand [][]expandStep, pkValues []string) {
+	sel := newRecordSelect(tbl, fields, expand, nil)
+	rowsQuery, rowsArgs := sel.selectOne(pkValues)
+	query, args, err := sel.query(r.Context(), sc, rowsQuery, rowsArgs, nil)
+	if err != nil {
+		done(nil)
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+
+	var record []byte
+	err = q.QueryRow(r.Context(), query, args...).Scan(&record)
+	if errors.Is(err, pgx.ErrNoRows) {
+		done(nil)
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	done(err)
+	if err != nil {
+		if !mapPGError(w, err) {
+			h.logger.Error("query error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(append(record, '\n'))
+}
+
 // decodeAndValidateBody reads, decodes, and validates a JSON request body against the table schema.
+// Field errors are reported together; see validateBody.
 // Returns the decoded data and true on success. On failure, writes an error response and returns nil, false.
 func decodeAndValidateBody(w http.ResponseWriter, r *http.Request, tbl *schema.Table) (map[string]any, bool) {
 	r.Body = http.MaxBytesReader(w, r.Body, httputil.MaxBodySize)
 	var data map[string]any
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+	if err := decodeJSONNumbers(r.Body, &data); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return nil, false
 	}
@@ -222,6 +334,17 @@ func decodeAndValidateBody(w http.ResponseWriter, r *http.Request, tbl *schema.T
 		writeError(w, http.StatusBadRequest, "no recognized columns in request body")
 		return nil, false
 	}
+	if countWritableColumns(tbl, data, false) == 0 {
+		writeError(w, http.StatusBadRequest, "no writable columns in request body")
+		return nil, false
+	}
+
+	errs := fieldErrors{}
+	validateBody(errs, "", tbl, data, false, strictBody(r))
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return nil, false
+	}
 
 	return data, true
 }
@@ -236,14 +359,32 @@ func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, ok := decodeAndValidateBody(w, r, tbl)
+	conflict, err := parseOnConflict(tbl, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, records, ok := decodeCreateBody(w, r, tbl)
 	if !ok {
 		return
 	}
+	if conflict != nil {
+		if records == nil {
+			h.upsert(w, r, tbl, []map[string]any{data}, true, conflict)
+		} else {
+			h.upsert(w, r, tbl, records, false, conflict)
+		}
+		return
+	}
+	if records != nil {
+		h.createMany(w, r, tbl, records)
+		return
+	}
 
 	query, args := buildInsert(tbl, data)
 
-	q, done, err := h.withRLS(r)
+	q, done, err := h.withRLSFor(r, tbl, ruleCreate)
 	if err != nil {
 		h.logger.Error("rls setup error", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal error")
@@ -270,13 +411,20 @@ func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	rows.Close()
+	if err := checkCreated(r.Context(), q, h.schemaFor(r), tbl, []map[string]any{record}, []map[string]any{data}); err != nil {
+		done(err)
+		h.writeRuleError(w, tbl, err)
+		return
+	}
 
 	done(nil)
 	writeJSON(w, http.StatusCreated, record)
-	h.publishEvent("create", tbl.Name, record)
+	h.publishEvent("create", h.collectionName(tbl), record)
 }
 
-// handleUpdate handles PATCH /collections/{table}/{id}
+// handleUpdate handles PATCH /collections/{table}/{id}. With If-Match, the
+// update only applies if the row is still at one of the given versions.
 func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	tbl := h.resolveTable(w, r)
 	if tbl == nil {
@@ -299,14 +447,18 @@ func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query, args := buildUpdate(tbl, data, pkValues)
+	ifMatch := parseIfMatch(r)
+	query, args := buildUpdate(tbl, data, pkValues, ifMatch)
 
-	q, done, err := h.withRLS(r)
+	q, done, err := h.withRLSFor(r, tbl, ruleUpdate)
 	if err != nil {
 		h.logger.Error("rls setup error", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	if !h.checkRecordRule(w, r, q, done, tbl, ruleUpdate, data, pkValues) {
+		return
+	}
 
 	rows, err := q.Query(r.Context(), query, args...)
 	if err != nil {
@@ -329,17 +481,19 @@ func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if record == nil {
-		done(nil)
-		writeError(w, http.StatusNotFound, "record not found")
+		rows.Close()
+		done(h.writeNoMatch(w, r, q, tbl, pkValues, ifMatch))
 		return
 	}
 
 	done(nil)
+	w.Header().Set("ETag", recordETag(record))
 	writeJSON(w, http.StatusOK, record)
-	h.publishEvent("update", tbl.Name, record)
+	h.publishEvent("update", h.collectionName(tbl), record)
 }
 
-// handleDelete handles DELETE /collections/{table}/{id}
+// handleDelete handles DELETE /collections/{table}/{id}, honoring If-Match
+// like handleUpdate.
 func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	tbl := h.resolveTable(w, r)
 	if tbl == nil {
@@ -357,14 +511,18 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query, args := buildDelete(tbl, pkValues)
+	ifMatch := parseIfMatch(r)
+	query, args := buildDelete(tbl, pkValues, ifMatch)
 
-	q, done, err := h.withRLS(r)
+	q, done, err := h.withRLSFor(r, tbl, ruleDelete)
 	if err != nil {
 		h.logger.Error("rls setup error", "error", err)
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	if !h.checkRecordRule(w, r, q, done, tbl, ruleDelete, nil, pkValues) {
+		return
+	}
 
 	tag, err := q.Exec(r.Context(), query, args...)
 	if err != nil {
@@ -377,8 +535,7 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if tag.RowsAffected() == 0 {
-		done(nil)
-		writeError(w, http.StatusNotFound, "record not found")
+		done(h.writeNoMatch(w, r, q, tbl, pkValues, ifMatch))
 		return
 	}
 
@@ -390,7 +547,7 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	for i, pk := range tbl.PrimaryKey {
 		record[pk] = pkValues[i]
 	}
-	h.publishEvent("delete", tbl.Name, record)
+	h.publishEvent("delete", h.collectionName(tbl), record)
 }
 
 // handleList handles GET /collections/{table}
@@ -402,49 +559,112 @@ func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 
-	// Parse pagination.
-	page, _ := strconv.Atoi(q.Get("page"))
-	if page < 1 {
-		page = 1
-	}
-	perPage, _ := strconv.Atoi(q.Get("perPage"))
-	if perPage < 1 {
-		perPage = 20
-	}
-	if perPage > 500 {
-		perPage = 500
-	}
+	page, perPage := parsePagination(q)
 	skipTotal := q.Get("skipTotal") == "true"
 
 	// Parse fields.
 	fields := parseFields(r)
 
+	sc := h.schemaFor(r)
+
 	// Parse sort.
-	sortSQL := parseSortSQL(tbl, q.Get("sort"))
+	sortFields := parseSort(sc, tbl, q.Get("sort"))
 
 	// Parse filter.
 	var filterSQL string
 	var filterArgs []any
 	if filterStr := q.Get("filter"); filterStr != "" {
 		var err error
-		filterSQL, filterArgs, err = parseFilter(tbl, filterStr)
+		filterSQL, filterArgs, err = parseFilterExpr(r.Context(), sc, tbl, filterStr, 0)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, "invalid filter: "+err.Error())
 			return
 		}
 	}
+	filterSQL, filterArgs, err := withRule(sc, tbl, ruleList, requestVars(r.Context(), nil), filterSQL, filterArgs)
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+
+	// Parse expand.
+	var expand [][]expandStep
+	if expandParam := q.Get("expand"); expandParam != "" && sc != nil {
+		var err error
+		if expand, err = parseExpand(sc, tbl, expandParam); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expand: "+err.Error())
+			return
+		}
+	}
 
+	// Parse full-text search. The term becomes one more filter argument so the
+	// match and the rank expression share its placeholder.
+	var search *textSearch
+	if term := q.Get("search"); term != "" {
+		var err error
+		search, err = parseSearch(tbl, q.Get("searchFields"), len(filterArgs)+1)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid search: "+err.Error())
+			return
+		}
+		if filterSQL == "" {
+			filterSQL = search.whereSQL()
+		} else {
+			filterSQL = "(" + filterSQL + ") AND " + search.whereSQL()
+		}
+		filterArgs = append(filterArgs, term)
+	}
+	for i := range sortFields {
+		if sortFields[i].column != rankSort {
+			continue
+		}
+		if search == nil {
+			writeError(w, http.StatusBadRequest, "sorting by @rank requires search")
+			return
+		}
+		sortFields[i].expr = search.rankSQL()
+	}
+	sortArgs, err := sortRules(sc, sortFields, requestVars(r.Context(), nil), len(filterArgs))
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
+
+	// Parse cursor. Its presence (even empty) switches to keyset pagination.
+	// Cursors are built from the keyset columns, which are selected even if
+	// fields leaves them out.
+	var cursor *cursorPage
+	var keys []string
+	if q.Has("cursor") {
+		var err error
+		cursor, err = parseCursor(tbl, sortFields, q.Get("cursor"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor: "+err.Error())
+			return
+		}
+		keys = cursor.columns()
+	}
+
+	sel := newRecordSelect(tbl, fields, expand, keys)
 	opts := listOpts{
 		page:       page,
 		perPage:    perPage,
 		skipTotal:  skipTotal,
-		fields:     fields,
-		sortSQL:    sortSQL,
+		fields:     sel.columns,
+		sortSQL:    sortSQL(sortFields),
+		sortArgs:   sortArgs,
 		filterSQL:  filterSQL,
 		filterArgs: filterArgs,
+		cursor:     cursor,
+		raw:        true,
 	}
 
-	dataQuery, dataArgs, countQuery, countArgs := buildList(tbl, opts)
+	rowsQuery, rowsArgs, countQuery, countArgs := buildList(tbl, opts)
+	dataQuery, dataArgs, err := sel.query(r.Context(), sc, rowsQuery, rowsArgs, cursor)
+	if err != nil {
+		h.writeRuleError(w, tbl, err)
+		return
+	}
 
 	querier, done, err := h.withRLS(r)
 	if err != nil {
@@ -467,7 +687,8 @@ func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
 		totalPages = int(math.Ceil(float64(totalItems) / float64(perPage)))
 	}
 
-	// Get data rows.
+	// Get data rows. The first is fetched before committing to a 200, so that
+	// query errors still get a proper error response.
 	rows, err := querier.Query(r.Context(), dataQuery, dataArgs...)
 	if err != nil {
 		done(err)
@@ -479,30 +700,43 @@ func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	items, err := scanRows(rows)
-	if err != nil {
+	hasRow := rows.Next()
+	if !hasRow && rows.Err() != nil {
+		err := rows.Err()
 		done(err)
-		h.logger.Error("scan error", "error", err, "table", tbl.Name)
-		writeError(w, http.StatusInternalServerError, "internal error")
+		if !mapPGError(w, err) {
+			h.logger.Error("list error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
 		return
 	}
 
-	// Handle expand if requested.
-	if expandParam := q.Get("expand"); expandParam != "" && len(items) > 0 {
-		sc := h.schema.Get()
-		if sc != nil {
-			expandRecords(r.Context(), querier, sc, tbl, items, expandParam, h.logger)
-		}
+	if cursor != nil {
+		page = 0
 	}
-
-	done(nil)
-	writeJSON(w, http.StatusOK, ListResponse{
+	n, err := writeRecordList(w, rows, hasRow, ListResponse{
 		Page:       page,
 		PerPage:    perPage,
 		TotalItems: totalItems,
 		TotalPages: totalPages,
-		Items:      items,
-	})
+	}, cursor)
+	if err != nil {
+		// Headers are already sent; the client sees a truncated body.
+		rows.Close()
+		done(err)
+		h.logger.Error("list stream error", "error", err, "table", tbl.Name, "rows", n)
+		return
+	}
+	done(nil)
+}
+
+// collectionName returns the name tbl is addressed by, as realtime events
+// name it. See schema.SchemaCache.CollectionName.
+func (h *Handler) collectionName(tbl *schema.Table) string {
+	if sc := h.schema.Get(); sc != nil {
+		return sc.CollectionName(tbl)
+	}
+	return tbl.Name
 }
 
 // publishEvent sends a realtime event to the hub if it's configured.
@@ -517,6 +751,27 @@ func (h *Handler) publishEvent(action, table string, record map[string]any) {
 	})
 }
 
+// publishEvents sends one realtime event per record. Delete events carry only the
+// primary key values, matching single-record deletes.
+func (h *Handler) publishEvents(action string, tbl *schema.Table, records []map[string]any) {
+	if h.hub == nil {
+		return
+	}
+	for _, rec := range records {
+		if action == "delete" {
+			if len(tbl.PrimaryKey) == 0 {
+				continue
+			}
+			pk := make(map[string]any, len(tbl.PrimaryKey))
+			for _, col := range tbl.PrimaryKey {
+				pk[col] = rec[col]
+			}
+			rec = pk
+		}
+		h.publishEvent(action, h.collectionName(tbl), rec)
+	}
+}
+
 // countKnownColumns returns the number of keys in data that match a column in the table schema.
 func countKnownColumns(tbl *schema.Table, data map[string]any) int {
 	n := 0
@@ -528,6 +783,35 @@ func countKnownColumns(tbl *schema.Table, data map[string]any) int {
 	return n
 }
 
+// countWritableColumns returns the number of keys in data that match a column
+// that inserts (or, if insert is false, updates) may set.
+func countWritableColumns(tbl *schema.Table, data map[string]any, insert bool) int {
+	n := 0
+	for col := range data {
+		if tbl.ColumnByName(col) != nil && (insert && tbl.CanInsert(col) || !insert && tbl.CanUpdate(col)) {
+			n++
+		}
+	}
+	return n
+}
+
+// parsePagination reads the page and perPage query parameters. Pages start
+// at 1, with 20 records per page by default and at most 500.
+func parsePagination(q url.Values) (page, perPage int) {
+	page, _ = strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ = strconv.Atoi(q.Get("perPage"))
+	if perPage < 1 {
+		perPage = 20
+	}
+	if perPage > 500 {
+		perPage = 500
+	}
+	return page, perPage
+}
+
 // parseFields extracts the fields query parameter.
 func parseFields(r *http.Request) []string {
 	f := r.URL.Query().Get("fields")
@@ -545,15 +829,30 @@ func parseFields(r *http.Request) []string {
 	return fields
 }
 
-// parseSortSQL converts the sort parameter to a SQL ORDER BY clause.
-// Format: "-created,+name" → "created" DESC, "name" ASC
-func parseSortSQL(tbl *schema.Table, sortParam string) string {
+// sortField is one column of a parsed sort parameter.
+type sortField struct {
+	column string
+	desc   bool
+	expr   string // SQL to sort by instead of column, e.g. the search rank
+
+	// hops and ref locate a related field, whose expr is built by sortRules.
+	hops []relHop
+	ref  string
+}
+
+// parseSort parses the sort parameter, skipping columns not in the table.
+// Format: "-created,+name" → created DESC, name ASC
+// With a schema cache, dotted paths through many-to-one relationships such as
+// "-author.created_at" sort by the related row's column, once sortRules has
+// applied the related tables' list rules.
+func parseSort(sc *schema.SchemaCache, tbl *schema.Table, sortParam string) []sortField {
 	if sortParam == "" {
-		return ""
+		return nil
 	}
 
 	parts := strings.Split(sortParam, ",")
-	clauses := make([]string, 0, len(parts))
+	fields := make([]sortField, 0, len(parts))
+	aliases := 0
 
 	for _, p := range parts {
 		p = strings.TrimSpace(p)
@@ -561,23 +860,91 @@ func parseSortSQL(tbl *schema.Table, sortParam string) string {
 			continue
 		}
 
-		dir := "ASC"
+		desc := false
 		col := p
 		if strings.HasPrefix(p, "-") {
-			dir = "DESC"
+			desc = true
 			col = p[1:]
 		} else if strings.HasPrefix(p, "+") {
 			col = p[1:]
 		}
 
+		// @rank is resolved once the search is known.
+		if col == rankSort {
+			fields = append(fields, sortField{column: col, desc: desc})
+			continue
+		}
+
 		// Validate column exists in schema.
-		if tbl.ColumnByName(col) == nil {
+		_, colRef, hops, err := resolvePath(sc, tbl, col, "s", &aliases)
+		if err != nil {
 			continue
 		}
+		field := sortField{column: col, desc: desc}
+		if len(hops) > 0 {
+			if _, err = relatedSortExpr(hops, colRef); err != nil {
+				continue
+			}
+			field.hops, field.ref = hops, colRef
+		} else if tbl.ColumnByName(col) == nil {
+			field.expr = colRef // computed field
+		}
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// parseSortSQL converts the sort parameter to a SQL ORDER BY clause.
+// Format: "-created,+name" → "created" DESC, "name" ASC
+func parseSortSQL(tbl *schema.Table, sortParam string) string {
+	return sortSQL(parseSort(nil, tbl, sortParam))
+}
 
-		clauses = append(clauses, quoteIdent(col)+" "+dir)
+// sortRules builds the sort expressions of related fields, which read only the
+// related rows that vars may list, as related filters do. Their placeholders
+// are numbered from argOffset+1; the arguments are returned.
+func sortRules(sc *schema.SchemaCache, fields []sortField, vars *ruleVars, argOffset int) ([]any, error) {
+	var args []any
+	for i := range fields {
+		f := &fields[i]
+		if len(f.hops) == 0 {
+			continue
+		}
+		for j := range f.hops {
+			ruleSQL, ruleArgs, err := ruleFilter(sc, f.hops[j].table, ruleList, vars, argOffset+len(args))
+			if err != nil {
+				return nil, err
+			}
+			f.hops[j].where = ruleSQL
+			args = append(args, ruleArgs...)
+		}
+		var err error
+		if f.expr, err = relatedSortExpr(f.hops, f.ref); err != nil {
+			return nil, err
+		}
 	}
+	return args, nil
+}
 
+// sortSQL renders sort fields as an ORDER BY list. An unresolved @rank, and a
+// related field sortRules has not built, are skipped.
+func sortSQL(fields []sortField) string {
+	clauses := make([]string, 0, len(fields))
+	for _, f := range fields {
+		dir := "ASC"
+		if f.desc {
+			dir = "DESC"
+		}
+		switch {
+		case f.expr != "":
+			clauses = append(clauses, f.expr+" "+dir)
+		case f.column == rankSort || len(f.hops) > 0:
+			continue
+		default:
+			clauses = append(clauses, quoteIdent(f.column)+" "+dir)
+		}
+	}
 	return strings.Join(clauses, ", ")
 }
 
@@ -615,13 +982,20 @@ func scanRows(rows pgx.Rows) ([]map[string]any, error) {
 	return result, nil
 }
 
-// scanCurrentRow scans the current row into a map.
+// scanCurrentRow scans the current row into a map. JSON values are kept as
+// their text, so that their numbers keep every digit, and other values are
+// converted by jsonValue.
 func scanCurrentRow(rows pgx.Rows) (map[string]any, error) {
 	descs := rows.FieldDescriptions()
 	values := make([]any, len(descs))
+	docs := make([]json.RawMessage, len(descs))
 	ptrs := make([]any, len(descs))
-	for i := range values {
-		ptrs[i] = &values[i]
+	for i, desc := range descs {
+		if desc.DataTypeOID == pgtype.JSONOID || desc.DataTypeOID == pgtype.JSONBOID {
+			ptrs[i] = &docs[i]
+		} else {
+			ptrs[i] = &values[i]
+		}
 	}
 
 	if err := rows.Scan(ptrs...); err != nil {
@@ -630,7 +1004,11 @@ func scanCurrentRow(rows pgx.Rows) (map[string]any, error) {
 
 	record := make(map[string]any, len(descs))
 	for i, desc := range descs {
-		record[desc.Name] = values[i]
+		if docs[i] != nil {
+			record[desc.Name] = docs[i]
+		} else {
+			record[desc.Name] = jsonValue(values[i])
+		}
 	}
 	return record, nil
 }
@@ -119,6 +119,19 @@ func TestCreateCollectionNotFound(t *testing.T) {
 	testutil.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestSchemaQualifiedCollection(t *testing.T) {
+	h := testHandler(testSchema())
+
+	// public.users resolves to users; the body fails validation before any query.
+	w := doRequest(h, "POST", "/collections/public.users", `{"name":"Ann"}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Equal(t, "validation failed", decodeError(t, w).Message)
+
+	w = doRequest(h, "GET", "/collections/other.users", "")
+	testutil.Equal(t, http.StatusNotFound, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "collection not found: other.users")
+}
+
 // --- Write on view ---
 
 func TestCreateOnViewNotAllowed(t *testing.T) {
@@ -201,6 +214,57 @@ func TestUpdateInvalidJSON(t *testing.T) {
 	testutil.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestCreateReportsEveryFieldError(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/collections/users", `{"id":"not-a-uuid","name":5}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Equal(t, resp.Message, "validation failed")
+	testutil.MapLen(t, resp.Data, 3)
+	testutil.Equal(t, resp.Data["id"].(map[string]any)["code"], any("invalid_format"))
+	testutil.Equal(t, resp.Data["email"].(map[string]any)["code"], any("required"))
+	testutil.Equal(t, resp.Data["name"].(map[string]any)["code"], any("invalid_type"))
+}
+
+func TestBulkCreateFieldErrorsByRow(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/collections/users?strict=true",
+		`[{"id":"5f0c6a3e-8a7b-4d9e-9c1f-2b3a4c5d6e7f","email":"a@example.com"},{"email":null,"nickname":"x"}]`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.MapLen(t, resp.Data, 3)
+	testutil.Equal(t, resp.Data["1.id"].(map[string]any)["code"], any("required"))
+	testutil.Equal(t, resp.Data["1.email"].(map[string]any)["code"], any("not_null"))
+	testutil.Equal(t, resp.Data["1.nickname"].(map[string]any)["code"], any("unknown_field"))
+}
+
+func TestUpdateStrictRejectsUnknownFields(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "PATCH", "/collections/users/123?strict=true", `{"name":"Ann","nickname":"x"}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.MapLen(t, resp.Data, 1)
+	testutil.Equal(t, resp.Data["nickname"].(map[string]any)["code"], any("unknown_field"))
+}
+
+// --- Soft delete ---
+
+func TestRestoreWithoutSoftDelete(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "POST", "/collections/users/123/restore", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "soft delete is not enabled")
+}
+
+func TestWithDeletedRequiresAdmin(t *testing.T) {
+	h := testHandler(testSchema())
+	w := doRequest(h, "GET", "/collections/users?withDeleted=true", "")
+	testutil.Equal(t, http.StatusForbidden, w.Code)
+	resp := decodeError(t, w)
+	testutil.Contains(t, resp.Message, "withDeleted requires admin access")
+}
+
 // --- Invalid filter ---
 
 func TestListInvalidFilter(t *testing.T) {
@@ -312,6 +376,14 @@ func TestMapPGErrorInvalidText(t *testing.T) {
 	testutil.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestMapPGErrorCardinalityViolation(t *testing.T) {
+	w := httptest.NewRecorder()
+	pgErr := &pgconn.PgError{Code: "21000", Message: "ON CONFLICT DO UPDATE command cannot affect row a second time"}
+	handled := mapPGError(w, pgErr)
+	testutil.True(t, handled, "cardinality violation should be handled")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestMapPGErrorUnknownCode(t *testing.T) {
 	w := httptest.NewRecorder()
 	pgErr := &pgconn.PgError{Code: "99999"}
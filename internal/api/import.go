@@ -0,0 +1,546 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/httputil"
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// maxImportSize caps the size of an import body.
+	maxImportSize = 64 << 20
+	// importBatchRows is the number of rows inserted per statement.
+	importBatchRows = 500
+	// maxImportErrors is the number of row errors after which an import stops.
+	maxImportErrors = 100
+)
+
+// ImportResponse reports the outcome of a successful import.
+type ImportResponse struct {
+	Total    int  `json:"total"`
+	Inserted int  `json:"inserted"`
+	Updated  int  `json:"updated"`
+	Skipped  int  `json:"skipped"`
+	DryRun   bool `json:"dryRun,omitempty"`
+}
+
+// ImportError is a problem with one row of an import. Rows are numbered from 1,
+// not counting the CSV header or blank NDJSON lines.
+type ImportError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// importReader yields the rows of an import body. next returns the row's values
+// keyed by column along with any problems found in them, or io.EOF at the end.
+// Any other error means the body cannot be read further.
+type importReader interface {
+	next() (row int, data map[string]any, errs []ImportError, err error)
+}
+
+// importFormat returns the import format from the format parameter, falling
+// back to the request content type.
+func importFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f != "csv" && f != "ndjson" {
+			return "", fmt.Errorf("invalid format: must be csv or ndjson")
+		}
+		return f, nil
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "text/csv":
+		return "csv", nil
+	case "application/x-ndjson":
+		return "ndjson", nil
+	}
+	return "", fmt.Errorf("unsupported content type: use text/csv or application/x-ndjson")
+}
+
+// newImportReader returns a reader for body in the given format. For CSV the
+// header row is read and checked against the table's columns.
+func newImportReader(tbl *schema.Table, format string, body io.Reader) (importReader, error) {
+	if format == "ndjson" {
+		s := bufio.NewScanner(body)
+		s.Buffer(nil, httputil.MaxBodySize)
+		return &ndjsonImportReader{tbl: tbl, scanner: s}, nil
+	}
+	return newCSVImportReader(tbl, body)
+}
+
+// csvImportReader reads CSV with a header row naming the columns.
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns []*schema.Column
+	row     int
+}
+
+func newCSVImportReader(tbl *schema.Table, body io.Reader) (*csvImportReader, error) {
+	cr := csv.NewReader(body)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty CSV: expected a header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := make([]*schema.Column, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // byte order mark
+		}
+		col := tbl.ColumnByName(name)
+		if col == nil {
+			return nil, fmt.Errorf("unknown column in header: %q", name)
+		}
+		if !tbl.CanInsert(name) {
+			return nil, fmt.Errorf("read-only column in header: %q", name)
+		}
+		if slices.Contains(columns, col) {
+			return nil, fmt.Errorf("duplicate column in header: %q", name)
+		}
+		columns[i] = col
+	}
+
+	cr.FieldsPerRecord = len(header)
+	cr.ReuseRecord = true
+	return &csvImportReader{reader: cr, columns: columns}, nil
+}
+
+func (c *csvImportReader) next() (int, map[string]any, []ImportError, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return 0, nil, nil, io.EOF
+	}
+	c.row++
+	if err != nil {
+		var pe *csv.ParseError
+		if errors.As(err, &pe) && errors.Is(pe.Err, csv.ErrFieldCount) {
+			return c.row, nil, []ImportError{{
+				Row:     c.row,
+				Message: fmt.Sprintf("wrong number of fields: expected %d, got %d", len(c.columns), len(record)),
+			}}, nil
+		}
+		if pe != nil {
+			return c.row, nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		return c.row, nil, nil, err
+	}
+
+	data := make(map[string]any, len(c.columns))
+	var errs []ImportError
+	for i, col := range c.columns {
+		v, err := convertImportValue(col, record[i])
+		if err != nil {
+			errs = append(errs, ImportError{Row: c.row, Column: col.Name, Message: err.Error()})
+			continue
+		}
+		if code, msg := checkColumnValue(col, v); code != "" {
+			errs = append(errs, ImportError{Row: c.row, Column: col.Name, Message: msg})
+			continue
+		}
+		data[col.Name] = v
+	}
+	return c.row, data, errs, nil
+}
+
+// convertImportValue converts a CSV field to a value for col. Empty fields are
+// NULL. Numbers keep their text form so that numeric precision is not lost;
+// JSON and array fields are decoded the same way as in a JSON request body.
+// Money and composite fields may also be in the form Postgres casts them to
+// text in, as in CSV exports.
+func convertImportValue(col *schema.Column, s string) (any, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if col.IsArray {
+		if !strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return s, nil // Postgres array literal, e.g. {a,b}
+		}
+		var v []any
+		if err := decodeJSONNumbers(strings.NewReader(s), &v); err != nil {
+			return nil, fmt.Errorf("invalid JSON array")
+		}
+		return v, nil
+	}
+
+	switch col.JSONType {
+	case "integer":
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %q", s)
+		}
+		return n, nil
+	case "number":
+		s = strings.TrimSpace(s)
+		if base, _ := baseType(col.TypeName); base == "money" {
+			return s, nil
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("invalid number: %q", s)
+		}
+		return s, nil
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean: %q", s)
+		}
+		return b, nil
+	case "object":
+		if !col.IsJSON && !strings.HasPrefix(strings.TrimSpace(s), "{") {
+			return s, nil // Postgres row literal, e.g. (1,2)
+		}
+		var v any
+		if err := decodeJSONNumbers(strings.NewReader(s), &v); err != nil {
+			return nil, fmt.Errorf("invalid JSON")
+		}
+		return v, nil
+	}
+
+	if col.IsEnum && len(col.EnumValues) > 0 && !slices.Contains(col.EnumValues, s) {
+		return nil, fmt.Errorf("invalid value %q: must be one of %s", s, strings.Join(col.EnumValues, ", "))
+	}
+	return s, nil
+}
+
+// ndjsonImportReader reads one JSON object per line, skipping blank lines.
+type ndjsonImportReader struct {
+	tbl     *schema.Table
+	scanner *bufio.Scanner
+	row     int
+}
+
+func (n *ndjsonImportReader) next() (int, map[string]any, []ImportError, error) {
+	for n.scanner.Scan() {
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		n.row++
+
+		var data map[string]any
+		if err := decodeJSONNumbers(bytes.NewReader(line), &data); err != nil || data == nil {
+			return n.row, nil, []ImportError{{Row: n.row, Message: "invalid JSON object"}}, nil
+		}
+		if len(data) == 0 {
+			return n.row, nil, []ImportError{{Row: n.row, Message: "no columns"}}, nil
+		}
+
+		var errs []ImportError
+		for key, v := range data {
+			col := n.tbl.ColumnByName(key)
+			if col == nil {
+				errs = append(errs, ImportError{Row: n.row, Column: key, Message: "unknown column"})
+			} else if !n.tbl.CanInsert(key) {
+				errs = append(errs, ImportError{Row: n.row, Column: key, Message: "read-only column"})
+			} else if code, msg := checkColumnValue(col, v); code != "" {
+				errs = append(errs, ImportError{Row: n.row, Column: key, Message: msg})
+			}
+		}
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Column < errs[j].Column })
+		return n.row, data, errs, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return n.row + 1, nil, nil, fmt.Errorf("invalid NDJSON: line longer than %d bytes", httputil.MaxBodySize)
+		}
+		return n.row + 1, nil, nil, err
+	}
+	return 0, nil, nil, io.EOF
+}
+
+// importer inserts rows in batches inside a single transaction. Each batch runs
+// under a savepoint; when a batch fails, its rows are retried one at a time so
+// that database errors are reported against the row that caused them.
+type importer struct {
+	tx   pgx.Tx
+	sc   *schema.SchemaCache
+	tbl  *schema.Table
+	oc   *onConflict
+	keep bool // collect written records for realtime events
+
+	batch     []map[string]any
+	batchRows []int
+	params    int
+
+	resp    ImportResponse
+	errs    []ImportError
+	created []map[string]any
+	updated []map[string]any
+}
+
+// add queues a row for insertion, flushing the batch when it is full.
+func (im *importer) add(ctx context.Context, row int, data map[string]any) error {
+	if len(im.batch) > 0 && im.params+len(data) > maxQueryParams {
+		if err := im.flush(ctx); err != nil {
+			return err
+		}
+	}
+	im.batch = append(im.batch, data)
+	im.batchRows = append(im.batchRows, row)
+	im.params += len(data)
+	if len(im.batch) >= importBatchRows {
+		return im.flush(ctx)
+	}
+	return nil
+}
+
+// flush inserts the queued rows. Only errors that are not tied to a row are
+// returned.
+func (im *importer) flush(ctx context.Context) error {
+	batch, rows := im.batch, im.batchRows
+	im.batch, im.batchRows, im.params = nil, nil, 0
+	if len(batch) == 0 {
+		return nil
+	}
+
+	items, err := im.insert(ctx, batch)
+	if err == nil {
+		im.record(len(batch), items)
+		return nil
+	}
+	if _, ok := importDBError(0, err); !ok {
+		return err
+	}
+
+	for i, data := range batch {
+		items, err := im.insert(ctx, []map[string]any{data})
+		if err != nil {
+			ie, ok := importDBError(rows[i], err)
+			if !ok {
+				return err
+			}
+			im.errs = append(im.errs, ie)
+			if len(im.errs) >= maxImportErrors {
+				return nil
+			}
+			continue
+		}
+		im.record(1, items)
+	}
+	return nil
+}
+
+// insert runs the insert or upsert of rows under a savepoint, and checks the
+// created records against the create rule.
+func (im *importer) insert(ctx context.Context, rows []map[string]any) ([]map[string]any, error) {
+	sp, err := im.tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]any
+	if im.oc == nil {
+		items, err = insertRows(ctx, sp, im.sc, im.tbl, rows)
+	} else {
+		items, err = im.upsert(ctx, sp, rows)
+	}
+	if err != nil {
+		_ = sp.Rollback(ctx)
+		return nil, err
+	}
+	return items, sp.Commit(ctx)
+}
+
+// upsert runs one upsert statement, and checks the created records against
+// the create rule.
+func (im *importer) upsert(ctx context.Context, q Querier, rows []map[string]any) ([]map[string]any, error) {
+	query, args := buildUpsert(im.tbl, rows, im.oc)
+	res, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanRows(res)
+	res.Close()
+	if err != nil {
+		return nil, err
+	}
+	created, bodies := createdRows(rows, im.oc, items)
+	return items, checkCreated(ctx, q, im.sc, im.tbl, created, bodies)
+}
+
+// record counts the rows written by a statement for n input rows. Rows left
+// out of RETURNING were skipped by ON CONFLICT DO NOTHING.
+func (im *importer) record(n int, items []map[string]any) {
+	im.resp.Skipped += n - len(items)
+	for _, item := range items {
+		inserted := true
+		if v, ok := item[upsertInsertedColumn]; ok {
+			inserted, _ = v.(bool)
+			delete(item, upsertInsertedColumn)
+		}
+		if inserted {
+			im.resp.Inserted++
+			if im.keep {
+				im.created = append(im.created, item)
+			}
+		} else {
+			im.resp.Updated++
+			if im.keep {
+				im.updated = append(im.updated, item)
+			}
+		}
+	}
+}
+
+// importDBError converts a database error or a create rule denial for a single
+// row to an ImportError. ok is false for any other error.
+func importDBError(row int, err error) (ImportError, bool) {
+	if errors.Is(err, errCreateDenied) {
+		return ImportError{Row: row, Message: err.Error()}, true
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return ImportError{}, false
+	}
+	msg := pgErr.Message
+	if _, resp, ok := pgErrorResponse(err); ok {
+		msg = resp.Message
+		if pgErr.Detail != "" && !strings.Contains(msg, pgErr.Detail) {
+			msg += ": " + pgErr.Detail
+		}
+	}
+	return ImportError{Row: row, Column: pgErr.ColumnName, Message: msg}, true
+}
+
+// HandleImport handles POST /collections/{table}/import. The body is CSV with a
+// header row or NDJSON, selected by the format parameter or the content type.
+// All rows are loaded in one transaction under the caller's RLS context, so the
+// import either succeeds completely or changes nothing. Failed rows are
+// reported together, up to maxImportErrors. With dryRun=true the transaction is
+// always rolled back. onConflict and merge work as on create. Unlike the other
+// routes, it takes CSV and NDJSON bodies, so the server mounts it apart from
+// its JSON-only routes.
+func (h *Handler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	tbl := h.resolveTable(w, r)
+	if tbl == nil {
+		return
+	}
+	if !requireWritable(w, tbl) {
+		return
+	}
+
+	format, err := importFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid dryRun value: %q", v))
+			return
+		}
+	}
+
+	oc, err := parseOnConflict(tbl, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	reader, err := newImportReader(tbl, format, r.Body)
+	if err != nil {
+		writeImportReadError(w, err)
+		return
+	}
+
+	tx, err := h.beginTx(r)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	defer tx.Rollback(r.Context()) // no-op after commit
+
+	ctx := r.Context()
+	im := &importer{tx: tx, sc: h.schemaFor(r), tbl: tbl, oc: oc, keep: h.hub != nil && !dryRun}
+	for len(im.errs) < maxImportErrors {
+		row, data, errs, err := reader.next()
+		if err == io.EOF {
+			err = im.flush(ctx)
+			if err != nil {
+				h.logger.Error("import error", "error", err, "table", tbl.Name)
+				writeError(w, http.StatusInternalServerError, "internal error")
+				return
+			}
+			break
+		}
+		if err != nil {
+			writeImportReadError(w, fmt.Errorf("row %d: %w", row, err))
+			return
+		}
+
+		im.resp.Total++
+		if len(errs) > 0 {
+			im.errs = append(im.errs, errs...)
+			continue
+		}
+		if err := im.add(ctx, row, data); err != nil {
+			h.logger.Error("import error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+
+	if len(im.errs) > 0 {
+		msg := fmt.Sprintf("import failed: %d errors", len(im.errs))
+		if len(im.errs) >= maxImportErrors {
+			msg = fmt.Sprintf("import stopped after %d errors", len(im.errs))
+		}
+		writeJSON(w, http.StatusBadRequest, httputil.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: msg,
+			Data:    map[string]any{"errors": im.errs},
+		})
+		return
+	}
+
+	im.resp.DryRun = dryRun
+	if dryRun {
+		writeJSON(w, http.StatusOK, im.resp)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		if !mapPGError(w, err) {
+			h.logger.Error("import commit error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, im.resp)
+	h.publishEvents("create", tbl, im.created)
+	h.publishEvents("update", tbl, im.updated)
+}
+
+// writeImportReadError responds to an import body that cannot be read.
+func writeImportReadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("import body too large: max %d bytes", maxImportSize))
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
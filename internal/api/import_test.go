@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func importTestTable() *schema.Table {
+	return &schema.Table{
+		Schema: "public",
+		Name:   "items",
+		Kind:   "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", JSONType: "integer", IsPrimaryKey: true},
+			{Name: "name", TypeName: "text", JSONType: "string", IsNullable: true},
+			{Name: "price", TypeName: "numeric", JSONType: "number", IsNullable: true},
+			{Name: "active", TypeName: "boolean", JSONType: "boolean", IsNullable: true},
+			{Name: "meta", TypeName: "jsonb", JSONType: "object", IsJSON: true, IsNullable: true},
+			{Name: "tags", TypeName: "text[]", JSONType: "array", IsArray: true, IsNullable: true},
+			{Name: "status", TypeName: "item_status", JSONType: "string", IsEnum: true, EnumValues: []string{"draft", "live"}, IsNullable: true},
+		},
+		PrimaryKey: []string{"id"},
+	}
+}
+
+func TestConvertImportValue(t *testing.T) {
+	tbl := importTestTable()
+	tests := []struct {
+		column string
+		in     string
+		want   any
+	}{
+		{"id", "", nil},
+		{"id", " 42 ", int64(42)},
+		{"name", " padded ", " padded "},
+		{"price", "19.990", "19.990"},
+		{"active", "true", true},
+		{"active", "f", false},
+		{"meta", `{"a":1}`, map[string]any{"a": json.Number("1")}},
+		{"tags", "{a,b}", "{a,b}"},
+		{"tags", `["a","b"]`, []any{"a", "b"}},
+		{"status", "live", "live"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column+"="+tt.in, func(t *testing.T) {
+			got, err := convertImportValue(tbl.ColumnByName(tt.column), tt.in)
+			testutil.NoError(t, err)
+			testutil.True(t, reflect.DeepEqual(got, tt.want), "got %#v, want %#v", got, tt.want)
+		})
+	}
+}
+
+func TestConvertImportValueTextForms(t *testing.T) {
+	// CSV exports cast money and composite values to text.
+	money := &schema.Column{Name: "price", TypeName: "money", JSONType: "number"}
+	got, err := convertImportValue(money, "$1,234.50")
+	testutil.NoError(t, err)
+	testutil.Equal(t, got, any("$1,234.50"))
+
+	point := &schema.Column{Name: "at", TypeName: "geo_point", JSONType: "object", IsComposite: true}
+	got, err = convertImportValue(point, "(1.5,2)")
+	testutil.NoError(t, err)
+	testutil.Equal(t, got, any("(1.5,2)"))
+	got, err = convertImportValue(point, `{"x":1.5,"y":2}`)
+	testutil.NoError(t, err)
+	testutil.True(t, reflect.DeepEqual(got, map[string]any{"x": json.Number("1.5"), "y": json.Number("2")}), "got %#v", got)
+}
+
+func TestConvertImportValueErrors(t *testing.T) {
+	tbl := importTestTable()
+	tests := []struct {
+		column string
+		in     string
+		msg    string
+	}{
+		{"id", "4.5", "invalid integer"},
+		{"price", "abc", "invalid number"},
+		{"active", "maybe", "invalid boolean"},
+		{"meta", "{oops", "invalid JSON"},
+		{"tags", "[1,", "invalid JSON array"},
+		{"status", "gone", "must be one of draft, live"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column+"="+tt.in, func(t *testing.T) {
+			_, err := convertImportValue(tbl.ColumnByName(tt.column), tt.in)
+			testutil.ErrorContains(t, err, tt.msg)
+		})
+	}
+}
+
+// readImport reads every row of an import body.
+func readImport(t *testing.T, format, body string) ([]map[string]any, []ImportError) {
+	t.Helper()
+	rd, err := newImportReader(importTestTable(), format, strings.NewReader(body))
+	testutil.NoError(t, err)
+
+	var rows []map[string]any
+	var errs []ImportError
+	for {
+		_, data, rowErrs, err := rd.next()
+		if err == io.EOF {
+			return rows, errs
+		}
+		testutil.NoError(t, err)
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+		rows = append(rows, data)
+	}
+}
+
+func TestCSVImportReader(t *testing.T) {
+	body := "\ufeffid,name,active\n1,Widget,true\n2,,false\nx,Gadget,maybe\n3,Short\n"
+	rows, errs := readImport(t, "csv", body)
+
+	testutil.SliceLen(t, rows, 2)
+	testutil.True(t, reflect.DeepEqual(rows[0], map[string]any{"id": int64(1), "name": "Widget", "active": true}), "row 1: %v", rows[0])
+	testutil.Nil(t, rows[1]["name"])
+
+	testutil.SliceLen(t, errs, 3)
+	testutil.Equal(t, errs[0], ImportError{Row: 3, Column: "id", Message: `invalid integer: "x"`})
+	testutil.Equal(t, errs[1], ImportError{Row: 3, Column: "active", Message: `invalid boolean: "maybe"`})
+	testutil.Equal(t, errs[2], ImportError{Row: 4, Message: "wrong number of fields: expected 3, got 2"})
+}
+
+func TestCSVImportReaderHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		msg  string
+	}{
+		{"empty", "", "expected a header row"},
+		{"unknown column", "id,bogus\n", `unknown column in header: "bogus"`},
+		{"duplicate column", "id,name,id\n", `duplicate column in header: "id"`},
+		{"malformed", "id,\"name\n", "invalid CSV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newImportReader(importTestTable(), "csv", strings.NewReader(tt.body))
+			testutil.ErrorContains(t, err, tt.msg)
+		})
+	}
+}
+
+func TestNDJSONImportReader(t *testing.T) {
+	body := `{"id":1,"name":"Widget"}` + "\n\n" + `not json` + "\n" + `{"id":3,"zz":1,"aa":2}` + "\n" + `{}`
+	rows, errs := readImport(t, "ndjson", body)
+
+	testutil.SliceLen(t, rows, 1)
+	testutil.True(t, reflect.DeepEqual(rows[0], map[string]any{"id": json.Number("1"), "name": "Widget"}), "row 1: %v", rows[0])
+
+	testutil.SliceLen(t, errs, 4)
+	testutil.Equal(t, errs[0], ImportError{Row: 2, Message: "invalid JSON object"})
+	testutil.Equal(t, errs[1], ImportError{Row: 3, Column: "aa", Message: "unknown column"})
+	testutil.Equal(t, errs[2], ImportError{Row: 3, Column: "zz", Message: "unknown column"})
+	testutil.Equal(t, errs[3], ImportError{Row: 4, Message: "no columns"})
+}
+
+func TestImportReadersCheckValues(t *testing.T) {
+	rows, errs := readImport(t, "csv", "id,name,status\n,Widget,draft\n2,Gadget,\n")
+	testutil.SliceLen(t, rows, 1)
+	testutil.SliceLen(t, errs, 1)
+	testutil.Equal(t, errs[0], ImportError{Row: 1, Column: "id", Message: "cannot be null"})
+
+	body := `{"id":1.5,"name":"Widget"}` + "\n" + `{"id":2,"active":"maybe","tags":["a",3]}` + "\n" + `{"id":3,"status":"gone"}`
+	rows, errs = readImport(t, "ndjson", body)
+	testutil.SliceLen(t, rows, 0)
+	testutil.SliceLen(t, errs, 4)
+	testutil.Equal(t, errs[0], ImportError{Row: 1, Column: "id", Message: "must be an integer"})
+	testutil.Equal(t, errs[1], ImportError{Row: 2, Column: "active", Message: "must be a boolean"})
+	testutil.Equal(t, errs[2], ImportError{Row: 2, Column: "tags", Message: "item 1 must be a string"})
+	testutil.Equal(t, errs[3], ImportError{Row: 3, Column: "status", Message: "must be one of: draft, live"})
+}
+
+func TestImportHandlerErrors(t *testing.T) {
+	h := testHandler(testSchema())
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		msg         string
+	}{
+		{"unknown table", "/collections/nope/import", "text/csv", "id\n", http.StatusNotFound, "collection not found"},
+		{"json body", "/collections/users/import", "application/json", "[]", http.StatusBadRequest, "unsupported content type"},
+		{"bad format", "/collections/users/import?format=xml", "text/csv", "id\n", http.StatusBadRequest, "invalid format"},
+		{"bad dryRun", "/collections/users/import?dryRun=maybe", "text/csv", "id\n", http.StatusBadRequest, "invalid dryRun value"},
+		{"bad onConflict", "/collections/users/import?onConflict=bogus", "text/csv", "id\n", http.StatusBadRequest, "unknown column in onConflict"},
+		{"unknown header", "/collections/users/import", "text/csv; charset=utf-8", "id,bogus\n", http.StatusBadRequest, "unknown column in header"},
+		{"empty csv", "/collections/users/import?format=csv", "application/octet-stream", "", http.StatusBadRequest, "expected a header row"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			testutil.Equal(t, tt.status, w.Code)
+			testutil.Contains(t, decodeError(t, w).Message, tt.msg)
+		})
+	}
+}
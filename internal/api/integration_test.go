@@ -6,13 +6,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/allyourbase/ayb/internal/config"
+	"github.com/allyourbase/ayb/internal/migrations"
 	"github.com/allyourbase/ayb/internal/schema"
 	"github.com/allyourbase/ayb/internal/server"
 	"github.com/allyourbase/ayb/internal/testutil"
@@ -72,6 +78,13 @@ func setupTestServer(t *testing.T, ctx context.Context) (*server.Server, *testut
 	t.Helper()
 
 	resetAndSeedDB(t, ctx)
+	return newTestServer(t, ctx), sharedPG
+}
+
+// newTestServer builds a server over the current database without reseeding,
+// for tests that change the schema before loading it.
+func newTestServer(t *testing.T, ctx context.Context) *server.Server {
+	t.Helper()
 
 	logger := testutil.DiscardLogger()
 	ch := schema.NewCacheHolder(sharedPG.Pool, logger)
@@ -80,9 +93,26 @@ func setupTestServer(t *testing.T, ctx context.Context) (*server.Server, *testut
 	}
 
 	cfg := config.Default()
-	srv := server.New(cfg, logger, ch, sharedPG.Pool, nil, nil)
+	return server.New(cfg, logger, ch, sharedPG.Pool, nil, nil)
+}
+
+// newAdminTestServer is newTestServer with an admin password, and returns the
+// admin token too.
+func newAdminTestServer(t *testing.T, ctx context.Context) (*server.Server, string) {
+	t.Helper()
+
+	logger := testutil.DiscardLogger()
+	ch := schema.NewCacheHolder(sharedPG.Pool, logger)
+	if err := ch.Load(ctx); err != nil {
+		t.Fatalf("loading schema cache: %v", err)
+	}
 
-	return srv, sharedPG
+	cfg := config.Default()
+	cfg.Admin.Password = "admin-pass"
+	srv := server.New(cfg, logger, ch, sharedPG.Pool, nil, nil)
+	w := doRequest(t, srv, "POST", "/api/admin/auth", map[string]any{"password": "admin-pass"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	return srv, jsonStr(t, parseJSON(t, w)["token"])
 }
 
 func doRequest(t *testing.T, srv *server.Server, method, path string, body any) *httptest.ResponseRecorder {
@@ -347,7 +377,50 @@ func TestCreateRecordNotNullViolation(t *testing.T) {
 	testutil.Equal(t, w.Code, http.StatusBadRequest)
 
 	body := parseJSON(t, w)
-	testutil.Contains(t, jsonStr(t, body["message"]), "missing required")
+	testutil.Equal(t, jsonStr(t, body["message"]), "validation failed")
+	fields, _ := body["data"].(map[string]any)
+	name, _ := fields["name"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, name["code"]), "required")
+}
+
+func TestCreateRecordValidationErrors(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	// Every problem is reported at once, before anything reaches the database.
+	data := map[string]any{"body": 5, "author_id": "x", "created_at": "yesterday noon", "extra": 1}
+	w := doRequest(t, srv, "POST", "/api/collections/posts/?strict=true", data)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+
+	fields, _ := parseJSON(t, w)["data"].(map[string]any)
+	testutil.MapLen(t, fields, 5)
+	for field, code := range map[string]string{
+		"title":      "required",
+		"body":       "invalid_type",
+		"author_id":  "invalid_type",
+		"created_at": "invalid_format",
+		"extra":      "unknown_field",
+	} {
+		f, _ := fields[field].(map[string]any)
+		testutil.Equal(t, jsonStr(t, f["code"]), code)
+	}
+
+	// Without strict, unknown keys are ignored as before.
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Ok", "extra": 1})
+	testutil.Equal(t, w.Code, http.StatusOK)
+}
+
+func TestBulkCreateValidationErrors(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	rows := []map[string]any{{"name": "rust"}, {"name": nil}}
+	w := doRequest(t, srv, "POST", "/api/collections/tags/", rows)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+
+	fields, _ := parseJSON(t, w)["data"].(map[string]any)
+	f, _ := fields["1.name"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, f["code"]), "not_null")
 }
 
 func TestCreateRecordUniqueViolation(t *testing.T) {
@@ -605,3 +678,1689 @@ func TestCombinedFilterSortPagination(t *testing.T) {
 	testutil.Equal(t, len(items), 1)
 	testutil.Equal(t, jsonNum(t, items[0]["id"]), 3.0) // Bob Post, highest published ID
 }
+
+// --- Batch tests ---
+
+func TestBatchCommitsAllOperations(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	req := map[string]any{
+		"operations": []map[string]any{
+			{"method": "create", "table": "authors", "body": map[string]any{"name": "Carol"}},
+			{"method": "create", "table": "posts", "body": map[string]any{"title": "Carol's Post", "author_id": "${0.id}"}},
+			{"method": "update", "table": "posts", "id": "${1.id}", "body": map[string]any{"status": "published"}},
+			{"method": "delete", "table": "tags", "id": "3"},
+		},
+	}
+	w := doRequest(t, srv, "POST", "/api/batch", req)
+	testutil.Equal(t, w.Code, http.StatusOK)
+
+	body := parseJSON(t, w)
+	results, ok := body["results"].([]any)
+	testutil.True(t, ok, "expected results array")
+	testutil.Equal(t, len(results), 4)
+
+	author := results[0].(map[string]any)["body"].(map[string]any)
+	post := results[2].(map[string]any)["body"].(map[string]any)
+	testutil.Equal(t, jsonNum(t, post["author_id"]), jsonNum(t, author["id"]))
+	testutil.Equal(t, jsonStr(t, post["status"]), "published")
+	testutil.Equal(t, jsonNum(t, results[3].(map[string]any)["status"]), 204.0)
+
+	w = doRequest(t, srv, "GET", "/api/collections/tags/3", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+}
+
+func TestBatchRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	req := map[string]any{
+		"operations": []map[string]any{
+			{"method": "create", "table": "tags", "body": map[string]any{"name": "fresh"}},
+			{"method": "create", "table": "tags", "body": map[string]any{"name": "go"}}, // unique violation
+		},
+	}
+	w := doRequest(t, srv, "POST", "/api/batch", req)
+	testutil.Equal(t, w.Code, http.StatusConflict)
+
+	body := parseJSON(t, w)
+	testutil.Contains(t, jsonStr(t, body["message"]), "operation 1")
+
+	// The first insert must have been rolled back.
+	w = doRequest(t, srv, "GET", "/api/collections/tags/?filter=name%3D'fresh'", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, len(jsonItems(t, parseJSON(t, w))), 0)
+}
+
+// --- Bulk tests ---
+
+func TestBulkCreate(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	rows := []map[string]any{{"name": "rust"}, {"name": "sql"}}
+	w := doRequest(t, srv, "POST", "/api/collections/tags/", rows)
+	testutil.Equal(t, w.Code, http.StatusCreated)
+
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["count"]), 2.0)
+	items := jsonItems(t, body)
+	testutil.Equal(t, jsonStr(t, items[0]["name"]), "rust")
+	testutil.Equal(t, jsonStr(t, items[1]["name"]), "sql")
+}
+
+func TestBulkCreateIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	rows := []map[string]any{{"name": "rust"}, {"name": "go"}} // "go" already exists
+	w := doRequest(t, srv, "POST", "/api/collections/tags/", rows)
+	testutil.Equal(t, w.Code, http.StatusConflict)
+
+	w = doRequest(t, srv, "GET", "/api/collections/tags/?filter=name%3D'rust'", nil)
+	testutil.Equal(t, len(jsonItems(t, parseJSON(t, w))), 0)
+}
+
+func TestBulkUpdateByFilter(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "PATCH", "/api/collections/posts/?filter=author_id%3D1", map[string]any{"status": "archived"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["count"]), 2.0)
+	for _, item := range jsonItems(t, body) {
+		testutil.Equal(t, jsonStr(t, item["status"]), "archived")
+	}
+}
+
+func TestBulkDeleteByFilter(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "DELETE", "/api/collections/tags/?filter=id%3E1", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["count"]), 2.0)
+
+	w = doRequest(t, srv, "GET", "/api/collections/tags/", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 1.0)
+}
+
+// --- Upsert tests ---
+
+func TestUpsertMergeUpdatesExisting(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "POST", "/api/collections/posts/?onConflict=id&merge=true",
+		map[string]any{"id": 1, "title": "Renamed"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["id"]), 1.0)
+	testutil.Equal(t, jsonStr(t, body["title"]), "Renamed")
+	testutil.Equal(t, jsonStr(t, body["body"]), "Hello world")
+	_, leaked := body["_ayb_inserted"]
+	testutil.False(t, leaked, "helper column should be stripped")
+}
+
+func TestUpsertMergeInsertsNew(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "POST", "/api/collections/tags/?onConflict=name&merge=true",
+		map[string]any{"name": "rust"})
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	testutil.Equal(t, jsonStr(t, parseJSON(t, w)["name"]), "rust")
+}
+
+func TestUpsertDoNothingSkipsExisting(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "POST", "/api/collections/tags/?onConflict=name", map[string]any{"name": "go"})
+	testutil.Equal(t, w.Code, http.StatusNoContent)
+
+	rows := []map[string]any{{"name": "go"}, {"name": "rust"}}
+	w = doRequest(t, srv, "POST", "/api/collections/tags/?onConflict=name", rows)
+	testutil.Equal(t, w.Code, http.StatusCreated)
+
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["count"]), 1.0)
+	testutil.Equal(t, jsonStr(t, jsonItems(t, body)[0]["name"]), "rust")
+}
+
+func TestUpsertMergeRejectsRepeatedKey(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	rows := []map[string]any{{"name": "go"}, {"name": "rust"}, {"name": "go"}}
+	w := doRequest(t, srv, "POST", "/api/collections/tags/?onConflict=name&merge=true", rows)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+	testutil.Contains(t, jsonStr(t, parseJSON(t, w)["message"]), "rows 0 and 2 have the same onConflict key")
+
+	// Nothing was written.
+	w = doRequest(t, srv, "GET", "/api/collections/tags/?filter=name='rust'", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 0.0)
+}
+
+func TestUpsertRejectsNonUniqueTarget(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "POST", "/api/collections/posts/?onConflict=title", map[string]any{"title": "x"})
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+// --- Cursor pagination tests ---
+
+func TestListCursorPagination(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?cursor=&perPage=2&sort=-id&skipTotal=true", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body := parseJSON(t, w)
+	items := jsonItems(t, body)
+	testutil.Equal(t, len(items), 2)
+	testutil.Equal(t, jsonNum(t, items[0]["id"]), 3.0)
+	testutil.Equal(t, jsonNum(t, items[1]["id"]), 2.0)
+	_, hasPrev := body["prevCursor"]
+	testutil.False(t, hasPrev, "first page should have no prevCursor")
+	next := jsonStr(t, body["nextCursor"])
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?perPage=2&sort=-id&skipTotal=true&cursor="+next, nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body = parseJSON(t, w)
+	items = jsonItems(t, body)
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonNum(t, items[0]["id"]), 1.0)
+	_, hasNext := body["nextCursor"]
+	testutil.False(t, hasNext, "last page should have no nextCursor")
+	prev := jsonStr(t, body["prevCursor"])
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?perPage=2&sort=-id&skipTotal=true&cursor="+prev, nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items = jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 2)
+	testutil.Equal(t, jsonNum(t, items[0]["id"]), 3.0)
+	testutil.Equal(t, jsonNum(t, items[1]["id"]), 2.0)
+}
+
+func TestListCursorWithFilterFieldsAndExpand(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	path := "/api/collections/posts/?perPage=1&sort=title&filter=author_id%3D1&fields=title,author_id&expand=author"
+	w := doRequest(t, srv, "GET", path+"&cursor=", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body := parseJSON(t, w)
+	items := jsonItems(t, body)
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "First Post")
+	_, hasID := items[0]["id"]
+	testutil.False(t, hasID, "keyset column not in fields should be stripped")
+	testutil.NotNil(t, items[0]["expand"])
+
+	w = doRequest(t, srv, "GET", path+"&cursor="+jsonStr(t, body["nextCursor"]), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body = parseJSON(t, w)
+	items = jsonItems(t, body)
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Second Post")
+	_, hasNext := body["nextCursor"]
+	testutil.False(t, hasNext, "filter leaves only two posts")
+}
+
+// --- Aggregate tests ---
+
+func TestAggregateGroupBy(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/aggregate?group=status&agg=count(),max(author_id)", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 2)
+	testutil.Equal(t, jsonStr(t, items[0]["status"]), "draft")
+	testutil.Equal(t, jsonNum(t, items[0]["count"]), 1.0)
+	testutil.Equal(t, jsonStr(t, items[1]["status"]), "published")
+	testutil.Equal(t, jsonNum(t, items[1]["count"]), 2.0)
+	testutil.Equal(t, jsonNum(t, items[1]["max_author_id"]), 2.0)
+}
+
+func TestAggregateFilterHavingAndDateTrunc(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET",
+		"/api/collections/posts/aggregate?group=author_id,date_trunc(day,created_at)&agg=count()&filter=status%3D'published'&having=count%3E%3D1&sort=-author_id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 2)
+	testutil.Equal(t, jsonNum(t, items[0]["author_id"]), 2.0)
+	testutil.NotNil(t, items[0]["created_at_day"])
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/aggregate?group=author_id&having=count%3E1", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items = jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonNum(t, items[0]["author_id"]), 1.0)
+}
+
+// --- Full-text search tests ---
+
+func TestListSearch(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?search=world&searchFields=title,body", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body := parseJSON(t, w)
+	items := jsonItems(t, body)
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "First Post")
+	testutil.Equal(t, jsonNum(t, body["totalItems"]), 1.0)
+}
+
+func TestListSearchRankAndFilter(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?search=post&filter=status%3D'published'&sort=-@rank,id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 2)
+	for _, item := range items {
+		testutil.Equal(t, jsonStr(t, item["status"]), "published")
+	}
+}
+
+func TestListSearchUsesIndexExpression(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+
+	_, err := sharedPG.Pool.Exec(ctx,
+		`CREATE INDEX posts_fts ON posts USING gin (to_tsvector('english', coalesce(title, '') || ' ' || coalesce(body, '')))`)
+	testutil.NoError(t, err)
+	srv := newTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?search=%22another+post%22&sort=-@rank", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Second Post")
+}
+
+func TestListSearchSkipsIndexOverHiddenColumn(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+
+	_, err := sharedPG.Pool.Exec(ctx,
+		`CREATE INDEX posts_fts ON posts USING gin (to_tsvector('english', coalesce(title, '') || ' ' || coalesce(body, '')))`)
+	testutil.NoError(t, err)
+	srv := setColumnAccess(t, ctx, map[string]string{"posts.body": "hidden"})
+
+	// "world" is only in a body, which anonymous requests cannot see.
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?search=world", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, len(jsonItems(t, parseJSON(t, w))), 0)
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?search=bob", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Bob Post")
+}
+
+// --- Related field filter and sort tests ---
+
+func TestListFilterByRelatedField(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?filter=author.name%3D'Bob'", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Bob Post")
+}
+
+func TestListFilterOneToManyAllAndAny(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	// Every post published: only Bob.
+	w := doRequest(t, srv, "GET", "/api/collections/authors/?filter=posts.status%3D'published'", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["name"]), "Bob")
+
+	// At least one draft: only Alice.
+	w = doRequest(t, srv, "GET", "/api/collections/authors/?filter=posts.status%3F%3D'draft'", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items = jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["name"]), "Alice")
+}
+
+func TestListSortByRelatedField(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?sort=-author.name,id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 3)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Bob Post")
+	testutil.Equal(t, jsonStr(t, items[1]["title"]), "First Post")
+}
+
+func TestBulkUpdateByRelatedFilter(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "PATCH", "/api/collections/posts/?filter=author.name%3D'Alice'", map[string]any{"status": "archived"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["count"]), 2.0)
+}
+
+// --- Advanced filter operator tests ---
+
+func setupItemsTable(t *testing.T, ctx context.Context) *server.Server {
+	t.Helper()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE TABLE items (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			meta JSONB,
+			tags TEXT[],
+			created_at TIMESTAMPTZ DEFAULT now()
+		);
+		INSERT INTO items (name, meta, tags, created_at) VALUES
+			('old', '{"color": "red", "size": 3}', '{go,api}', now() - interval '30 days'),
+			('new', '{"color": "blue", "dims": {"w": 2}}', '{go}', now()),
+			('bare', NULL, NULL, now())`)
+	testutil.NoError(t, err)
+	return newTestServer(t, ctx)
+}
+
+func listItemNames(t *testing.T, srv *server.Server, filter string) []string {
+	t.Helper()
+	w := doRequest(t, srv, "GET", "/api/collections/items/?sort=id&filter="+url.QueryEscape(filter), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	var names []string
+	for _, item := range jsonItems(t, parseJSON(t, w)) {
+		names = append(names, jsonStr(t, item["name"]))
+	}
+	return names
+}
+
+func TestListFilterAdvancedOperators(t *testing.T) {
+	ctx := context.Background()
+	srv := setupItemsTable(t, ctx)
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"id BETWEEN 2 AND 3", []string{"new", "bare"}},
+		{"meta IS NULL", []string{"bare"}},
+		{"name ~* 'OL%'", []string{"old"}},
+		{"NOT (name='old' || name='new')", []string{"bare"}},
+		{"meta->>'color' = 'red'", []string{"old"}},
+		{"meta->'size' = 3", []string{"old"}},
+		{"meta->'dims' ? 'w'", []string{"new"}},
+		{`meta @> '{"color": "blue"}'`, []string{"new"}},
+		{"tags @> ('go', 'api')", []string{"old"}},
+		{"tags && ('api', 'x')", []string{"old"}},
+		{"tags ?= 'go'", []string{"old", "new"}},
+		{"created_at < now() - interval '7 days'", []string{"old"}},
+	}
+	for _, tc := range tests {
+		names := listItemNames(t, srv, tc.filter)
+		testutil.Equal(t, len(names), len(tc.want))
+		for i := range tc.want {
+			testutil.Equal(t, names[i], tc.want[i])
+		}
+	}
+}
+
+func TestListFilterInvalidInterval(t *testing.T) {
+	ctx := context.Background()
+	srv := setupItemsTable(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/items/?filter="+url.QueryEscape("created_at > now() - interval 'soon'"), nil)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+// --- Many-to-many tests ---
+
+func setupPostTags(t *testing.T, ctx context.Context) *server.Server {
+	t.Helper()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE TABLE post_tags (
+			post_id INTEGER NOT NULL REFERENCES posts(id),
+			tag_id INTEGER NOT NULL REFERENCES tags(id),
+			PRIMARY KEY (post_id, tag_id)
+		);
+		INSERT INTO post_tags (post_id, tag_id) VALUES (1, 1), (1, 2), (3, 1)`)
+	testutil.NoError(t, err)
+	return newTestServer(t, ctx)
+}
+
+func TestListWithManyToManyExpand(t *testing.T) {
+	ctx := context.Background()
+	srv := setupPostTags(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?expand=tags&sort=id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 3)
+
+	first := items[0]["expand"].(map[string]any)["tags"].([]any)
+	testutil.Equal(t, len(first), 2)
+	tag := first[0].(map[string]any)
+	_, leaked := tag["_ayb_junction_key"]
+	testutil.False(t, leaked, "junction key should be stripped")
+
+	_, ok := items[1]["expand"]
+	testutil.False(t, ok, "post without tags should have no expand")
+
+	third := items[2]["expand"].(map[string]any)["tags"].([]any)
+	testutil.Equal(t, len(third), 1)
+	testutil.Equal(t, jsonStr(t, third[0].(map[string]any)["name"]), "go")
+
+	// And in reverse: tags to posts.
+	w = doRequest(t, srv, "GET", "/api/collections/tags/1?expand=posts", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	posts := parseJSON(t, w)["expand"].(map[string]any)["posts"].([]any)
+	testutil.Equal(t, len(posts), 2)
+}
+
+func TestListFilterByManyToMany(t *testing.T) {
+	ctx := context.Background()
+	srv := setupPostTags(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?sort=id&filter="+url.QueryEscape("tags.name?='api'"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "First Post")
+}
+
+// --- Expand options tests ---
+
+func TestListExpandWithOptions(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	// Latest post per author, limited per parent.
+	w := doRequest(t, srv, "GET", "/api/collections/authors/?sort=id&expand="+url.QueryEscape("posts(sort=-id,limit=1,fields=id,title)"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 2)
+
+	alice := items[0]["expand"].(map[string]any)["posts"].([]any)
+	testutil.Equal(t, len(alice), 1)
+	post := alice[0].(map[string]any)
+	testutil.Equal(t, jsonStr(t, post["title"]), "Second Post")
+	_, hasBody := post["body"]
+	testutil.False(t, hasBody, "fields should restrict expanded columns")
+
+	bob := items[1]["expand"].(map[string]any)["posts"].([]any)
+	testutil.Equal(t, len(bob), 1)
+
+	// Filtered: Alice's published posts only.
+	w = doRequest(t, srv, "GET", "/api/collections/authors/1?expand="+url.QueryEscape("posts(filter=status='published')"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	posts := parseJSON(t, w)["expand"].(map[string]any)["posts"].([]any)
+	testutil.Equal(t, len(posts), 1)
+	testutil.Equal(t, jsonStr(t, posts[0].(map[string]any)["title"]), "First Post")
+}
+
+func TestListExpandNestedWithFields(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	// author_id is needed for the nested expand but not returned.
+	w := doRequest(t, srv, "GET", "/api/collections/authors/2?expand="+url.QueryEscape("posts(fields=title).author_id"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	posts := parseJSON(t, w)["expand"].(map[string]any)["posts"].([]any)
+	testutil.Equal(t, len(posts), 1)
+	post := posts[0].(map[string]any)
+	_, hasFK := post["author_id"]
+	testutil.False(t, hasFK, "join column should be stripped")
+	author := post["expand"].(map[string]any)["author"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, author["name"]), "Bob")
+}
+
+func TestListExpandWithoutJoinColumn(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?sort=id&fields=title&expand=author", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 3)
+	testutil.Equal(t, len(items[0]), 2) // title and expand
+	author := items[0]["expand"].(map[string]any)["author"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, author["name"]), "Alice")
+}
+
+func TestListExpandSelfRelation(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		ALTER TABLE authors ADD COLUMN mentor_id INTEGER REFERENCES authors(id);
+		INSERT INTO authors (name, mentor_id) VALUES ('Carol', 2);
+		UPDATE authors SET mentor_id = 1 WHERE id = 2;`)
+	testutil.NoError(t, err)
+	srv := newTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/authors/?sort=id&expand=mentor.mentor", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 3)
+	_, ok := items[0]["expand"]
+	testutil.False(t, ok, "author without mentor should have no expand")
+	mentor := items[2]["expand"].(map[string]any)["mentor"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, mentor["name"]), "Bob")
+	grand := mentor["expand"].(map[string]any)["mentor"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, grand["name"]), "Alice")
+}
+
+func TestListRecordsKeepPrecision(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE TABLE ledger (id BIGINT PRIMARY KEY, amount NUMERIC(30, 10) NOT NULL);
+		INSERT INTO ledger VALUES (9007199254740993, 12345678901234567890.0123456789);`)
+	testutil.NoError(t, err)
+	srv := newTestServer(t, ctx)
+
+	// Records are copied as Postgres renders them, digit for digit.
+	w := doRequest(t, srv, "GET", "/api/collections/ledger/", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Contains(t, w.Body.String(), `{"id":9007199254740993,"amount":12345678901234567890.0123456789}`)
+}
+
+// exactJSON decodes a response body keeping numbers as they are written.
+func exactJSON(t *testing.T, body []byte) map[string]any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v map[string]any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("parsing JSON response: %v\nbody: %s", err, body)
+	}
+	return v
+}
+
+// createTypedTable creates a table with a column of each type that does not
+// map onto JSON by itself.
+func createTypedTable(t *testing.T, ctx context.Context) {
+	t.Helper()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE TYPE geo_point AS (x DOUBLE PRECISION, y DOUBLE PRECISION);
+		CREATE TABLE typed (
+			id BIGINT PRIMARY KEY,
+			amount NUMERIC(30, 10),
+			price MONEY,
+			data BYTEA,
+			at TIMESTAMPTZ,
+			span INTERVAL,
+			ip INET,
+			seats INT4RANGE,
+			loc geo_point,
+			ratio DOUBLE PRECISION,
+			ids BIGINT[],
+			stamps TIMESTAMPTZ[]
+		);`)
+	testutil.NoError(t, err)
+}
+
+const typedRecord = `{"id":9007199254740993,"amount":12345678901234567890.0123456789,"price":1234.50,` +
+	`"data":"\\x0102ff","at":"2026-02-07T08:00:00.5Z","span":"1 day 02:00:00","ip":"10.0.0.0/8",` +
+	`"seats":"[1,10)","loc":{"x":1.5,"y":-2},"ratio":"NaN","ids":[9007199254740993,1],` +
+	`"stamps":["2026-02-07T08:00:00Z","infinity"]}`
+
+func TestRecordTypesRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	createTypedTable(t, ctx)
+	srv := newTestServer(t, ctx)
+	want := exactJSON(t, []byte(typedRecord))
+
+	// Values are written in other forms Postgres reads, and come back in one.
+	body := json.RawMessage(`{"id":9007199254740993,"amount":12345678901234567890.0123456789,"price":"$1,234.50",` +
+		`"data":"\\x0102FF","at":"2026-02-07T10:00:00.5+02:00","span":"26 hours","ip":"10.0.0.0/8",` +
+		`"seats":"[1,9]","loc":{"x":1.5,"y":-2},"ratio":"NaN","ids":[9007199254740993,1.0],` +
+		`"stamps":["2026-02-07 09:00:00+01","infinity"]}`)
+	w := doRequest(t, srv, "POST", "/api/collections/typed/", body)
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	created := exactJSON(t, w.Body.Bytes())
+	want["span"] = "26:00:00"
+	testutil.True(t, reflect.DeepEqual(created, want), "created %v, want %v", created, want)
+
+	// Records are written back as they read.
+	want["span"] = "1 day 02:00:00"
+	update := maps.Clone(want)
+	delete(update, "id")
+	w = doRequest(t, srv, "PATCH", "/api/collections/typed/9007199254740993", update)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.True(t, reflect.DeepEqual(exactJSON(t, w.Body.Bytes()), want), "updated %s", w.Body.String())
+
+	w = doRequest(t, srv, "GET", "/api/collections/typed/9007199254740993", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.True(t, reflect.DeepEqual(exactJSON(t, w.Body.Bytes()), want), "read %s", w.Body.String())
+
+	// The list is rendered by Postgres, in the same forms.
+	w = doRequest(t, srv, "GET", "/api/collections/typed/?sort=-amount", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := exactJSON(t, w.Body.Bytes())["items"].([]any)
+	testutil.Equal(t, len(items), 1)
+	testutil.True(t, reflect.DeepEqual(items[0], any(want)), "listed %s", w.Body.String())
+}
+
+func TestRecordTypesNumericStrings(t *testing.T) {
+	ctx := context.Background()
+	createTypedTable(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE TABLE transfers (id SERIAL PRIMARY KEY, typed_id BIGINT REFERENCES typed(id), fee MONEY);`)
+	testutil.NoError(t, err)
+
+	logger := testutil.DiscardLogger()
+	ch := schema.NewCacheHolder(sharedPG.Pool, logger)
+	ch.SetExposure(schema.Exposure{NumericStrings: true})
+	testutil.NoError(t, ch.Load(ctx))
+	srv := server.New(config.Default(), logger, ch, sharedPG.Pool, nil, nil)
+
+	w := doRequest(t, srv, "POST", "/api/collections/typed/", map[string]any{
+		"id": "9007199254740993", "amount": "0.1000000000", "price": "1234.5",
+	})
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	rec := parseJSON(t, w)
+	testutil.Equal(t, jsonStr(t, rec["id"]), "9007199254740993")
+	testutil.Equal(t, jsonStr(t, rec["amount"]), "0.1000000000")
+	testutil.Equal(t, jsonStr(t, rec["price"]), "1234.50")
+
+	// Keys in their string form still join related records.
+	w = doRequest(t, srv, "POST", "/api/collections/transfers/", map[string]any{"typed_id": rec["id"], "fee": 2})
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	w = doRequest(t, srv, "GET", "/api/collections/transfers/?expand=typed", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["fee"]), "2.00")
+	typed := items[0]["expand"].(map[string]any)["typed"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, typed["id"]), "9007199254740993")
+
+	data := gqlData(t, doGraphQL(t, srv, `{ transfers { fee typed { id price } } }`, nil))
+	transfers := data["transfers"].([]any)
+	testutil.SliceLen(t, transfers, 1)
+	typed = transfers[0].(map[string]any)["typed"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, typed["id"]), "9007199254740993")
+	testutil.Equal(t, jsonStr(t, typed["price"]), "1234.50")
+}
+
+func TestListExpandInvalidOptions(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/authors/?expand="+url.QueryEscape("posts(filter=nope=1)"), nil)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+// --- Export tests ---
+
+func TestExportCSV(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/export?format=csv&fields=id,title,body&sort=id&filter="+url.QueryEscape("status='published'"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+	testutil.Contains(t, w.Header().Get("Content-Disposition"), `filename="posts.csv"`)
+	testutil.Equal(t, w.Body.String(), "id,title,body\n1,First Post,Hello world\n3,Bob Post,By Bob\n")
+}
+
+func TestExportNDJSONAndJSON(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/authors/export?format=ndjson&sort=id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, w.Body.String(), "{\"id\":1,\"name\":\"Alice\"}\n{\"id\":2,\"name\":\"Bob\"}\n")
+
+	w = doRequest(t, srv, "GET", "/api/collections/authors/export?format=json&sort=-id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	var items []map[string]any
+	testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	testutil.Equal(t, len(items), 2)
+	testutil.Equal(t, jsonStr(t, items[0]["name"]), "Bob")
+
+	// No rows is still a valid document.
+	w = doRequest(t, srv, "GET", "/api/collections/authors/export?filter="+url.QueryEscape("id>100"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, w.Body.String(), "[]\n")
+}
+
+func TestExportNoPageCap(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `INSERT INTO tags (name) SELECT 'bulk' || g FROM generate_series(1, 1200) AS g`)
+	testutil.NoError(t, err)
+	srv := newTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/tags/export?format=ndjson", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, bytes.Count(w.Body.Bytes(), []byte("\n")), 1203)
+}
+
+// doImport posts an import body with the given content type.
+func doImport(t *testing.T, srv *server.Server, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doImport(t, srv, "/api/collections/posts/import", "text/csv",
+		"title,body,author_id,status\nImported One,,2,published\n\"Imported, Two\",\"multi\nline\",1,draft\n")
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["total"]), 2)
+	testutil.Equal(t, jsonNum(t, body["inserted"]), 2)
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts?filter="+url.QueryEscape("title~'Imported%'")+"&sort=id", nil)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 2)
+	testutil.Equal(t, items[0]["body"], nil)
+	testutil.Equal(t, jsonStr(t, items[1]["title"]), "Imported, Two")
+	testutil.Equal(t, jsonStr(t, items[1]["body"]), "multi\nline")
+	testutil.Equal(t, jsonNum(t, items[1]["author_id"]), 1)
+}
+
+func TestImportNDJSONUpsert(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	body := `{"name":"go"}` + "\n" + `{"name":"sql"}` + "\n"
+	w := doImport(t, srv, "/api/collections/tags/import?onConflict=name", "application/x-ndjson", body)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	resp := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, resp["inserted"]), 1)
+	testutil.Equal(t, jsonNum(t, resp["skipped"]), 1)
+
+	w = doImport(t, srv, "/api/collections/authors/import?onConflict=id&merge=true", "application/x-ndjson",
+		`{"id":1,"name":"Alicia"}`+"\n"+`{"id":3,"name":"Carol"}`+"\n")
+	testutil.Equal(t, w.Code, http.StatusOK)
+	resp = parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, resp["inserted"]), 1)
+	testutil.Equal(t, jsonNum(t, resp["updated"]), 1)
+
+	w = doRequest(t, srv, "GET", "/api/collections/authors/1", nil)
+	testutil.Equal(t, jsonStr(t, parseJSON(t, w)["name"]), "Alicia")
+}
+
+func TestImportDryRunWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doImport(t, srv, "/api/collections/tags/import?dryRun=true", "text/csv", "name\nrust\nzig\n")
+	testutil.Equal(t, w.Code, http.StatusOK)
+	resp := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, resp["inserted"]), 2)
+	testutil.Equal(t, resp["dryRun"], true)
+
+	w = doRequest(t, srv, "GET", "/api/collections/tags", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 3)
+}
+
+func TestImportReportsRowErrorsAndRollsBack(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	// Row 2 fails conversion, row 3 breaks the foreign key, row 4 the unique index.
+	w := doImport(t, srv, "/api/collections/posts/import", "text/csv",
+		"title,author_id\nGood,1\nBad,x\nOrphan,99\nAlso good,2\n")
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+	resp := parseJSON(t, w)
+	testutil.Contains(t, jsonStr(t, resp["message"]), "import failed: 2 errors")
+	errs := resp["data"].(map[string]any)["errors"].([]any)
+	testutil.Equal(t, len(errs), 2)
+	first := errs[0].(map[string]any)
+	testutil.Equal(t, jsonNum(t, first["row"]), 2)
+	testutil.Equal(t, jsonStr(t, first["column"]), "author_id")
+	second := errs[1].(map[string]any)
+	testutil.Equal(t, jsonNum(t, second["row"]), 3)
+	testutil.Contains(t, jsonStr(t, second["message"]), "foreign key violation")
+
+	w = doImport(t, srv, "/api/collections/tags/import", "text/csv", "name\nnew\ngo\n")
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+	errs = parseJSON(t, w)["data"].(map[string]any)["errors"].([]any)
+	testutil.Equal(t, len(errs), 1)
+	testutil.Equal(t, jsonNum(t, errs[0].(map[string]any)["row"]), 2)
+	testutil.Contains(t, jsonStr(t, errs[0].(map[string]any)["message"]), "unique constraint violation")
+
+	// Nothing from either import was kept.
+	w = doRequest(t, srv, "GET", "/api/collections/posts", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 3)
+	w = doRequest(t, srv, "GET", "/api/collections/tags", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 3)
+}
+
+func TestImportManyBatches(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	var buf bytes.Buffer
+	buf.WriteString("name\n")
+	for i := 0; i < 1234; i++ {
+		fmt.Fprintf(&buf, "bulk%d\n", i)
+	}
+	w := doImport(t, srv, "/api/collections/tags/import", "text/csv", buf.String())
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["inserted"]), 1234)
+
+	w = doRequest(t, srv, "GET", "/api/collections/tags?perPage=1", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 1237)
+}
+
+// doRequestWithHeader is doRequest with one extra request header.
+func doRequestWithHeader(t *testing.T, srv *server.Server, method, path string, body any, key, value string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reqBody io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reqBody = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, reqBody)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(key, value)
+	w := httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestReadETagAndIfNoneMatch(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/1", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	etag := w.Header().Get("ETag")
+	testutil.True(t, etag != "", "expected an ETag")
+	_, leaked := parseJSON(t, w)["_ayb_etag"]
+	testutil.False(t, leaked, "version column should not be returned")
+
+	w = doRequestWithHeader(t, srv, "GET", "/api/collections/posts/1", nil, "If-None-Match", etag)
+	testutil.Equal(t, w.Code, http.StatusNotModified)
+	testutil.Equal(t, w.Body.Len(), 0)
+
+	// Any change to the row changes the tag.
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Edited"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	newTag := w.Header().Get("ETag")
+	testutil.NotEqual(t, newTag, etag)
+
+	w = doRequestWithHeader(t, srv, "GET", "/api/collections/posts/1", nil, "If-None-Match", etag)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, w.Header().Get("ETag"), newTag)
+
+	// Another selection of fields is another representation.
+	w = doRequestWithHeader(t, srv, "GET", "/api/collections/posts/1?fields=id", nil, "If-None-Match", newTag)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.NotEqual(t, w.Header().Get("ETag"), newTag)
+}
+
+func TestUpdateIfMatch(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/1", nil)
+	etag := w.Header().Get("ETag")
+
+	// First editor wins.
+	w = doRequestWithHeader(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Mine"}, "If-Match", etag)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonStr(t, parseJSON(t, w)["title"]), "Mine")
+
+	// Second editor, holding the old tag, is refused.
+	w = doRequestWithHeader(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Theirs"}, "If-Match", etag)
+	testutil.Equal(t, w.Code, http.StatusPreconditionFailed)
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/1", nil)
+	testutil.Equal(t, jsonStr(t, parseJSON(t, w)["title"]), "Mine")
+
+	// A missing record is still a 404.
+	w = doRequestWithHeader(t, srv, "PATCH", "/api/collections/posts/999", map[string]any{"title": "x"}, "If-Match", etag)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+}
+
+func TestDeleteIfMatch(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	w := doRequestWithHeader(t, srv, "DELETE", "/api/collections/posts/2", nil, "If-Match", `"1"`)
+	testutil.Equal(t, w.Code, http.StatusPreconditionFailed)
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/2", nil)
+	etag := w.Header().Get("ETag")
+	w = doRequestWithHeader(t, srv, "DELETE", "/api/collections/posts/2", nil, "If-Match", etag)
+	testutil.Equal(t, w.Code, http.StatusNoContent)
+}
+
+// --- Computed field tests ---
+
+func setupComputedFields(t *testing.T, ctx context.Context) *server.Server {
+	t.Helper()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE FUNCTION shout(authors) RETURNS text AS $$
+			SELECT upper($1.name) || '!'
+		$$ LANGUAGE sql STABLE;
+		CREATE FUNCTION title_length(posts) RETURNS integer AS $$
+			SELECT length($1.title)
+		$$ LANGUAGE sql STABLE`)
+	testutil.NoError(t, err)
+	return newTestServer(t, ctx)
+}
+
+func TestComputedFieldsSelectFilterSort(t *testing.T) {
+	ctx := context.Background()
+	srv := setupComputedFields(t, ctx)
+
+	// Computed fields are only returned when asked for.
+	w := doRequest(t, srv, "GET", "/api/collections/authors/1", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	_, ok := parseJSON(t, w)["shout"]
+	testutil.False(t, ok, "computed field should not be selected by default")
+
+	w = doRequest(t, srv, "GET", "/api/collections/authors/1?fields=*,shout", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonStr(t, body["name"]), "Alice")
+	testutil.Equal(t, jsonStr(t, body["shout"]), "ALICE!")
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?fields=id,title_length&sort=-title_length,id&filter="+url.QueryEscape("title_length > 8"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.SliceLen(t, items, 2)
+	testutil.Equal(t, jsonNum(t, items[0]["id"]), 2.0)
+	testutil.Equal(t, jsonNum(t, items[0]["title_length"]), 11.0)
+	testutil.Equal(t, jsonNum(t, items[1]["id"]), 1.0)
+
+	// Computed fields on related tables can be filtered on too.
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?sort=id&filter="+url.QueryEscape("author.shout = 'BOB!'"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items = jsonItems(t, parseJSON(t, w))
+	testutil.SliceLen(t, items, 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Bob Post")
+}
+
+func TestComputedFieldsInSchema(t *testing.T) {
+	ctx := context.Background()
+	srv := setupComputedFields(t, ctx)
+
+	w := doRequest(t, srv, "GET", "/api/schema", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	var sc schema.SchemaCache
+	testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	cf := sc.Tables["public.authors"].ComputedFieldByName("shout")
+	testutil.NotNil(t, cf)
+	testutil.Equal(t, cf.JSONType, "string")
+}
+
+// --- GraphQL tests ---
+
+// doGraphQL posts a GraphQL request and returns the decoded response.
+func doGraphQL(t *testing.T, srv *server.Server, query string, variables map[string]any) map[string]any {
+	t.Helper()
+	w := doRequest(t, srv, "POST", "/api/graphql", map[string]any{"query": query, "variables": variables})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	return parseJSON(t, w)
+}
+
+// gqlData returns the data of a GraphQL response, failing on errors.
+func gqlData(t *testing.T, resp map[string]any) map[string]any {
+	t.Helper()
+	if errs, ok := resp["errors"]; ok {
+		t.Fatalf("unexpected GraphQL errors: %v", errs)
+	}
+	return resp["data"].(map[string]any)
+}
+
+func TestGraphQLQueryWithRelations(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	data := gqlData(t, doGraphQL(t, srv, `{
+		authors(sort: "id") {
+			name
+			latest: posts(sort: "-id", limit: 1) { title author { name } }
+			published: posts(filter: "status='published'") { title }
+		}
+		posts(filter: "status='published'", sort: "id", perPage: 1, page: 2) { __typename title author { name } }
+		published: posts_count(filter: "status='published'")
+	}`, nil))
+
+	authors := data["authors"].([]any)
+	testutil.SliceLen(t, authors, 2)
+	alice := authors[0].(map[string]any)
+	testutil.Equal(t, jsonStr(t, alice["name"]), "Alice")
+	latest := alice["latest"].([]any)
+	testutil.SliceLen(t, latest, 1)
+	post := latest[0].(map[string]any)
+	testutil.Equal(t, jsonStr(t, post["title"]), "Second Post")
+	testutil.Equal(t, jsonStr(t, post["author"].(map[string]any)["name"]), "Alice")
+	testutil.SliceLen(t, alice["published"].([]any), 1)
+
+	posts := data["posts"].([]any)
+	testutil.SliceLen(t, posts, 1)
+	post = posts[0].(map[string]any)
+	testutil.Equal(t, jsonStr(t, post["__typename"]), "posts")
+	testutil.Equal(t, jsonStr(t, post["title"]), "Bob Post")
+	testutil.Equal(t, jsonStr(t, post["author"].(map[string]any)["name"]), "Bob")
+	testutil.Equal(t, jsonNum(t, data["published"]), 2.0)
+
+	// Selection order is kept, and join columns that were not asked for are
+	// left out.
+	w := doRequest(t, srv, "POST", "/api/graphql", map[string]any{"query": `{ posts_by_pk(id: 3) { title author { name } id } }`})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, strings.TrimSpace(w.Body.String()), `{"data":{"posts_by_pk":{"title":"Bob Post","author":{"name":"Bob"},"id":3}}}`)
+}
+
+func TestGraphQLByPKAndComputedFields(t *testing.T) {
+	ctx := context.Background()
+	srv := setupComputedFields(t, ctx)
+
+	data := gqlData(t, doGraphQL(t, srv, `query ($id: Int!) {
+		authors_by_pk(id: $id) { name shout posts(sort: "id") { title title_length } }
+		missing: authors_by_pk(id: 99) { name }
+	}`, map[string]any{"id": 1}))
+
+	author := data["authors_by_pk"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, author["shout"]), "ALICE!")
+	posts := author["posts"].([]any)
+	testutil.SliceLen(t, posts, 2)
+	testutil.Equal(t, jsonNum(t, posts[0].(map[string]any)["title_length"]), 10.0)
+	testutil.Nil(t, data["missing"])
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	data := gqlData(t, doGraphQL(t, srv, `mutation ($title: String!) {
+		created: insert_posts_one(object: {title: $title, author_id: 2}) { id title status author { name } }
+		many: insert_tags(objects: [{name: "db"}, {name: "sql"}]) { name }
+		updated: update_posts(filter: "author_id=1", set: {status: "archived"}) { id status }
+		deleted: delete_tags_by_pk(id: 3) { name }
+		none: delete_tags_by_pk(id: 99) { name }
+	}`, map[string]any{"title": "From GraphQL"}))
+
+	created := data["created"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, created["title"]), "From GraphQL")
+	testutil.Equal(t, jsonStr(t, created["status"]), "draft")
+	testutil.Equal(t, jsonStr(t, created["author"].(map[string]any)["name"]), "Bob")
+	testutil.SliceLen(t, data["many"].([]any), 2)
+	testutil.SliceLen(t, data["updated"].([]any), 2)
+	testutil.Equal(t, jsonStr(t, data["deleted"].(map[string]any)["name"]), "test")
+	testutil.Nil(t, data["none"])
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?filter="+url.QueryEscape("status='archived'"), nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 2.0)
+	w = doRequest(t, srv, "GET", "/api/collections/tags/3", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+
+	data = gqlData(t, doGraphQL(t, srv, fmt.Sprintf(`mutation {
+		update_posts_by_pk(id: %d, set: {title: "Renamed"}) { title }
+	}`, int(jsonNum(t, created["id"]))), nil))
+	testutil.Equal(t, jsonStr(t, data["update_posts_by_pk"].(map[string]any)["title"]), "Renamed")
+}
+
+func TestGraphQLMutationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := setupTestServer(t, ctx)
+
+	resp := doGraphQL(t, srv, `mutation {
+		a: insert_tags_one(object: {name: "new"}) { id }
+		b: insert_tags_one(object: {name: "go"}) { id }
+	}`, nil)
+	testutil.Nil(t, resp["data"])
+	errs := resp["errors"].([]any)
+	testutil.SliceLen(t, errs, 1)
+	gerr := errs[0].(map[string]any)
+	testutil.Equal(t, jsonStr(t, gerr["message"]), "unique constraint violation")
+	testutil.True(t, reflect.DeepEqual(gerr["path"], []any{"b"}), "path: %v", gerr["path"])
+
+	// The first insert was rolled back with the second.
+	w := doRequest(t, srv, "GET", "/api/collections/tags/", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 3.0)
+}
+
+func TestGraphQLFunctions(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE FUNCTION posts_by_status(want text) RETURNS SETOF posts AS $$
+			SELECT * FROM posts WHERE status = want ORDER BY id
+		$$ LANGUAGE sql STABLE;
+		CREATE FUNCTION add_numbers(a integer, b integer) RETURNS integer AS $$
+			SELECT a + b
+		$$ LANGUAGE sql IMMUTABLE`)
+	testutil.NoError(t, err)
+	srv := newTestServer(t, ctx)
+
+	data := gqlData(t, doGraphQL(t, srv, `mutation {
+		posts_by_status(want: "published") { title author { name } }
+		add_numbers(a: 2, b: 3)
+	}`, nil))
+	posts := data["posts_by_status"].([]any)
+	testutil.SliceLen(t, posts, 2)
+	testutil.Equal(t, jsonStr(t, posts[1].(map[string]any)["author"].(map[string]any)["name"]), "Bob")
+	testutil.Equal(t, jsonNum(t, data["add_numbers"]), 5.0)
+}
+
+// --- Access rule tests ---
+
+// setRules stores access rules for a table, keyed by action, and returns a
+// server whose schema cache includes them.
+func setRules(t *testing.T, ctx context.Context, table string, rules map[string]string) *server.Server {
+	t.Helper()
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS _ayb_collection_rules (
+			table_schema TEXT NOT NULL DEFAULT 'public',
+			table_name   TEXT NOT NULL,
+			list_rule    TEXT,
+			view_rule    TEXT,
+			create_rule  TEXT,
+			update_rule  TEXT,
+			delete_rule  TEXT,
+			updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (table_schema, table_name)
+		)`)
+	testutil.NoError(t, err)
+	_, err = sharedPG.Pool.Exec(ctx, `
+		INSERT INTO _ayb_collection_rules (table_name, list_rule, view_rule, create_rule, update_rule, delete_rule)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''))`,
+		table, rules["list"], rules["view"], rules["create"], rules["update"], rules["delete"])
+	testutil.NoError(t, err)
+	return newTestServer(t, ctx)
+}
+
+func TestRulesLimitRelatedFilters(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setRules(t, ctx, "authors", map[string]string{"list": "name = 'Alice'"})
+
+	// Bob is hidden from lists, so filters cannot reach him through posts.
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?filter="+url.QueryEscape("author.name='Bob'"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 0.0)
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?filter="+url.QueryEscape("author.name='Alice'"), nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 2.0)
+
+	// The same holds for bulk writes, which filter the same way.
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/?filter="+url.QueryEscape("author.name='Bob'"), map[string]any{"status": "draft"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["count"]), 0.0)
+}
+
+func TestRulesLimitRelatedSorts(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setRules(t, ctx, "authors", map[string]string{"list": "name = 'Bob'"})
+
+	// Alice is hidden from lists, so her posts sort as if they had no author.
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?sort=author.name,id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 3)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Bob Post")
+	testutil.Equal(t, jsonStr(t, items[1]["title"]), "First Post")
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/export?format=ndjson&fields=title&sort=author.name,id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	testutil.Equal(t, len(lines), 3)
+	testutil.Contains(t, lines[0], "Bob Post")
+}
+
+func TestRulesListAndView(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setRules(t, ctx, "posts", map[string]string{
+		"list": "status = 'published'",
+		"view": "status = 'published'",
+	})
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?sort=id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["totalItems"]), 2.0)
+
+	// The rule is combined with the request's filter.
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?filter="+url.QueryEscape("author_id=1"), nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 1.0)
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/1", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	w = doRequest(t, srv, "GET", "/api/collections/posts/2", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+
+	// Expanded posts are listed under the same rule.
+	w = doRequest(t, srv, "GET", "/api/collections/authors/1?expand=posts", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	posts := parseJSON(t, w)["expand"].(map[string]any)["posts"].([]any)
+	testutil.SliceLen(t, posts, 1)
+
+	data := gqlData(t, doGraphQL(t, srv, `{ posts { title } posts_count second: posts_by_pk(id: 2) { title } }`, nil))
+	testutil.SliceLen(t, data["posts"].([]any), 2)
+	testutil.Equal(t, jsonNum(t, data["posts_count"]), 2.0)
+	testutil.True(t, data["second"] == nil, "posts_by_pk should not find a draft")
+
+	// Tables without rules are unaffected.
+	w = doRequest(t, srv, "GET", "/api/collections/authors/", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 2.0)
+}
+
+func TestRulesCreate(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setRules(t, ctx, "posts", map[string]string{
+		"create": "@request.body.status = 'draft' && author_id = 1",
+	})
+
+	w := doRequest(t, srv, "POST", "/api/collections/posts/", map[string]any{"title": "Ok", "status": "draft", "author_id": 1})
+	testutil.Equal(t, w.Code, http.StatusCreated)
+
+	w = doRequest(t, srv, "POST", "/api/collections/posts/", map[string]any{"title": "No", "status": "published", "author_id": 1})
+	testutil.Equal(t, w.Code, http.StatusForbidden)
+	testutil.Contains(t, w.Body.String(), "create rule")
+
+	w = doRequest(t, srv, "POST", "/api/collections/posts/", []map[string]any{
+		{"title": "Ok too", "status": "draft", "author_id": 1},
+		{"title": "Wrong author", "status": "draft", "author_id": 2},
+	})
+	testutil.Equal(t, w.Code, http.StatusForbidden)
+
+	// Denied inserts are rolled back.
+	w = doRequest(t, srv, "GET", "/api/collections/posts/", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 4.0)
+
+	resp := doGraphQL(t, srv, `mutation { insert_posts_one(object: {title: "Gql", status: "published", author_id: 1}) { id } }`, nil)
+	errs, _ := resp["errors"].([]any)
+	testutil.SliceLen(t, errs, 1)
+	testutil.Contains(t, jsonStr(t, errs[0].(map[string]any)["message"]), "create rule")
+}
+
+func TestRulesCreateManyChecksEachBody(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setRules(t, ctx, "posts", map[string]string{"create": "@request.body.title = title"})
+
+	// Each record is checked with the body it was created from.
+	rows := make([]map[string]any, 20)
+	for i := range rows {
+		rows[i] = map[string]any{"title": fmt.Sprintf("Post %d", i), "author_id": 1 + i%2}
+	}
+	w := doRequest(t, srv, "POST", "/api/collections/posts/", rows)
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 20)
+	testutil.Equal(t, jsonStr(t, items[19]["title"]), "Post 19")
+
+	objects := `[{title: "Gql 1", author_id: 1}, {title: "Gql 2", author_id: 2}]`
+	resp := doGraphQL(t, srv, `mutation { insert_posts(objects: `+objects+`) { title } }`, nil)
+	testutil.Nil(t, resp["errors"])
+}
+
+func TestRulesUpdateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setRules(t, ctx, "posts", map[string]string{
+		// A field missing from the body is null, and null is never unequal.
+		"update": "status = 'draft' && (@request.body.status = null || @request.body.status != 'archived')",
+		"delete": "false",
+	})
+
+	w := doRequest(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Edited"})
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/2", map[string]any{"status": "archived"})
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/2", map[string]any{"title": "Edited"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/?filter="+url.QueryEscape("id > 0"), map[string]any{"body": "Bulk"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["count"]), 1.0)
+
+	w = doRequest(t, srv, "DELETE", "/api/collections/posts/2", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "DELETE", "/api/collections/posts/?filter="+url.QueryEscape("id > 0"), nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["count"]), 0.0)
+
+	w = doRequest(t, srv, "POST", "/api/batch", map[string]any{"operations": []map[string]any{
+		{"method": "delete", "table": "posts", "id": 3},
+	}})
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+
+	// Merging would update rows without the update rule.
+	w = doRequest(t, srv, "POST", "/api/collections/posts/?onConflict=id&merge=true", map[string]any{"id": 2, "title": "Merged"})
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+func TestRulesInvalidRuleFailsClosed(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setRules(t, ctx, "posts", map[string]string{"list": "no_such_column = 1"})
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/", nil)
+	testutil.Equal(t, w.Code, http.StatusInternalServerError)
+	testutil.Contains(t, w.Body.String(), "invalid access rule")
+}
+
+// --- Column access tests ---
+
+// setColumnAccess stores column restrictions for anonymous requests, keyed by
+// "table.column", and returns a server whose schema cache includes them.
+func setColumnAccess(t *testing.T, ctx context.Context, access map[string]string) *server.Server {
+	t.Helper()
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS _ayb_column_access (
+			table_schema TEXT NOT NULL DEFAULT 'public',
+			table_name   TEXT NOT NULL,
+			column_name  TEXT NOT NULL,
+			role         TEXT NOT NULL DEFAULT '*',
+			access       TEXT NOT NULL,
+			updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (table_schema, table_name, column_name, role)
+		)`)
+	testutil.NoError(t, err)
+	for key, level := range access {
+		table, column, _ := strings.Cut(key, ".")
+		_, err = sharedPG.Pool.Exec(ctx, `
+			INSERT INTO _ayb_column_access (table_name, column_name, role, access) VALUES ($1, $2, 'anon', $3)`,
+			table, column, level)
+		testutil.NoError(t, err)
+	}
+	return newTestServer(t, ctx)
+}
+
+func TestColumnAccessHidden(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setColumnAccess(t, ctx, map[string]string{"posts.body": "hidden"})
+
+	w := doRequest(t, srv, "GET", "/api/collections/posts/?sort=id", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "First Post")
+	_, ok := items[0]["body"]
+	testutil.False(t, ok, "body should be hidden")
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/1?fields=*,body", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	_, ok = parseJSON(t, w)["body"]
+	testutil.False(t, ok, "body should be hidden")
+
+	// Hidden columns cannot be filtered or sorted on.
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?filter="+url.QueryEscape("body='By Bob'"), nil)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+
+	// Writes ignore them like unknown columns, and do not return them.
+	w = doRequest(t, srv, "POST", "/api/collections/posts/", map[string]any{"title": "New", "body": "secret"})
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	_, ok = parseJSON(t, w)["body"]
+	testutil.False(t, ok, "body should be hidden")
+	var body *string
+	testutil.NoError(t, sharedPG.Pool.QueryRow(ctx, "SELECT body FROM posts WHERE title = 'New'").Scan(&body))
+	testutil.True(t, body == nil, "body should not be written")
+
+	// Expanded records are restricted too.
+	w = doRequest(t, srv, "GET", "/api/collections/authors/1?expand=posts", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	expanded := parseJSON(t, w)["expand"].(map[string]any)["posts"].([]any)
+	_, ok = expanded[0].(map[string]any)["body"]
+	testutil.False(t, ok, "body should be hidden")
+
+	resp := doGraphQL(t, srv, `{ posts { title body } }`, nil)
+	testutil.NotNil(t, resp["errors"])
+}
+
+func TestColumnAccessReadOnly(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	srv := setColumnAccess(t, ctx, map[string]string{
+		"posts.status": "read_only",
+		"posts.title":  "insert_only",
+	})
+
+	w := doRequest(t, srv, "POST", "/api/collections/posts/", map[string]any{"title": "New", "status": "published"})
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	created := parseJSON(t, w)
+	testutil.Equal(t, jsonStr(t, created["title"]), "New")
+	testutil.Equal(t, jsonStr(t, created["status"]), "draft")
+
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Changed", "status": "draft"})
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+	testutil.Contains(t, w.Body.String(), "no writable columns")
+
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Changed", "body": "Edited"})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	updated := parseJSON(t, w)
+	testutil.Equal(t, jsonStr(t, updated["title"]), "First Post")
+	testutil.Equal(t, jsonStr(t, updated["body"]), "Edited")
+
+	resp := doGraphQL(t, srv, `mutation { update_posts_by_pk(id: 1, set: {status: "draft"}) { id } }`, nil)
+	testutil.NotNil(t, resp["errors"])
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		ALTER TABLE posts ADD COLUMN deleted_at TIMESTAMPTZ;
+		CREATE TABLE IF NOT EXISTS _ayb_soft_delete (
+			table_schema TEXT NOT NULL DEFAULT 'public',
+			table_name   TEXT NOT NULL,
+			column_name  TEXT NOT NULL DEFAULT 'deleted_at',
+			updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (table_schema, table_name)
+		);
+		INSERT INTO _ayb_soft_delete (table_name) VALUES ('posts')`)
+	testutil.NoError(t, err)
+	srv, adminToken := newAdminTestServer(t, ctx)
+
+	w := doRequest(t, srv, "DELETE", "/api/collections/posts/1", nil)
+	testutil.Equal(t, w.Code, http.StatusNoContent)
+
+	// The row is kept, but hidden from reads and writes.
+	var deleted bool
+	err = sharedPG.Pool.QueryRow(ctx, "SELECT deleted_at IS NOT NULL FROM posts WHERE id = 1").Scan(&deleted)
+	testutil.NoError(t, err)
+	testutil.True(t, deleted, "expected deleted_at to be set")
+
+	w = doRequest(t, srv, "GET", "/api/collections/posts/1", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "GET", "/api/collections/posts/", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 2.0)
+	w = doRequest(t, srv, "PATCH", "/api/collections/posts/1", map[string]any{"title": "Changed"})
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "DELETE", "/api/collections/posts/1", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+
+	// Only admins may include deleted records.
+	w = doRequest(t, srv, "GET", "/api/collections/posts/?withDeleted=true", nil)
+	testutil.Equal(t, w.Code, http.StatusForbidden)
+	w = doRequestWithHeader(t, srv, "GET", "/api/collections/posts/?withDeleted=true", nil, "Authorization", "Bearer "+adminToken)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 3.0)
+
+	// Without an admin password nobody is an admin.
+	w = doRequest(t, newTestServer(t, ctx), "GET", "/api/collections/posts/?withDeleted=true", nil)
+	testutil.Equal(t, w.Code, http.StatusForbidden)
+
+	w = doRequest(t, srv, "POST", "/api/collections/posts/1/restore", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	restored := parseJSON(t, w)
+	testutil.Equal(t, jsonStr(t, restored["title"]), "First Post")
+	testutil.True(t, restored["deleted_at"] == nil, "expected deleted_at to be cleared")
+
+	w = doRequest(t, srv, "POST", "/api/collections/posts/1/restore", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "GET", "/api/collections/posts/1", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+}
+
+func TestAuditHistory(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	runner := migrations.NewRunner(sharedPG.Pool, testutil.DiscardLogger())
+	testutil.NoError(t, runner.Bootstrap(ctx))
+	_, err := runner.Run(ctx)
+	testutil.NoError(t, err)
+	_, err = sharedPG.Pool.Exec(ctx, "INSERT INTO _ayb_audit_tables (table_name) VALUES ('posts')")
+	testutil.NoError(t, err)
+	srv, adminToken := newAdminTestServer(t, ctx)
+
+	w := doRequest(t, srv, "POST", "/api/collections/posts/", map[string]any{"title": "Audited"})
+	testutil.Equal(t, w.Code, http.StatusCreated)
+	id := fmt.Sprint(jsonNum(t, parseJSON(t, w)["id"]))
+
+	// Changes made as a user are attributed to them, through the API or not.
+	tx, err := sharedPG.Pool.Begin(ctx)
+	testutil.NoError(t, err)
+	_, err = tx.Exec(ctx, "SELECT set_config('ayb.user_id', 'user-1', true)")
+	testutil.NoError(t, err)
+	_, err = tx.Exec(ctx, "UPDATE posts SET title = 'Edited' WHERE id = $1", id)
+	testutil.NoError(t, err)
+	testutil.NoError(t, tx.Commit(ctx))
+
+	w = doRequest(t, srv, "DELETE", "/api/collections/posts/"+id, nil)
+	testutil.Equal(t, w.Code, http.StatusNoContent)
+
+	// Admins can still read the deleted record's history.
+	w = doRequestWithHeader(t, srv, "GET", "/api/collections/posts/"+id+"/history", nil, "Authorization", "Bearer "+adminToken)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body := parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["totalItems"]), 3.0)
+	items := jsonItems(t, body)
+	testutil.Equal(t, jsonStr(t, items[0]["action"]), "delete")
+	testutil.True(t, items[0]["new"] == nil, "expected no new row for a delete")
+	testutil.Equal(t, jsonStr(t, items[1]["action"]), "update")
+	testutil.Equal(t, jsonStr(t, items[1]["userId"]), "user-1")
+	testutil.Equal(t, jsonStr(t, items[1]["old"].(map[string]any)["title"]), "Audited")
+	testutil.Equal(t, jsonStr(t, items[1]["new"].(map[string]any)["title"]), "Edited")
+	testutil.Equal(t, jsonStr(t, items[2]["action"]), "create")
+	testutil.Equal(t, jsonStr(t, items[2]["recordId"]), id)
+
+	w = doRequestWithHeader(t, srv, "GET", "/api/admin/audit?table=posts&userId=user-1", nil, "Authorization", "Bearer "+adminToken)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	body = parseJSON(t, w)
+	testutil.Equal(t, jsonNum(t, body["totalItems"]), 1.0)
+
+	w = doRequestWithHeader(t, srv, "GET", "/api/admin/audit?since=yesterday", nil, "Authorization", "Bearer "+adminToken)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+
+	w = doRequest(t, srv, "GET", "/api/collections/authors/1/history", nil)
+	testutil.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+func TestAuditHistoryWithoutAdminPassword(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	runner := migrations.NewRunner(sharedPG.Pool, testutil.DiscardLogger())
+	testutil.NoError(t, runner.Bootstrap(ctx))
+	_, err := runner.Run(ctx)
+	testutil.NoError(t, err)
+	_, err = sharedPG.Pool.Exec(ctx, "INSERT INTO _ayb_audit_tables (table_name) VALUES ('posts')")
+	testutil.NoError(t, err)
+	srv := setColumnAccess(t, ctx, map[string]string{"posts.body": "hidden"})
+
+	var id string
+	err = sharedPG.Pool.QueryRow(ctx, "INSERT INTO posts (title, body) VALUES ('Audited', 'secret') RETURNING id::text").Scan(&id)
+	testutil.NoError(t, err)
+
+	// Without an admin password, history is read like any other caller's:
+	// hidden columns are left out of the row images.
+	w := doRequest(t, srv, "GET", "/api/collections/posts/"+id+"/history", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	row := items[0]["new"].(map[string]any)
+	testutil.Equal(t, jsonStr(t, row["title"]), "Audited")
+	_, ok := row["body"]
+	testutil.False(t, ok, "body should be hidden")
+
+	// Records the caller cannot view have no readable history.
+	_, err = sharedPG.Pool.Exec(ctx, "DELETE FROM posts WHERE id = $1::int", id)
+	testutil.NoError(t, err)
+	w = doRequest(t, srv, "GET", "/api/collections/posts/"+id+"/history", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+}
+
+func TestSchemaQualifiedCollections(t *testing.T) {
+	ctx := context.Background()
+	resetAndSeedDB(t, ctx)
+	_, err := sharedPG.Pool.Exec(ctx, `
+		DROP SCHEMA IF EXISTS archive CASCADE;
+		DROP SCHEMA IF EXISTS internal CASCADE;
+		CREATE SCHEMA archive;
+		CREATE TABLE archive.posts (id SERIAL PRIMARY KEY, title TEXT NOT NULL);
+		INSERT INTO archive.posts (title) VALUES ('Archived');
+		CREATE SCHEMA internal;
+		CREATE TABLE internal.jobs (id SERIAL PRIMARY KEY);
+		CREATE FUNCTION archive.post_count() RETURNS bigint LANGUAGE sql AS 'SELECT count(*) FROM archive.posts';`)
+	testutil.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = sharedPG.Pool.Exec(ctx, "DROP SCHEMA IF EXISTS archive CASCADE; DROP SCHEMA IF EXISTS internal CASCADE")
+	})
+
+	logger := testutil.DiscardLogger()
+	ch := schema.NewCacheHolder(sharedPG.Pool, logger)
+	ch.SetExposure(schema.Exposure{ExcludeTables: []string{"internal.*"}})
+	testutil.NoError(t, ch.Load(ctx))
+	srv := server.New(config.Default(), logger, ch, sharedPG.Pool, nil, nil)
+
+	// Unqualified names still mean public; qualified names reach the rest.
+	w := doRequest(t, srv, "GET", "/api/collections/posts/", nil)
+	testutil.Equal(t, jsonNum(t, parseJSON(t, w)["totalItems"]), 3.0)
+	w = doRequest(t, srv, "GET", "/api/collections/archive.posts/", nil)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	items := jsonItems(t, parseJSON(t, w))
+	testutil.Equal(t, len(items), 1)
+	testutil.Equal(t, jsonStr(t, items[0]["title"]), "Archived")
+
+	w = doRequest(t, srv, "POST", "/api/rpc/archive.post_count", map[string]any{})
+	testutil.Equal(t, w.Code, http.StatusOK)
+	testutil.Equal(t, strings.TrimSpace(w.Body.String()), "1")
+
+	// Excluded tables are not served under any name.
+	w = doRequest(t, srv, "GET", "/api/collections/internal.jobs/", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "GET", "/api/collections/jobs/", nil)
+	testutil.Equal(t, w.Code, http.StatusNotFound)
+	w = doRequest(t, srv, "GET", "/api/schema", nil)
+	testutil.False(t, strings.Contains(w.Body.String(), "jobs"), "schema should not describe internal.jobs")
+}
@@ -13,21 +13,31 @@ func quoteIdent(name string) string {
 	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
 
+// quoteLiteral quotes a string as a SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
 // tableRef returns the fully-qualified, quoted "schema"."table" reference.
 func tableRef(tbl *schema.Table) string {
 	return quoteIdent(tbl.Schema) + "." + quoteIdent(tbl.Name)
 }
 
 // buildSelectOne builds a SELECT query for a single record by primary key.
+// Versioned rows also carry etagColumn.
 func buildSelectOne(tbl *schema.Table, fields []string, pkValues []string) (string, []any) {
 	cols := buildColumnList(tbl, fields)
+	if hasVersion(tbl) {
+		cols += ", " + versionSelect()
+	}
 	where, args := buildPKWhere(tbl, pkValues)
 
 	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT 1", cols, tableRef(tbl), where)
 	return q, args
 }
 
-// buildInsert builds an INSERT ... RETURNING * statement.
+// buildInsert builds an INSERT ... RETURNING * statement. Columns that inserts
+// may not set are skipped like unknown ones.
 func buildInsert(tbl *schema.Table, data map[string]any) (string, []any) {
 	columns := make([]string, 0, len(data))
 	placeholders := make([]string, 0, len(data))
@@ -35,35 +45,97 @@ func buildInsert(tbl *schema.Table, data map[string]any) (string, []any) {
 
 	i := 1
 	for col, val := range data {
-		if tbl.ColumnByName(col) == nil {
-			continue // skip unknown columns
+		if tbl.ColumnByName(col) == nil || !tbl.CanInsert(col) {
+			continue // skip unknown and read-only columns
 		}
+		ph, arg := inputArg(tbl.ColumnByName(col), val, fmt.Sprintf("$%d", i))
 		columns = append(columns, quoteIdent(col))
-		placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-		args = append(args, val)
+		placeholders = append(placeholders, ph)
+		args = append(args, arg)
 		i++
 	}
 
-	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING *",
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
 		tableRef(tbl),
 		strings.Join(columns, ", "),
 		strings.Join(placeholders, ", "),
+		buildColumnList(tbl, nil),
 	)
 	return q, args
 }
 
+// buildBulkInsert builds a multi-row INSERT ... RETURNING * statement.
+func buildBulkInsert(tbl *schema.Table, rows []map[string]any) (string, []any) {
+	columns, values, args := insertValues(tbl, rows)
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s RETURNING %s",
+		tableRef(tbl),
+		quoteIdents(columns),
+		values,
+		buildColumnList(tbl, nil),
+	)
+	return q, args
+}
+
+// insertValues builds the VALUES list for a multi-row insert. The column list is
+// the union of known columns across all rows, in table order; rows that omit a
+// column insert its DEFAULT. Columns that inserts may not set are skipped.
+func insertValues(tbl *schema.Table, rows []map[string]any) (columns []string, values string, args []any) {
+	for _, col := range tbl.Columns {
+		if !tbl.CanInsert(col.Name) {
+			continue
+		}
+		for _, row := range rows {
+			if _, ok := row[col.Name]; ok {
+				columns = append(columns, col.Name)
+				break
+			}
+		}
+	}
+
+	args = make([]any, 0, len(rows)*len(columns))
+	tuples := make([]string, len(rows))
+	for r, row := range rows {
+		vals := make([]string, len(columns))
+		for c, col := range columns {
+			val, ok := row[col]
+			if !ok {
+				vals[c] = "DEFAULT"
+				continue
+			}
+			ph, arg := inputArg(tbl.ColumnByName(col), val, fmt.Sprintf("$%d", len(args)+1))
+			args = append(args, arg)
+			vals[c] = ph
+		}
+		tuples[r] = "(" + strings.Join(vals, ", ") + ")"
+	}
+	return columns, strings.Join(tuples, ", "), args
+}
+
+// quoteIdents quotes each name and joins them with commas.
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = quoteIdent(n)
+	}
+	return strings.Join(quoted, ", ")
+}
+
 // buildUpdate builds an UPDATE ... SET ... WHERE pk = ... RETURNING * statement.
-func buildUpdate(tbl *schema.Table, data map[string]any, pkValues []string) (string, []any) {
+// The returned row also carries etagColumn. A non-nil ifMatch restricts the
+// update to those row versions. Columns that updates may not set are skipped,
+// and soft-deleted records are not updated.
+func buildUpdate(tbl *schema.Table, data map[string]any, pkValues []string, ifMatch []string) (string, []any) {
 	setClauses := make([]string, 0, len(data))
 	args := make([]any, 0, len(data)+len(tbl.PrimaryKey))
 
 	i := 1
 	for col, val := range data {
-		if tbl.ColumnByName(col) == nil {
+		if tbl.ColumnByName(col) == nil || !tbl.CanUpdate(col) {
 			continue
 		}
-		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", quoteIdent(col), i))
-		args = append(args, val)
+		ph, arg := inputArg(tbl.ColumnByName(col), val, fmt.Sprintf("$%d", i))
+		setClauses = append(setClauses, quoteIdent(col)+" = "+ph)
+		args = append(args, arg)
 		i++
 	}
 
@@ -74,22 +146,89 @@ func buildUpdate(tbl *schema.Table, data map[string]any, pkValues []string) (str
 		args = append(args, pkValues[j])
 		i++
 	}
+	if ifMatch != nil {
+		whereParts = append(whereParts, versionCondition(i))
+		args = append(args, ifMatch)
+	}
+	if col := tbl.SoftDeleteColumn; col != "" {
+		whereParts = append(whereParts, quoteIdent(col)+" IS NULL")
+	}
 
-	q := fmt.Sprintf("UPDATE %s SET %s WHERE %s RETURNING *",
+	q := fmt.Sprintf("UPDATE %s SET %s WHERE %s RETURNING %s, %s",
 		tableRef(tbl),
 		strings.Join(setClauses, ", "),
 		strings.Join(whereParts, " AND "),
+		buildColumnList(tbl, nil),
+		versionSelect(),
 	)
 	return q, args
 }
 
-// buildDelete builds a DELETE ... WHERE pk = ... statement.
-func buildDelete(tbl *schema.Table, pkValues []string) (string, []any) {
+// buildDelete builds a DELETE ... WHERE pk = ... statement. A non-nil ifMatch
+// restricts the delete to those row versions. In soft-delete tables, it is an
+// UPDATE that sets the soft-delete column of a live record instead.
+func buildDelete(tbl *schema.Table, pkValues []string, ifMatch []string) (string, []any) {
 	where, args := buildPKWhere(tbl, pkValues)
+	if ifMatch != nil {
+		args = append(args, ifMatch)
+		where += " AND " + versionCondition(len(args))
+	}
+	if col := tbl.SoftDeleteColumn; col != "" {
+		q := fmt.Sprintf("UPDATE %s SET %s = now() WHERE %s AND %s IS NULL", tableRef(tbl), quoteIdent(col), where, quoteIdent(col))
+		return q, args
+	}
 	q := fmt.Sprintf("DELETE FROM %s WHERE %s", tableRef(tbl), where)
 	return q, args
 }
 
+// buildRestore builds an UPDATE that clears the soft-delete column of a
+// soft-deleted record, returning the record.
+func buildRestore(tbl *schema.Table, pkValues []string) (string, []any) {
+	where, args := buildPKWhere(tbl, pkValues)
+	col := quoteIdent(tbl.SoftDeleteColumn)
+	q := fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s AND %s IS NOT NULL RETURNING %s",
+		tableRef(tbl), col, where, col, buildColumnList(tbl, nil))
+	return q, args
+}
+
+// buildBulkUpdate builds an UPDATE ... SET ... WHERE <filter> RETURNING * statement.
+// The filter SQL is expected to use $1..$N for filterArgs; SET values follow them.
+func buildBulkUpdate(tbl *schema.Table, data map[string]any, filterSQL string, filterArgs []any) (string, []any) {
+	args := append(make([]any, 0, len(filterArgs)+len(data)), filterArgs...)
+	setClauses := make([]string, 0, len(data))
+
+	for _, col := range tbl.Columns {
+		val, ok := data[col.Name]
+		if !ok || !tbl.CanUpdate(col.Name) {
+			continue
+		}
+		ph, arg := inputArg(col, val, fmt.Sprintf("$%d", len(args)+1))
+		args = append(args, arg)
+		setClauses = append(setClauses, quoteIdent(col.Name)+" = "+ph)
+	}
+
+	q := fmt.Sprintf("UPDATE %s SET %s WHERE %s RETURNING %s",
+		tableRef(tbl),
+		strings.Join(setClauses, ", "),
+		filterSQL,
+		buildColumnList(tbl, nil),
+	)
+	return q, args
+}
+
+// buildBulkDelete builds a DELETE ... WHERE <filter> RETURNING * statement, or
+// for soft-delete tables an UPDATE that sets the soft-delete column. The
+// filter is expected to include the delete rule, which leaves out records
+// already soft-deleted.
+func buildBulkDelete(tbl *schema.Table, filterSQL string, filterArgs []any) (string, []any) {
+	if col := tbl.SoftDeleteColumn; col != "" {
+		q := fmt.Sprintf("UPDATE %s SET %s = now() WHERE %s RETURNING %s", tableRef(tbl), quoteIdent(col), filterSQL, buildColumnList(tbl, nil))
+		return q, filterArgs
+	}
+	q := fmt.Sprintf("DELETE FROM %s WHERE %s RETURNING %s", tableRef(tbl), filterSQL, buildColumnList(tbl, nil))
+	return q, filterArgs
+}
+
 // buildPKWhere builds the WHERE clause for primary key matching.
 func buildPKWhere(tbl *schema.Table, pkValues []string) (string, []any) {
 	parts := make([]string, len(tbl.PrimaryKey))
@@ -102,26 +241,102 @@ func buildPKWhere(tbl *schema.Table, pkValues []string) (string, []any) {
 }
 
 // buildColumnList builds the column selection for SELECT queries.
-// If fields is empty, returns "*".
+// If fields is empty, returns "*". A "*" field selects every column, and
+// computed fields are selected by calling their function, so "*,full_name"
+// returns all columns plus full_name. When columns of tbl are hidden from the
+// request, "*" is spelled out as the visible columns. Values are selected in
+// their JSON form (see outputSQL), which spells out "*" too when a column
+// needs converting.
 func buildColumnList(tbl *schema.Table, fields []string) string {
+	return columnList(tbl, fields, true)
+}
+
+// rawColumnList is buildColumnList selecting values as stored, for queries
+// whose rows are rendered by an enclosing one.
+func rawColumnList(tbl *schema.Table, fields []string) string {
+	return columnList(tbl, fields, false)
+}
+
+func columnList(tbl *schema.Table, fields []string, render bool) string {
 	if len(fields) == 0 {
-		return "*"
+		return starColumns(tbl, render)
 	}
 	quoted := make([]string, 0, len(fields))
 	for _, f := range fields {
-		if tbl.ColumnByName(f) != nil {
-			quoted = append(quoted, quoteIdent(f))
+		switch {
+		case f == "*":
+			quoted = append(quoted, starColumns(tbl, render))
+		case tbl.ColumnByName(f) != nil:
+			quoted = append(quoted, selectField(tbl, f, quoteIdent(f), render))
+		case tbl.ComputedFieldByName(f) != nil:
+			expr := computedFieldSQL(tbl.ComputedFieldByName(f), quoteIdent(tbl.Name))
+			if render {
+				expr = outputSQL(fieldColumn(tbl, f), expr)
+			}
+			quoted = append(quoted, expr+" AS "+quoteIdent(f))
 		}
 	}
 	if len(quoted) == 0 {
-		return "*"
+		return starColumns(tbl, render)
 	}
 	return strings.Join(quoted, ", ")
 }
 
+// selectField returns the select list item for field name of tbl, whose value
+// is expr, in its JSON form if render is set.
+func selectField(tbl *schema.Table, name, expr string, render bool) string {
+	if !render {
+		return expr
+	}
+	return outputField(tbl, name, expr)
+}
+
+// starColumns returns "*", or the visible columns of tbl if some are hidden or,
+// with render, if some need converting to their JSON form.
+func starColumns(tbl *schema.Table, render bool) string {
+	if !tbl.HasHiddenColumns() && !(render && needsOutput(tbl, nil)) {
+		return "*"
+	}
+	names := make([]string, len(tbl.Columns))
+	for i, col := range tbl.Columns {
+		names[i] = selectField(tbl, col.Name, quoteIdent(col.Name), render)
+	}
+	return strings.Join(names, ", ")
+}
+
+// needsOutput reports whether any of fields of tbl, resolved as recordFields
+// does, needs converting to its JSON form.
+func needsOutput(tbl *schema.Table, fields []string) bool {
+	for _, name := range recordFields(tbl, fields) {
+		if col := fieldColumn(tbl, name); col != nil && outputSQL(col, "v") != "v" {
+			return true
+		}
+	}
+	return false
+}
+
+// renderRows wraps rowsQuery, which selects fields of tbl as stored, each
+// once, in the query that selects them in their JSON form. Sorting by a
+// converted column in rowsQuery itself would sort by its JSON form; the
+// enclosing query keeps the order of the rows.
+func renderRows(tbl *schema.Table, fields []string, rowsQuery string) string {
+	row := quoteIdent("_ayb_row")
+	names := recordFields(tbl, fields)
+	items := make([]string, len(names))
+	for i, name := range names {
+		items[i] = outputField(tbl, name, row+"."+quoteIdent(name))
+	}
+	return "SELECT " + strings.Join(items, ", ") + " FROM (" + rowsQuery + ") AS " + row
+}
+
 // buildList builds a SELECT query for listing records with pagination, sort, and optional filter.
 func buildList(tbl *schema.Table, opts listOpts) (dataQuery string, dataArgs []any, countQuery string, countArgs []any) {
-	cols := buildColumnList(tbl, opts.fields)
+	fields := opts.fields
+	render := !opts.raw && needsOutput(tbl, fields)
+	if render {
+		fields = recordFields(tbl, fields)
+	}
+	cols := rawColumnList(tbl, fields)
 	ref := tableRef(tbl)
 
 	whereClause := ""
@@ -143,13 +358,39 @@ func buildList(tbl *schema.Table, opts listOpts) (dataQuery string, dataArgs []a
 		orderClause = " ORDER BY " + opts.sortSQL
 	}
 
+	if opts.cursor != nil {
+		// Keyset pagination: seek past the cursor instead of using OFFSET, and
+		// fetch one extra row to tell whether another page follows.
+		dataArgs = append([]any{}, filterArgs...)
+		keysetSQL, keysetArgs := opts.cursor.whereSQL(len(filterArgs))
+		dataWhere := whereClause
+		if keysetSQL != "" {
+			if dataWhere == "" {
+				dataWhere = " WHERE " + keysetSQL
+			} else {
+				dataWhere = " WHERE (" + opts.filterSQL + ") AND " + keysetSQL
+			}
+			dataArgs = append(dataArgs, keysetArgs...)
+		}
+		dataQuery = fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT $%d",
+			cols, ref, dataWhere, opts.cursor.orderSQL(), len(dataArgs)+1)
+		dataArgs = append(dataArgs, opts.perPage+1)
+		if render {
+			dataQuery = renderRows(tbl, fields, dataQuery)
+		}
+		return
+	}
+
 	offset := (opts.page - 1) * opts.perPage
-	argIdx := len(filterArgs) + 1
+	dataArgs = append(append([]any{}, filterArgs...), opts.sortArgs...)
+	argIdx := len(dataArgs) + 1
 
 	dataQuery = fmt.Sprintf("SELECT %s FROM %s%s%s LIMIT $%d OFFSET $%d",
 		cols, ref, whereClause, orderClause, argIdx, argIdx+1)
-	dataArgs = append(append([]any{}, filterArgs...), opts.perPage, offset)
-
+	dataArgs = append(dataArgs, opts.perPage, offset)
+	if render {
+		dataQuery = renderRows(tbl, fields, dataQuery)
+	}
 	return
 }
 
@@ -160,8 +401,11 @@ type listOpts struct {
 	skipTotal  bool
 	fields     []string
 	sortSQL    string
+	sortArgs   []any // follow filterArgs
 	filterSQL  string
 	filterArgs []any
+	cursor     *cursorPage // keyset pagination; page is ignored when set
+	raw        bool        // select values as stored, for recordSelect to render
 }
 
 // parsePKValues splits a composite primary key value from the URL.
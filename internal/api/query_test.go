@@ -1,6 +1,7 @@
 package api
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/allyourbase/ayb/internal/schema"
@@ -51,7 +52,7 @@ func TestBuildSelectOne(t *testing.T) {
 	tbl := testTable()
 
 	q, args := buildSelectOne(tbl, nil, []string{"42"})
-	testutil.Contains(t, q, `SELECT * FROM "public"."users"`)
+	testutil.Contains(t, q, `SELECT *, xmin::text AS "_ayb_etag" FROM "public"."users"`)
 	testutil.Contains(t, q, `"id" = $1`)
 	testutil.Contains(t, q, "LIMIT 1")
 	testutil.SliceLen(t, args, 1)
@@ -102,22 +103,64 @@ func TestBuildUpdate(t *testing.T) {
 	tbl := testTable()
 
 	data := map[string]any{"name": "Bob"}
-	q, args := buildUpdate(tbl, data, []string{"1"})
+	q, args := buildUpdate(tbl, data, []string{"1"}, nil)
 	testutil.Contains(t, q, "UPDATE")
 	testutil.Contains(t, q, "SET")
 	testutil.Contains(t, q, `"name" = $1`)
 	testutil.Contains(t, q, `"id" = $2`)
-	testutil.Contains(t, q, "RETURNING *")
+	testutil.Contains(t, q, `RETURNING *, xmin::text AS "_ayb_etag"`)
 	testutil.SliceLen(t, args, 2)
 }
 
+func TestBuildUpdateIfMatch(t *testing.T) {
+	tbl := testTable()
+
+	q, args := buildUpdate(tbl, map[string]any{"name": "Bob"}, []string{"1"}, []string{"741"})
+	testutil.Contains(t, q, `WHERE "id" = $2 AND xmin::text = ANY($3::text[]) RETURNING`)
+	testutil.SliceLen(t, args, 3)
+	testutil.Equal(t, args[2].([]string)[0], "741")
+}
+
 func TestBuildDelete(t *testing.T) {
 	tbl := testTable()
 
-	q, args := buildDelete(tbl, []string{"5"})
+	q, args := buildDelete(tbl, []string{"5"}, nil)
 	testutil.Contains(t, q, "DELETE FROM")
 	testutil.Contains(t, q, `"id" = $1`)
 	testutil.SliceLen(t, args, 1)
+
+	q, args = buildDelete(tbl, []string{"5"}, []string{})
+	testutil.Equal(t, q, `DELETE FROM "public"."users" WHERE "id" = $1 AND xmin::text = ANY($2::text[])`)
+	testutil.SliceLen(t, args, 2)
+}
+
+func softDeleteTable() *schema.Table {
+	tbl := testTable()
+	tbl.Columns = append(tbl.Columns, &schema.Column{Name: "deleted_at", Position: 5, TypeName: "timestamp with time zone", IsNullable: true})
+	tbl.SoftDeleteColumn = "deleted_at"
+	return tbl
+}
+
+func TestBuildSoftDelete(t *testing.T) {
+	tbl := softDeleteTable()
+
+	q, args := buildDelete(tbl, []string{"5"}, nil)
+	testutil.Equal(t, q, `UPDATE "public"."users" SET "deleted_at" = now() WHERE "id" = $1 AND "deleted_at" IS NULL`)
+	testutil.SliceLen(t, args, 1)
+
+	// The timestamp is returned in its JSON form, so "*" is spelled out.
+	returning := ` RETURNING "id", "name", "email", "age", (to_json(("deleted_at") AT TIME ZONE 'UTC') #>> '{}' || CASE WHEN isfinite("deleted_at") THEN 'Z' ELSE '' END) AS "deleted_at"`
+	q, _ = buildBulkDelete(tbl, `"age" > $1`, []any{30})
+	testutil.Equal(t, q, `UPDATE "public"."users" SET "deleted_at" = now() WHERE "age" > $1`+returning)
+
+	q, args = buildRestore(tbl, []string{"5"})
+	testutil.Equal(t, q, `UPDATE "public"."users" SET "deleted_at" = NULL WHERE "id" = $1 AND "deleted_at" IS NOT NULL`+returning)
+	testutil.SliceLen(t, args, 1)
+
+	// Soft-deleted records can't be updated, and the column can't be set directly.
+	q, args = buildUpdate(tbl, map[string]any{"name": "Ann", "deleted_at": nil}, []string{"5"}, nil)
+	testutil.Contains(t, q, `SET "name" = $1 WHERE "id" = $2 AND "deleted_at" IS NULL RETURNING`)
+	testutil.SliceLen(t, args, 2)
 }
 
 func TestBuildPKWhereComposite(t *testing.T) {
@@ -213,6 +256,51 @@ func TestBuildListWithSort(t *testing.T) {
 	testutil.Contains(t, dataQ, `ORDER BY "name" ASC, "age" DESC`)
 }
 
+func TestBuildListRendersJSONForms(t *testing.T) {
+	tbl := &schema.Table{
+		Schema: "public",
+		Name:   "payments",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "bigint", JSONType: "integer"},
+			{Name: "amount", TypeName: "money", JSONType: "number"},
+		},
+	}
+	opts := listOpts{page: 1, perPage: 20, sortSQL: `"amount" DESC`, skipTotal: true}
+
+	// Rows are sorted by the stored value, then converted.
+	dataQ, _, _, _ := buildList(tbl, opts)
+	testutil.Equal(t, dataQ, `SELECT "_ayb_row"."id", ("_ayb_row"."amount")::numeric AS "amount" `+
+		`FROM (SELECT "id", "amount" FROM "public"."payments" ORDER BY "amount" DESC LIMIT $1 OFFSET $2) AS "_ayb_row"`)
+
+	opts.raw = true
+	dataQ, _, _, _ = buildList(tbl, opts)
+	testutil.Equal(t, dataQ, `SELECT * FROM "public"."payments" ORDER BY "amount" DESC LIMIT $1 OFFSET $2`)
+}
+
+func TestBuildListWithCursor(t *testing.T) {
+	tbl := testTable()
+
+	cur := &cursorPage{
+		fields: []sortField{{column: "age", desc: true}, {column: "id"}},
+		values: []any{"30", "7"},
+	}
+	opts := listOpts{
+		page:       3,
+		perPage:    10,
+		filterSQL:  `"name" = $1`,
+		filterArgs: []any{"Alice"},
+		cursor:     cur,
+	}
+
+	dataQ, dataArgs, countQ, _ := buildList(tbl, opts)
+	testutil.Contains(t, dataQ, `WHERE ("name" = $1) AND (("age" < $2) OR ("age" = $3 AND ("id" > $4 OR "id" IS NULL)))`)
+	testutil.Contains(t, dataQ, `ORDER BY "age" DESC, "id" ASC LIMIT $5`)
+	testutil.True(t, !strings.Contains(dataQ, "OFFSET"), "cursor queries should not use OFFSET")
+	testutil.SliceLen(t, dataArgs, 5)
+	testutil.Equal(t, dataArgs[4].(int), 11) // perPage + 1
+	testutil.True(t, !strings.Contains(countQ, "$2"), "count query ignores the cursor")
+}
+
 func TestParsePKValues(t *testing.T) {
 	// Single PK.
 	vals := parsePKValues("42", 1)
@@ -225,3 +313,92 @@ func TestParsePKValues(t *testing.T) {
 	testutil.Equal(t, vals[0], "10")
 	testutil.Equal(t, vals[1], "20")
 }
+
+func TestBuildBulkInsert(t *testing.T) {
+	tbl := testTable()
+
+	rows := []map[string]any{
+		{"name": "Alice", "email": "a@example.com"},
+		{"name": "Bob", "age": 30, "nonexistent": "x"},
+	}
+	q, args := buildBulkInsert(tbl, rows)
+	testutil.Contains(t, q, `INSERT INTO "public"."users" ("name", "email", "age")`)
+	testutil.Contains(t, q, "VALUES ($1, $2, DEFAULT), ($3, DEFAULT, $4)")
+	testutil.Contains(t, q, "RETURNING *")
+	testutil.SliceLen(t, args, 4)
+	testutil.Equal(t, args[0].(string), "Alice")
+	testutil.Equal(t, args[3].(int), 30)
+}
+
+func TestBuildBulkUpdate(t *testing.T) {
+	tbl := testTable()
+
+	q, args := buildBulkUpdate(tbl, map[string]any{"name": "X", "age": 5}, `"age" > $1`, []any{int64(18)})
+	testutil.Contains(t, q, `UPDATE "public"."users" SET "name" = $2, "age" = $3`)
+	testutil.Contains(t, q, `WHERE "age" > $1 RETURNING *`)
+	testutil.SliceLen(t, args, 3)
+	testutil.Equal(t, args[0].(int64), int64(18))
+}
+
+func TestBuildBulkDelete(t *testing.T) {
+	tbl := testTable()
+
+	q, args := buildBulkDelete(tbl, `"name" = $1`, []any{"Alice"})
+	testutil.Equal(t, q, `DELETE FROM "public"."users" WHERE "name" = $1 RETURNING *`)
+	testutil.SliceLen(t, args, 1)
+}
+
+// restrictedTable returns testTable as seen by anonymous requests: email is
+// hidden, age is read-only and name is insert-only.
+func restrictedTable() *schema.Table {
+	tbl := testTable()
+	tbl.ColumnAccess = []*schema.ColumnAccess{
+		{Column: "email", Role: "anon", Access: schema.AccessHidden},
+		{Column: "age", Role: "*", Access: schema.AccessReadOnly},
+		{Column: "name", Role: "*", Access: schema.AccessInsertOnly},
+	}
+	sc := &schema.SchemaCache{Tables: map[string]*schema.Table{"public.users": tbl}}
+	return sc.ForRole("anon").Tables["public.users"]
+}
+
+func TestBuildColumnListHiddenColumns(t *testing.T) {
+	tbl := restrictedTable()
+	testutil.Equal(t, buildColumnList(tbl, nil), `"id", "name", "age"`)
+	testutil.Equal(t, buildColumnList(tbl, []string{"*", "email"}), `"id", "name", "age"`)
+	testutil.Equal(t, buildColumnList(tbl, []string{"name"}), `"name"`)
+}
+
+func TestBuildWritesSkipReadOnlyColumns(t *testing.T) {
+	tbl := restrictedTable()
+	data := map[string]any{"name": "Alice", "email": "a@example.com", "age": 30}
+
+	q, args := buildInsert(tbl, data)
+	testutil.Equal(t, q, `INSERT INTO "public"."users" ("name") VALUES ($1) RETURNING "id", "name", "age"`)
+	testutil.SliceLen(t, args, 1)
+
+	q, args = buildBulkInsert(tbl, []map[string]any{data})
+	testutil.Equal(t, q, `INSERT INTO "public"."users" ("name") VALUES ($1) RETURNING "id", "name", "age"`)
+	testutil.SliceLen(t, args, 1)
+
+	data["id"] = 7
+	q, args = buildUpdate(tbl, data, []string{"1"}, nil)
+	testutil.Contains(t, q, `SET "id" = $1 WHERE "id" = $2 RETURNING "id", "name", "age", xmin::text`)
+	testutil.SliceLen(t, args, 2)
+
+	q, _ = buildBulkUpdate(tbl, data, `"id" > $1`, []any{0})
+	testutil.Contains(t, q, `SET "id" = $2 WHERE`)
+
+	// Insert-only columns are not merged.
+	oc := &onConflict{columns: []string{"id"}, merge: true}
+	q, _ = buildUpsert(tbl, []map[string]any{{"id": 1, "name": "Alice", "age": 3}}, oc)
+	testutil.Contains(t, q, `("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "id" = EXCLUDED."id" RETURNING "id", "name", "age",`)
+}
+
+func TestCountWritableColumns(t *testing.T) {
+	tbl := restrictedTable()
+	data := map[string]any{"name": "Alice", "email": "a@example.com", "age": 30}
+	testutil.Equal(t, countKnownColumns(tbl, data), 2)
+	testutil.Equal(t, countWritableColumns(tbl, data, true), 1)
+	testutil.Equal(t, countWritableColumns(tbl, data, false), 0)
+	testutil.Equal(t, countWritableColumns(testTable(), data, false), 3)
+}
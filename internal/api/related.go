@@ -0,0 +1,161 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// maxRelationDepth caps the number of relationships a dotted filter or sort path
+// may traverse, e.g. "post.author.name" is two.
+const maxRelationDepth = 3
+
+// relHop is one relationship traversed by a dotted path. The related table is
+// read under alias, joined to the previous table (outer) on the relationship's
+// columns.
+type relHop struct {
+	rel   *schema.Relationship
+	table *schema.Table
+	alias string
+	outer string // quoted reference to the previous table or alias
+	where string // condition on the related table limiting the rows reached
+}
+
+// joinSQL returns the condition joining the related rows to the outer row.
+// For many-to-many, the junction table is joined to the outer row instead.
+func (h relHop) joinSQL() string {
+	if h.rel.Type == "many-to-many" {
+		return joinColumns(h.junctionAlias(), h.rel.JunctionFromColumns, h.outer, h.rel.FromColumns)
+	}
+	return joinColumns(quoteIdent(h.alias), h.rel.ToColumns, h.outer, h.rel.FromColumns)
+}
+
+// fromSQL returns the aliased related table for a subquery's FROM clause,
+// joined to the junction table for many-to-many. With a where condition, the
+// table is read in a subquery, in which the condition's references to it
+// resolve.
+func (h relHop) fromSQL() string {
+	from := tableRef(h.table) + " AS " + quoteIdent(h.alias)
+	if h.where != "" {
+		from = "(SELECT * FROM " + tableRef(h.table) + " WHERE " + h.where + ") AS " + quoteIdent(h.alias)
+	}
+	if h.rel.Type == "many-to-many" {
+		from += " JOIN " + quoteIdent(h.rel.JunctionSchema) + "." + quoteIdent(h.rel.JunctionTable) + " AS " + h.junctionAlias() +
+			" ON " + joinColumns(h.junctionAlias(), h.rel.JunctionToColumns, quoteIdent(h.alias), h.rel.ToColumns)
+	}
+	return from
+}
+
+// junctionAlias is the quoted alias of a many-to-many hop's junction table.
+func (h relHop) junctionAlias() string {
+	return quoteIdent(h.alias + "j")
+}
+
+// joinColumns equates left.leftCols[i] with right.rightCols[i].
+func joinColumns(left string, leftCols []string, right string, rightCols []string) string {
+	conds := make([]string, len(leftCols))
+	for i := range leftCols {
+		conds[i] = left + "." + quoteIdent(leftCols[i]) + " = " + right + "." + quoteIdent(rightCols[i])
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// findRelationship finds a relationship by field name (e.g. "author") or, for
+// many-to-one, by FK column name (e.g. "author_id").
+func findRelationship(tbl *schema.Table, name string) *schema.Relationship {
+	for _, r := range tbl.Relationships {
+		if r.FieldName == name {
+			return r
+		}
+		if r.Type == "many-to-one" && len(r.FromColumns) == 1 && r.FromColumns[0] == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// resolvePath resolves a column name, or a dotted path through relationships
+// ending in a column of the last related table. Returns the column, the quoted
+// SQL reference to it, and the hops traversed (none for a plain column). Aliases
+// are drawn from next, which is advanced for each hop. Computed fields resolve
+// like columns, to a call of their function.
+func resolvePath(sc *schema.SchemaCache, tbl *schema.Table, path string, aliasPrefix string, next *int) (*schema.Column, string, []relHop, error) {
+	if col := tbl.ColumnByName(path); col != nil || !strings.Contains(path, ".") {
+		if col == nil {
+			if cf := tbl.ComputedFieldByName(path); cf != nil {
+				return computedColumn(cf), computedFieldSQL(cf, quoteIdent(tbl.Name)), nil, nil
+			}
+			return nil, "", nil, fmt.Errorf("unknown column: %s", path)
+		}
+		return col, quoteIdent(path), nil, nil
+	}
+	if sc == nil {
+		return nil, "", nil, fmt.Errorf("unknown column: %s", path)
+	}
+
+	parts := strings.Split(path, ".")
+	if len(parts)-1 > maxRelationDepth {
+		return nil, "", nil, fmt.Errorf("relation path too deep: %s", path)
+	}
+
+	var hops []relHop
+	cur := tbl
+	outer := tableRef(tbl)
+	for _, name := range parts[:len(parts)-1] {
+		rel := findRelationship(cur, name)
+		if rel == nil {
+			return nil, "", nil, fmt.Errorf("unknown relation %q on %s", name, cur.Name)
+		}
+		related := sc.Tables[rel.ToSchema+"."+rel.ToTable]
+		if related == nil {
+			return nil, "", nil, fmt.Errorf("unknown relation %q on %s", name, cur.Name)
+		}
+		*next++
+		hop := relHop{rel: rel, table: related, alias: fmt.Sprintf("%s%d", aliasPrefix, *next), outer: outer}
+		hops = append(hops, hop)
+		cur = related
+		outer = quoteIdent(hop.alias)
+	}
+
+	last := parts[len(parts)-1]
+	col := cur.ColumnByName(last)
+	if col == nil {
+		if cf := cur.ComputedFieldByName(last); cf != nil {
+			return computedColumn(cf), computedFieldSQL(cf, outer), hops, nil
+		}
+		return nil, "", nil, fmt.Errorf("unknown column %q on %s", last, cur.Name)
+	}
+	return col, outer + "." + quoteIdent(last), hops, nil
+}
+
+// wrapRelated wraps a condition on the last related table in EXISTS subqueries
+// for each hop, innermost first. For to-many hops, anyMatch requires at least
+// one related row to match; otherwise every related row must match and there
+// must be at least one.
+func wrapRelated(hops []relHop, cond string, anyMatch bool) string {
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := hops[i]
+		if h.rel.Type != "many-to-one" && !anyMatch {
+			cond = fmt.Sprintf("(EXISTS (SELECT 1 FROM %s WHERE %s) AND NOT EXISTS (SELECT 1 FROM %s WHERE %s AND (%s) IS NOT TRUE))",
+				h.fromSQL(), h.joinSQL(), h.fromSQL(), h.joinSQL(), cond)
+		} else {
+			cond = fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s AND %s)", h.fromSQL(), h.joinSQL(), cond)
+		}
+	}
+	return cond
+}
+
+// relatedSortExpr returns a scalar subquery selecting colRef through many-to-one
+// hops. Returns an error if any hop is to-many, which has no single value.
+func relatedSortExpr(hops []relHop, colRef string) (string, error) {
+	expr := colRef
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := hops[i]
+		if h.rel.Type != "many-to-one" {
+			return "", fmt.Errorf("cannot sort by to-many relation %s", h.rel.FieldName)
+		}
+		expr = fmt.Sprintf("(SELECT %s FROM %s WHERE %s)", expr, h.fromSQL(), h.joinSQL())
+	}
+	return expr, nil
+}
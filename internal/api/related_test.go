@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+// relatedTestSchema has posts → authors (many-to-one) and posts → comments (one-to-many).
+func relatedTestSchema() *schema.SchemaCache {
+	authors := &schema.Table{
+		Schema: "public", Name: "authors", Kind: "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", IsPrimaryKey: true},
+			{Name: "name", TypeName: "text"},
+			{Name: "org_id", TypeName: "integer"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	orgs := &schema.Table{
+		Schema: "public", Name: "orgs", Kind: "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", IsPrimaryKey: true},
+			{Name: "name", TypeName: "text"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	posts := &schema.Table{
+		Schema: "public", Name: "posts", Kind: "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", IsPrimaryKey: true},
+			{Name: "title", TypeName: "text"},
+			{Name: "author_id", TypeName: "integer"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	comments := &schema.Table{
+		Schema: "public", Name: "comments", Kind: "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", IsPrimaryKey: true},
+			{Name: "post_id", TypeName: "integer"},
+			{Name: "approved", TypeName: "boolean"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	tags := &schema.Table{
+		Schema: "public", Name: "tags", Kind: "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", IsPrimaryKey: true},
+			{Name: "name", TypeName: "text"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+
+	posts.Relationships = []*schema.Relationship{
+		{Name: "posts_author_id_fkey", Type: "many-to-one", FromSchema: "public", FromTable: "posts",
+			FromColumns: []string{"author_id"}, ToSchema: "public", ToTable: "authors", ToColumns: []string{"id"}, FieldName: "author"},
+		{Name: "comments_post_id_fkey", Type: "one-to-many", FromSchema: "public", FromTable: "posts",
+			FromColumns: []string{"id"}, ToSchema: "public", ToTable: "comments", ToColumns: []string{"post_id"}, FieldName: "comments"},
+		{Name: "post_tags_tag_id_fkey", Type: "many-to-many", FromSchema: "public", FromTable: "posts",
+			FromColumns: []string{"id"}, ToSchema: "public", ToTable: "tags", ToColumns: []string{"id"}, FieldName: "tags",
+			JunctionSchema: "public", JunctionTable: "post_tags", JunctionFromColumns: []string{"post_id"}, JunctionToColumns: []string{"tag_id"}},
+	}
+	authors.Relationships = []*schema.Relationship{
+		{Name: "authors_org_id_fkey", Type: "many-to-one", FromSchema: "public", FromTable: "authors",
+			FromColumns: []string{"org_id"}, ToSchema: "public", ToTable: "orgs", ToColumns: []string{"id"}, FieldName: "org"},
+	}
+
+	return &schema.SchemaCache{
+		Tables: map[string]*schema.Table{
+			"public.authors":  authors,
+			"public.orgs":     orgs,
+			"public.posts":    posts,
+			"public.comments": comments,
+			"public.tags":     tags,
+		},
+		Schemas: []string{"public"},
+	}
+}
+
+func TestFilterManyToOne(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, args, err := parseFilterExpr(context.Background(), sc, tbl, "author.name='Ann' && title~'%go%'", 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `(EXISTS (SELECT 1 FROM "public"."authors" AS "r1" WHERE "r1"."id" = "public"."posts"."author_id" AND "r1"."name" = $1) AND "title" LIKE $2)`)
+	testutil.SliceLen(t, args, 2)
+	testutil.Equal(t, args[0].(string), "Ann")
+}
+
+func TestFilterByFKColumnName(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, _, err := parseFilterExpr(context.Background(), sc, tbl, "author_id.name='Ann'", 0)
+	testutil.NoError(t, err)
+	testutil.Contains(t, sql, `FROM "public"."authors" AS "r1"`)
+}
+
+func TestFilterNestedManyToOne(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, args, err := parseFilterExpr(context.Background(), sc, tbl, "author.org.name='Acme'", 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `EXISTS (SELECT 1 FROM "public"."authors" AS "r1" WHERE "r1"."id" = "public"."posts"."author_id" AND `+
+		`EXISTS (SELECT 1 FROM "public"."orgs" AS "r2" WHERE "r2"."id" = "r1"."org_id" AND "r2"."name" = $1))`)
+	testutil.SliceLen(t, args, 1)
+}
+
+func TestFilterRelatedAppliesListRule(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+	sc.Tables["public.authors"].Rules = &schema.AccessRules{List: "org_id = 7"}
+	sc.Tables["public.orgs"].SoftDeleteColumn = "deleted_at"
+
+	// Rows the request may not list are not reached, and their placeholders
+	// follow the filter's.
+	sql, args, err := parseFilterExpr(context.Background(), sc, tbl, "author.org.name='Acme'", 1)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `EXISTS (SELECT 1 FROM (SELECT * FROM "public"."authors" WHERE "org_id" = $2) AS "r1" WHERE "r1"."id" = "public"."posts"."author_id" AND `+
+		`EXISTS (SELECT 1 FROM (SELECT * FROM "public"."orgs" WHERE "deleted_at" IS NULL) AS "r2" WHERE "r2"."id" = "r1"."org_id" AND "r2"."name" = $3))`)
+	testutil.SliceLen(t, args, 2)
+	testutil.Equal(t, args[1].(string), "Acme")
+
+	// Access rules themselves see every related row.
+	sql, _, err = parseExpr(sc, tbl, "author.name='Ann'", 0, &ruleVars{})
+	testutil.NoError(t, err)
+	testutil.Contains(t, sql, `FROM "public"."authors" AS "r1"`)
+}
+
+func TestFilterOneToManyAll(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, _, err := parseFilterExpr(context.Background(), sc, tbl, "comments.approved=true", 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `(EXISTS (SELECT 1 FROM "public"."comments" AS "r1" WHERE "r1"."post_id" = "public"."posts"."id") AND `+
+		`NOT EXISTS (SELECT 1 FROM "public"."comments" AS "r1" WHERE "r1"."post_id" = "public"."posts"."id" AND ("r1"."approved" = $1) IS NOT TRUE))`)
+}
+
+func TestFilterOneToManyAny(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, args, err := parseFilterExpr(context.Background(), sc, tbl, "comments.approved?=false", 2)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `EXISTS (SELECT 1 FROM "public"."comments" AS "r1" WHERE "r1"."post_id" = "public"."posts"."id" AND "r1"."approved" = $3)`)
+	testutil.SliceLen(t, args, 1)
+}
+
+func TestFilterManyToMany(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	sql, _, err := parseFilterExpr(context.Background(), sc, tbl, "tags.name?='go'", 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `EXISTS (SELECT 1 FROM "public"."tags" AS "r1" JOIN "public"."post_tags" AS "r1j" ON "r1j"."tag_id" = "r1"."id" `+
+		`WHERE "r1j"."post_id" = "public"."posts"."id" AND "r1"."name" = $1)`)
+
+	// Without ?, every tag must match.
+	sql, _, err = parseFilterExpr(context.Background(), sc, tbl, "tags.name='go'", 0)
+	testutil.NoError(t, err)
+	testutil.Contains(t, sql, "NOT EXISTS")
+
+	// Many-to-many has no single value to sort by.
+	testutil.SliceLen(t, parseSort(sc, tbl, "tags.name"), 0)
+}
+
+func TestFilterRelatedErrors(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	tests := []struct {
+		filter  string
+		wantErr string
+	}{
+		{"editor.name='x'", "unknown relation"},
+		{"author.nope='x'", "unknown column"},
+		{"author.org.a.b.c='x'", "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			_, _, err := parseFilterExpr(context.Background(), sc, tbl, tt.filter, 0)
+			testutil.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	// Without a schema cache, dotted paths are unknown columns.
+	_, _, err := parseFilter(tbl, "author.name='x'")
+	testutil.ErrorContains(t, err, "unknown column")
+}
+
+func TestTokenizeAnyOperators(t *testing.T) {
+	tokens, err := tokenize("a?=1 && b?!='x' && c?>=2")
+	testutil.NoError(t, err)
+	testutil.Equal(t, tokens[1].value, "?=")
+	testutil.Equal(t, tokens[5].value, "?!=")
+	testutil.Equal(t, tokens[9].value, "?>=")
+}
+
+func TestSortRelated(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+
+	fields := parseSort(sc, tbl, "-author.name,title,comments.approved")
+	testutil.SliceLen(t, fields, 2) // to-many sort is skipped
+
+	_, err := parseCursor(tbl, fields, "")
+	testutil.ErrorContains(t, err, "cannot sort by author.name")
+
+	args, err := sortRules(sc, fields, nil, 0)
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, args, 0)
+	testutil.Equal(t, sortSQL(fields),
+		`(SELECT "s1"."name" FROM "public"."authors" AS "s1" WHERE "s1"."id" = "public"."posts"."author_id") DESC, "title" ASC`)
+}
+
+func TestSortRelatedAppliesListRule(t *testing.T) {
+	sc := relatedTestSchema()
+	tbl := sc.Tables["public.posts"]
+	sc.Tables["public.authors"].Rules = &schema.AccessRules{List: "org_id = 7"}
+	sc.Tables["public.orgs"].SoftDeleteColumn = "deleted_at"
+
+	// Until the rules are applied, related fields are left out of the sort.
+	fields := parseSort(sc, tbl, "author.org.name,title")
+	testutil.SliceLen(t, fields, 2)
+	testutil.Equal(t, sortSQL(fields), `"title" ASC`)
+
+	// Rows the request may not list sort as NULL, and the rule's placeholders
+	// follow the filter's.
+	args, err := sortRules(sc, fields, &ruleVars{}, 1)
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, args, 1)
+	testutil.Equal(t, sortSQL(fields),
+		`(SELECT (SELECT "s2"."name" FROM (SELECT * FROM "public"."orgs" WHERE "deleted_at" IS NULL) AS "s2" WHERE "s2"."id" = "s1"."org_id") `+
+			`FROM (SELECT * FROM "public"."authors" WHERE "org_id" = $2) AS "s1" WHERE "s1"."id" = "public"."posts"."author_id") ASC, "title" ASC`)
+}
+
+func TestListRelatedFilterUnknownRelation(t *testing.T) {
+	h := testHandler(relatedTestSchema())
+
+	w := doRequest(h, "GET", "/collections/posts?filter=editor.name%3D'x'", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "unknown relation")
+}
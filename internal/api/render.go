@@ -0,0 +1,364 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/jackc/pgx/v5"
+)
+
+// valueColumn is the column the rendering subqueries return their JSON in.
+const valueColumn = "_ayb_v"
+
+// recordSelect renders the records of a read or list request as JSON objects
+// in Postgres, so that they can be copied to the client as they arrive instead
+// of being decoded into maps and encoded again. Expanded relations are
+// rendered by LATERAL subqueries, to-many ones aggregated with json_agg.
+type recordSelect struct {
+	tbl     *schema.Table
+	fields  []string // the fields records are rendered with, in order
+	columns []string // fields, then the columns expansions and cursors need
+	expand  []*expandNode
+}
+
+// newRecordSelect resolves the fields parameter as buildColumnList does: "*",
+// or no field at all, stands for every column. keys are columns the caller
+// needs alongside each record, such as the keyset of a cursor.
+func newRecordSelect(tbl *schema.Table, fields []string, expand [][]expandStep, keys []string) *recordSelect {
+	s := &recordSelect{tbl: tbl, fields: recordFields(tbl, fields), expand: expandTree(expand)}
+	s.columns = appendMissing(slices.Clone(s.fields), expandColumns(s.expand)...)
+	s.columns = appendMissing(s.columns, keys...)
+	return s
+}
+
+// recordFields returns the fields the records of tbl are rendered with: the
+// requested columns and computed fields, or every column if none is.
+func recordFields(tbl *schema.Table, fields []string) []string {
+	var names []string
+	for _, f := range fields {
+		switch {
+		case f == "*":
+			for _, col := range tbl.Columns {
+				names = appendMissing(names, col.Name)
+			}
+		case tbl.ColumnByName(f) != nil || tbl.ComputedFieldByName(f) != nil:
+			names = appendMissing(names, f)
+		}
+	}
+	if len(names) == 0 {
+		for _, col := range tbl.Columns {
+			names = append(names, col.Name)
+		}
+	}
+	return names
+}
+
+// expandColumns returns the columns the relations in nodes are joined on.
+func expandColumns(nodes []*expandNode) []string {
+	var cols []string
+	for _, n := range nodes {
+		cols = appendMissing(cols, n.rel.FromColumns...)
+	}
+	return cols
+}
+
+func appendMissing(list []string, names ...string) []string {
+	for _, name := range names {
+		if !slices.Contains(list, name) {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// query wraps rowsQuery, which must select s.columns from a table, in the
+// query that renders each of its rows as a JSON object in the first result
+// column. With a cursor, the keyset columns follow; backward pages are put
+// back in display order, after the number of rows fetched.
+func (s *recordSelect) query(ctx context.Context, sc *schema.SchemaCache, rowsQuery string, rowsArgs []any, cursor *cursorPage) (string, []any, error) {
+	r := &renderer{ctx: ctx, sc: sc, args: slices.Clone(rowsArgs)}
+	row := r.alias()
+	obj, joins, err := r.object(s.tbl, row, s.fields, s.expand)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sel, order := obj, ""
+	if cursor != nil {
+		if cursor.backward {
+			sel += ", count(*) OVER ()"
+		}
+		display := make([]sortField, len(cursor.fields))
+		for i, f := range cursor.fields {
+			ref := row + "." + quoteIdent(f.column)
+			sel += ", " + ref
+			display[i] = sortField{column: f.column, desc: f.desc, expr: ref}
+		}
+		if cursor.backward {
+			order = " ORDER BY " + sortSQL(display)
+		}
+	}
+	return "SELECT " + sel + " FROM (" + rowsQuery + ") AS " + row + joins + order, r.args, nil
+}
+
+// selectOne builds the query for query that selects the columns of the
+// record of s's table with the given primary key.
+func (s *recordSelect) selectOne(pkValues []string) (string, []any) {
+	where, args := buildPKWhere(s.tbl, pkValues)
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT 1", rawColumnList(s.tbl, s.columns), tableRef(s.tbl), where), args
+}
+
+// renderer builds the SQL that renders records. Placeholders continue from
+// the arguments collected so far, and every row source gets its own alias,
+// so that a table expanded from itself is not confused with its parent.
+type renderer struct {
+	ctx     context.Context
+	sc      *schema.SchemaCache
+	args    []any
+	aliases int
+}
+
+func (r *renderer) alias() string {
+	r.aliases++
+	return quoteIdent("_ayb_r" + strconv.Itoa(r.aliases))
+}
+
+// object renders the row of tbl aliased row as a JSON object of fields, with an
+// "expand" object holding the relations in nodes that have records, if any
+// does. It returns the expression and the LATERAL joins it reads from.
+func (r *renderer) object(tbl *schema.Table, row string, fields []string, nodes []*expandNode) (expr, joins string, err error) {
+	plain := rowJSON(tbl, row, fields, "")
+	if len(nodes) == 0 {
+		return plain, "", nil
+	}
+
+	var b strings.Builder
+	pairs := make([]string, len(nodes))
+	for i, n := range nodes {
+		sub, err := r.relation(row, n)
+		if err != nil {
+			return "", "", err
+		}
+		alias := r.alias()
+		fmt.Fprintf(&b, " LEFT JOIN LATERAL (%s) AS %s ON true", sub, alias)
+		pairs[i] = "(" + quoteLiteral(n.rel.FieldName) + ", " + alias + "." + valueColumn + ")"
+	}
+	expand := r.alias()
+	fmt.Fprintf(&b, " LEFT JOIN LATERAL (SELECT json_object_agg(k, v) AS %s FROM (VALUES %s) AS e (k, v) WHERE v IS NOT NULL) AS %s ON true",
+		valueColumn, strings.Join(pairs, ", "), expand)
+
+	// An expanded record's own "expand" column is replaced, as it would be
+	// when decoded into a map.
+	withExpand := rowJSON(tbl, row, slices.DeleteFunc(slices.Clone(fields), func(f string) bool { return f == "expand" }), expand+"."+valueColumn)
+	expr = "CASE WHEN " + expand + "." + valueColumn + " IS NULL THEN " + plain + " ELSE " + withExpand + " END"
+	return expr, b.String(), nil
+}
+
+// rowJSON renders fields of the row of tbl aliased row as a JSON object, in
+// order and in their JSON form, followed by an "expand" key holding the
+// expression expand if it is set.
+func rowJSON(tbl *schema.Table, row string, fields []string, expand string) string {
+	cols := make([]string, 0, len(fields)+1)
+	for _, f := range fields {
+		cols = append(cols, outputField(tbl, f, row+"."+quoteIdent(f)))
+	}
+	if expand != "" {
+		cols = append(cols, expand+" AS expand")
+	}
+	return "(SELECT row_to_json(o) FROM (SELECT " + strings.Join(cols, ", ") + ") AS o)"
+}
+
+// relation renders the records n expands on the row aliased parent: an object
+// for a many-to-one relation and an array for a to-many one, or null when
+// there are none. Many-to-many records are reached through the junction table,
+// which is read in a subquery so that its columns cannot clash with the
+// filter's. Related records are limited by the related table's list rule.
+func (r *renderer) relation(parent string, n *expandNode) (string, error) {
+	rel, tbl, opts := n.rel, n.table, n.opts
+	ref := tableRef(tbl)
+
+	fields := recordFields(tbl, opts.fields)
+	columns := appendMissing(slices.Clone(fields), expandColumns(n.children)...)
+	sel := make([]string, len(columns))
+	for i, f := range columns {
+		if cf := tbl.ComputedFieldByName(f); cf != nil && tbl.ColumnByName(f) == nil {
+			sel[i] = computedFieldSQL(cf, ref) + " AS " + quoteIdent(f)
+		} else {
+			sel[i] = ref + "." + quoteIdent(f)
+		}
+	}
+
+	from := ref
+	var where []string
+	if rel.Type == "many-to-many" {
+		if len(rel.JunctionFromColumns) == 0 {
+			return "", fmt.Errorf("relationship %s has no junction columns", rel.Name)
+		}
+		junction := quoteIdent(rel.JunctionSchema) + "." + quoteIdent(rel.JunctionTable)
+		alias := quoteIdent("_ayb_junction")
+		refs := make([]string, len(rel.JunctionToColumns))
+		selects := make([]string, len(rel.JunctionToColumns))
+		for i, col := range rel.JunctionToColumns {
+			refs[i] = fmt.Sprintf("_ayb_to_%d", i)
+			selects[i] = quoteIdent(col) + " AS " + quoteIdent(refs[i])
+		}
+		from = fmt.Sprintf("%s JOIN (SELECT %s FROM %s WHERE %s) AS %s ON %s",
+			ref,
+			strings.Join(selects, ", "),
+			junction,
+			joinColumns(junction, rel.JunctionFromColumns, parent, rel.FromColumns),
+			alias,
+			joinColumns(alias, refs, ref, rel.ToColumns),
+		)
+	} else {
+		where = append(where, joinColumns(ref, rel.ToColumns, parent, rel.FromColumns))
+	}
+
+	if opts.filter != "" {
+		filterSQL, filterArgs, err := parseFilterExpr(r.ctx, r.sc, tbl, opts.filter, len(r.args))
+		if err != nil {
+			return "", err
+		}
+		where = append(where, "("+filterSQL+")")
+		r.args = append(r.args, filterArgs...)
+	}
+	ruleSQL, ruleArgs, err := ruleFilter(r.sc, tbl, ruleList, requestVars(r.ctx, nil), len(r.args))
+	if err != nil {
+		return "", err
+	}
+	if ruleSQL != "" {
+		where = append(where, "("+ruleSQL+")")
+		r.args = append(r.args, ruleArgs...)
+	}
+
+	q := "SELECT " + strings.Join(sel, ", ") + " FROM " + from
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	sorts := parseSort(r.sc, tbl, opts.sort)
+	sortArgs, err := sortRules(r.sc, sorts, requestVars(r.ctx, nil), len(r.args))
+	if err != nil {
+		return "", err
+	}
+	r.args = append(r.args, sortArgs...)
+	orderSQL := sortSQL(sorts)
+	if orderSQL == "" && opts.limit > 0 && len(tbl.PrimaryKey) > 0 {
+		pk := make([]sortField, len(tbl.PrimaryKey))
+		for i, col := range tbl.PrimaryKey {
+			pk[i] = sortField{column: col}
+		}
+		orderSQL = sortSQL(pk)
+	}
+	if orderSQL != "" {
+		q += " ORDER BY " + orderSQL
+	}
+	switch {
+	case rel.Type == "many-to-one":
+		q += " LIMIT 1"
+	case opts.limit > 0:
+		r.args = append(r.args, opts.limit)
+		q += fmt.Sprintf(" LIMIT $%d", len(r.args))
+	}
+
+	row := r.alias()
+	obj, joins, err := r.object(tbl, row, fields, n.children)
+	if err != nil {
+		return "", err
+	}
+	q = "SELECT " + obj + " AS " + valueColumn + " FROM (" + q + ") AS " + row + joins
+	if rel.Type == "many-to-one" {
+		return q, nil
+	}
+	// json_agg takes the records in the order of the subquery, as sorted.
+	return "SELECT json_agg(" + valueColumn + ") AS " + valueColumn + " FROM (" + q + ") AS l", nil
+}
+
+// writeRecordList streams a list response whose records come from rows, the
+// result of recordSelect.query, positioned on its first row when hasRow is
+// set. Each record is copied from the row to the client as it arrives. With
+// a cursor, rows holds up to perPage+1 records, the extra one only telling
+// that another page follows, and resp gets the cursors of the neighbouring
+// pages. It returns the number of records written.
+func writeRecordList(w http.ResponseWriter, rows pgx.Rows, hasRow bool, resp ListResponse, cursor *cursorPage) (int, error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	bw := bufio.NewWriter(w)
+
+	bw.WriteByte('{')
+	if resp.Page > 0 {
+		fmt.Fprintf(bw, `"page":%d,`, resp.Page)
+	}
+	fmt.Fprintf(bw, `"perPage":%d,"totalItems":%d,"totalPages":%d,"items":[`, resp.PerPage, resp.TotalItems, resp.TotalPages)
+
+	var (
+		dest    []any
+		keys    []any
+		fetched int64
+		first   map[string]any
+		hasMore bool
+		n       int
+		err     error
+	)
+	if cursor != nil {
+		dest = []any{nil} // the record is read raw
+		if cursor.backward {
+			dest = append(dest, &fetched)
+		}
+		keys = make([]any, len(cursor.fields))
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+	}
+
+	for ; hasRow && err == nil; hasRow = rows.Next() {
+		if cursor != nil {
+			if n == resp.PerPage {
+				hasMore = true
+				continue
+			}
+			if err = rows.Scan(dest...); err != nil {
+				break
+			}
+			// Backward pages are fetched in reverse, so the extra record
+			// comes first once they are back in display order.
+			if cursor.backward && n == 0 && !hasMore && fetched > int64(resp.PerPage) {
+				hasMore = true
+				continue
+			}
+			if n == 0 {
+				first = cursor.position(keys)
+			}
+		}
+		if n > 0 {
+			bw.WriteByte(',')
+		}
+		_, err = bw.Write(rows.RawValues()[0])
+		n++
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return n, err
+	}
+
+	bw.WriteByte(']')
+	if cursor != nil && n > 0 {
+		next, prev := cursor.links(first, cursor.position(keys), hasMore)
+		for _, c := range []struct{ key, value string }{{"nextCursor", next}, {"prevCursor", prev}} {
+			if c.value != "" {
+				v, _ := json.Marshal(c.value)
+				fmt.Fprintf(bw, `,%q:%s`, c.key, v)
+			}
+		}
+	}
+	bw.WriteString("}\n")
+	return n, bw.Flush()
+}
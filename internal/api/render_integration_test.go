@@ -0,0 +1,107 @@
+//go:build integration
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+// BenchmarkListRead compares the two read paths end to end, on a page of 500
+// posts with and without expanding their author and comments: decoding rows
+// into maps, expanding them with a batch query per relation and encoding them
+// with encoding/json, as GraphQL still does, against rendering the records in
+// Postgres and copying them to the client.
+func BenchmarkListRead(b *testing.B) {
+	ctx := context.Background()
+	pg, cleanup := testutil.StartPostgresForTestMain(ctx)
+	defer cleanup()
+
+	_, err := pg.Pool.Exec(ctx, `
+		CREATE TABLE authors (id SERIAL PRIMARY KEY, name TEXT NOT NULL);
+		CREATE TABLE posts (
+			id SERIAL PRIMARY KEY,
+			title TEXT NOT NULL,
+			body TEXT,
+			author_id INTEGER REFERENCES authors(id),
+			score NUMERIC(10, 2) DEFAULT 0,
+			created_at TIMESTAMPTZ DEFAULT now()
+		);
+		CREATE TABLE comments (id SERIAL PRIMARY KEY, post_id INTEGER NOT NULL REFERENCES posts(id), body TEXT NOT NULL);
+		CREATE INDEX ON comments (post_id);
+		INSERT INTO authors (name) SELECT 'Author ' || i FROM generate_series(1, 50) AS i;
+		INSERT INTO posts (title, body, author_id, score)
+			SELECT 'Post ' || i, repeat('lorem ipsum ', 20), 1 + i % 50, i / 7.0 FROM generate_series(1, 500) AS i;
+		INSERT INTO comments (post_id, body) SELECT 1 + i % 500, 'Comment ' || i FROM generate_series(1, 2000) AS i;
+		ANALYZE;`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sc, err := schema.BuildCache(ctx, pg.Pool)
+	if err != nil {
+		b.Fatal(err)
+	}
+	posts := sc.TableByName("posts")
+	opts := listOpts{page: 1, perPage: 500, skipTotal: true, sortSQL: `"id" ASC`}
+	resp := ListResponse{Page: 1, PerPage: 500, TotalItems: -1, TotalPages: -1}
+
+	for _, bc := range []struct{ name, expand string }{{"plain", ""}, {"expand", "author,comments"}} {
+		paths, err := parseExpand(sc, posts, bc.expand)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(bc.name+"/maps", func(b *testing.B) {
+			query, args, _, _ := buildList(posts, opts)
+			b.ReportAllocs()
+			for range b.N {
+				rows, err := pg.Pool.Query(ctx, query, args...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				items, err := scanRows(rows)
+				rows.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, path := range paths {
+					if err := expandRelation(ctx, pg.Pool, sc, items, path); err != nil {
+						b.Fatal(err)
+					}
+				}
+				r := resp
+				r.Items = items
+				writeJSON(httptest.NewRecorder(), http.StatusOK, r)
+			}
+		})
+
+		b.Run(bc.name+"/rendered", func(b *testing.B) {
+			sel := newRecordSelect(posts, nil, paths, nil)
+			o := opts
+			o.fields = sel.columns
+			o.raw = true
+			rowsQuery, rowsArgs, _, _ := buildList(posts, o)
+			query, args, err := sel.query(ctx, sc, rowsQuery, rowsArgs, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for range b.N {
+				rows, err := pg.Pool.Query(ctx, query, args...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, err = writeRecordList(httptest.NewRecorder(), rows, rows.Next(), resp, nil)
+				rows.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
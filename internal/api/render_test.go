@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRecordFields(t *testing.T) {
+	tbl := computedTestSchema().Tables["public.posts"]
+
+	testutil.Equal(t, fmt.Sprint(recordFields(tbl, nil)), "[id title author_id]")
+	testutil.Equal(t, fmt.Sprint(recordFields(tbl, []string{"title", "nope", "title", "word_count"})), "[title word_count]")
+	testutil.Equal(t, fmt.Sprint(recordFields(tbl, []string{"word_count", "*", "id"})), "[word_count id title author_id]")
+	testutil.Equal(t, fmt.Sprint(recordFields(tbl, []string{"nope"})), "[id title author_id]")
+}
+
+func TestExpandTree(t *testing.T) {
+	sc := relatedTestSchema()
+	paths, err := parseExpand(sc, sc.Tables["public.posts"], "author(fields=id),comments,author.org")
+	testutil.NoError(t, err)
+
+	tree := expandTree(paths)
+	testutil.SliceLen(t, tree, 2)
+	testutil.Equal(t, tree[0].rel.FieldName, "author")
+	testutil.Equal(t, fmt.Sprint(tree[0].opts.fields), "[id]")
+	testutil.SliceLen(t, tree[0].children, 1)
+	testutil.Equal(t, tree[0].children[0].rel.FieldName, "org")
+	testutil.Equal(t, tree[1].rel.FieldName, "comments")
+	testutil.Equal(t, fmt.Sprint(expandColumns(tree)), "[author_id id]")
+}
+
+func TestRecordSelectQuery(t *testing.T) {
+	sc := relatedTestSchema()
+	posts := sc.Tables["public.posts"]
+	rows := `SELECT "title", "author_id" FROM "public"."posts"`
+
+	sel := newRecordSelect(posts, []string{"title"}, nil, nil)
+	testutil.Equal(t, fmt.Sprint(sel.columns), "[title]")
+	q, args, err := sel.query(context.Background(), sc, `SELECT "title" FROM "public"."posts"`, nil, nil)
+	testutil.NoError(t, err)
+	testutil.Equal(t, q, `SELECT (SELECT row_to_json(o) FROM (SELECT "_ayb_r1"."title") AS o) `+
+		`FROM (SELECT "title" FROM "public"."posts") AS "_ayb_r1"`)
+	testutil.SliceLen(t, args, 0)
+
+	// The join column is selected, but not rendered.
+	paths, err := parseExpand(sc, posts, "author")
+	testutil.NoError(t, err)
+	sel = newRecordSelect(posts, []string{"title"}, paths, nil)
+	testutil.Equal(t, fmt.Sprint(sel.columns), "[title author_id]")
+	q, _, err = sel.query(context.Background(), sc, rows, nil, nil)
+	testutil.NoError(t, err)
+	testutil.Equal(t, q, `SELECT CASE WHEN "_ayb_r4"._ayb_v IS NULL `+
+		`THEN (SELECT row_to_json(o) FROM (SELECT "_ayb_r1"."title") AS o) `+
+		`ELSE (SELECT row_to_json(o) FROM (SELECT "_ayb_r1"."title", "_ayb_r4"._ayb_v AS expand) AS o) END `+
+		`FROM (`+rows+`) AS "_ayb_r1" `+
+		`LEFT JOIN LATERAL (SELECT (SELECT row_to_json(o) FROM (SELECT "_ayb_r2"."id", "_ayb_r2"."name", "_ayb_r2"."org_id") AS o) AS _ayb_v `+
+		`FROM (SELECT "public"."authors"."id", "public"."authors"."name", "public"."authors"."org_id" FROM "public"."authors" `+
+		`WHERE "public"."authors"."id" = "_ayb_r1"."author_id" LIMIT 1) AS "_ayb_r2") AS "_ayb_r3" ON true `+
+		`LEFT JOIN LATERAL (SELECT json_object_agg(k, v) AS _ayb_v FROM (VALUES ('author', "_ayb_r3"._ayb_v)) AS e (k, v) `+
+		`WHERE v IS NOT NULL) AS "_ayb_r4" ON true`)
+
+	// Option placeholders follow the row query's.
+	paths, err = parseExpand(sc, posts, "comments(filter=approved=true,sort=-id,limit=5,fields=id)")
+	testutil.NoError(t, err)
+	sel = newRecordSelect(posts, nil, paths, nil)
+	q, args, err = sel.query(context.Background(), sc, rows+" WHERE id = $1", []any{"7"}, nil)
+	testutil.NoError(t, err)
+	testutil.Contains(t, q, `LEFT JOIN LATERAL (SELECT json_agg(_ayb_v) AS _ayb_v FROM (`+
+		`SELECT (SELECT row_to_json(o) FROM (SELECT "_ayb_r2"."id") AS o) AS _ayb_v `+
+		`FROM (SELECT "public"."comments"."id" FROM "public"."comments" `+
+		`WHERE "public"."comments"."post_id" = "_ayb_r1"."id" AND ("approved" = $2) ORDER BY "id" DESC LIMIT $3) AS "_ayb_r2") AS l)`)
+	testutil.SliceLen(t, args, 3)
+	testutil.Equal(t, args[1], any(true))
+	testutil.Equal(t, args[2], any(5))
+
+	paths, err = parseExpand(sc, posts, "tags(sort=name)")
+	testutil.NoError(t, err)
+	sel = newRecordSelect(posts, nil, paths, nil)
+	q, _, err = sel.query(context.Background(), sc, rows, nil, nil)
+	testutil.NoError(t, err)
+	testutil.Contains(t, q, `FROM "public"."tags" JOIN (SELECT "tag_id" AS "_ayb_to_0" FROM "public"."post_tags" `+
+		`WHERE "public"."post_tags"."post_id" = "_ayb_r1"."id") AS "_ayb_junction" `+
+		`ON "_ayb_junction"."_ayb_to_0" = "public"."tags"."id" ORDER BY "name" ASC`)
+}
+
+func TestRecordSelectSelfRelation(t *testing.T) {
+	sc := relatedTestSchema()
+	authors := sc.Tables["public.authors"]
+	authors.Columns = append(authors.Columns, &schema.Column{Name: "mentor_id", TypeName: "integer"})
+	authors.Relationships = append(authors.Relationships, &schema.Relationship{
+		Name: "authors_mentor_id_fkey", Type: "many-to-one", FromSchema: "public", FromTable: "authors",
+		FromColumns: []string{"mentor_id"}, ToSchema: "public", ToTable: "authors", ToColumns: []string{"id"}, FieldName: "mentor",
+	})
+
+	// Each level joins on the aliased row above it, not on the table itself.
+	paths, err := parseExpand(sc, authors, "mentor.mentor")
+	testutil.NoError(t, err)
+	q, _, err := newRecordSelect(authors, nil, paths, nil).query(context.Background(), sc, `SELECT * FROM "public"."authors"`, nil, nil)
+	testutil.NoError(t, err)
+	testutil.Contains(t, q, `WHERE "public"."authors"."id" = "_ayb_r1"."mentor_id" LIMIT 1) AS "_ayb_r2"`)
+	testutil.Contains(t, q, `WHERE "public"."authors"."id" = "_ayb_r2"."mentor_id" LIMIT 1) AS "_ayb_r3"`)
+}
+
+func TestRecordSelectCursor(t *testing.T) {
+	sc := relatedTestSchema()
+	posts := sc.Tables["public.posts"]
+	cp, err := parseCursor(posts, []sortField{{column: "title", desc: true}}, "")
+	testutil.NoError(t, err)
+
+	sel := newRecordSelect(posts, []string{"title"}, nil, cp.columns())
+	testutil.Equal(t, fmt.Sprint(sel.columns), "[title id]")
+	q, _, err := sel.query(context.Background(), sc, "ROWS", nil, cp)
+	testutil.NoError(t, err)
+	testutil.Equal(t, q, `SELECT (SELECT row_to_json(o) FROM (SELECT "_ayb_r1"."title") AS o), "_ayb_r1"."title", "_ayb_r1"."id" `+
+		`FROM (ROWS) AS "_ayb_r1"`)
+
+	// Backward pages are fetched in reverse and put back in display order.
+	cp.backward = true
+	q, _, err = sel.query(context.Background(), sc, "ROWS", nil, cp)
+	testutil.NoError(t, err)
+	testutil.Equal(t, q, `SELECT (SELECT row_to_json(o) FROM (SELECT "_ayb_r1"."title") AS o), count(*) OVER (), "_ayb_r1"."title", "_ayb_r1"."id" `+
+		`FROM (ROWS) AS "_ayb_r1" ORDER BY "_ayb_r1"."title" DESC, "_ayb_r1"."id" ASC`)
+}
+
+func TestRecordSelectInvalidRule(t *testing.T) {
+	sc := relatedTestSchema()
+	sc.Tables["public.authors"].Rules = &schema.AccessRules{List: "nope = 1"}
+	paths, err := parseExpand(sc, sc.Tables["public.posts"], "author")
+	testutil.NoError(t, err)
+
+	_, _, err = newRecordSelect(sc.Tables["public.posts"], nil, paths, nil).query(context.Background(), sc, "ROWS", nil, nil)
+	testutil.ErrorContains(t, err, "nope")
+}
+
+// fakeRows serves fixed rows through pgx.Rows. The first value of each row
+// is its raw form, for RawValues; the rest are scanned.
+type fakeRows struct {
+	pgx.Rows
+	cols []string
+	rows [][]any
+	cur  int
+}
+
+func (r *fakeRows) Next() bool { r.cur++; return r.cur <= len(r.rows) }
+func (r *fakeRows) Err() error { return nil }
+func (r *fakeRows) Close()     {}
+
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription {
+	descs := make([]pgconn.FieldDescription, len(r.cols))
+	for i, c := range r.cols {
+		descs[i].Name = c
+	}
+	return descs
+}
+
+func (r *fakeRows) RawValues() [][]byte {
+	raw, _ := r.rows[r.cur-1][0].([]byte)
+	return [][]byte{raw}
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		v := r.rows[r.cur-1][i]
+		switch d := d.(type) {
+		case nil:
+		case *any:
+			*d = v
+		case *int64:
+			*d = v.(int64)
+		default:
+			return fmt.Errorf("cannot scan into %T", d)
+		}
+	}
+	return nil
+}
+
+// listRows returns fake rows of records with the given ids, rendered as
+// JSON, each followed by the id as keyset column and, if fetched is
+// positive, preceded by it.
+func listRows(fetched int64, ids ...int) *fakeRows {
+	rows := &fakeRows{}
+	for _, id := range ids {
+		row := []any{[]byte(fmt.Sprintf(`{"id":%d}`, id))}
+		if fetched > 0 {
+			row = append(row, fetched)
+		}
+		rows.rows = append(rows.rows, append(row, int64(id)))
+	}
+	return rows
+}
+
+func TestWriteRecordList(t *testing.T) {
+	write := func(rows *fakeRows, resp ListResponse, cursor *cursorPage) map[string]any {
+		t.Helper()
+		w := httptest.NewRecorder()
+		_, err := writeRecordList(w, rows, rows.Next(), resp, cursor)
+		testutil.NoError(t, err)
+		testutil.Equal(t, w.Header().Get("Content-Type"), "application/json")
+		var body map[string]any
+		testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+	ids := func(body map[string]any) string {
+		var out []any
+		for _, item := range body["items"].([]any) {
+			out = append(out, item.(map[string]any)["id"])
+		}
+		return fmt.Sprint(out)
+	}
+
+	body := write(listRows(0, 1, 2), ListResponse{Page: 2, PerPage: 2, TotalItems: 5, TotalPages: 3}, nil)
+	testutil.Equal(t, ids(body), "[1 2]")
+	testutil.Equal(t, body["page"], any(2.0))
+	testutil.Equal(t, body["totalPages"], any(3.0))
+
+	body = write(listRows(0), ListResponse{Page: 1, PerPage: 20, TotalItems: -1, TotalPages: -1}, nil)
+	testutil.Equal(t, ids(body), "[]")
+
+	// Going forward, the extra record is the last.
+	fields := []sortField{{column: "id"}}
+	body = write(listRows(0, 1, 2, 3), ListResponse{PerPage: 2}, &cursorPage{fields: fields})
+	testutil.Equal(t, ids(body), "[1 2]")
+	_, hasPage := body["page"]
+	testutil.False(t, hasPage, "cursor pages have no number")
+	testutil.True(t, body["nextCursor"] != nil, "expected next cursor")
+	testutil.True(t, body["prevCursor"] == nil, "expected no prev cursor")
+
+	// Going backward, it is the first.
+	body = write(listRows(3, 2, 3, 4), ListResponse{PerPage: 2}, &cursorPage{fields: fields, values: []any{"5"}, backward: true})
+	testutil.Equal(t, ids(body), "[3 4]")
+	prev, err := parseCursor(testTable(), nil, body["prevCursor"].(string))
+	testutil.NoError(t, err)
+	testutil.Equal(t, prev.values[0], any("3"))
+	next, err := parseCursor(testTable(), nil, body["nextCursor"].(string))
+	testutil.NoError(t, err)
+	testutil.Equal(t, next.values[0], any("4"))
+
+	body = write(listRows(2, 3, 4), ListResponse{PerPage: 2}, &cursorPage{fields: fields, values: []any{"5"}, backward: true})
+	testutil.Equal(t, ids(body), "[3 4]")
+	testutil.True(t, body["prevCursor"] == nil, "expected no prev cursor")
+}
+
+// BenchmarkListResponse compares the Go side of the two ways to answer a list
+// request of 500 records: decoding rows into maps and encoding them with
+// encoding/json, as GraphQL still does, and copying records rendered by
+// Postgres. The map path also pays for pgx decoding the values, which is not
+// measured here; the integration benchmarks measure both end to end.
+func BenchmarkListResponse(b *testing.B) {
+	const n = 500
+	created := time.Date(2026, 2, 7, 10, 0, 0, 0, time.UTC)
+	cols := []string{"id", "title", "body", "author_id", "status", "created_at"}
+	values := make([][]any, n)
+	rendered := make([][]any, n)
+	for i := range values {
+		values[i] = []any{int32(i), fmt.Sprintf("Post %d", i), "Lorem ipsum dolor sit amet", int32(i % 10), "published", created}
+		raw, _ := json.Marshal(map[string]any{
+			"id": i, "title": values[i][1], "body": values[i][2], "author_id": values[i][3], "status": "published", "created_at": created,
+		})
+		rendered[i] = []any{raw}
+	}
+
+	b.Run("maps", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			items, err := scanRows(&fakeRows{cols: cols, rows: values})
+			if err != nil {
+				b.Fatal(err)
+			}
+			writeJSON(httptest.NewRecorder(), 200, ListResponse{Page: 1, PerPage: n, TotalItems: n, TotalPages: 1, Items: items})
+		}
+	})
+	b.Run("rendered", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			rows := &fakeRows{rows: rendered}
+			if _, err := writeRecordList(httptest.NewRecorder(), rows, rows.Next(), ListResponse{Page: 1, PerPage: n, TotalItems: n, TotalPages: 1}, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
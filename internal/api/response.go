@@ -10,56 +10,111 @@ import (
 )
 
 // ListResponse is the envelope for paginated list endpoints.
+// With cursor pagination, page is omitted and nextCursor/prevCursor are set
+// when a neighbouring page exists.
 type ListResponse struct {
-	Page       int              `json:"page"`
+	Page       int              `json:"page,omitempty"`
 	PerPage    int              `json:"perPage"`
 	TotalItems int              `json:"totalItems"`
 	TotalPages int              `json:"totalPages"`
 	Items      []map[string]any `json:"items"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+	PrevCursor string           `json:"prevCursor,omitempty"`
+}
+
+// AuditResponse is the envelope for the record history and audit log
+// endpoints.
+type AuditResponse struct {
+	Page       int          `json:"page"`
+	PerPage    int          `json:"perPage"`
+	TotalItems int          `json:"totalItems"`
+	TotalPages int          `json:"totalPages"`
+	Items      []AuditEntry `json:"items"`
+}
+
+// AggregateResponse is the envelope for the aggregate endpoint.
+type AggregateResponse struct {
+	Items []map[string]any `json:"items"`
+}
+
+// BulkResponse is the envelope for bulk create, update, and delete endpoints.
+type BulkResponse struct {
+	Count int              `json:"count"`
+	Items []map[string]any `json:"items,omitempty"`
 }
 
 // Package-level aliases for the shared HTTP helpers so existing call sites
 // within this package continue to compile without changes.
 var (
-	writeJSON       = httputil.WriteJSON
-	writeError      = httputil.WriteError
-	writeFieldError = httputil.WriteFieldError
+	writeJSON  = httputil.WriteJSON
+	writeError = httputil.WriteError
 )
 
 // mapPGError converts a pgx/pgconn error to an appropriate HTTP response.
 // Returns true if a PG error was handled.
 func mapPGError(w http.ResponseWriter, err error) bool {
-	if err == nil {
+	status, resp, ok := pgErrorResponse(err)
+	if !ok {
 		return false
 	}
+	writeJSON(w, status, resp)
+	return true
+}
+
+// pgErrorResponse returns the HTTP status and error envelope for a pgx/pgconn error.
+// ok is false when the error is not a recognized database error.
+func pgErrorResponse(err error) (status int, resp httputil.ErrorResponse, ok bool) {
+	if err == nil {
+		return 0, resp, false
+	}
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		writeError(w, http.StatusNotFound, "record not found")
-		return true
+		return http.StatusNotFound, errorResponse(http.StatusNotFound, "record not found"), true
 	}
 
 	var pgErr *pgconn.PgError
 	if !errors.As(err, &pgErr) {
-		return false
+		return 0, resp, false
 	}
 
 	switch pgErr.Code {
 	case "23505": // unique_violation
-		writeFieldError(w, http.StatusConflict, "unique constraint violation",
-			pgErr.ConstraintName, "unique_violation", pgErr.Detail)
+		return http.StatusConflict, fieldErrorResponse(http.StatusConflict, "unique constraint violation",
+			pgErr.ConstraintName, "unique_violation", pgErr.Detail), true
 	case "23503": // foreign_key_violation
-		writeFieldError(w, http.StatusBadRequest, "foreign key violation",
-			pgErr.ConstraintName, "foreign_key_violation", pgErr.Detail)
+		return http.StatusBadRequest, fieldErrorResponse(http.StatusBadRequest, "foreign key violation",
+			pgErr.ConstraintName, "foreign_key_violation", pgErr.Detail), true
 	case "23502": // not_null_violation
-		writeFieldError(w, http.StatusBadRequest, "missing required value",
-			pgErr.ColumnName, "not_null_violation", pgErr.Message)
+		return http.StatusBadRequest, fieldErrorResponse(http.StatusBadRequest, "missing required value",
+			pgErr.ColumnName, "not_null_violation", pgErr.Message), true
 	case "23514": // check_violation
-		writeFieldError(w, http.StatusBadRequest, "check constraint violation",
-			pgErr.ConstraintName, "check_violation", pgErr.Detail)
-	case "22P02": // invalid_text_representation
-		writeError(w, http.StatusBadRequest, "invalid value: "+pgErr.Message)
+		return http.StatusBadRequest, fieldErrorResponse(http.StatusBadRequest, "check constraint violation",
+			pgErr.ConstraintName, "check_violation", pgErr.Detail), true
+	case "21000": // cardinality_violation
+		return http.StatusBadRequest, errorResponse(http.StatusBadRequest, "cardinality violation: "+pgErr.Message), true
+	case "22P02", "22007": // invalid_text_representation, invalid_datetime_format
+		return http.StatusBadRequest, errorResponse(http.StatusBadRequest, "invalid value: "+pgErr.Message), true
 	default:
-		return false
+		return 0, resp, false
+	}
+}
+
+// errorResponse builds a standard error envelope.
+func errorResponse(status int, message string) httputil.ErrorResponse {
+	return httputil.ErrorResponse{Code: status, Message: message}
+}
+
+// fieldErrorResponse builds an error envelope with field-level validation detail,
+// matching the shape written by httputil.WriteFieldError.
+func fieldErrorResponse(status int, message, field, fieldCode, fieldMsg string) httputil.ErrorResponse {
+	return httputil.ErrorResponse{
+		Code:    status,
+		Message: message,
+		Data: map[string]any{
+			field: map[string]string{
+				"code":    fieldCode,
+				"message": fieldMsg,
+			},
+		},
 	}
-	return true
 }
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
@@ -22,7 +21,7 @@ func (h *Handler) handleRPC(w http.ResponseWriter, r *http.Request) {
 	var args map[string]any
 	if r.ContentLength > 0 {
 		r.Body = http.MaxBytesReader(w, r.Body, httputil.MaxBodySize)
-		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		if err := decodeJSONNumbers(r.Body, &args); err != nil {
 			writeError(w, http.StatusBadRequest, "invalid JSON body")
 			return
 		}
@@ -90,24 +89,26 @@ func (h *Handler) handleRPC(w http.ResponseWriter, r *http.Request) {
 	}
 	done(nil)
 
+	writeJSON(w, http.StatusOK, unwrapRPCResult(record))
+}
+
+// unwrapRPCResult unwraps a scalar function result. If the result has a single
+// column named after the function, its value is returned instead of the row.
+func unwrapRPCResult(record map[string]any) any {
 	if record == nil {
-		writeJSON(w, http.StatusOK, nil)
-		return
+		return nil
 	}
-
-	// If the result has a single column named after the function, unwrap it.
 	if len(record) == 1 {
 		for _, v := range record {
-			writeJSON(w, http.StatusOK, v)
-			return
+			return v
 		}
 	}
-	writeJSON(w, http.StatusOK, record)
+	return record
 }
 
 // resolveFunction looks up the function in the schema cache and validates it exists.
 func (h *Handler) resolveFunction(w http.ResponseWriter, r *http.Request) *schema.Function {
-	sc := h.schema.Get()
+	sc := h.schemaFor(r)
 	if sc == nil {
 		writeError(w, http.StatusServiceUnavailable, "schema cache not ready")
 		return nil
@@ -122,6 +123,17 @@ func (h *Handler) resolveFunction(w http.ResponseWriter, r *http.Request) *schem
 	return fn
 }
 
+// paramColumn describes param as a column, for inputArg.
+func paramColumn(param *schema.FuncParam) *schema.Column {
+	base, _ := baseType(param.Type)
+	return &schema.Column{
+		Name:     param.Name,
+		TypeName: param.Type,
+		IsArray:  strings.HasSuffix(base, "[]"),
+		IsJSON:   base == "json" || base == "jsonb",
+	}
+}
+
 // buildRPCCall generates the SQL and args for calling a function.
 // For set-returning functions: SELECT * FROM schema.func($1, $2, ...)
 // For scalar/void functions: SELECT schema.func($1, $2, ...)
@@ -140,8 +152,8 @@ func buildRPCCall(fn *schema.Function, args map[string]any) (string, []any, erro
 			// Missing param — pass NULL.
 			val = nil
 		}
+		placeholders[i], val = inputArg(paramColumn(param), val, fmt.Sprintf("$%d", i+1))
 		queryArgs = append(queryArgs, val)
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
 	}
 
 	funcRef := quoteIdent(fn.Schema) + "." + quoteIdent(fn.Name)
@@ -152,6 +152,29 @@ func TestBuildRPCCallMissingArgPassesNull(t *testing.T) {
 	testutil.True(t, args[0] == nil, "missing arg should be nil")
 }
 
+func TestBuildRPCCallNumberArgs(t *testing.T) {
+	fn := &schema.Function{
+		Schema:     "public",
+		Name:       "transfer",
+		ReturnType: "void",
+		Parameters: []*schema.FuncParam{
+			{Name: "account", Type: "bigint", Position: 1},
+			{Name: "amount", Type: "numeric", Position: 2},
+			{Name: "tags", Type: "integer[]", Position: 3},
+		},
+	}
+	args := map[string]any{
+		"account": json.Number("9007199254740993"),
+		"amount":  json.Number("0.10000000000000000001"),
+		"tags":    []any{json.Number("1"), json.Number("2e1")},
+	}
+	_, queryArgs, err := buildRPCCall(fn, args)
+	testutil.NoError(t, err)
+	testutil.Equal(t, "9007199254740993", queryArgs[0].(string))
+	testutil.Equal(t, "0.10000000000000000001", queryArgs[1].(string))
+	testutil.Equal(t, "{1,20}", queryArgs[2].(string))
+}
+
 func TestBuildRPCCallUnnamedParamErrors(t *testing.T) {
 	fn := &schema.Function{
 		Schema:     "public",
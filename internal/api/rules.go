@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/auth"
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/jackc/pgx/v5"
+)
+
+// Access rule actions, one per rule in schema.AccessRules.
+const (
+	ruleList   = "list"
+	ruleView   = "view"
+	ruleCreate = "create"
+	ruleUpdate = "update"
+	ruleDelete = "delete"
+	// ruleRestore undoes a soft delete, which the delete rule also governs.
+	ruleRestore = "restore"
+)
+
+// errCreateDenied is returned when a new record does not satisfy the create rule.
+var errCreateDenied = errors.New("record does not satisfy the create rule")
+
+// invalidRuleError is a stored rule that cannot be applied. It is a server
+// misconfiguration rather than a bad request, so requests fail closed.
+type invalidRuleError struct {
+	table  string
+	action string
+	err    error
+}
+
+func (e *invalidRuleError) Error() string {
+	return fmt.Sprintf("invalid %s rule on %s: %v", e.action, e.table, e.err)
+}
+
+func (e *invalidRuleError) Unwrap() error { return e.err }
+
+// ruleVars holds the values of the @request variables in access rules.
+type ruleVars struct {
+	claims *auth.Claims // nil for unauthenticated requests
+	body   map[string]any
+	// withDeleted includes soft-deleted records in lists and views.
+	withDeleted bool
+}
+
+// requestVars returns the rule variables of a request with the given body.
+func requestVars(ctx context.Context, body map[string]any) *ruleVars {
+	return &ruleVars{claims: auth.ClaimsFromContext(ctx), body: body, withDeleted: withDeletedFromContext(ctx)}
+}
+
+// lookup returns the value of a variable. @request.auth.id and
+// @request.auth.email are empty for unauthenticated requests; @request.body.x
+// is nil when the body has no field x.
+func (v *ruleVars) lookup(name string) (any, error) {
+	switch {
+	case name == "@request.auth.id":
+		if v.claims == nil {
+			return "", nil
+		}
+		return v.claims.Subject, nil
+	case name == "@request.auth.email":
+		if v.claims == nil {
+			return "", nil
+		}
+		return v.claims.Email, nil
+	case strings.HasPrefix(name, "@request.body."):
+		return ruleValue(v.body[strings.TrimPrefix(name, "@request.body.")]), nil
+	}
+	return nil, fmt.Errorf("unknown variable %s", name)
+}
+
+// ruleValue converts a decoded JSON value for binding. Whole numbers become
+// integers so they compare with integer columns, and objects and arrays are
+// bound as their JSON text.
+func ruleValue(v any) any {
+	switch val := v.(type) {
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return int64(val)
+		}
+		return val
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	case map[string]any, []any:
+		doc, _ := json.Marshal(val)
+		return string(doc)
+	}
+	return v
+}
+
+// tableRule returns tbl's rule for action, or "" if the action is unrestricted.
+func tableRule(tbl *schema.Table, action string) string {
+	r := tbl.Rules
+	if r == nil {
+		return ""
+	}
+	var rule string
+	switch action {
+	case ruleList:
+		rule = r.List
+	case ruleView:
+		rule = r.View
+	case ruleCreate:
+		rule = r.Create
+	case ruleUpdate:
+		rule = r.Update
+	case ruleDelete, ruleRestore:
+		rule = r.Delete
+	}
+	return strings.TrimSpace(rule)
+}
+
+// ruleFilter renders tbl's rule for action as a condition with placeholders
+// numbered from argOffset+1, along with the soft-delete condition for action.
+// It returns "" when the action is unrestricted. Rules are written by admins,
+// so they may use columns hidden from the request.
+func ruleFilter(sc *schema.SchemaCache, tbl *schema.Table, action string, vars *ruleVars, argOffset int) (string, []any, error) {
+	deleted := softDeleteFilter(tbl, action, vars)
+	rule := tableRule(tbl, action)
+	if rule == "" {
+		return deleted, nil, nil
+	}
+	sql, args, err := parseExpr(sc.Unrestricted(), tbl.Unrestricted(), rule, argOffset, vars)
+	if err != nil {
+		return "", nil, &invalidRuleError{table: tbl.Name, action: action, err: err}
+	}
+	if deleted != "" {
+		sql = deleted + " AND (" + sql + ")"
+	}
+	return sql, args, nil
+}
+
+// withRule adds tbl's rule for action to a filter, so that only rows matching
+// both are affected. The rule's placeholders follow the filter's.
+func withRule(sc *schema.SchemaCache, tbl *schema.Table, action string, vars *ruleVars, filterSQL string, filterArgs []any) (string, []any, error) {
+	ruleSQL, ruleArgs, err := ruleFilter(sc, tbl, action, vars, len(filterArgs))
+	if err != nil || ruleSQL == "" {
+		return filterSQL, filterArgs, err
+	}
+	if filterSQL == "" {
+		return ruleSQL, ruleArgs, nil
+	}
+	return "(" + filterSQL + ") AND (" + ruleSQL + ")", append(filterArgs, ruleArgs...), nil
+}
+
+// ViewRule renders tbl's view rule for a realtime client with the given
+// claims, as a condition with placeholders numbered from argOffset+1. It
+// returns "" when tbl has no view rule. See realtime.Handler.SetViewRule.
+func ViewRule(sc *schema.SchemaCache, tbl *schema.Table, claims *auth.Claims, argOffset int) (string, []any, error) {
+	return ruleFilter(sc, tbl, ruleView, &ruleVars{claims: claims}, argOffset)
+}
+
+// matchesRule reports whether the record with the given primary key matches
+// tbl's rule for action. Rows checked for update and delete are locked, so
+// that they cannot change between the check and the write.
+func matchesRule(ctx context.Context, q Querier, sc *schema.SchemaCache, tbl *schema.Table, action string, vars *ruleVars, pkValues []string) (bool, error) {
+	ruleSQL, ruleArgs, err := ruleFilter(sc, tbl, action, vars, len(pkValues))
+	if err != nil || ruleSQL == "" {
+		return err == nil, err
+	}
+
+	where, args := buildPKWhere(tbl, pkValues)
+	query := "SELECT 1 FROM " + tableRef(tbl) + " WHERE " + where + " AND (" + ruleSQL + ")"
+	if action == ruleUpdate || action == ruleDelete {
+		query += " FOR UPDATE"
+	}
+	var one int
+	err = q.QueryRow(ctx, query, append(args, ruleArgs...)...).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// checkCreated checks new records against tbl's create rule, each with the
+// body it was created from. It runs in the transaction of the insert, which
+// the caller rolls back on error.
+func checkCreated(ctx context.Context, q Querier, sc *schema.SchemaCache, tbl *schema.Table, records, bodies []map[string]any) error {
+	if tableRule(tbl, ruleCreate) == "" || len(records) == 0 {
+		return nil
+	}
+	if len(tbl.PrimaryKey) == 0 {
+		return &invalidRuleError{table: tbl.Name, action: ruleCreate, err: errors.New("create rules require a primary key")}
+	}
+	claims := auth.ClaimsFromContext(ctx)
+	for i, rec := range records {
+		var body map[string]any
+		if i < len(bodies) {
+			body = bodies[i]
+		}
+		ok, err := matchesRule(ctx, q, sc, tbl, ruleCreate, &ruleVars{claims: claims, body: body}, recordPK(tbl, rec))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errCreateDenied
+		}
+	}
+	return nil
+}
+
+// recordPK returns a record's primary key values in the form the query
+// builders take.
+func recordPK(tbl *schema.Table, record map[string]any) []string {
+	values := make([]string, len(tbl.PrimaryKey))
+	for i, col := range tbl.PrimaryKey {
+		values[i] = formatPKValue(record[col])
+	}
+	return values
+}
+
+// withRLSFor is withRLS, but runs in a transaction whenever tbl has a rule for
+// action, so that the rule check and the statement it guards are atomic.
+// Soft deletes need no transaction, as the statements check deleted_at
+// themselves.
+func (h *Handler) withRLSFor(r *http.Request, tbl *schema.Table, action string) (Querier, func(error), error) {
+	if tableRule(tbl, action) == "" {
+		return h.withRLS(r)
+	}
+	return h.withTx(r)
+}
+
+// writeRuleError responds to an error from applying an access rule.
+func (h *Handler) writeRuleError(w http.ResponseWriter, tbl *schema.Table, err error) {
+	var ire *invalidRuleError
+	switch {
+	case errors.Is(err, errCreateDenied):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.As(err, &ire):
+		h.logger.Error("invalid access rule", "error", err, "table", tbl.Name)
+		writeError(w, http.StatusInternalServerError, "invalid access rule")
+	case !mapPGError(w, err):
+		h.logger.Error("rule check error", "error", err, "table", tbl.Name)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// checkRecordRule applies tbl's rule for action to the record with the given
+// primary key, with body as @request.body. A record the rule does not match is
+// reported as not found, so that rules do not reveal which records exist. On
+// failure it finishes the transaction, writes the response and returns false.
+func (h *Handler) checkRecordRule(w http.ResponseWriter, r *http.Request, q Querier, done func(error), tbl *schema.Table, action string, body map[string]any, pkValues []string) bool {
+	ok, err := matchesRule(r.Context(), q, h.schemaFor(r), tbl, action, requestVars(r.Context(), body), pkValues)
+	if err != nil {
+		done(err)
+		h.writeRuleError(w, tbl, err)
+		return false
+	}
+	if !ok {
+		done(nil)
+		writeError(w, http.StatusNotFound, "record not found")
+		return false
+	}
+	return true
+}
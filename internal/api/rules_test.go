@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/auth"
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func rulesTestVars() *ruleVars {
+	return &ruleVars{
+		claims: &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}, Email: "a@example.com"},
+		body:   map[string]any{"name": "Alice", "age": float64(30), "score": 1.5, "active": true, "tags": []any{"a"}},
+	}
+}
+
+func TestTokenizeVariable(t *testing.T) {
+	tokens, err := tokenize("id = @request.auth.id")
+	testutil.NoError(t, err)
+	testutil.SliceLen(t, tokens, 3)
+	testutil.Equal(t, tokens[2].kind, tokVar)
+	testutil.Equal(t, tokens[2].value, "@request.auth.id")
+}
+
+func TestVariablesOnlyInRules(t *testing.T) {
+	_, _, err := parseFilter(filterTestTable(), "name = @request.auth.id")
+	testutil.ErrorContains(t, err, "only allowed in access rules")
+}
+
+func TestRuleVariableAsValue(t *testing.T) {
+	sql, args, err := parseExpr(nil, filterTestTable(), "name = @request.auth.id && email = @request.auth.email", 0, rulesTestVars())
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `("name" = $1 AND "email" = $2)`)
+	testutil.SliceLen(t, args, 2)
+	testutil.Equal(t, args[0], any("user-1"))
+	testutil.Equal(t, args[1], any("a@example.com"))
+}
+
+func TestRuleVariableOnLeft(t *testing.T) {
+	tests := []struct {
+		rule string
+		sql  string
+		arg  any
+	}{
+		{"@request.body.name = 'Alice'", "$1::text = $2", "Alice"},
+		{"@request.body.age > 18", "$1::bigint > $2", int64(30)},
+		{"@request.body.score < 2.5", "$1::float8 < $2", 1.5},
+		{"@request.body.active = true", "$1::boolean = $2", true},
+		{"@request.body.tags = '[\"a\"]'", "$1::text = $2", `["a"]`},
+		{"@request.body.missing = null", "$1::text IS NULL", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			sql, args, err := parseExpr(nil, filterTestTable(), tt.rule, 0, rulesTestVars())
+			testutil.NoError(t, err)
+			testutil.Equal(t, sql, tt.sql)
+			testutil.Equal(t, args[0], tt.arg)
+		})
+	}
+}
+
+func TestRuleMissingBodyFieldIsNull(t *testing.T) {
+	sql, args, err := parseExpr(nil, filterTestTable(), "status = @request.body.status", 0, rulesTestVars())
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `"status" = NULL`)
+	testutil.SliceLen(t, args, 0)
+}
+
+func TestRuleUnauthenticated(t *testing.T) {
+	sql, args, err := parseExpr(nil, filterTestTable(), "@request.auth.id != ''", 0, &ruleVars{})
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, "$1::text != $2")
+	testutil.Equal(t, args[0], any(""))
+}
+
+func TestRuleUnknownVariable(t *testing.T) {
+	_, _, err := parseExpr(nil, filterTestTable(), "name = @request.query.x", 0, rulesTestVars())
+	testutil.ErrorContains(t, err, "unknown variable @request.query.x")
+}
+
+func TestBareBooleanFilter(t *testing.T) {
+	sql, _, err := parseFilter(filterTestTable(), "false")
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, "FALSE")
+
+	sql, _, err = parseFilter(filterTestTable(), "true || age > 1")
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `(TRUE OR "age" > $1)`)
+}
+
+func TestWithRule(t *testing.T) {
+	tbl := filterTestTable()
+	tbl.Rules = &schema.AccessRules{List: "name = @request.auth.id", Update: " "}
+
+	sql, args, err := withRule(nil, tbl, ruleList, rulesTestVars(), `"age" > $1`, []any{int64(18)})
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `("age" > $1) AND ("name" = $2)`)
+	testutil.SliceLen(t, args, 2)
+
+	sql, args, err = withRule(nil, tbl, ruleList, rulesTestVars(), "", nil)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `"name" = $1`)
+	testutil.SliceLen(t, args, 1)
+
+	// Blank rules leave the action unrestricted.
+	sql, _, err = withRule(nil, tbl, ruleUpdate, rulesTestVars(), `"age" > $1`, []any{int64(18)})
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `"age" > $1`)
+}
+
+func TestInvalidRule(t *testing.T) {
+	tbl := filterTestTable()
+	tbl.Rules = &schema.AccessRules{View: "nope = 1"}
+	_, _, err := ruleFilter(nil, tbl, ruleView, rulesTestVars(), 0)
+	var ire *invalidRuleError
+	testutil.True(t, errors.As(err, &ire), "expected invalidRuleError, got %v", err)
+	testutil.Contains(t, err.Error(), "invalid view rule on users")
+}
+
+func TestTableRuleWithoutRules(t *testing.T) {
+	testutil.Equal(t, tableRule(filterTestTable(), ruleCreate), "")
+}
+
+func TestCreatedRows(t *testing.T) {
+	rows := []map[string]any{{"name": "go"}, {"name": "api"}}
+
+	oc := &onConflict{columns: []string{"name"}}
+	items := []map[string]any{
+		{"id": 2, "name": "api", upsertInsertedColumn: true},
+		{"id": 1, "name": "go", upsertInsertedColumn: false},
+	}
+	created, bodies := createdRows(rows, oc, items)
+	testutil.SliceLen(t, created, 1)
+	testutil.Equal(t, created[0]["id"], any(2))
+	testutil.Equal(t, bodies[0]["name"], any("api"))
+}
+
+func TestSoftDeleteFilter(t *testing.T) {
+	tbl := softDeleteTable()
+	vars := rulesTestVars()
+
+	testutil.Equal(t, softDeleteFilter(tbl, ruleList, vars), `"deleted_at" IS NULL`)
+	testutil.Equal(t, softDeleteFilter(tbl, ruleDelete, vars), `"deleted_at" IS NULL`)
+	testutil.Equal(t, softDeleteFilter(tbl, ruleRestore, vars), `"deleted_at" IS NOT NULL`)
+	testutil.Equal(t, softDeleteFilter(tbl, ruleCreate, vars), "")
+	testutil.Equal(t, softDeleteFilter(testTable(), ruleList, vars), "")
+
+	// withDeleted shows soft-deleted records, but writes still skip them.
+	vars.withDeleted = true
+	testutil.Equal(t, softDeleteFilter(tbl, ruleView, vars), "")
+	testutil.Equal(t, softDeleteFilter(tbl, ruleUpdate, vars), `"deleted_at" IS NULL`)
+}
+
+func TestRuleFilterWithSoftDelete(t *testing.T) {
+	tbl := softDeleteTable()
+	tbl.Rules = &schema.AccessRules{Delete: "name = @request.auth.id"}
+
+	sql, args, err := ruleFilter(nil, tbl, ruleList, rulesTestVars(), 0)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `"deleted_at" IS NULL`)
+	testutil.SliceLen(t, args, 0)
+
+	// Restores are governed by the delete rule.
+	sql, args, err = ruleFilter(nil, tbl, ruleRestore, rulesTestVars(), 1)
+	testutil.NoError(t, err)
+	testutil.Equal(t, sql, `"deleted_at" IS NOT NULL AND ("name" = $2)`)
+	testutil.SliceLen(t, args, 1)
+}
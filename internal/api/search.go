@@ -0,0 +1,234 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// rankSort is the pseudo-column accepted in sort to order by search relevance.
+const rankSort = "@rank"
+
+// indexConfigPattern extracts the text search configuration from an indexed
+// expression such as to_tsvector('english'::regconfig, title).
+var indexConfigPattern = regexp.MustCompile(`^to_tsvector\(('(?:[^']|'')*'::regconfig),`)
+
+// textSearch is a full-text search condition on a table.
+type textSearch struct {
+	vector string // tsvector expression
+	query  string // tsquery expression, referencing the search term placeholder
+}
+
+// whereSQL returns the match condition.
+func (s *textSearch) whereSQL() string {
+	return s.vector + " @@ " + s.query
+}
+
+// rankSQL returns the relevance expression used by sort=-@rank.
+func (s *textSearch) rankSQL() string {
+	return "ts_rank(" + s.vector + ", " + s.query + ")"
+}
+
+// parseSearch builds a full-text search over searchFields (comma-separated), or
+// over the table's default search target when searchFields is empty. The term is
+// bound to $paramIndex and parsed with websearch_to_tsquery.
+//
+// A tsvector column is used directly. For text columns, a GIN index on a
+// matching to_tsvector expression is used if one exists, so the planner can use
+// it; otherwise the tsvector is built on the fly.
+func parseSearch(tbl *schema.Table, searchFields string, paramIndex int) (*textSearch, error) {
+	param := fmt.Sprintf("$%d", paramIndex)
+
+	var cols []*schema.Column
+	for _, name := range strings.Split(searchFields, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		col := tbl.ColumnByName(name)
+		if col == nil {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		if !isTSVectorColumn(col) && !isTextColumn(col) {
+			return nil, fmt.Errorf("column is not searchable: %s", name)
+		}
+		cols = append(cols, col)
+	}
+
+	if len(cols) == 0 {
+		// Default target: a tsvector column, then a text search index, then
+		// every text column.
+		for _, col := range tbl.Columns {
+			if isTSVectorColumn(col) {
+				return &textSearch{vector: quoteIdent(col.Name), query: "websearch_to_tsquery(" + param + ")"}, nil
+			}
+		}
+		if s := searchIndex(tbl, nil, param); s != nil {
+			return s, nil
+		}
+		for _, col := range tbl.Columns {
+			if isTextColumn(col) {
+				cols = append(cols, col)
+			}
+		}
+		if len(cols) == 0 {
+			return nil, fmt.Errorf("table has no searchable columns")
+		}
+	}
+
+	if len(cols) == 1 && isTSVectorColumn(cols[0]) {
+		return &textSearch{vector: quoteIdent(cols[0].Name), query: "websearch_to_tsquery(" + param + ")"}, nil
+	}
+
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = col.Name
+	}
+	if s := searchIndex(tbl, names, param); s != nil {
+		return s, nil
+	}
+
+	parts := make([]string, len(cols))
+	for i, col := range cols {
+		if isTSVectorColumn(col) {
+			parts[i] = "coalesce(" + quoteIdent(col.Name) + ", ''::tsvector)"
+		} else {
+			parts[i] = "to_tsvector(coalesce(" + quoteIdent(col.Name) + "::text, ''))"
+		}
+	}
+	return &textSearch{
+		vector: "(" + strings.Join(parts, " || ") + ")",
+		query:  "websearch_to_tsquery(" + param + ")",
+	}, nil
+}
+
+// searchIndex finds a GIN index on a to_tsvector expression over exactly the
+// given columns (any such index when columns is nil) and returns a search that
+// repeats the indexed expression and its configuration. Indexes over columns
+// hidden from the role are never used, since matches would reveal them.
+func searchIndex(tbl *schema.Table, columns []string, param string) *textSearch {
+	for _, idx := range tbl.Indexes {
+		if idx.Method != "gin" || idx.IsPartial {
+			continue
+		}
+		expr := indexExpression(idx.Definition)
+		if !strings.HasPrefix(expr, "to_tsvector(") {
+			continue
+		}
+		refs := expressionColumns(tbl.Unrestricted(), expr)
+		if slices.ContainsFunc(refs, func(c string) bool { return tbl.ColumnByName(c) == nil }) {
+			continue
+		}
+		if columns != nil {
+			if len(refs) != len(columns) {
+				continue
+			}
+			match := true
+			for _, c := range columns {
+				if !slices.Contains(refs, c) {
+					match = false
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+		}
+
+		query := "websearch_to_tsquery(" + param + ")"
+		if m := indexConfigPattern.FindStringSubmatch(expr); m != nil {
+			query = "websearch_to_tsquery(" + m[1] + ", " + param + ")"
+		}
+		return &textSearch{vector: expr, query: query}
+	}
+	return nil
+}
+
+// indexExpression returns the single key expression of an index definition
+// from pg_get_indexdef, e.g. "to_tsvector('english'::regconfig, title)" from
+// "CREATE INDEX i ON public.t USING gin (to_tsvector('english'::regconfig, title))".
+// Returns "" if the definition has more than one key.
+func indexExpression(def string) string {
+	start := strings.Index(def, " USING ")
+	if start < 0 {
+		return ""
+	}
+	open := strings.IndexByte(def[start:], '(')
+	if open < 0 {
+		return ""
+	}
+	open += start
+
+	depth := 0
+	inString := false
+	for i := open; i < len(def); i++ {
+		switch ch := def[i]; {
+		case ch == '\'':
+			inString = !inString
+		case inString:
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(def[open+1 : i])
+			}
+		case ch == ',' && depth == 1:
+			return ""
+		}
+	}
+	return ""
+}
+
+// expressionColumns returns the table columns referenced in a SQL expression,
+// ignoring string literals.
+func expressionColumns(tbl *schema.Table, expr string) []string {
+	var refs []string
+	add := func(name string) {
+		if tbl.ColumnByName(name) != nil && !slices.Contains(refs, name) {
+			refs = append(refs, name)
+		}
+	}
+
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == '\'':
+			j := i + 1
+			for j < len(expr) && expr[j] != '\'' {
+				j++
+			}
+			i = j + 1
+		case ch == '"':
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				j++
+			}
+			if j < len(expr) {
+				add(expr[i+1 : j])
+			}
+			i = j + 1
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			j := i
+			for j < len(expr) && (expr[j] == '_' || expr[j] >= 'a' && expr[j] <= 'z' ||
+				expr[j] >= 'A' && expr[j] <= 'Z' || expr[j] >= '0' && expr[j] <= '9') {
+				j++
+			}
+			// Skip function names and type casts.
+			if (j >= len(expr) || expr[j] != '(') && (i < 2 || expr[i-2:i] != "::") {
+				add(expr[i:j])
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return refs
+}
+
+func isTSVectorColumn(col *schema.Column) bool {
+	return !col.IsArray && strings.EqualFold(col.TypeName, "tsvector")
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func searchTestTable() *schema.Table {
+	return &schema.Table{
+		Schema: "public",
+		Name:   "posts",
+		Kind:   "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", JSONType: "integer", IsPrimaryKey: true},
+			{Name: "title", TypeName: "text", JSONType: "string"},
+			{Name: "body", TypeName: "text", JSONType: "string"},
+			{Name: "summary", TypeName: "character varying(200)", JSONType: "string"},
+			{Name: "views", TypeName: "integer", JSONType: "integer"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+}
+
+func TestParseSearchOnTheFly(t *testing.T) {
+	tbl := searchTestTable()
+
+	s, err := parseSearch(tbl, "title, body", 2)
+	testutil.NoError(t, err)
+	testutil.Equal(t, s.whereSQL(),
+		`(to_tsvector(coalesce("title"::text, '')) || to_tsvector(coalesce("body"::text, ''))) @@ websearch_to_tsquery($2)`)
+	testutil.Contains(t, s.rankSQL(), "ts_rank(")
+}
+
+func TestParseSearchDefaultsToTextColumns(t *testing.T) {
+	tbl := searchTestTable()
+
+	s, err := parseSearch(tbl, "", 1)
+	testutil.NoError(t, err)
+	testutil.Contains(t, s.vector, `"title"`)
+	testutil.Contains(t, s.vector, `"body"`)
+	testutil.Contains(t, s.vector, `"summary"`)
+}
+
+func TestParseSearchUsesTSVectorColumn(t *testing.T) {
+	tbl := searchTestTable()
+	tbl.Columns = append(tbl.Columns, &schema.Column{Name: "search_vec", TypeName: "tsvector", JSONType: "string"})
+
+	s, err := parseSearch(tbl, "", 1)
+	testutil.NoError(t, err)
+	testutil.Equal(t, s.whereSQL(), `"search_vec" @@ websearch_to_tsquery($1)`)
+
+	s, err = parseSearch(tbl, "search_vec", 3)
+	testutil.NoError(t, err)
+	testutil.Equal(t, s.whereSQL(), `"search_vec" @@ websearch_to_tsquery($3)`)
+}
+
+func TestParseSearchUsesGINIndex(t *testing.T) {
+	tbl := searchTestTable()
+	tbl.Indexes = []*schema.Index{
+		{Name: "posts_pkey", IsUnique: true, IsPrimary: true, Method: "btree", Columns: []string{"id"},
+			Definition: "CREATE UNIQUE INDEX posts_pkey ON public.posts USING btree (id)"},
+		{Name: "posts_fts", Method: "gin", Columns: []string{""},
+			Definition: "CREATE INDEX posts_fts ON public.posts USING gin (to_tsvector('english'::regconfig, (title || ' '::text) || body))"},
+	}
+
+	want := `to_tsvector('english'::regconfig, (title || ' '::text) || body) @@ websearch_to_tsquery('english'::regconfig, $1)`
+
+	s, err := parseSearch(tbl, "body,title", 1)
+	testutil.NoError(t, err)
+	testutil.Equal(t, s.whereSQL(), want)
+
+	s, err = parseSearch(tbl, "", 1)
+	testutil.NoError(t, err)
+	testutil.Equal(t, s.whereSQL(), want)
+
+	// A different column set doesn't match the index.
+	s, err = parseSearch(tbl, "title", 1)
+	testutil.NoError(t, err)
+	testutil.Contains(t, s.vector, `to_tsvector(coalesce("title"::text, ''))`)
+}
+
+func TestParseSearchSkipsIndexOverHiddenColumn(t *testing.T) {
+	tbl := searchTestTable()
+	tbl.Indexes = []*schema.Index{
+		{Name: "posts_fts", Method: "gin", Columns: []string{""},
+			Definition: "CREATE INDEX posts_fts ON public.posts USING gin (to_tsvector('english'::regconfig, (title || ' '::text) || body))"},
+	}
+	tbl.ColumnAccess = []*schema.ColumnAccess{{Column: "body", Role: "anon", Access: schema.AccessHidden}}
+	sc := &schema.SchemaCache{Tables: map[string]*schema.Table{"public.posts": tbl}}
+	anon := sc.ForRole("anon").Tables["public.posts"]
+
+	// Matches through the index would reveal the hidden body.
+	s, err := parseSearch(anon, "", 1)
+	testutil.NoError(t, err)
+	testutil.Equal(t, s.vector, `(to_tsvector(coalesce("title"::text, '')) || to_tsvector(coalesce("summary"::text, '')))`)
+
+	s, err = parseSearch(anon, "title", 1)
+	testutil.NoError(t, err)
+	testutil.Equal(t, s.vector, `(to_tsvector(coalesce("title"::text, '')))`)
+
+	// Other roles still use it.
+	s, err = parseSearch(sc.ForRole("admin").Tables["public.posts"], "", 1)
+	testutil.NoError(t, err)
+	testutil.Contains(t, s.vector, "'english'::regconfig")
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	tbl := searchTestTable()
+
+	_, err := parseSearch(tbl, "nope", 1)
+	testutil.ErrorContains(t, err, "unknown column")
+
+	_, err = parseSearch(tbl, "views", 1)
+	testutil.ErrorContains(t, err, "not searchable")
+
+	tbl.Columns = tbl.Columns[:1]
+	_, err = parseSearch(tbl, "", 1)
+	testutil.ErrorContains(t, err, "no searchable columns")
+}
+
+func TestIndexExpression(t *testing.T) {
+	testutil.Equal(t,
+		indexExpression("CREATE INDEX i ON public.t USING gin (to_tsvector('simple'::regconfig, COALESCE(title, ''::text)))"),
+		"to_tsvector('simple'::regconfig, COALESCE(title, ''::text))")
+	testutil.Equal(t, indexExpression("CREATE INDEX i ON public.t USING btree (a, b)"), "")
+	testutil.Equal(t, indexExpression("not an index"), "")
+}
+
+func TestExpressionColumns(t *testing.T) {
+	tbl := searchTestTable()
+
+	refs := expressionColumns(tbl, `to_tsvector('english'::regconfig, (title || ' body '::text) || "summary")`)
+	testutil.SliceLen(t, refs, 2)
+	testutil.Equal(t, refs[0], "title")
+	testutil.Equal(t, refs[1], "summary")
+}
+
+func TestParseSortRank(t *testing.T) {
+	tbl := searchTestTable()
+
+	fields := parseSort(nil, tbl, "-@rank,title")
+	testutil.SliceLen(t, fields, 2)
+	testutil.Equal(t, fields[0].column, rankSort)
+	testutil.Equal(t, sortSQL(fields), `"title" ASC`) // unresolved rank is skipped
+
+	fields[0].expr = "ts_rank(v, q)"
+	testutil.Equal(t, sortSQL(fields), `ts_rank(v, q) DESC, "title" ASC`)
+
+	_, err := parseCursor(tbl, fields, "")
+	testutil.ErrorContains(t, err, "cannot sort by @rank")
+}
+
+func TestListSearchErrors(t *testing.T) {
+	h := testHandler(testSchema())
+
+	w := doRequest(h, "GET", "/collections/users?sort=-@rank", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "requires search")
+
+	w = doRequest(h, "GET", "/collections/users?search=ann&searchFields=bogus", "")
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "invalid search")
+}
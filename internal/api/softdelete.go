@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+type withDeletedKey struct{}
+
+// withDeletedFromContext reports whether the request asked for soft-deleted
+// records with ?withDeleted=true and was allowed to.
+func withDeletedFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(withDeletedKey{}).(bool)
+	return v
+}
+
+// withDeletedParam handles the withDeleted query parameter, which only admins
+// may pass. See SetAdminCheck.
+func (h *Handler) withDeletedParam(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("withDeleted") != "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if h.isAdmin == nil || !h.isAdmin(r) {
+			writeError(w, http.StatusForbidden, "withDeleted requires admin access")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), withDeletedKey{}, true)))
+	})
+}
+
+// softDeleteFilter returns the condition that selects the records action
+// applies to in a soft-delete table: live ones, except for restores and for
+// lists and views with withDeleted. It returns "" for other tables.
+func softDeleteFilter(tbl *schema.Table, action string, vars *ruleVars) string {
+	col := tbl.SoftDeleteColumn
+	switch {
+	case col == "" || action == ruleCreate:
+		return ""
+	case action == ruleRestore:
+		return quoteIdent(col) + " IS NOT NULL"
+	case (action == ruleList || action == ruleView) && vars != nil && vars.withDeleted:
+		return ""
+	}
+	return quoteIdent(col) + " IS NULL"
+}
+
+// handleRestore handles POST /collections/{table}/{id}/restore, which undoes
+// the soft delete of a record. Callers the delete rule lets delete the record
+// may restore it.
+func (h *Handler) handleRestore(w http.ResponseWriter, r *http.Request) {
+	tbl := h.resolveTable(w, r)
+	if tbl == nil {
+		return
+	}
+	if !requireWritable(w, tbl) {
+		return
+	}
+	if tbl.SoftDeleteColumn == "" {
+		writeError(w, http.StatusBadRequest, "soft delete is not enabled for "+tbl.Name)
+		return
+	}
+	if !requirePK(w, tbl) {
+		return
+	}
+
+	pkValues := extractPK(w, r, tbl)
+	if pkValues == nil {
+		return
+	}
+	query, args := buildRestore(tbl, pkValues)
+
+	q, done, err := h.withRLSFor(r, tbl, ruleRestore)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !h.checkRecordRule(w, r, q, done, tbl, ruleRestore, nil, pkValues) {
+		return
+	}
+
+	record, err := queryOne(r.Context(), q, query, args)
+	if err != nil {
+		done(err)
+		if !mapPGError(w, err) {
+			h.logger.Error("restore error", "error", err, "table", tbl.Name)
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	done(nil)
+	if record == nil {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, record)
+	h.publishEvent("restore", h.collectionName(tbl), record)
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// upsertInsertedColumn is an extra RETURNING column that tells inserted rows
+// apart from merged ones. It is stripped before records are returned.
+const upsertInsertedColumn = "_ayb_inserted"
+
+// onConflict describes the ON CONFLICT clause requested on create.
+type onConflict struct {
+	columns []string
+	merge   bool // DO UPDATE when true, DO NOTHING otherwise
+}
+
+// parseOnConflict reads the onConflict and merge query parameters.
+// Returns nil if the request is a plain insert.
+func parseOnConflict(tbl *schema.Table, r *http.Request) (*onConflict, error) {
+	q := r.URL.Query()
+	target := strings.TrimSpace(q.Get("onConflict"))
+
+	merge := false
+	if v := q.Get("merge"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merge value: %q", v)
+		}
+		merge = b
+	}
+
+	if target == "" {
+		if merge {
+			return nil, fmt.Errorf("merge requires onConflict")
+		}
+		return nil, nil
+	}
+
+	var columns []string
+	for _, name := range strings.Split(target, ",") {
+		name = strings.TrimSpace(name)
+		if tbl.ColumnByName(name) == nil {
+			return nil, fmt.Errorf("unknown column in onConflict: %q", name)
+		}
+		columns = append(columns, name)
+	}
+	if !tbl.HasUniqueKey(columns) {
+		return nil, fmt.Errorf("onConflict columns must match the primary key or a unique index")
+	}
+	// Merged rows would be updated without checking the update rule.
+	if merge && tableRule(tbl, ruleUpdate) != "" {
+		return nil, fmt.Errorf("merge is not supported on collections with an update rule")
+	}
+	return &onConflict{columns: columns, merge: merge}, nil
+}
+
+// buildUpsert builds an INSERT ... ON CONFLICT ... RETURNING statement for one
+// or more rows. With merge, every inserted column except the conflict target
+// and columns that updates may not set is overwritten from EXCLUDED. Each
+// returned row carries upsertInsertedColumn.
+func buildUpsert(tbl *schema.Table, rows []map[string]any, oc *onConflict) (string, []any) {
+	columns, values, args := insertValues(tbl, rows)
+
+	action := "DO NOTHING"
+	if oc.merge {
+		var sets []string
+		for _, col := range columns {
+			if !slices.Contains(oc.columns, col) && tbl.CanUpdate(col) {
+				sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", quoteIdent(col), quoteIdent(col)))
+			}
+		}
+		if len(sets) == 0 {
+			// Nothing to change, but DO UPDATE still returns the existing row.
+			col := quoteIdent(oc.columns[0])
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+		}
+		action = "DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) %s RETURNING %s, (xmax = 0) AS %s",
+		tableRef(tbl),
+		quoteIdents(columns),
+		values,
+		quoteIdents(oc.columns),
+		action,
+		buildColumnList(tbl, nil),
+		quoteIdent(upsertInsertedColumn),
+	)
+	return q, args
+}
+
+// duplicateConflictKey finds two rows of a merge with the same values for the
+// conflict columns, which Postgres refuses to update twice in one statement.
+// It returns their indexes. Rows with a missing or null key column never
+// conflict, and DO NOTHING skips repeats without error.
+func duplicateConflictKey(rows []map[string]any, oc *onConflict) (int, int, bool) {
+	if !oc.merge {
+		return 0, 0, false
+	}
+	seen := make(map[string]int, len(rows))
+	for i, row := range rows {
+		parts := make([]string, len(oc.columns))
+		for c, col := range oc.columns {
+			v := row[col]
+			if v == nil {
+				parts = nil
+				break
+			}
+			parts[c] = formatPKValue(v)
+		}
+		if parts == nil {
+			continue
+		}
+		key := strings.Join(parts, "\x00")
+		if j, ok := seen[key]; ok {
+			return j, i, true
+		}
+		seen[key] = i
+	}
+	return 0, 0, false
+}
+
+// upsert handles POST /collections/{table}?onConflict=... for a single object
+// (single is true) or an array of rows. Responds 201 if any row was inserted,
+// 200 if rows were only merged, and 204 if a single row was skipped by DO NOTHING.
+func (h *Handler) upsert(w http.ResponseWriter, r *http.Request, tbl *schema.Table, rows []map[string]any, single bool, oc *onConflict) {
+	if i, j, ok := duplicateConflictKey(rows, oc); ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("rows %d and %d have the same onConflict key", i, j))
+		return
+	}
+	query, args := buildUpsert(tbl, rows, oc)
+
+	q, done, err := h.withRLSFor(r, tbl, ruleCreate)
+	if err != nil {
+		h.logger.Error("rls setup error", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	check := func(items []map[string]any) error {
+		created, bodies := createdRows(rows, oc, items)
+		return checkCreated(r.Context(), q, h.schemaFor(r), tbl, created, bodies)
+	}
+	items, ok := h.queryBulk(w, r, q, done, tbl, query, args, check, "upsert error")
+	if !ok {
+		return
+	}
+
+	var created, updated []map[string]any
+	for _, item := range items {
+		inserted, _ := item[upsertInsertedColumn].(bool)
+		delete(item, upsertInsertedColumn)
+		if inserted {
+			created = append(created, item)
+		} else {
+			updated = append(updated, item)
+		}
+	}
+
+	status := http.StatusOK
+	if len(created) > 0 {
+		status = http.StatusCreated
+	}
+
+	if single {
+		if len(items) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, status, items[0])
+	} else {
+		writeJSON(w, status, BulkResponse{Count: len(items), Items: items})
+	}
+	h.publishEvents("create", tbl, created)
+	h.publishEvents("update", tbl, updated)
+}
+
+// createdRows returns the records created by an upsert, along with the rows
+// they were created from.
+func createdRows(rows []map[string]any, oc *onConflict, items []map[string]any) (created, bodies []map[string]any) {
+	for _, item := range items {
+		if inserted, _ := item[upsertInsertedColumn].(bool); inserted {
+			created = append(created, item)
+			bodies = append(bodies, upsertBody(rows, oc, item))
+		}
+	}
+	return created, bodies
+}
+
+// upsertBody returns the row of an upsert that a returned item was created
+// from, matched by the conflict columns, or nil if there is none.
+func upsertBody(rows []map[string]any, oc *onConflict, item map[string]any) map[string]any {
+	if len(rows) == 1 {
+		return rows[0]
+	}
+	for _, row := range rows {
+		match := true
+		for _, col := range oc.columns {
+			v, ok := row[col]
+			if !ok || formatPKValue(v) != formatPKValue(item[col]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return row
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func upsertTestTable() *schema.Table {
+	tbl := testTable()
+	tbl.Indexes = []*schema.Index{
+		{Name: "users_pkey", IsUnique: true, IsPrimary: true, Columns: []string{"id"}},
+		{Name: "users_email_key", IsUnique: true, Columns: []string{"email"}},
+		{Name: "users_name_idx", Columns: []string{"name"}},
+	}
+	return tbl
+}
+
+func TestParseOnConflict(t *testing.T) {
+	tbl := upsertTestTable()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    *onConflict
+		wantErr string
+	}{
+		{"none", "", nil, ""},
+		{"do nothing", "onConflict=email", &onConflict{columns: []string{"email"}}, ""},
+		{"merge", "onConflict=email&merge=true", &onConflict{columns: []string{"email"}, merge: true}, ""},
+		{"primary key", "onConflict=id&merge=1", &onConflict{columns: []string{"id"}, merge: true}, ""},
+		{"merge without target", "merge=true", nil, "merge requires onConflict"},
+		{"bad merge", "onConflict=email&merge=yes", nil, "invalid merge value"},
+		{"unknown column", "onConflict=nope", nil, "unknown column"},
+		{"not unique", "onConflict=name", nil, "must match the primary key or a unique index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/collections/users?"+tt.query, nil)
+			got, err := parseOnConflict(tbl, r)
+			if tt.wantErr != "" {
+				testutil.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			testutil.NoError(t, err)
+			if tt.want == nil {
+				testutil.True(t, got == nil, "expected no conflict clause")
+				return
+			}
+			testutil.NotNil(t, got)
+			testutil.Equal(t, got.merge, tt.want.merge)
+			testutil.SliceLen(t, got.columns, len(tt.want.columns))
+			testutil.Equal(t, got.columns[0], tt.want.columns[0])
+		})
+	}
+}
+
+func TestBuildUpsertDoNothing(t *testing.T) {
+	tbl := upsertTestTable()
+	rows := []map[string]any{{"email": "a@example.com", "name": "Ann"}}
+
+	q, args := buildUpsert(tbl, rows, &onConflict{columns: []string{"email"}})
+	testutil.Equal(t, q, `INSERT INTO "public"."users" ("name", "email") VALUES ($1, $2) `+
+		`ON CONFLICT ("email") DO NOTHING RETURNING *, (xmax = 0) AS "_ayb_inserted"`)
+	testutil.SliceLen(t, args, 2)
+}
+
+func TestBuildUpsertMerge(t *testing.T) {
+	tbl := upsertTestTable()
+	rows := []map[string]any{
+		{"email": "a@example.com", "name": "Ann"},
+		{"email": "b@example.com", "age": 40},
+	}
+
+	q, args := buildUpsert(tbl, rows, &onConflict{columns: []string{"email"}, merge: true})
+	testutil.Contains(t, q, `VALUES ($1, $2, DEFAULT), (DEFAULT, $3, $4)`)
+	testutil.Contains(t, q, `ON CONFLICT ("email") DO UPDATE SET "name" = EXCLUDED."name", "age" = EXCLUDED."age"`)
+	testutil.SliceLen(t, args, 4)
+}
+
+func TestBuildUpsertMergeOnlyConflictColumns(t *testing.T) {
+	tbl := upsertTestTable()
+	rows := []map[string]any{{"email": "a@example.com"}}
+
+	q, _ := buildUpsert(tbl, rows, &onConflict{columns: []string{"email"}, merge: true})
+	testutil.Contains(t, q, `DO UPDATE SET "email" = EXCLUDED."email"`)
+}
+
+func TestCreateUpsertValidation(t *testing.T) {
+	h := testHandler(testSchema())
+
+	w := doRequest(h, "POST", "/collections/users?onConflict=name", `{"email":"a"}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "unique index")
+
+	w = doRequest(h, "POST", "/collections/users?merge=true", `{"email":"a"}`)
+	testutil.Equal(t, http.StatusBadRequest, w.Code)
+	testutil.Contains(t, decodeError(t, w).Message, "merge requires onConflict")
+}
+
+func TestDuplicateConflictKey(t *testing.T) {
+	merge := &onConflict{columns: []string{"email"}, merge: true}
+	rows := []map[string]any{
+		{"email": "a@x.io", "name": "A"},
+		{"email": nil, "name": "B"},
+		{"name": "C"},
+		{"email": nil, "name": "D"},
+		{"email": "a@x.io", "name": "E"},
+	}
+	i, j, ok := duplicateConflictKey(rows, merge)
+	testutil.True(t, ok, "expected a duplicate")
+	testutil.Equal(t, i, 0)
+	testutil.Equal(t, j, 4)
+
+	_, _, ok = duplicateConflictKey(rows[:4], merge)
+	testutil.False(t, ok, "null keys never conflict")
+	_, _, ok = duplicateConflictKey(rows, &onConflict{columns: []string{"email"}})
+	testutil.False(t, ok, "DO NOTHING skips repeats")
+
+	pair := &onConflict{columns: []string{"id", "email"}, merge: true}
+	_, _, ok = duplicateConflictKey([]map[string]any{{"id": float64(1), "email": "a"}, {"id": "1", "email": "b"}}, pair)
+	testutil.False(t, ok, "keys differ in one column")
+	_, _, ok = duplicateConflictKey([]map[string]any{{"id": float64(1), "email": "a"}, {"id": "1", "email": "a"}}, pair)
+	testutil.True(t, ok, "keys are compared as the values Postgres reads")
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/allyourbase/ayb/internal/httputil"
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// Field error codes reported by body validation.
+const (
+	fieldRequired      = "required"
+	fieldNotNull       = "not_null"
+	fieldInvalidType   = "invalid_type"
+	fieldInvalidFormat = "invalid_format"
+	fieldInvalidEnum   = "invalid_enum"
+	fieldOutOfRange    = "out_of_range"
+	fieldTooLong       = "too_long"
+	fieldUnknown       = "unknown_field"
+)
+
+// fieldErrors collects validation errors by field, in the shape of the data of
+// an error response: {"field": {"code": ..., "message": ...}}.
+type fieldErrors map[string]any
+
+func (fe fieldErrors) add(field, code, message string) {
+	if _, ok := fe[field]; !ok {
+		fe[field] = map[string]string{"code": code, "message": message}
+	}
+}
+
+// writeValidationError responds with every field error at once.
+func writeValidationError(w http.ResponseWriter, errs fieldErrors) {
+	writeJSON(w, http.StatusBadRequest, httputil.ErrorResponse{
+		Code:    http.StatusBadRequest,
+		Message: "validation failed",
+		Data:    errs,
+	})
+}
+
+// strictBody reports whether the request asks for unknown keys in the body to
+// be rejected rather than ignored.
+func strictBody(r *http.Request) bool {
+	return r.URL.Query().Get("strict") == "true"
+}
+
+// validateBody checks a record body against tbl's columns before it reaches
+// the database, adding an error to errs for each field that is wrong. Field
+// names are prefixed with prefix, which identifies the row of a bulk request.
+//
+// Values are checked against their column's type. Inserts must also set every
+// column that is not nullable and has no default. Columns the request may not
+// write are ignored, as the query builders leave them out; keys that are not
+// columns are ignored too, unless strict is set.
+func validateBody(errs fieldErrors, prefix string, tbl *schema.Table, data map[string]any, insert, strict bool) {
+	for key, v := range data {
+		col := tbl.ColumnByName(key)
+		if col == nil {
+			if strict {
+				errs.add(prefix+key, fieldUnknown, "unknown field")
+			}
+			continue
+		}
+		if insert && !tbl.CanInsert(key) || !insert && !tbl.CanUpdate(key) {
+			continue
+		}
+		if code, msg := checkColumnValue(col, v); code != "" {
+			errs.add(prefix+key, code, msg)
+		}
+	}
+	if !insert {
+		return
+	}
+	for _, col := range tbl.Columns {
+		if col.IsNullable || col.HasDefault() || !tbl.CanInsert(col.Name) {
+			continue
+		}
+		if _, ok := data[col.Name]; !ok {
+			errs.add(prefix+col.Name, fieldRequired, "is required")
+		}
+	}
+}
+
+// checkColumnValue checks a decoded JSON value against a column. It returns
+// the error code and message, or "" if the value is acceptable.
+func checkColumnValue(col *schema.Column, v any) (code, message string) {
+	if v == nil {
+		if !col.IsNullable {
+			return fieldNotNull, "cannot be null"
+		}
+		return "", ""
+	}
+	if !isDecodedJSON(v) {
+		return "", ""
+	}
+	switch {
+	case col.IsJSON:
+		return "", ""
+	case col.IsArray:
+		return checkArray(strings.TrimSuffix(col.TypeName, "[]"), v)
+	case col.IsEnum:
+		s, ok := v.(string)
+		if len(col.EnumValues) > 0 && (!ok || !slices.Contains(col.EnumValues, s)) {
+			return fieldInvalidEnum, "must be one of: " + strings.Join(col.EnumValues, ", ")
+		}
+		return "", ""
+	}
+	jsonType := col.JSONType
+	if jsonType == "string" && schema.IsNumericString(col.TypeName) {
+		// Served as strings, but read from numbers too.
+		jsonType = schema.JSONTypeOf(col.TypeName)
+	}
+	return checkScalar(col.TypeName, jsonType, v)
+}
+
+// isDecodedJSON reports whether v is a value encoding/json decodes into any.
+// Anything else, such as a value a batch reference copied from an earlier
+// result, came from the database and is not checked.
+func isDecodedJSON(v any) bool {
+	switch v.(type) {
+	case bool, float64, json.Number, string, []any, map[string]any:
+		return true
+	}
+	return false
+}
+
+// checkArray checks an array value and each of its elements. Strings are
+// passed through as Postgres array literals.
+func checkArray(elemType string, v any) (code, message string) {
+	switch val := v.(type) {
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(val), "{") {
+			return fieldInvalidType, "must be an array"
+		}
+		return "", ""
+	case []any:
+		for i, e := range val {
+			if e == nil || !isDecodedJSON(e) {
+				continue
+			}
+			var code, msg string
+			if _, nested := e.([]any); nested {
+				code, msg = checkArray(elemType, e)
+			} else {
+				code, msg = checkScalar(elemType, schema.JSONTypeOf(elemType), e)
+			}
+			if code != "" {
+				return code, fmt.Sprintf("item %d %s", i, msg)
+			}
+		}
+		return "", ""
+	}
+	return fieldInvalidType, "must be an array"
+}
+
+// typeModifierPattern matches the modifiers in a type name from format_type(),
+// as in "character varying(255)" and "timestamp(3) with time zone".
+var typeModifierPattern = regexp.MustCompile(`\s*\(([\d,\s]+)\)`)
+
+// stringTypes are the built-in types whose values are sent as JSON strings.
+var stringTypes = map[string]bool{
+	"text": true, "citext": true, "name": true, "xml": true, "bytea": true,
+	"character varying": true, "varchar": true, "character": true, "char": true, "bpchar": true,
+	"uuid": true, "date": true, "interval": true,
+	"timestamp": true, "timestamp without time zone": true, "timestamp with time zone": true, "timestamptz": true,
+	"time": true, "time without time zone": true, "time with time zone": true, "timetz": true,
+	"inet": true, "cidr": true, "macaddr": true, "macaddr8": true,
+}
+
+// checkScalar checks a value against a type that is neither an array, JSON nor
+// an enum.
+func checkScalar(typeName, jsonType string, v any) (code, message string) {
+	base, modifier := baseType(typeName)
+
+	switch jsonType {
+	case "boolean":
+		return checkBoolean(v)
+	case "integer":
+		return checkInteger(base, v)
+	case "number":
+		return checkNumber(base, v)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		// Other types, such as domains and composite types, are left to Postgres.
+		if stringTypes[base] {
+			return fieldInvalidType, "must be a string"
+		}
+		return "", ""
+	}
+	switch base {
+	case "uuid":
+		if !uuidPattern.MatchString(strings.TrimSpace(s)) {
+			return fieldInvalidFormat, "must be a UUID"
+		}
+	case "date", "timestamp", "timestamp without time zone", "timestamp with time zone", "timestamptz":
+		if !isTimestamp(s) {
+			if base == "date" {
+				return fieldInvalidFormat, "must be an ISO 8601 date"
+			}
+			return fieldInvalidFormat, "must be an ISO 8601 timestamp"
+		}
+	case "time", "time without time zone", "time with time zone", "timetz":
+		if !isTime(s) {
+			return fieldInvalidFormat, "must be an ISO 8601 time"
+		}
+	case "character varying", "varchar", "character", "char", "bpchar":
+		if n, err := strconv.Atoi(modifier); err == nil && utf8.RuneCountInString(s) > n {
+			return fieldTooLong, fmt.Sprintf("must be at most %d characters", n)
+		}
+	}
+	return "", ""
+}
+
+// checkBoolean accepts booleans and the strings Postgres reads as booleans.
+func checkBoolean(v any) (code, message string) {
+	switch val := v.(type) {
+	case bool:
+		return "", ""
+	case string:
+		switch strings.ToLower(strings.TrimSpace(val)) {
+		case "true", "false", "t", "f", "yes", "no", "y", "n", "on", "off", "1", "0":
+			return "", ""
+		}
+	}
+	return fieldInvalidType, "must be a boolean"
+}
+
+// checkInteger accepts whole numbers, as numbers or numeric strings, that fit
+// the integer type.
+func checkInteger(base string, v any) (code, message string) {
+	lo, hi := int64(math.MinInt32), int64(math.MaxInt32)
+	switch base {
+	case "smallint", "int2", "smallserial", "serial2":
+		lo, hi = math.MinInt16, math.MaxInt16
+	case "bigint", "int8", "bigserial", "serial8":
+		lo, hi = math.MinInt64, math.MaxInt64
+	case "oid":
+		lo, hi = 0, math.MaxUint32
+	}
+	outOfRange := fmt.Sprintf("must be between %d and %d", lo, hi)
+
+	var text string
+	switch val := v.(type) {
+	case float64:
+		if val != math.Trunc(val) || math.IsInf(val, 0) {
+			return fieldInvalidType, "must be an integer"
+		}
+		// float64(math.MaxInt64) rounds up to 2^63, which is out of range.
+		if val < float64(lo) || val >= float64(hi)+1 {
+			return fieldOutOfRange, outOfRange
+		}
+		return "", ""
+	case json.Number:
+		// Numbers decoded exactly may still be written as 1.0 or 1e3.
+		r, ok := new(big.Rat).SetString(val.String())
+		if !ok || !r.IsInt() {
+			return fieldInvalidType, "must be an integer"
+		}
+		if r.Num().Cmp(big.NewInt(lo)) < 0 || r.Num().Cmp(big.NewInt(hi)) > 0 {
+			return fieldOutOfRange, outOfRange
+		}
+		return "", ""
+	case string:
+		text = strings.TrimSpace(val)
+	default:
+		return fieldInvalidType, "must be an integer"
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil && !isRangeError(err) {
+		return fieldInvalidType, "must be an integer"
+	}
+	if err != nil || n < lo || n > hi {
+		return fieldOutOfRange, outOfRange
+	}
+	return "", ""
+}
+
+// checkNumber accepts numbers and numeric strings, including NaN and Infinity.
+// Money also takes strings with currency symbols, which are left to Postgres.
+func checkNumber(base string, v any) (code, message string) {
+	switch val := v.(type) {
+	case float64, json.Number:
+		return "", ""
+	case string:
+		if base == "money" {
+			return "", ""
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil || isRangeError(err) {
+			return "", ""
+		}
+	}
+	return fieldInvalidType, "must be a number"
+}
+
+// isRangeError reports whether a strconv error is for a well-formed number
+// that does not fit.
+func isRangeError(err error) bool {
+	return errors.Is(err, strconv.ErrRange)
+}
+
+// uuidPattern matches the UUID spellings Postgres accepts most commonly:
+// 32 hex digits, optionally hyphenated in the standard groups and in braces.
+var uuidPattern = regexp.MustCompile(`^\{?[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}\}?$`)
+
+// specialTimeValues are the date and time keywords Postgres accepts as input.
+var specialTimeValues = map[string]bool{
+	"infinity": true, "-infinity": true, "epoch": true,
+	"now": true, "today": true, "tomorrow": true, "yesterday": true, "allballs": true,
+}
+
+// timestampLayouts are the ISO 8601 forms accepted for dates and timestamps.
+// Fractional seconds are accepted after the seconds field of any of them.
+var timestampLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05-07",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+}
+
+var timeLayouts = []string{
+	"15:04:05Z07:00",
+	"15:04:05-0700",
+	"15:04:05-07",
+	"15:04:05",
+	"15:04Z07:00",
+	"15:04",
+}
+
+func isTimestamp(s string) bool {
+	s = strings.TrimSpace(s)
+	if specialTimeValues[strings.ToLower(s)] {
+		return true
+	}
+	// Postgres, and its output, separate the date and time with a space.
+	if len(s) > 10 && s[10] == ' ' {
+		s = s[:10] + "T" + s[11:]
+	}
+	return parsesAs(s, timestampLayouts)
+}
+
+func isTime(s string) bool {
+	s = strings.TrimSpace(s)
+	return specialTimeValues[strings.ToLower(s)] || parsesAs(s, timeLayouts)
+}
+
+func parsesAs(s string, layouts []string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
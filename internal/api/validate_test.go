@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestCheckColumnValue(t *testing.T) {
+	col := func(typeName string) *schema.Column {
+		return &schema.Column{Name: "c", TypeName: typeName, JSONType: schema.JSONTypeOf(typeName), IsArray: len(typeName) > 2 && typeName[len(typeName)-2:] == "[]"}
+	}
+	status := &schema.Column{Name: "status", TypeName: "status", IsEnum: true, JSONType: "string", EnumValues: []string{"draft", "published"}}
+	notNull := &schema.Column{Name: "title", TypeName: "text", JSONType: "string"}
+	nullable := &schema.Column{Name: "body", TypeName: "text", JSONType: "string", IsNullable: true}
+	meta := &schema.Column{Name: "meta", TypeName: "jsonb", JSONType: "object", IsJSON: true}
+	idString := &schema.Column{Name: "id", TypeName: "bigint", JSONType: "string"} // numeric strings
+
+	tests := []struct {
+		name  string
+		col   *schema.Column
+		value any
+		code  string
+	}{
+		{"uuid", col("uuid"), "5f0c6a3e-8a7b-4d9e-9c1f-2b3a4c5d6e7f", ""},
+		{"uuid without hyphens", col("uuid"), "5f0c6a3e8a7b4d9e9c1f2b3a4c5d6e7f", ""},
+		{"bad uuid", col("uuid"), "5f0c6a3e-8a7b", fieldInvalidFormat},
+		{"uuid number", col("uuid"), float64(5), fieldInvalidType},
+		{"timestamptz", col("timestamp with time zone"), "2024-05-01T10:30:00.123Z", ""},
+		{"timestamp with space", col("timestamp(3) without time zone"), "2024-05-01 10:30:00", ""},
+		{"timestamp offset", col("timestamp with time zone"), "2024-05-01 10:30:00+02", ""},
+		{"timestamp keyword", col("timestamp with time zone"), "now", ""},
+		{"bad timestamp", col("timestamp with time zone"), "May 1st", fieldInvalidFormat},
+		{"date", col("date"), "2024-05-01", ""},
+		{"bad date", col("date"), "2024-13-01", fieldInvalidFormat},
+		{"time", col("time without time zone"), "10:30", ""},
+		{"bad time", col("time without time zone"), "10h30", fieldInvalidFormat},
+		{"integer", col("integer"), float64(42), ""},
+		{"integer string", col("integer"), "42", ""},
+		{"fraction", col("integer"), 4.2, fieldInvalidType},
+		{"integer text", col("integer"), "forty-two", fieldInvalidType},
+		{"smallint range", col("smallint"), float64(40000), fieldOutOfRange},
+		{"integer range", col("integer"), "3000000000", fieldOutOfRange},
+		{"bigint range", col("bigint"), "9223372036854775808", fieldOutOfRange},
+		{"bigint", col("bigint"), "9223372036854775807", ""},
+		{"exact bigint", col("bigint"), json.Number("9007199254740993"), ""},
+		{"exact integer exponent", col("integer"), json.Number("1e3"), ""},
+		{"exact fraction", col("integer"), json.Number("1.5"), fieldInvalidType},
+		{"exact bigint range", col("bigint"), json.Number("9223372036854775808"), fieldOutOfRange},
+		{"bigint as string", idString, "9007199254740993", ""},
+		{"bigint as string number", idString, json.Number("42"), ""},
+		{"bigint as string text", idString, "forty-two", fieldInvalidType},
+		{"numeric", col("numeric(10,2)"), 1.5, ""},
+		{"numeric string", col("numeric(10,2)"), "12345678901234567890.5", ""},
+		{"numeric bool", col("numeric"), true, fieldInvalidType},
+		{"boolean", col("boolean"), false, ""},
+		{"boolean string", col("boolean"), "yes", ""},
+		{"bad boolean", col("boolean"), "maybe", fieldInvalidType},
+		{"varchar", col("character varying(5)"), "héllo", ""},
+		{"varchar too long", col("character varying(5)"), "hello!", fieldTooLong},
+		{"text object", col("text"), map[string]any{}, fieldInvalidType},
+		{"domain", col("positive_int"), float64(1), ""},
+		{"enum", status, "draft", ""},
+		{"bad enum", status, "deleted", fieldInvalidEnum},
+		{"array", col("integer[]"), []any{float64(1), nil, float64(3)}, ""},
+		{"nested array", col("integer[]"), []any{[]any{float64(1)}, []any{"x"}}, fieldInvalidType},
+		{"array literal", col("text[]"), "{a,b}", ""},
+		{"array element", col("uuid[]"), []any{"nope"}, fieldInvalidFormat},
+		{"not an array", col("text[]"), "a", fieldInvalidType},
+		{"json", meta, []any{"anything"}, ""},
+		{"null", notNull, nil, fieldNotNull},
+		{"nullable null", nullable, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, msg := checkColumnValue(tt.col, tt.value)
+			testutil.Equal(t, code, tt.code)
+			testutil.Equal(t, msg == "", tt.code == "")
+		})
+	}
+}
+
+func TestValidateBodyRequired(t *testing.T) {
+	tbl := &schema.Table{
+		Name: "posts",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", JSONType: "integer", IsIdentity: true},
+			{Name: "title", TypeName: "text", JSONType: "string"},
+			{Name: "status", TypeName: "text", JSONType: "string", DefaultExpr: "'draft'::text"},
+			{Name: "body", TypeName: "text", JSONType: "string", IsNullable: true},
+		},
+	}
+
+	errs := fieldErrors{}
+	validateBody(errs, "", tbl, map[string]any{"body": "x"}, true, false)
+	testutil.MapLen(t, errs, 1)
+	testutil.Equal(t, errs["title"].(map[string]string)["code"], fieldRequired)
+
+	// Updates leave out whatever they don't change.
+	errs = fieldErrors{}
+	validateBody(errs, "", tbl, map[string]any{"body": "x"}, false, false)
+	testutil.MapLen(t, errs, 0)
+
+	errs = fieldErrors{}
+	validateBody(errs, "3.", tbl, map[string]any{"title": "x", "extra": 1}, true, true)
+	testutil.MapLen(t, errs, 1)
+	testutil.Equal(t, errs["3.extra"].(map[string]string)["code"], fieldUnknown)
+}
+
+func TestValidateBodySkipsReadOnlyColumns(t *testing.T) {
+	tbl := restrictedTable()
+
+	// age is read-only and email hidden for anon, so neither is checked.
+	errs := fieldErrors{}
+	validateBody(errs, "", tbl, map[string]any{"id": float64(1), "name": "Alice", "age": "old", "email": 1}, true, false)
+	testutil.MapLen(t, errs, 0)
+
+	errs = fieldErrors{}
+	validateBody(errs, "", tbl, map[string]any{"id": float64(1), "name": "Alice", "email": 1}, true, true)
+	testutil.Equal(t, errs["email"].(map[string]string)["code"], fieldUnknown)
+}
@@ -69,6 +69,21 @@ type Claims struct {
 	Email string `json:"email"`
 }
 
+// Roles of API requests, which scope column access: requests with valid
+// claims are authenticated, and all others are anonymous.
+const (
+	RoleAnon          = "anon"
+	RoleAuthenticated = "authenticated"
+)
+
+// RoleOf returns the role of a request made with claims, which may be nil.
+func RoleOf(claims *Claims) string {
+	if claims == nil {
+		return RoleAnon
+	}
+	return RoleAuthenticated
+}
+
 // NewService creates a new auth service.
 func NewService(pool *pgxpool.Pool, jwtSecret string, tokenDuration, refreshDuration time.Duration, logger *slog.Logger) *Service {
 	return &Service{
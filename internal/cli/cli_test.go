@@ -1,11 +1,16 @@
 package cli
 
 import (
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/allyourbase/ayb/internal/schema"
 	"github.com/pelletier/go-toml/v2"
 )
 
@@ -90,7 +95,7 @@ func TestConfigCommandProducesValidTOML(t *testing.T) {
 }
 
 func TestRootCommandRegistersSubcommands(t *testing.T) {
-	expected := []string{"start", "stop", "status", "config", "version", "migrate", "admin"}
+	expected := []string{"start", "stop", "status", "config", "version", "migrate", "admin", "import", "gen", "purge"}
 
 	commands := make(map[string]bool)
 	for _, cmd := range rootCmd.Commands() {
@@ -150,3 +155,167 @@ func TestHelpDoesNotError(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestImportFileFormat(t *testing.T) {
+	cases := map[string]string{
+		"posts.csv":    "csv",
+		"POSTS.CSV":    "csv",
+		"posts.ndjson": "ndjson",
+		"posts.jsonl":  "ndjson",
+		"posts.txt":    "",
+	}
+	for path, want := range cases {
+		if got := importFileFormat(path); got != want {
+			t.Errorf("importFileFormat(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestImportURL(t *testing.T) {
+	got, err := importURL("http://localhost:8090/", "posts", "csv", true, "slug", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "http://localhost:8090/api/collections/posts/import?dryRun=true&format=csv&merge=true&onConflict=slug"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if _, err := importURL("localhost:8090", "posts", "csv", false, "", false); err == nil {
+		t.Fatal("expected error for URL without scheme")
+	}
+}
+
+func TestImportCommandPostsFile(t *testing.T) {
+	var gotPath, gotQuery, gotType, gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotQuery, gotBody = r.URL.Path, r.URL.RawQuery, string(body)
+		gotType, gotAuth = r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"total":2,"inserted":2,"updated":0,"skipped":0}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "posts.csv")
+	if err := os.WriteFile(path, []byte("title\nA\nB\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	output := captureStdout(t, func() {
+		rootCmd.SetArgs([]string{"import", "posts", path, "--url", srv.URL, "--token", "secret"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	if gotPath != "/api/collections/posts/import" || gotQuery != "format=csv" {
+		t.Fatalf("unexpected request URL: %s?%s", gotPath, gotQuery)
+	}
+	if gotType != "text/csv" || gotAuth != "Bearer secret" {
+		t.Fatalf("unexpected headers: Content-Type %q, Authorization %q", gotType, gotAuth)
+	}
+	if gotBody != "title\nA\nB\n" {
+		t.Fatalf("unexpected body: %q", gotBody)
+	}
+	if !strings.Contains(output, "Imported 2 rows (2 inserted, 0 updated, 0 skipped)") {
+		t.Fatalf("unexpected output: %q", output)
+	}
+}
+
+func TestPrintImportResultErrors(t *testing.T) {
+	var out strings.Builder
+	body := `{"code":400,"message":"import failed: 2 errors","data":{"errors":[` +
+		`{"row":1,"column":"age","message":"invalid integer: \"x\""},{"row":3,"message":"wrong number of fields: expected 2, got 1"}]}}`
+	err := printImportResult(&out, http.StatusBadRequest, []byte(body))
+	if err == nil || err.Error() != "import failed: 2 errors" {
+		t.Fatalf("expected import failed error, got %v", err)
+	}
+	want := "row 1, column age: invalid integer: \"x\"\nrow 3: wrong number of fields: expected 2, got 1\n"
+	if out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestGenTypesFromServer(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"tables":{"public.posts":{"schema":"public","name":"posts","kind":"table","columns":[` +
+			`{"name":"id","type":"integer","nullable":false,"default":"nextval('posts_id_seq'::regclass)","jsonType":"integer"},` +
+			`{"name":"status","type":"post_status","nullable":false,"jsonType":"string","enumValues":["draft","published"]}]}},` +
+			`"functions":{},"schemas":["public"]}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for _, tt := range []struct{ lang, file, want string }{
+		{"ts", "db.ts", "export type Posts = {\n  id: number;\n  status: PostStatus;\n};"},
+		{"go", "db.go", "Status PostStatus `json:\"status\"`"},
+	} {
+		out := filepath.Join(dir, tt.file)
+		rootCmd.SetArgs([]string{"gen", "types", "--url", srv.URL, "--token", "secret", "--lang", tt.lang, "--package", "db", "--out", out})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gotPath != "/api/schema" || gotAuth != "Bearer secret" {
+			t.Fatalf("unexpected request: %s with Authorization %q", gotPath, gotAuth)
+		}
+		src, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("read output: %v", err)
+		}
+		if !strings.Contains(string(src), tt.want) {
+			t.Fatalf("expected %s output to contain %q, got:\n%s", tt.lang, tt.want, src)
+		}
+	}
+}
+
+func TestGenTypesRejectsUnknownLanguage(t *testing.T) {
+	rootCmd.SetArgs([]string{"gen", "types", "--lang", "rust"})
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), `invalid language "rust"`) {
+		t.Fatalf("expected invalid language error, got %v", err)
+	}
+}
+
+func purgeTestSchema() *schema.SchemaCache {
+	return &schema.SchemaCache{Tables: map[string]*schema.Table{
+		"public.posts":    {Schema: "public", Name: "posts", SoftDeleteColumn: "deleted_at"},
+		"public.comments": {Schema: "public", Name: "comments", SoftDeleteColumn: "removed_at"},
+		"public.tags":     {Schema: "public", Name: "tags"},
+	}}
+}
+
+func TestPurgeTables(t *testing.T) {
+	tables, err := purgeTables(purgeTestSchema(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 || tables[0].Name != "comments" || tables[1].Name != "posts" {
+		t.Fatalf("expected comments and posts, got %v", tables)
+	}
+
+	if _, err := purgeTables(purgeTestSchema(), []string{"tags"}); err == nil || !strings.Contains(err.Error(), "soft delete is not enabled for tags") {
+		t.Fatalf("expected soft delete error, got %v", err)
+	}
+	if _, err := purgeTables(purgeTestSchema(), []string{"nope"}); err == nil || !strings.Contains(err.Error(), "table not found") {
+		t.Fatalf("expected table not found, got %v", err)
+	}
+}
+
+func TestBuildPurge(t *testing.T) {
+	tbl := purgeTestSchema().Tables["public.posts"]
+
+	query, args := buildPurge(tbl, 0, false)
+	if query != `DELETE FROM "public"."posts" WHERE "deleted_at" IS NOT NULL` || len(args) != 0 {
+		t.Fatalf("unexpected purge: %s %v", query, args)
+	}
+
+	query, args = buildPurge(tbl, 30*24*time.Hour, true)
+	want := `SELECT count(*) FROM "public"."posts" WHERE "deleted_at" IS NOT NULL AND "deleted_at" <= now() - make_interval(secs => $1)`
+	if query != want || len(args) != 1 || args[0] != float64(2592000) {
+		t.Fatalf("unexpected dry run: %s %v", query, args)
+	}
+}
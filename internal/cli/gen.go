@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/typegen"
+	"github.com/spf13/cobra"
+)
+
+var genCmd = &cobra.Command{
+	Use:   "gen",
+	Short: "Generate code from the database schema",
+}
+
+var genTypesCmd = &cobra.Command{
+	Use:   "types",
+	Short: "Generate TypeScript or Go types for tables, enums and functions",
+	Long: `Generate type definitions from the database schema: a record type per table
+and view, Insert and Update types per table, a type per enum, and the
+arguments and results of every function served at /api/rpc.
+
+The schema is read from the database, like ayb migrate, or from a running
+server's /api/schema endpoint when --url is given.
+
+TypeScript types plug into the SDK's generics:
+  const posts = await ayb.records.list<Posts>("posts");
+
+Examples:
+  ayb gen types --out src/db.ts
+  ayb gen types --lang go --package models --out models/db.go
+  ayb gen types --url http://localhost:8090 --out src/db.ts`,
+	RunE: runGenTypes,
+}
+
+func init() {
+	genCmd.AddCommand(genTypesCmd)
+
+	genTypesCmd.Flags().String("config", "", "Path to ayb.toml config file")
+	genTypesCmd.Flags().String("database-url", "", "PostgreSQL connection URL (overrides config)")
+	genTypesCmd.Flags().String("url", "", "Read the schema from a running server instead of the database")
+	genTypesCmd.Flags().String("token", "", "Bearer token to authenticate with (default $AYB_TOKEN)")
+	genTypesCmd.Flags().String("lang", "typescript", "Output language: typescript (ts) or go")
+	genTypesCmd.Flags().String("package", "models", "Package name of generated Go code")
+	genTypesCmd.Flags().StringP("out", "o", "", "Output file (default stdout)")
+}
+
+func runGenTypes(cmd *cobra.Command, args []string) error {
+	lang, _ := cmd.Flags().GetString("lang")
+	switch lang {
+	case "typescript", "ts", "go":
+	default:
+		return fmt.Errorf("invalid language %q: must be typescript or go", lang)
+	}
+
+	var sc *schema.SchemaCache
+	var err error
+	if baseURL, _ := cmd.Flags().GetString("url"); baseURL != "" {
+		token, _ := cmd.Flags().GetString("token")
+		if token == "" {
+			token = os.Getenv("AYB_TOKEN")
+		}
+		sc, err = fetchSchema(cmd.Context(), baseURL, token)
+	} else {
+		sc, err = loadSchema(cmd)
+	}
+	if err != nil {
+		return err
+	}
+
+	var src []byte
+	if lang == "go" {
+		pkg, _ := cmd.Flags().GetString("package")
+		if src, err = typegen.Go(sc, pkg); err != nil {
+			return err
+		}
+	} else {
+		src = typegen.TypeScript(sc)
+	}
+
+	out, _ := cmd.Flags().GetString("out")
+	if out == "" {
+		_, err = cmd.OutOrStdout().Write(src)
+		return err
+	}
+	if err := os.WriteFile(out, src, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", out, err)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %s\n", out)
+	return nil
+}
+
+// loadSchema introspects the database configured for cmd.
+func loadSchema(cmd *cobra.Command) (*schema.SchemaCache, error) {
+	cfg, err := loadMigrateConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	pool, cleanup, err := connectForMigrate(cmd, cfg, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	sc, err := schema.BuildExposedCache(context.Background(), pool.DB(), schemaExposure(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("reading schema: %w", err)
+	}
+	return sc, nil
+}
+
+// fetchSchema reads the schema from a server's /api/schema endpoint.
+func fetchSchema(ctx context.Context, baseURL, token string) (*schema.SchemaCache, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL: %q", baseURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.JoinPath("api", "schema").String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("fetching schema: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var sc schema.SchemaCache
+	if err := json.NewDecoder(resp.Body).Decode(&sc); err != nil {
+		return nil, fmt.Errorf("decoding schema: %w", err)
+	}
+	return &sc, nil
+}
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <table> <file>",
+	Short: "Import rows from a CSV or NDJSON file",
+	Long: `Import rows into a table through a running AYB server. The file is sent to
+POST /api/collections/{table}/import, so row-level security applies and
+realtime events are published for the new rows. Either every row is imported
+or none is; failed rows are listed with their row number.
+
+CSV files need a header row naming the columns. The format is taken from the
+file extension (.csv, .ndjson, .jsonl) unless --format is given.
+
+Examples:
+  ayb import posts posts.csv
+  ayb import posts posts.csv --dry-run
+  ayb import users users.ndjson --on-conflict email --merge`,
+	Args: cobra.ExactArgs(2),
+	RunE: runImport,
+}
+
+func init() {
+	importCmd.Flags().String("config", "", "Path to ayb.toml config file")
+	importCmd.Flags().String("url", "", "Server URL (default from config, e.g. http://localhost:8090)")
+	importCmd.Flags().String("token", "", "Bearer token to authenticate with (default $AYB_TOKEN)")
+	importCmd.Flags().String("format", "", "File format: csv or ndjson (default from file extension)")
+	importCmd.Flags().Bool("dry-run", false, "Validate and roll back without writing")
+	importCmd.Flags().String("on-conflict", "", "Comma-separated unique columns to upsert on")
+	importCmd.Flags().Bool("merge", false, "Update existing rows on conflict instead of skipping them")
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	table, path := args[0], args[1]
+
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = importFileFormat(path)
+		if format == "" {
+			return fmt.Errorf("cannot tell the format of %s: use --format csv or --format ndjson", path)
+		}
+	}
+	contentType := "text/csv"
+	switch format {
+	case "csv":
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		return fmt.Errorf("invalid format %q: must be csv or ndjson", format)
+	}
+
+	baseURL, _ := cmd.Flags().GetString("url")
+	if baseURL == "" {
+		cfg, err := loadMigrateConfig(cmd)
+		if err != nil {
+			return err
+		}
+		baseURL = serverURL(cfg)
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	onConflict, _ := cmd.Flags().GetString("on-conflict")
+	merge, _ := cmd.Flags().GetBool("merge")
+	target, err := importURL(baseURL, table, format, dryRun, onConflict, merge)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(cmd.Context(), http.MethodPost, target, f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	token, _ := cmd.Flags().GetString("token")
+	if token == "" {
+		token = os.Getenv("AYB_TOKEN")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending import: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	return printImportResult(cmd.OutOrStdout(), resp.StatusCode, body)
+}
+
+// importFileFormat guesses the import format from a file extension.
+func importFileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	}
+	return ""
+}
+
+// serverURL returns the URL of the server described by cfg, using localhost
+// when it listens on all interfaces.
+func serverURL(cfg *config.Config) string {
+	host := cfg.Server.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + host + ":" + strconv.Itoa(cfg.Server.Port)
+}
+
+// importURL builds the import endpoint URL for a table.
+func importURL(baseURL, table, format string, dryRun bool, onConflict string, merge bool) (string, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid server URL: %q", baseURL)
+	}
+	u = u.JoinPath("api", "collections", table, "import")
+
+	q := url.Values{}
+	q.Set("format", format)
+	if dryRun {
+		q.Set("dryRun", "true")
+	}
+	if onConflict != "" {
+		q.Set("onConflict", onConflict)
+	}
+	if merge {
+		q.Set("merge", "true")
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// printImportResult prints the server's import report, or its errors.
+func printImportResult(w io.Writer, status int, body []byte) error {
+	if status == http.StatusOK {
+		var res struct {
+			Total    int  `json:"total"`
+			Inserted int  `json:"inserted"`
+			Updated  int  `json:"updated"`
+			Skipped  int  `json:"skipped"`
+			DryRun   bool `json:"dryRun"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return fmt.Errorf("unexpected response: %s", strings.TrimSpace(string(body)))
+		}
+		prefix := "Imported"
+		if res.DryRun {
+			prefix = "Dry run: would import"
+		}
+		fmt.Fprintf(w, "%s %d rows (%d inserted, %d updated, %d skipped)\n",
+			prefix, res.Total, res.Inserted, res.Updated, res.Skipped)
+		return nil
+	}
+
+	var res struct {
+		Message string `json:"message"`
+		Data    struct {
+			Errors []struct {
+				Row     int    `json:"row"`
+				Column  string `json:"column"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Message == "" {
+		return fmt.Errorf("import failed: HTTP %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	for _, e := range res.Data.Errors {
+		if e.Column != "" {
+			fmt.Fprintf(w, "row %d, column %s: %s\n", e.Row, e.Column, e.Message)
+		} else {
+			fmt.Fprintf(w, "row %d: %s\n", e.Row, e.Message)
+		}
+	}
+	return fmt.Errorf("%s", res.Message)
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/cobra"
+)
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge [table...]",
+	Short: "Permanently delete soft-deleted records",
+	Long: `Permanently delete the records that API deletes have soft-deleted, in the
+given tables or in every table in soft-delete mode. Purged records can no
+longer be restored, and no realtime events are published for them.
+
+Examples:
+  ayb purge
+  ayb purge posts comments --older-than 720h
+  ayb purge posts --dry-run`,
+	RunE: runPurge,
+}
+
+func init() {
+	purgeCmd.Flags().String("config", "", "Path to ayb.toml config file")
+	purgeCmd.Flags().String("database-url", "", "PostgreSQL connection URL (overrides config)")
+	purgeCmd.Flags().Duration("older-than", 0, "Only purge records deleted at least this long ago, e.g. 720h")
+	purgeCmd.Flags().Bool("dry-run", false, "Count the records that would be purged without deleting them")
+}
+
+func runPurge(cmd *cobra.Command, args []string) error {
+	olderThan, _ := cmd.Flags().GetDuration("older-than")
+	if olderThan < 0 {
+		return fmt.Errorf("invalid --older-than %s: must not be negative", olderThan)
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	cfg, err := loadMigrateConfig(cmd)
+	if err != nil {
+		return err
+	}
+	pool, cleanup, err := connectForMigrate(cmd, cfg, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	sc, err := schema.BuildCache(ctx, pool.DB())
+	if err != nil {
+		return fmt.Errorf("reading schema: %w", err)
+	}
+	tables, err := purgeTables(sc, args)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "No tables are in soft-delete mode.")
+		return nil
+	}
+
+	verb := "Purged"
+	if dryRun {
+		verb = "Would purge"
+	}
+	for _, tbl := range tables {
+		query, queryArgs := buildPurge(tbl, olderThan, dryRun)
+		var n int64
+		if dryRun {
+			err = pool.DB().QueryRow(ctx, query, queryArgs...).Scan(&n)
+		} else {
+			tag, execErr := pool.DB().Exec(ctx, query, queryArgs...)
+			n, err = tag.RowsAffected(), execErr
+		}
+		if err != nil {
+			return fmt.Errorf("purging %s: %w", tbl.Name, err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %d records from %s\n", verb, n, tbl.Name)
+	}
+	return nil
+}
+
+// purgeTables returns the soft-delete tables named, or all of them if none
+// is, sorted by name.
+func purgeTables(sc *schema.SchemaCache, names []string) ([]*schema.Table, error) {
+	var tables []*schema.Table
+	if len(names) == 0 {
+		for _, tbl := range sc.TableList() {
+			if tbl.SoftDeleteColumn != "" {
+				tables = append(tables, tbl)
+			}
+		}
+	}
+	for _, name := range names {
+		tbl := sc.TableByName(name)
+		if tbl == nil {
+			return nil, fmt.Errorf("table not found: %s", name)
+		}
+		if tbl.SoftDeleteColumn == "" {
+			return nil, fmt.Errorf("soft delete is not enabled for %s", name)
+		}
+		tables = append(tables, tbl)
+	}
+	slices.SortFunc(tables, func(a, b *schema.Table) int {
+		return strings.Compare(a.Schema+"."+a.Name, b.Schema+"."+b.Name)
+	})
+	return tables, nil
+}
+
+// buildPurge builds the statement that deletes a table's soft-deleted records,
+// or counts them when dryRun is set. A positive olderThan keeps records
+// deleted more recently.
+func buildPurge(tbl *schema.Table, olderThan time.Duration, dryRun bool) (string, []any) {
+	col := pgx.Identifier{tbl.SoftDeleteColumn}.Sanitize()
+	where := col + " IS NOT NULL"
+	var args []any
+	if olderThan > 0 {
+		where += " AND " + col + " <= now() - make_interval(secs => $1)"
+		args = append(args, olderThan.Seconds())
+	}
+	ref := pgx.Identifier{tbl.Schema, tbl.Name}.Sanitize()
+	if dryRun {
+		return "SELECT count(*) FROM " + ref + " WHERE " + where, args
+	}
+	return "DELETE FROM " + ref + " WHERE " + where, args
+}
@@ -39,6 +39,9 @@ func init() {
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(migrateCmd)
 	rootCmd.AddCommand(adminCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(genCmd)
+	rootCmd.AddCommand(purgeCmd)
 }
 
 // Execute runs the root command.
@@ -144,6 +144,7 @@ func runStart(cmd *cobra.Command, args []string) error {
 
 	// Initialize schema cache and start watcher.
 	schemaCache := schema.NewCacheHolder(pool.DB(), logger)
+	schemaCache.SetExposure(schemaExposure(cfg))
 	watcher := schema.NewWatcher(schemaCache, pool.DB(), cfg.Database.URL, logger)
 
 	watcherCtx, watcherCancel := context.WithCancel(ctx)
@@ -257,6 +258,17 @@ func runStart(cmd *cobra.Command, args []string) error {
 	}
 }
 
+// schemaExposure returns the schemas and tables the API is configured to
+// serve, and how it serves numeric values.
+func schemaExposure(cfg *config.Config) schema.Exposure {
+	return schema.Exposure{
+		Schemas:        cfg.API.Schemas,
+		IncludeTables:  cfg.API.IncludeTables,
+		ExcludeTables:  cfg.API.ExcludeTables,
+		NumericStrings: cfg.API.NumericStrings,
+	}
+}
+
 func buildMailer(cfg *config.Config, logger *slog.Logger) mailer.Mailer {
 	switch cfg.Email.Backend {
 	case "smtp":
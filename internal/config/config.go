@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 type Config struct {
 	Server   ServerConfig   `toml:"server"`
 	Database DatabaseConfig `toml:"database"`
+	API      APIConfig      `toml:"api"`
 	Admin    AdminConfig    `toml:"admin"`
 	Auth     AuthConfig     `toml:"auth"`
 	Email    EmailConfig    `toml:"email"`
@@ -40,6 +42,20 @@ type DatabaseConfig struct {
 	MigrationsDir   string `toml:"migrations_dir"`
 }
 
+// APIConfig selects the schemas and tables the API serves. System schemas and
+// AYB's own _ayb_ tables are never served.
+type APIConfig struct {
+	// Schemas whose tables and functions are served; empty serves all of them.
+	Schemas []string `toml:"schemas"`
+	// IncludeTables, when set, serves only the tables matching one of these
+	// patterns: "table" or "schema.table", with * and ? wildcards.
+	IncludeTables []string `toml:"include_tables"`
+	// ExcludeTables hides the tables matching any of these patterns.
+	ExcludeTables []string `toml:"exclude_tables"`
+	// NumericStrings sends bigint, numeric and money values as JSON strings.
+	NumericStrings bool `toml:"numeric_strings"`
+}
+
 type AdminConfig struct {
 	Enabled  bool   `toml:"enabled"`
 	Path     string `toml:"path"`
@@ -196,6 +212,16 @@ func (c *Config) Validate() error {
 	if c.Database.URL == "" && (c.Database.EmbeddedPort < 1 || c.Database.EmbeddedPort > 65535) {
 		return fmt.Errorf("database.embedded_port must be between 1 and 65535, got %d", c.Database.EmbeddedPort)
 	}
+	for _, list := range []struct {
+		key      string
+		patterns []string
+	}{{"api.include_tables", c.API.IncludeTables}, {"api.exclude_tables", c.API.ExcludeTables}} {
+		for _, p := range list.patterns {
+			if _, err := path.Match(p, ""); err != nil || p == "" {
+				return fmt.Errorf("%s: invalid table pattern %q", list.key, p)
+			}
+		}
+	}
 	if c.Auth.Enabled && c.Auth.JWTSecret == "" {
 		return fmt.Errorf("auth.jwt_secret is required when auth is enabled")
 	}
@@ -325,6 +351,18 @@ func applyEnv(cfg *Config) error {
 	if v := os.Getenv("AYB_DATABASE_MIGRATIONS_DIR"); v != "" {
 		cfg.Database.MigrationsDir = v
 	}
+	if v := os.Getenv("AYB_API_SCHEMAS"); v != "" {
+		cfg.API.Schemas = strings.Split(v, ",")
+	}
+	if v := os.Getenv("AYB_API_INCLUDE_TABLES"); v != "" {
+		cfg.API.IncludeTables = strings.Split(v, ",")
+	}
+	if v := os.Getenv("AYB_API_EXCLUDE_TABLES"); v != "" {
+		cfg.API.ExcludeTables = strings.Split(v, ",")
+	}
+	if v := os.Getenv("AYB_API_NUMERIC_STRINGS"); v != "" {
+		cfg.API.NumericStrings = v == "true" || v == "1"
+	}
 	if v := os.Getenv("AYB_ADMIN_PASSWORD"); v != "" {
 		cfg.Admin.Password = v
 	}
@@ -511,6 +549,23 @@ migrations_dir = "./migrations"
 # Data directory for embedded PostgreSQL (default: ~/.ayb/data).
 # embedded_data_dir = ""
 
+[api]
+# Schemas whose tables and functions the API serves. Empty serves every
+# schema except the system ones.
+# schemas = ["public"]
+
+# Serve only the tables matching these patterns: "table" or "schema.table",
+# with * and ? wildcards. Tables in other schemas are reached as
+# /api/collections/{schema}.{table}.
+# include_tables = []
+
+# Hide the tables matching these patterns.
+# exclude_tables = ["internal.*", "*_archive"]
+
+# Send bigint, numeric and money values as JSON strings, so that clients
+# that read JSON numbers as doubles, like browsers, don't round them.
+# numeric_strings = false
+
 [admin]
 # Enable the admin dashboard.
 enabled = true
@@ -97,6 +97,20 @@ func TestValidate(t *testing.T) {
 			name:   "port 1 valid",
 			modify: func(c *Config) { c.Server.Port = 1 },
 		},
+		{
+			name:   "table patterns valid",
+			modify: func(c *Config) { c.API.ExcludeTables = []string{"internal.*", "*_archive"} },
+		},
+		{
+			name:    "table pattern malformed",
+			modify:  func(c *Config) { c.API.IncludeTables = []string{"posts["} },
+			wantErr: `api.include_tables: invalid table pattern "posts["`,
+		},
+		{
+			name:    "table pattern empty",
+			modify:  func(c *Config) { c.API.ExcludeTables = []string{""} },
+			wantErr: "api.exclude_tables: invalid table pattern",
+		},
 		{
 			name:   "port 65535 valid",
 			modify: func(c *Config) { c.Server.Port = 65535 },
@@ -740,3 +754,20 @@ func TestApplyEmailWebhookEnvVars(t *testing.T) {
 	testutil.Equal(t, cfg.Email.Webhook.Secret, "whsec_abc123")
 	testutil.Equal(t, cfg.Email.Webhook.Timeout, 30)
 }
+
+func TestApplyAPIEnvVars(t *testing.T) {
+	t.Setenv("AYB_API_SCHEMAS", "public,app")
+	t.Setenv("AYB_API_INCLUDE_TABLES", "posts,app.*")
+	t.Setenv("AYB_API_EXCLUDE_TABLES", "internal.*")
+	t.Setenv("AYB_API_NUMERIC_STRINGS", "true")
+
+	cfg := Default()
+	err := applyEnv(cfg)
+	testutil.NoError(t, err)
+
+	testutil.SliceLen(t, cfg.API.Schemas, 2)
+	testutil.Equal(t, cfg.API.Schemas[1], "app")
+	testutil.SliceLen(t, cfg.API.IncludeTables, 2)
+	testutil.Equal(t, cfg.API.ExcludeTables[0], "internal.*")
+	testutil.True(t, cfg.API.NumericStrings)
+}
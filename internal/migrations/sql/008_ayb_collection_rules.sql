@@ -0,0 +1,27 @@
+-- Per-collection access rules, written in the filter expression language.
+-- A NULL or empty rule leaves the action unrestricted.
+CREATE TABLE IF NOT EXISTS _ayb_collection_rules (
+    table_schema TEXT NOT NULL DEFAULT 'public',
+    table_name   TEXT NOT NULL,
+    list_rule    TEXT,
+    view_rule    TEXT,
+    create_rule  TEXT,
+    update_rule  TEXT,
+    delete_rule  TEXT,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (table_schema, table_name)
+);
+
+-- Rules are part of the schema cache, so changing them triggers a reload.
+CREATE OR REPLACE FUNCTION _ayb_rules_notify() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  NOTIFY ayb_schema_changed, 'rules';
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS _ayb_rules_changed ON _ayb_collection_rules;
+CREATE TRIGGER _ayb_rules_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON _ayb_collection_rules
+    FOR EACH STATEMENT EXECUTE FUNCTION _ayb_rules_notify();
@@ -0,0 +1,27 @@
+-- Per-column API access. A column can be hidden (never read or written
+-- through the API), read_only, or insert_only (written only on insert), for
+-- requests made as one role ('anon' or 'authenticated') or as any role ('*').
+-- An entry for a role overrides the entry for '*'.
+CREATE TABLE IF NOT EXISTS _ayb_column_access (
+    table_schema TEXT NOT NULL DEFAULT 'public',
+    table_name   TEXT NOT NULL,
+    column_name  TEXT NOT NULL,
+    role         TEXT NOT NULL DEFAULT '*' CHECK (role IN ('*', 'anon', 'authenticated')),
+    access       TEXT NOT NULL CHECK (access IN ('hidden', 'read_only', 'insert_only')),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (table_schema, table_name, column_name, role)
+);
+
+-- Column access is part of the schema cache, so changing it triggers a reload.
+CREATE OR REPLACE FUNCTION _ayb_column_access_notify() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  NOTIFY ayb_schema_changed, 'column_access';
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS _ayb_column_access_changed ON _ayb_column_access;
+CREATE TRIGGER _ayb_column_access_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON _ayb_column_access
+    FOR EACH STATEMENT EXECUTE FUNCTION _ayb_column_access_notify();
@@ -0,0 +1,25 @@
+-- Collections in soft-delete mode. API deletes set column_name to the time of
+-- the delete instead of removing the row, and reads leave such rows out until
+-- they are restored or purged.
+CREATE TABLE IF NOT EXISTS _ayb_soft_delete (
+    table_schema TEXT NOT NULL DEFAULT 'public',
+    table_name   TEXT NOT NULL,
+    column_name  TEXT NOT NULL DEFAULT 'deleted_at',
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (table_schema, table_name)
+);
+
+-- Soft-delete settings are part of the schema cache, so changing them
+-- triggers a reload.
+CREATE OR REPLACE FUNCTION _ayb_soft_delete_notify() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  NOTIFY ayb_schema_changed, 'soft_delete';
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS _ayb_soft_delete_changed ON _ayb_soft_delete;
+CREATE TRIGGER _ayb_soft_delete_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON _ayb_soft_delete
+    FOR EACH STATEMENT EXECUTE FUNCTION _ayb_soft_delete_notify();
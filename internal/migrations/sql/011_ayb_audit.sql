@@ -0,0 +1,100 @@
+-- Row change history. Each insert, update and delete on an audited table
+-- records the row before and after the change and the user the API made it
+-- as, whether the write came through the API or not.
+CREATE TABLE IF NOT EXISTS _ayb_audit (
+    id           BIGSERIAL PRIMARY KEY,
+    table_schema TEXT NOT NULL,
+    table_name   TEXT NOT NULL,
+    record_id    TEXT,
+    action       TEXT NOT NULL,
+    old_data     JSONB,
+    new_data     JSONB,
+    user_id      TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ayb_audit_record ON _ayb_audit (table_schema, table_name, record_id);
+CREATE INDEX IF NOT EXISTS idx_ayb_audit_user ON _ayb_audit (user_id);
+CREATE INDEX IF NOT EXISTS idx_ayb_audit_created ON _ayb_audit (created_at);
+
+-- Audited collections. Adding a row installs the audit trigger on the table
+-- and removing it drops the trigger; past entries are kept.
+CREATE TABLE IF NOT EXISTS _ayb_audit_tables (
+    table_schema TEXT NOT NULL DEFAULT 'public',
+    table_name   TEXT NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (table_schema, table_name)
+);
+
+-- Records one row change. The record id is the primary key as the API
+-- addresses it, with composite keys joined by commas. Soft deletes and
+-- restores are updates of the soft-delete column, recorded as "delete" and
+-- "restore". It runs as its owner so that API roles need no access to
+-- _ayb_audit.
+CREATE OR REPLACE FUNCTION _ayb_audit_record() RETURNS trigger
+LANGUAGE plpgsql SECURITY DEFINER SET search_path = pg_catalog, public AS $$
+DECLARE
+  old_row   JSONB;
+  new_row   JSONB;
+  record_id TEXT;
+  action    TEXT;
+  deleted   TEXT;
+BEGIN
+  IF TG_OP <> 'INSERT' THEN
+    old_row := to_jsonb(OLD);
+  END IF;
+  IF TG_OP <> 'DELETE' THEN
+    new_row := to_jsonb(NEW);
+  END IF;
+  IF old_row = new_row THEN
+    RETURN NULL;
+  END IF;
+
+  action := CASE TG_OP WHEN 'INSERT' THEN 'create' WHEN 'UPDATE' THEN 'update' ELSE 'delete' END;
+  IF TG_OP = 'UPDATE' THEN
+    SELECT column_name INTO deleted FROM _ayb_soft_delete
+    WHERE table_schema = TG_TABLE_SCHEMA AND table_name = TG_TABLE_NAME;
+    IF deleted IS NOT NULL AND old_row -> deleted = 'null' AND new_row -> deleted <> 'null' THEN
+      action := 'delete';
+    ELSIF deleted IS NOT NULL AND old_row -> deleted <> 'null' AND new_row -> deleted = 'null' THEN
+      action := 'restore';
+    END IF;
+  END IF;
+
+  SELECT string_agg(COALESCE(new_row, old_row) ->> a.attname, ',' ORDER BY k.ord) INTO record_id
+  FROM pg_index i
+    CROSS JOIN unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+    JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+  WHERE i.indrelid = TG_RELID AND i.indisprimary;
+
+  INSERT INTO _ayb_audit (table_schema, table_name, record_id, action, old_data, new_data, user_id)
+  VALUES (TG_TABLE_SCHEMA, TG_TABLE_NAME, record_id, action, old_row, new_row,
+          NULLIF(current_setting('ayb.user_id', true), ''));
+  RETURN NULL;
+END;
+$$;
+
+-- Installs and drops the audit triggers as _ayb_audit_tables changes, and
+-- reloads the schema cache, which records the audited tables.
+CREATE OR REPLACE FUNCTION _ayb_audit_tables_sync() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE')
+     AND to_regclass(format('%I.%I', OLD.table_schema, OLD.table_name)) IS NOT NULL THEN
+    EXECUTE format('DROP TRIGGER IF EXISTS _ayb_audit ON %I.%I', OLD.table_schema, OLD.table_name);
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') THEN
+    EXECUTE format(
+      'CREATE TRIGGER _ayb_audit AFTER INSERT OR UPDATE OR DELETE ON %I.%I
+         FOR EACH ROW EXECUTE FUNCTION _ayb_audit_record()',
+      NEW.table_schema, NEW.table_name);
+  END IF;
+  NOTIFY ayb_schema_changed, 'audit';
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS _ayb_audit_tables_changed ON _ayb_audit_tables;
+CREATE TRIGGER _ayb_audit_tables_changed
+    AFTER INSERT OR UPDATE OR DELETE ON _ayb_audit_tables
+    FOR EACH ROW EXECUTE FUNCTION _ayb_audit_tables_sync();
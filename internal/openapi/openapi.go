@@ -0,0 +1,389 @@
+// Package openapi generates an OpenAPI 3 description of the REST API from the
+// schema cache, so clients can be generated for it and it can be loaded into
+// API gateways.
+package openapi
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// Version is the OpenAPI version of generated documents.
+const Version = "3.0.3"
+
+// Options describes which optional parts of the API are enabled.
+type Options struct {
+	// Auth adds the auth endpoints and a bearer token requirement on
+	// collections, RPC and batch.
+	Auth bool
+	// OAuthProviders are the enabled OAuth provider names.
+	OAuthProviders []string
+	// Storage adds the file storage endpoints.
+	Storage bool
+}
+
+// Document is an OpenAPI 3 document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info is the document's metadata.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL the paths are relative to.
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Tag groups operations, one per collection and one per built-in area.
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations on a path.
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+// Operation is a single API operation.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+// SecurityRequirement names the security schemes an operation accepts.
+type SecurityRequirement map[string][]string
+
+// Parameter is a path, query or header parameter, or a reference to one.
+type Parameter struct {
+	Ref         string  `json:"$ref,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	In          string  `json:"in,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes an operation's request body.
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// MediaType is the schema of a body in one content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Response describes a response for one status code.
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Header describes a response header.
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Schema is a JSON schema, or a reference to a component schema.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Components holds the reusable parts of the document.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	Parameters      map[string]*Parameter      `json:"parameters,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how requests authenticate.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Build generates the OpenAPI document for the API served over sc.
+func Build(sc *schema.SchemaCache, opts Options) *Document {
+	b := &builder{
+		sc:   sc,
+		opts: opts,
+		doc: &Document{
+			OpenAPI: Version,
+			Info: Info{
+				Title:       "AYB API",
+				Description: "REST API generated from the database schema.",
+				Version:     "1.0.0",
+			},
+			Servers: []Server{{URL: "/api"}},
+			Paths:   map[string]*PathItem{},
+			Components: Components{
+				Schemas:    map[string]*Schema{},
+				Parameters: map[string]*Parameter{},
+			},
+		},
+	}
+
+	b.addShared()
+	for _, tbl := range collections(sc) {
+		b.addCollection(tbl)
+	}
+	for _, fn := range functions(sc) {
+		b.addFunction(fn)
+	}
+	b.addBuiltins()
+	if opts.Auth {
+		b.addAuth()
+	}
+	if opts.Storage {
+		b.addStorage()
+	}
+	return b.doc
+}
+
+type builder struct {
+	sc   *schema.SchemaCache
+	opts Options
+	doc  *Document
+}
+
+// collections returns the tables served at /collections/{name}, sorted by the
+// name they are served at. A table shadowed by a same-named table, in public
+// or an earlier schema, is served as {schema}.{table}.
+func collections(sc *schema.SchemaCache) []*schema.Table {
+	tables := sc.TableList()
+	sort.Slice(tables, func(i, j int) bool { return sc.CollectionName(tables[i]) < sc.CollectionName(tables[j]) })
+	return tables
+}
+
+// functions returns the functions served at /rpc/{name}, sorted like
+// collections.
+func functions(sc *schema.SchemaCache) []*schema.Function {
+	fns := make([]*schema.Function, 0, len(sc.Functions))
+	for _, fn := range sc.Functions {
+		fns = append(fns, fn)
+	}
+	sort.Slice(fns, func(i, j int) bool { return sc.FunctionName(fns[i]) < sc.FunctionName(fns[j]) })
+	return fns
+}
+
+var invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// componentName returns a valid component key for a table or type name.
+func componentName(name string) string {
+	return invalidComponentChars.ReplaceAllString(name, "_")
+}
+
+// pascalCase turns a snake_case name into PascalCase for operation IDs.
+func pascalCase(name string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '_' || r == '-' || r == ' ' || r == '.' {
+			upper = true
+			continue
+		}
+		if upper {
+			sb.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func ref(component string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + component}
+}
+
+func paramRef(name string) *Parameter {
+	return &Parameter{Ref: "#/components/parameters/" + name}
+}
+
+// columnSchema returns the schema of a column's values.
+func columnSchema(col *schema.Column) *Schema {
+	var s *Schema
+	switch {
+	case col.IsEnum:
+		s = &Schema{Type: "string"}
+		for _, v := range col.EnumValues {
+			s.Enum = append(s.Enum, v)
+		}
+	case col.IsJSON:
+		s = &Schema{}
+	default:
+		s = scalarSchema(col.JSONType, col.TypeName)
+	}
+	s.Description = col.Comment
+	if col.IsNullable {
+		s.Nullable = true
+		if s.Enum != nil {
+			s.Enum = append(s.Enum, nil)
+		}
+	}
+	return s
+}
+
+// scalarSchema returns the schema for a JSON type, with a format derived from
+// the Postgres type name where one applies.
+func scalarSchema(jsonType, typeName string) *Schema {
+	base := strings.ToLower(typeName)
+	if i := strings.Index(base, "("); i > 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+
+	switch jsonType {
+	case "array":
+		return &Schema{Type: "array", Items: scalarSchema(schema.JSONTypeOf(strings.TrimSuffix(typeName, "[]")), strings.TrimSuffix(typeName, "[]"))}
+	case "object":
+		return &Schema{}
+	case "integer":
+		s := &Schema{Type: "integer", Format: "int32"}
+		switch base {
+		case "bigint", "int8", "bigserial", "serial8":
+			s.Format = "int64"
+		}
+		return s
+	case "number":
+		s := &Schema{Type: "number"}
+		switch base {
+		case "real", "float4":
+			s.Format = "float"
+		case "double precision", "float8":
+			s.Format = "double"
+		}
+		return s
+	case "boolean":
+		return &Schema{Type: "boolean"}
+	}
+
+	s := &Schema{Type: "string"}
+	switch {
+	case base == "uuid":
+		s.Format = "uuid"
+	case base == "date":
+		s.Format = "date"
+	case strings.HasPrefix(base, "timestamp"):
+		s.Format = "date-time"
+	case base == "bytea":
+		s.Format = "byte"
+	}
+	return s
+}
+
+// typeSchema returns the schema for a type named outside a column, as for
+// function parameters and results: a collection's row type refers to its
+// record schema, and enums list their values.
+func (b *builder) typeSchema(typeName string) *Schema {
+	if elem, ok := strings.CutSuffix(typeName, "[]"); ok {
+		return &Schema{Type: "array", Items: b.typeSchema(elem)}
+	}
+	qualified := strings.ReplaceAll(typeName, `"`, "")
+	name := qualified
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	if tbl := b.sc.TableByName(qualified); tbl != nil && b.doc.Components.Schemas[componentName(b.sc.CollectionName(tbl))] != nil {
+		return ref(componentName(b.sc.CollectionName(tbl)))
+	}
+	for _, e := range b.sc.Enums {
+		if e.Name == name {
+			s := &Schema{Type: "string"}
+			for _, v := range e.Values {
+				s.Enum = append(s.Enum, v)
+			}
+			return s
+		}
+	}
+	if name == "record" {
+		return &Schema{Type: "object", AdditionalProperties: &Schema{}}
+	}
+	return scalarSchema(schema.JSONTypeOf(typeName), typeName)
+}
+
+func jsonContent(s *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: s}}
+}
+
+func jsonResponse(description string, s *Schema) *Response {
+	return &Response{Description: description, Content: jsonContent(s)}
+}
+
+func errorResponse(description string) *Response {
+	return jsonResponse(description, ref("Error"))
+}
+
+func jsonBody(description string, s *Schema) *RequestBody {
+	return &RequestBody{Description: description, Required: true, Content: jsonContent(s)}
+}
+
+// security returns the requirement for endpoints behind RequireAuth, or nil
+// when auth is disabled and they are open.
+func (b *builder) security() []SecurityRequirement {
+	if !b.opts.Auth {
+		return nil
+	}
+	return []SecurityRequirement{{"bearerAuth": {}}}
+}
+
+// optionalSecurity returns the requirement for endpoints behind OptionalAuth,
+// which accept a bearer token but do not need one.
+func (b *builder) optionalSecurity() []SecurityRequirement {
+	if !b.opts.Auth {
+		return nil
+	}
+	return []SecurityRequirement{{"bearerAuth": {}}, {}}
+}
+
+func (b *builder) addTag(name, description string) {
+	b.doc.Tags = append(b.doc.Tags, Tag{Name: name, Description: description})
+}
+
+func (b *builder) path(p string) *PathItem {
+	item := b.doc.Paths[p]
+	if item == nil {
+		item = &PathItem{}
+		b.doc.Paths[p] = item
+	}
+	return item
+}
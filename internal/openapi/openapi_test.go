@@ -0,0 +1,268 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func testSchema() *schema.SchemaCache {
+	authors := &schema.Table{
+		Schema: "public", Name: "authors", Kind: "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "bigint", JSONType: "integer", IsPrimaryKey: true, DefaultExpr: "nextval('authors_id_seq'::regclass)"},
+			{Name: "name", TypeName: "text", JSONType: "string"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	posts := &schema.Table{
+		Schema: "public", Name: "posts", Kind: "table", Comment: "Blog posts",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "uuid", JSONType: "string", IsPrimaryKey: true, DefaultExpr: "gen_random_uuid()"},
+			{Name: "title", TypeName: "text", JSONType: "string", Comment: "Headline"},
+			{Name: "status", TypeName: "post_status", JSONType: "string", IsEnum: true, IsNullable: true, EnumValues: []string{"draft", "published"}},
+			{Name: "tags", TypeName: "text[]", JSONType: "array", IsArray: true, IsNullable: true},
+			{Name: "meta", TypeName: "jsonb", JSONType: "object", IsJSON: true, IsNullable: true},
+			{Name: "score", TypeName: "double precision", JSONType: "number", IsNullable: true},
+			{Name: "created_at", TypeName: "timestamp with time zone", JSONType: "string", DefaultExpr: "now()"},
+			{Name: "author_id", TypeName: "bigint", JSONType: "integer", IsNullable: true},
+		},
+		PrimaryKey: []string{"id"},
+		Relationships: []*schema.Relationship{
+			{Type: "many-to-one", FromSchema: "public", FromTable: "posts", ToSchema: "public", ToTable: "authors", FieldName: "author"},
+		},
+		ComputedFields: []*schema.ComputedField{
+			{Name: "word_count", FunctionSchema: "public", TypeName: "integer", JSONType: "integer"},
+		},
+	}
+	authors.Relationships = []*schema.Relationship{
+		{Type: "one-to-many", FromSchema: "public", FromTable: "authors", ToSchema: "public", ToTable: "posts", FieldName: "posts"},
+	}
+	feed := &schema.Table{
+		Schema: "public", Name: "feed", Kind: "view",
+		Columns: []*schema.Column{{Name: "title", TypeName: "text", JSONType: "string"}},
+	}
+
+	return &schema.SchemaCache{
+		Tables: map[string]*schema.Table{
+			"public.authors": authors,
+			"public.posts":   posts,
+			"public.feed":    feed,
+		},
+		Functions: map[string]*schema.Function{
+			"public.recent_posts": {
+				Schema: "public", Name: "recent_posts", ReturnType: "posts", ReturnsSet: true,
+				Parameters: []*schema.FuncParam{{Name: "since", Type: "timestamp with time zone", Position: 1}},
+			},
+			"public.cleanup": {Schema: "public", Name: "cleanup", ReturnType: "void", IsVoid: true},
+			"public.add":     {Schema: "public", Name: "add", ReturnType: "integer", Parameters: []*schema.FuncParam{{Name: "a", Type: "integer", Position: 1}}},
+		},
+		Enums:   map[uint32]*schema.EnumType{1: {Schema: "public", Name: "post_status", Values: []string{"draft", "published"}}},
+		Schemas: []string{"public"},
+	}
+}
+
+func TestBuildCollectionPaths(t *testing.T) {
+	doc := Build(testSchema(), Options{})
+
+	posts := doc.Paths["/collections/posts"]
+	testutil.NotNil(t, posts)
+	testutil.Equal(t, posts.Get.OperationID, "listPosts")
+	testutil.Equal(t, posts.Post.OperationID, "createPosts")
+	testutil.NotNil(t, posts.Patch)
+	testutil.NotNil(t, posts.Delete)
+
+	item := doc.Paths["/collections/posts/{id}"]
+	testutil.NotNil(t, item)
+	testutil.NotNil(t, item.Get.Responses["304"])
+	testutil.NotNil(t, item.Patch.Responses["412"])
+	testutil.NotNil(t, doc.Paths["/collections/posts/import"])
+
+	// Views are read-only and have no primary key.
+	feed := doc.Paths["/collections/feed"]
+	testutil.NotNil(t, feed.Get)
+	testutil.True(t, feed.Post == nil, "views should not be writable")
+	testutil.True(t, doc.Paths["/collections/feed/{id}"] == nil, "no item path without a primary key")
+	testutil.True(t, doc.Paths["/collections/feed/import"] == nil, "views cannot be imported into")
+	testutil.NotNil(t, doc.Paths["/collections/feed/export"])
+}
+
+func TestBuildRecordSchema(t *testing.T) {
+	doc := Build(testSchema(), Options{})
+	posts := doc.Components.Schemas["posts"]
+	testutil.NotNil(t, posts)
+	testutil.Equal(t, posts.Description, "Blog posts")
+	testutil.SliceLen(t, posts.Required, 8)
+
+	id := posts.Properties["id"]
+	testutil.Equal(t, id.Type, "string")
+	testutil.Equal(t, id.Format, "uuid")
+
+	title := posts.Properties["title"]
+	testutil.Equal(t, title.Description, "Headline")
+	testutil.False(t, title.Nullable, "title is NOT NULL")
+
+	status := posts.Properties["status"]
+	testutil.True(t, status.Nullable, "status is nullable")
+	testutil.True(t, reflect.DeepEqual(status.Enum, []any{"draft", "published", nil}), "enum: %v", status.Enum)
+
+	tags := posts.Properties["tags"]
+	testutil.Equal(t, tags.Type, "array")
+	testutil.Equal(t, tags.Items.Type, "string")
+
+	testutil.Equal(t, posts.Properties["meta"].Type, "")
+	testutil.Equal(t, posts.Properties["score"].Format, "double")
+	testutil.Equal(t, posts.Properties["created_at"].Format, "date-time")
+	testutil.Equal(t, posts.Properties["author_id"].Format, "int64")
+
+	wc := posts.Properties["word_count"]
+	testutil.True(t, wc.ReadOnly, "computed fields are read-only")
+	testutil.Equal(t, wc.Type, "integer")
+
+	expand := posts.Properties["expand"]
+	testutil.Equal(t, expand.Properties["author"].Ref, "#/components/schemas/authors")
+	authorsExpand := doc.Components.Schemas["authors"].Properties["expand"]
+	testutil.Equal(t, authorsExpand.Properties["posts"].Items.Ref, "#/components/schemas/posts")
+}
+
+func TestBuildCreateSchemaRequired(t *testing.T) {
+	doc := Build(testSchema(), Options{})
+	create := doc.Components.Schemas["postsCreate"]
+	testutil.True(t, reflect.DeepEqual(create.Required, []string{"title"}), "required: %v", create.Required)
+	testutil.SliceLen(t, doc.Components.Schemas["postsUpdate"].Required, 0)
+	testutil.True(t, doc.Components.Schemas["feedCreate"] == nil, "views have no create schema")
+}
+
+func TestBuildSoftDelete(t *testing.T) {
+	sc := testSchema()
+	posts := sc.Tables["public.posts"]
+	posts.Columns = append(posts.Columns, &schema.Column{Name: "deleted_at", TypeName: "timestamp with time zone", JSONType: "string", IsNullable: true})
+	posts.SoftDeleteColumn = "deleted_at"
+	doc := Build(sc, Options{})
+
+	restore := doc.Paths["/collections/posts/{id}/restore"]
+	testutil.NotNil(t, restore)
+	testutil.Equal(t, restore.Post.OperationID, "restorePosts")
+	testutil.True(t, doc.Paths["/collections/authors/{id}/restore"] == nil, "authors are deleted for good")
+
+	params := doc.Paths["/collections/posts"].Get.Parameters
+	testutil.Equal(t, params[len(params)-1].Name, "withDeleted")
+
+	// Only deletes and restores set the soft-delete column.
+	testutil.True(t, doc.Components.Schemas["postsCreate"].Properties["deleted_at"] == nil, "deleted_at is not insertable")
+	testutil.True(t, doc.Components.Schemas["postsUpdate"].Properties["deleted_at"] == nil, "deleted_at is not updatable")
+}
+
+func TestBuildAudited(t *testing.T) {
+	sc := testSchema()
+	sc.Tables["public.posts"].Audited = true
+	doc := Build(sc, Options{})
+
+	history := doc.Paths["/collections/posts/{id}/history"]
+	testutil.NotNil(t, history)
+	testutil.Equal(t, history.Get.OperationID, "historyPosts")
+	testutil.Equal(t, history.Get.Responses["200"].Content["application/json"].Schema.Ref, "#/components/schemas/AuditList")
+	testutil.True(t, doc.Paths["/collections/authors/{id}/history"] == nil, "authors are not audited")
+}
+
+func TestBuildQualifiedCollections(t *testing.T) {
+	sc := testSchema()
+	sc.Tables["archive.posts"] = &schema.Table{
+		Schema: "archive", Name: "posts", Kind: "table", PrimaryKey: []string{"id"},
+		Columns: []*schema.Column{{Name: "id", TypeName: "integer", JSONType: "integer", IsPrimaryKey: true}},
+	}
+	doc := Build(sc, Options{})
+
+	// The public table keeps the unqualified path; the shadowed one is
+	// reached by its qualified name.
+	testutil.NotNil(t, doc.Paths["/collections/posts"])
+	archived := doc.Paths["/collections/archive.posts"]
+	testutil.NotNil(t, archived)
+	testutil.Equal(t, archived.Get.OperationID, "listArchivePosts")
+	testutil.NotNil(t, doc.Components.Schemas["archive.posts"])
+	testutil.NotNil(t, doc.Paths["/collections/archive.posts/{id}"])
+}
+
+func TestBuildFunctions(t *testing.T) {
+	doc := Build(testSchema(), Options{})
+
+	recent := doc.Paths["/rpc/recent_posts"].Post
+	testutil.Equal(t, recent.OperationID, "rpcRecentPosts")
+	since := recent.RequestBody.Content["application/json"].Schema.Properties["since"]
+	testutil.Equal(t, since.Format, "date-time")
+	result := recent.Responses["200"].Content["application/json"].Schema
+	testutil.Equal(t, result.Type, "array")
+	testutil.Equal(t, result.Items.Ref, "#/components/schemas/posts")
+
+	cleanup := doc.Paths["/rpc/cleanup"].Post
+	testutil.NotNil(t, cleanup.Responses["204"])
+	testutil.True(t, cleanup.RequestBody == nil, "no body for a function without parameters")
+
+	add := doc.Paths["/rpc/add"].Post
+	testutil.Equal(t, add.Responses["200"].Content["application/json"].Schema.Type, "integer")
+}
+
+func TestBuildOptions(t *testing.T) {
+	doc := Build(testSchema(), Options{})
+	testutil.True(t, doc.Components.SecuritySchemes == nil, "no security without auth")
+	testutil.SliceLen(t, doc.Paths["/collections/posts"].Get.Security, 0)
+	testutil.True(t, doc.Paths["/auth/login"] == nil, "no auth paths without auth")
+	testutil.True(t, doc.Paths["/storage/{bucket}"] == nil, "no storage paths without storage")
+
+	doc = Build(testSchema(), Options{Auth: true, OAuthProviders: []string{"google", "github"}, Storage: true})
+	testutil.Equal(t, doc.Components.SecuritySchemes["bearerAuth"].Scheme, "bearer")
+	testutil.SliceLen(t, doc.Paths["/collections/posts"].Get.Security, 1)
+	testutil.SliceLen(t, doc.Paths["/storage/{bucket}"].Post.Security, 2)
+	testutil.SliceLen(t, doc.Paths["/auth/login"].Post.Security, 0)
+	testutil.NotNil(t, doc.Paths["/auth/me"].Get)
+	provider := doc.Paths["/auth/oauth/{provider}"].Get.Parameters[0]
+	testutil.True(t, reflect.DeepEqual(provider.Schema.Enum, []any{"github", "google"}), "providers: %v", provider.Schema.Enum)
+}
+
+// TestBuildReferencesResolve checks that every $ref points at a component and
+// that operation IDs are unique.
+func TestBuildReferencesResolve(t *testing.T) {
+	doc := Build(testSchema(), Options{Auth: true, Storage: true})
+	b, err := json.Marshal(doc)
+	testutil.NoError(t, err)
+
+	var raw map[string]any
+	testutil.NoError(t, json.Unmarshal(b, &raw))
+	components := raw["components"].(map[string]any)
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if r, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(r, "#/components/"), "/")
+				testutil.SliceLen(t, parts, 2)
+				group, _ := components[parts[0]].(map[string]any)
+				testutil.True(t, group[parts[1]] != nil, "unresolved $ref %s", r)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(raw)
+
+	ids := map[string]bool{}
+	for _, item := range doc.Paths {
+		for _, op := range []*Operation{item.Get, item.Post, item.Patch, item.Delete} {
+			if op == nil {
+				continue
+			}
+			testutil.False(t, ids[op.OperationID], "duplicate operationId %s", op.OperationID)
+			ids[op.OperationID] = true
+		}
+	}
+}
@@ -0,0 +1,799 @@
+package openapi
+
+import (
+	"sort"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// addShared adds the components used across collections: the error envelope,
+// the list query parameters and the security scheme.
+func (b *builder) addShared() {
+	c := &b.doc.Components
+	c.Schemas["Error"] = &Schema{
+		Type:     "object",
+		Required: []string{"code", "message"},
+		Properties: map[string]*Schema{
+			"code":    {Type: "integer", Description: "HTTP status code."},
+			"message": {Type: "string"},
+			"data":    {Type: "object", AdditionalProperties: &Schema{}, Description: "Field-level detail, keyed by column."},
+		},
+	}
+	c.Schemas["BulkResult"] = &Schema{
+		Type:     "object",
+		Required: []string{"count"},
+		Properties: map[string]*Schema{
+			"count": {Type: "integer"},
+			"items": {Type: "array", Items: &Schema{Type: "object", AdditionalProperties: &Schema{}}},
+		},
+	}
+	row := &Schema{Type: "object", AdditionalProperties: &Schema{}, Nullable: true}
+	c.Schemas["AuditList"] = &Schema{
+		Type:     "object",
+		Required: []string{"page", "perPage", "totalItems", "totalPages", "items"},
+		Properties: map[string]*Schema{
+			"page":       {Type: "integer"},
+			"perPage":    {Type: "integer"},
+			"totalItems": {Type: "integer"},
+			"totalPages": {Type: "integer"},
+			"items": {Type: "array", Items: &Schema{
+				Type:     "object",
+				Required: []string{"id", "schema", "table", "action", "old", "new", "createdAt"},
+				Properties: map[string]*Schema{
+					"id":        {Type: "integer", Format: "int64"},
+					"schema":    {Type: "string"},
+					"table":     {Type: "string"},
+					"recordId":  {Type: "string", Description: "Primary key values, joined by commas."},
+					"action":    {Type: "string", Enum: []any{"create", "update", "delete", "restore"}},
+					"old":       row,
+					"new":       row,
+					"userId":    {Type: "string", Description: "The user the change was made as."},
+					"createdAt": {Type: "string", Format: "date-time"},
+				},
+			}},
+		},
+	}
+
+	str := func(name, description string) *Parameter {
+		return &Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: "string"}}
+	}
+	c.Parameters["filter"] = str("filter", "Filter expression, e.g. status='active' AND age>21. "+
+		"Dotted paths filter on related records, e.g. author.name='Ann'.")
+	c.Parameters["sort"] = str("sort", "Comma-separated fields to sort by; prefix with - for descending, e.g. -created_at,title.")
+	c.Parameters["fields"] = str("fields", "Comma-separated columns to return; * selects every column, and computed fields must be named.")
+	c.Parameters["expand"] = str("expand", "Comma-separated relations to embed under expand, "+
+		"with optional options, e.g. author,comments(sort=-created_at,limit=5).")
+	c.Parameters["page"] = &Parameter{Name: "page", In: "query", Description: "Page number.", Schema: &Schema{Type: "integer", Format: "int32"}}
+	c.Parameters["perPage"] = &Parameter{Name: "perPage", In: "query", Description: "Items per page (max 500).", Schema: &Schema{Type: "integer", Format: "int32"}}
+	c.Parameters["skipTotal"] = &Parameter{Name: "skipTotal", In: "query", Description: "Skip counting the total items.", Schema: &Schema{Type: "boolean"}}
+	c.Parameters["cursor"] = str("cursor", "Keyset pagination cursor from nextCursor or prevCursor; an empty value starts from the first page.")
+	c.Parameters["search"] = str("search", "Full-text search query.")
+	c.Parameters["searchFields"] = str("searchFields", "Comma-separated columns to search.")
+
+	if b.opts.Auth {
+		c.SecuritySchemes = map[string]*SecurityScheme{
+			"bearerAuth": {
+				Type:         "http",
+				Scheme:       "bearer",
+				BearerFormat: "JWT",
+				Description:  "Access token from /auth/login, /auth/register or /auth/refresh.",
+			},
+		}
+	}
+}
+
+// addCollection adds the component schemas and paths for one collection.
+// Views only get the read endpoints, and single-record endpoints need a
+// primary key.
+func (b *builder) addCollection(tbl *schema.Table) {
+	coll := b.sc.CollectionName(tbl)
+	name := componentName(coll)
+	op := pascalCase(coll)
+	tags := []string{coll}
+	writable := tbl.Kind == "table" || tbl.Kind == "partitioned_table"
+	b.addTag(coll, tbl.Comment)
+
+	record := &Schema{Type: "object", Description: tbl.Comment, Properties: map[string]*Schema{}}
+	for _, col := range tbl.Columns {
+		record.Properties[col.Name] = columnSchema(col)
+		record.Required = append(record.Required, col.Name)
+	}
+	for _, cf := range tbl.ComputedFields {
+		s := scalarSchema(cf.JSONType, cf.TypeName)
+		s.Description = "Computed field, returned when named in fields."
+		if cf.Comment != "" {
+			s.Description = cf.Comment + " " + s.Description
+		}
+		s.Nullable = true
+		s.ReadOnly = true
+		record.Properties[cf.Name] = s
+	}
+	if len(tbl.Relationships) > 0 {
+		expand := &Schema{Type: "object", ReadOnly: true, Description: "Related records requested with expand.", Properties: map[string]*Schema{}}
+		for _, rel := range tbl.Relationships {
+			related := &Schema{Type: "object", AdditionalProperties: &Schema{}}
+			if target := b.sc.Tables[rel.ToSchema+"."+rel.ToTable]; target != nil && b.sc.TableByName(target.Name) == target {
+				related = ref(componentName(target.Name))
+			}
+			if rel.Type == "many-to-one" {
+				expand.Properties[rel.FieldName] = related
+			} else {
+				expand.Properties[rel.FieldName] = &Schema{Type: "array", Items: related}
+			}
+		}
+		record.Properties["expand"] = expand
+	}
+	b.doc.Components.Schemas[name] = record
+
+	b.doc.Components.Schemas[name+"List"] = &Schema{
+		Type:     "object",
+		Required: []string{"perPage", "totalItems", "totalPages", "items"},
+		Properties: map[string]*Schema{
+			"page":       {Type: "integer"},
+			"perPage":    {Type: "integer"},
+			"totalItems": {Type: "integer"},
+			"totalPages": {Type: "integer"},
+			"items":      {Type: "array", Items: ref(name)},
+			"nextCursor": {Type: "string"},
+			"prevCursor": {Type: "string"},
+		},
+	}
+
+	// Soft-deleted records are left out of reads unless an admin asks for them.
+	var withDeleted []*Parameter
+	if tbl.SoftDeleteColumn != "" {
+		withDeleted = append(withDeleted, &Parameter{Name: "withDeleted", In: "query", Description: "Include soft-deleted records (admins only).", Schema: &Schema{Type: "boolean"}})
+	}
+
+	collection := b.path("/collections/" + coll)
+	collection.Get = &Operation{
+		OperationID: "list" + op,
+		Summary:     "List " + coll,
+		Tags:        tags,
+		Parameters: append([]*Parameter{
+			paramRef("filter"), paramRef("sort"), paramRef("page"), paramRef("perPage"),
+			paramRef("fields"), paramRef("expand"), paramRef("skipTotal"), paramRef("cursor"),
+			paramRef("search"), paramRef("searchFields"),
+		}, withDeleted...),
+		Responses: map[string]*Response{
+			"200": jsonResponse("A page of records.", ref(name+"List")),
+			"400": errorResponse("Invalid query parameters."),
+		},
+		Security: b.security(),
+	}
+
+	b.path("/collections/" + coll + "/aggregate").Get = &Operation{
+		OperationID: "aggregate" + op,
+		Summary:     "Aggregate " + coll,
+		Tags:        tags,
+		Parameters: []*Parameter{
+			{Name: "group", In: "query", Description: "Comma-separated columns or date_trunc(unit,column) expressions to group by.", Schema: &Schema{Type: "string"}},
+			{Name: "agg", In: "query", Required: true, Description: "Comma-separated aggregates, e.g. count(),sum(amount).", Schema: &Schema{Type: "string"}},
+			paramRef("filter"),
+			{Name: "having", In: "query", Description: "Filter on aggregate results.", Schema: &Schema{Type: "string"}},
+			paramRef("sort"),
+		},
+		Responses: map[string]*Response{
+			"200": jsonResponse("Grouped results.", &Schema{
+				Type:       "object",
+				Required:   []string{"items"},
+				Properties: map[string]*Schema{"items": {Type: "array", Items: &Schema{Type: "object", AdditionalProperties: &Schema{}}}},
+			}),
+			"400": errorResponse("Invalid aggregate."),
+		},
+		Security: b.security(),
+	}
+
+	b.path("/collections/" + coll + "/export").Get = &Operation{
+		OperationID: "export" + op,
+		Summary:     "Export " + coll,
+		Description: "Streams every matching record, with no page limit.",
+		Tags:        tags,
+		Parameters: []*Parameter{
+			{Name: "format", In: "query", Schema: &Schema{Type: "string", Enum: []any{"json", "ndjson", "csv"}}},
+			paramRef("filter"), paramRef("sort"), paramRef("fields"),
+		},
+		Responses: map[string]*Response{
+			"200": {
+				Description: "The exported records.",
+				Content: map[string]*MediaType{
+					"application/json":     {Schema: &Schema{Type: "array", Items: ref(name)}},
+					"application/x-ndjson": {Schema: &Schema{Type: "string"}},
+					"text/csv":             {Schema: &Schema{Type: "string"}},
+				},
+			},
+			"400": errorResponse("Invalid query parameters."),
+		},
+		Security: b.security(),
+	}
+
+	if writable {
+		create := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		update := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for _, col := range tbl.Columns {
+			if tbl.CanInsert(col.Name) {
+				create.Properties[col.Name] = columnSchema(col)
+				if !col.IsNullable && !col.HasDefault() {
+					create.Required = append(create.Required, col.Name)
+				}
+			}
+			if tbl.CanUpdate(col.Name) {
+				update.Properties[col.Name] = columnSchema(col)
+			}
+		}
+		b.doc.Components.Schemas[name+"Create"] = create
+		b.doc.Components.Schemas[name+"Update"] = update
+
+		collection.Post = &Operation{
+			OperationID: "create" + op,
+			Summary:     "Create " + coll,
+			Description: "Accepts one record or an array of up to 1000. With onConflict, conflicting rows are skipped or, with merge, updated.",
+			Tags:        tags,
+			Parameters: []*Parameter{
+				{Name: "onConflict", In: "query", Description: "Comma-separated unique columns to upsert on.", Schema: &Schema{Type: "string"}},
+				{Name: "merge", In: "query", Description: "Update conflicting rows instead of skipping them.", Schema: &Schema{Type: "boolean"}},
+			},
+			RequestBody: jsonBody("", &Schema{OneOf: []*Schema{ref(name + "Create"), {Type: "array", Items: ref(name + "Create")}}}),
+			Responses: map[string]*Response{
+				"201": jsonResponse("The created record, or the created records for an array.", &Schema{OneOf: []*Schema{ref(name), ref("BulkResult")}}),
+				"200": jsonResponse("Existing records were updated by an upsert.", &Schema{OneOf: []*Schema{ref(name), ref("BulkResult")}}),
+				"204": {Description: "The record conflicted and was skipped."},
+				"400": errorResponse("Invalid record."),
+				"409": errorResponse("Unique constraint violation."),
+			},
+			Security: b.security(),
+		}
+		collection.Patch = &Operation{
+			OperationID: "bulkUpdate" + op,
+			Summary:     "Update every " + coll + " record matching a filter",
+			Tags:        tags,
+			Parameters:  []*Parameter{{Name: "filter", In: "query", Required: true, Description: "Records to update.", Schema: &Schema{Type: "string"}}},
+			RequestBody: jsonBody("", ref(name+"Update")),
+			Responses: map[string]*Response{
+				"200": jsonResponse("The updated records.", ref("BulkResult")),
+				"400": errorResponse("Missing or invalid filter."),
+			},
+			Security: b.security(),
+		}
+		collection.Delete = &Operation{
+			OperationID: "bulkDelete" + op,
+			Summary:     "Delete every " + coll + " record matching a filter",
+			Tags:        tags,
+			Parameters:  []*Parameter{{Name: "filter", In: "query", Required: true, Description: "Records to delete.", Schema: &Schema{Type: "string"}}},
+			Responses: map[string]*Response{
+				"200": jsonResponse("The number of deleted records.", ref("BulkResult")),
+				"400": errorResponse("Missing or invalid filter."),
+			},
+			Security: b.security(),
+		}
+
+		b.path("/collections/" + coll + "/import").Post = &Operation{
+			OperationID: "import" + op,
+			Summary:     "Import " + coll + " from CSV or NDJSON",
+			Description: "Either every row is imported or none is.",
+			Tags:        tags,
+			Parameters: []*Parameter{
+				{Name: "format", In: "query", Schema: &Schema{Type: "string", Enum: []any{"csv", "ndjson"}}},
+				{Name: "dryRun", In: "query", Description: "Validate and roll back.", Schema: &Schema{Type: "boolean"}},
+				{Name: "onConflict", In: "query", Schema: &Schema{Type: "string"}},
+				{Name: "merge", In: "query", Schema: &Schema{Type: "boolean"}},
+			},
+			RequestBody: &RequestBody{
+				Required: true,
+				Content: map[string]*MediaType{
+					"text/csv":             {Schema: &Schema{Type: "string"}},
+					"application/x-ndjson": {Schema: &Schema{Type: "string"}},
+				},
+			},
+			Responses: map[string]*Response{
+				"200": jsonResponse("The import report.", &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"total":    {Type: "integer"},
+						"inserted": {Type: "integer"},
+						"updated":  {Type: "integer"},
+						"skipped":  {Type: "integer"},
+						"dryRun":   {Type: "boolean"},
+					},
+				}),
+				"400": errorResponse("Rows failed; data.errors lists them with their row number."),
+				"413": errorResponse("The file is too large."),
+			},
+			Security: b.security(),
+		}
+	}
+
+	if len(tbl.PrimaryKey) == 0 {
+		return
+	}
+
+	idParam := &Parameter{
+		Name:        "id",
+		In:          "path",
+		Required:    true,
+		Description: "Primary key value; composite keys are comma-separated in key order.",
+		Schema:      &Schema{Type: "string"},
+	}
+	etag := map[string]*Header{"ETag": {Description: "The record's version.", Schema: &Schema{Type: "string"}}}
+	record200 := &Response{Description: "The record.", Headers: etag, Content: jsonContent(ref(name))}
+
+	item := b.path("/collections/" + coll + "/{id}")
+	item.Get = &Operation{
+		OperationID: "get" + op,
+		Summary:     "Get a " + coll + " record",
+		Tags:        tags,
+		Parameters: append([]*Parameter{
+			idParam, paramRef("fields"), paramRef("expand"),
+			{Name: "If-None-Match", In: "header", Description: "ETags the client already has.", Schema: &Schema{Type: "string"}},
+		}, withDeleted...),
+		Responses: map[string]*Response{
+			"200": record200,
+			"304": {Description: "The record matches If-None-Match."},
+			"404": errorResponse("Record not found."),
+		},
+		Security: b.security(),
+	}
+	if !writable {
+		return
+	}
+
+	ifMatch := &Parameter{Name: "If-Match", In: "header", Description: "Only write if the record still has this ETag.", Schema: &Schema{Type: "string"}}
+	item.Patch = &Operation{
+		OperationID: "update" + op,
+		Summary:     "Update a " + coll + " record",
+		Tags:        tags,
+		Parameters:  []*Parameter{idParam, ifMatch},
+		RequestBody: jsonBody("The columns to change.", ref(name+"Update")),
+		Responses: map[string]*Response{
+			"200": record200,
+			"400": errorResponse("Invalid record."),
+			"404": errorResponse("Record not found."),
+			"412": errorResponse("The record has changed since the If-Match ETag."),
+		},
+		Security: b.security(),
+	}
+	item.Delete = &Operation{
+		OperationID: "delete" + op,
+		Summary:     "Delete a " + coll + " record",
+		Tags:        tags,
+		Parameters:  []*Parameter{idParam, ifMatch},
+		Responses: map[string]*Response{
+			"204": {Description: "Deleted."},
+			"404": errorResponse("Record not found."),
+			"412": errorResponse("The record has changed since the If-Match ETag."),
+		},
+		Security: b.security(),
+	}
+	if tbl.SoftDeleteColumn != "" {
+		item.Delete.Description = "The record is soft-deleted: it is left out of reads until restored."
+		b.path("/collections/" + coll + "/{id}/restore").Post = &Operation{
+			OperationID: "restore" + op,
+			Summary:     "Restore a soft-deleted " + coll + " record",
+			Tags:        tags,
+			Parameters:  []*Parameter{idParam},
+			Responses: map[string]*Response{
+				"200": jsonResponse("The restored record.", ref(name)),
+				"404": errorResponse("No soft-deleted record with this key."),
+			},
+			Security: b.security(),
+		}
+	}
+	if tbl.Audited {
+		b.path("/collections/" + coll + "/{id}/history").Get = &Operation{
+			OperationID: "history" + op,
+			Summary:     "List the changes to a " + coll + " record",
+			Description: "Newest first. Admins may read the history of deleted records.",
+			Tags:        tags,
+			Parameters:  []*Parameter{idParam, paramRef("page"), paramRef("perPage")},
+			Responses: map[string]*Response{
+				"200": jsonResponse("The record's history.", ref("AuditList")),
+				"404": errorResponse("Record not found."),
+			},
+			Security: b.security(),
+		}
+	}
+}
+
+// addFunction adds the RPC path for a function. Arguments are passed by name
+// and missing ones are NULL, so none is required.
+func (b *builder) addFunction(fn *schema.Function) {
+	rpc := b.sc.FunctionName(fn)
+	body := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, p := range fn.Parameters {
+		if p.Name != "" {
+			body.Properties[p.Name] = b.typeSchema(p.Type)
+		}
+	}
+
+	responses := map[string]*Response{
+		"400": errorResponse("Invalid arguments."),
+		"404": errorResponse("Function not found."),
+	}
+	switch {
+	case fn.IsVoid:
+		responses["204"] = &Response{Description: "The function ran."}
+	case fn.ReturnsSet:
+		responses["200"] = jsonResponse("The returned rows.", &Schema{Type: "array", Items: b.typeSchema(fn.ReturnType)})
+	default:
+		responses["200"] = jsonResponse("The returned value.", b.typeSchema(fn.ReturnType))
+	}
+
+	op := &Operation{
+		OperationID: "rpc" + pascalCase(rpc),
+		Summary:     "Call " + rpc,
+		Description: fn.Comment,
+		Tags:        []string{"rpc"},
+		Responses:   responses,
+		Security:    b.security(),
+	}
+	if len(body.Properties) > 0 {
+		op.RequestBody = jsonBody("Arguments by name.", body)
+	}
+	b.path("/rpc/" + rpc).Post = op
+}
+
+// addBuiltins adds the endpoints that do not depend on the schema.
+func (b *builder) addBuiltins() {
+	b.addTag("rpc", "Database functions.")
+	b.addTag("system", "Batches, GraphQL, schema and realtime.")
+
+	b.path("/batch").Post = &Operation{
+		OperationID: "batch",
+		Summary:     "Run operations in one transaction",
+		Tags:        []string{"system"},
+		RequestBody: jsonBody("", &Schema{
+			Type:     "object",
+			Required: []string{"operations"},
+			Properties: map[string]*Schema{
+				"operations": {Type: "array", Items: &Schema{
+					Type:     "object",
+					Required: []string{"method"},
+					Properties: map[string]*Schema{
+						"method":   {Type: "string", Enum: []any{"create", "update", "delete", "rpc"}},
+						"table":    {Type: "string"},
+						"id":       {Description: "Primary key; may reference an earlier result as ${N.field}."},
+						"function": {Type: "string"},
+						"body":     {Type: "object", AdditionalProperties: &Schema{}},
+					},
+				}},
+			},
+		}),
+		Responses: map[string]*Response{
+			"200": jsonResponse("The result of each operation.", &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"results": {Type: "array", Items: &Schema{
+						Type: "object",
+						Properties: map[string]*Schema{
+							"status": {Type: "integer"},
+							"body":   {},
+						},
+					}},
+				},
+			}),
+			"400": errorResponse("An operation failed; nothing was written."),
+		},
+		Security: b.security(),
+	}
+
+	b.path("/graphql").Post = &Operation{
+		OperationID: "graphql",
+		Summary:     "Run a GraphQL query or mutation",
+		Description: "The GraphQL schema is generated from the database schema; use introspection to read it.",
+		Tags:        []string{"system"},
+		RequestBody: jsonBody("", &Schema{
+			Type:     "object",
+			Required: []string{"query"},
+			Properties: map[string]*Schema{
+				"query":         {Type: "string"},
+				"operationName": {Type: "string"},
+				"variables":     {Type: "object", AdditionalProperties: &Schema{}},
+			},
+		}),
+		Responses: map[string]*Response{
+			"200": jsonResponse("The result, with any execution errors.", &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"data":   {Type: "object", Nullable: true, AdditionalProperties: &Schema{}},
+					"errors": {Type: "array", Items: &Schema{Type: "object", AdditionalProperties: &Schema{}}},
+				},
+			}),
+			"400": jsonResponse("The request could not be parsed or validated.", &Schema{Type: "object", AdditionalProperties: &Schema{}}),
+		},
+		Security: b.security(),
+	}
+
+	b.path("/schema").Get = &Operation{
+		OperationID: "getSchema",
+		Summary:     "Get the database schema",
+		Tags:        []string{"system"},
+		Responses: map[string]*Response{
+			"200": jsonResponse("Tables, columns, relationships and functions.", &Schema{Type: "object", AdditionalProperties: &Schema{}}),
+		},
+	}
+
+	b.path("/realtime").Get = &Operation{
+		OperationID: "subscribe",
+		Summary:     "Subscribe to record changes",
+		Description: "A server-sent event stream of create, update and delete events.",
+		Tags:        []string{"system"},
+		Parameters: []*Parameter{
+			{Name: "tables", In: "query", Required: true, Description: "Comma-separated collections to watch.", Schema: &Schema{Type: "string"}},
+			{Name: "token", In: "query", Description: "Access token, for clients that cannot set headers.", Schema: &Schema{Type: "string"}},
+		},
+		Responses: map[string]*Response{
+			"200": {Description: "The event stream.", Content: map[string]*MediaType{"text/event-stream": {Schema: &Schema{Type: "string"}}}},
+		},
+	}
+}
+
+// addAuth adds the auth endpoints.
+func (b *builder) addAuth() {
+	b.addTag("auth", "Accounts and tokens.")
+	tags := []string{"auth"}
+	c := b.doc.Components.Schemas
+	c["AuthUser"] = &Schema{
+		Type:     "object",
+		Required: []string{"id", "email", "createdAt", "updatedAt"},
+		Properties: map[string]*Schema{
+			"id":        {Type: "string", Format: "uuid"},
+			"email":     {Type: "string"},
+			"createdAt": {Type: "string", Format: "date-time"},
+			"updatedAt": {Type: "string", Format: "date-time"},
+		},
+	}
+	c["AuthTokens"] = &Schema{
+		Type:     "object",
+		Required: []string{"token", "refreshToken", "user"},
+		Properties: map[string]*Schema{
+			"token":        {Type: "string"},
+			"refreshToken": {Type: "string"},
+			"user":         ref("AuthUser"),
+		},
+	}
+	c["Message"] = &Schema{Type: "object", Properties: map[string]*Schema{"message": {Type: "string"}}}
+
+	credentials := &Schema{
+		Type:     "object",
+		Required: []string{"email", "password"},
+		Properties: map[string]*Schema{
+			"email":    {Type: "string"},
+			"password": {Type: "string"},
+		},
+	}
+	refresh := &Schema{Type: "object", Required: []string{"refreshToken"}, Properties: map[string]*Schema{"refreshToken": {Type: "string"}}}
+	token := &Schema{Type: "object", Required: []string{"token"}, Properties: map[string]*Schema{"token": {Type: "string"}}}
+
+	b.path("/auth/register").Post = &Operation{
+		OperationID: "register",
+		Summary:     "Create an account",
+		Tags:        tags,
+		RequestBody: jsonBody("", credentials),
+		Responses: map[string]*Response{
+			"201": jsonResponse("The new account's tokens.", ref("AuthTokens")),
+			"400": errorResponse("Invalid email or password."),
+			"409": errorResponse("Email already registered."),
+		},
+	}
+	b.path("/auth/login").Post = &Operation{
+		OperationID: "login",
+		Summary:     "Log in with email and password",
+		Tags:        tags,
+		RequestBody: jsonBody("", credentials),
+		Responses: map[string]*Response{
+			"200": jsonResponse("Tokens.", ref("AuthTokens")),
+			"401": errorResponse("Invalid email or password."),
+		},
+	}
+	b.path("/auth/refresh").Post = &Operation{
+		OperationID: "refresh",
+		Summary:     "Exchange a refresh token for new tokens",
+		Tags:        tags,
+		RequestBody: jsonBody("", refresh),
+		Responses: map[string]*Response{
+			"200": jsonResponse("Tokens.", ref("AuthTokens")),
+			"401": errorResponse("Invalid refresh token."),
+		},
+	}
+	b.path("/auth/logout").Post = &Operation{
+		OperationID: "logout",
+		Summary:     "Revoke a refresh token",
+		Tags:        tags,
+		RequestBody: jsonBody("", refresh),
+		Responses:   map[string]*Response{"204": {Description: "Logged out."}},
+	}
+	b.path("/auth/me").Get = &Operation{
+		OperationID: "me",
+		Summary:     "Get the current user",
+		Tags:        tags,
+		Responses: map[string]*Response{
+			"200": jsonResponse("The current user.", ref("AuthUser")),
+			"401": errorResponse("Not authenticated."),
+		},
+		Security: b.security(),
+	}
+	b.path("/auth/password-reset").Post = &Operation{
+		OperationID: "requestPasswordReset",
+		Summary:     "Email a password reset link",
+		Tags:        tags,
+		RequestBody: jsonBody("", &Schema{Type: "object", Required: []string{"email"}, Properties: map[string]*Schema{"email": {Type: "string"}}}),
+		Responses:   map[string]*Response{"200": jsonResponse("Sent if the account exists.", ref("Message"))},
+	}
+	b.path("/auth/password-reset/confirm").Post = &Operation{
+		OperationID: "confirmPasswordReset",
+		Summary:     "Set a new password with a reset token",
+		Tags:        tags,
+		RequestBody: jsonBody("", &Schema{
+			Type:       "object",
+			Required:   []string{"token", "password"},
+			Properties: map[string]*Schema{"token": {Type: "string"}, "password": {Type: "string"}},
+		}),
+		Responses: map[string]*Response{
+			"200": jsonResponse("Password reset.", ref("Message")),
+			"400": errorResponse("Invalid or expired token."),
+		},
+	}
+	b.path("/auth/verify").Post = &Operation{
+		OperationID: "verifyEmail",
+		Summary:     "Verify an email address",
+		Tags:        tags,
+		RequestBody: jsonBody("", token),
+		Responses: map[string]*Response{
+			"200": jsonResponse("Email verified.", ref("Message")),
+			"400": errorResponse("Invalid or expired token."),
+		},
+	}
+	b.path("/auth/verify/resend").Post = &Operation{
+		OperationID: "resendVerification",
+		Summary:     "Resend the verification email",
+		Tags:        tags,
+		Responses: map[string]*Response{
+			"200": jsonResponse("Sent.", ref("Message")),
+			"401": errorResponse("Not authenticated."),
+		},
+		Security: b.security(),
+	}
+
+	provider := &Parameter{Name: "provider", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+	if len(b.opts.OAuthProviders) > 0 {
+		providers := append([]string(nil), b.opts.OAuthProviders...)
+		sort.Strings(providers)
+		for _, p := range providers {
+			provider.Schema.Enum = append(provider.Schema.Enum, p)
+		}
+	}
+	b.path("/auth/oauth/{provider}").Get = &Operation{
+		OperationID: "oauthRedirect",
+		Summary:     "Start an OAuth login",
+		Tags:        tags,
+		Parameters:  []*Parameter{provider},
+		Responses: map[string]*Response{
+			"307": {Description: "Redirect to the provider."},
+			"404": errorResponse("Provider not configured."),
+		},
+	}
+	b.path("/auth/oauth/{provider}/callback").Get = &Operation{
+		OperationID: "oauthCallback",
+		Summary:     "Complete an OAuth login",
+		Tags:        tags,
+		Parameters: []*Parameter{
+			provider,
+			{Name: "code", In: "query", Schema: &Schema{Type: "string"}},
+			{Name: "state", In: "query", Schema: &Schema{Type: "string"}},
+		},
+		Responses: map[string]*Response{
+			"200": jsonResponse("Tokens.", ref("AuthTokens")),
+			"307": {Description: "Redirect to the configured OAuth redirect URL with the tokens."},
+			"400": errorResponse("Invalid state or code."),
+		},
+	}
+}
+
+// addStorage adds the file storage endpoints.
+func (b *builder) addStorage() {
+	b.addTag("storage", "File storage.")
+	tags := []string{"storage"}
+	b.doc.Components.Schemas["StorageObject"] = &Schema{
+		Type:     "object",
+		Required: []string{"id", "bucket", "name", "size", "contentType", "createdAt", "updatedAt"},
+		Properties: map[string]*Schema{
+			"id":          {Type: "string"},
+			"bucket":      {Type: "string"},
+			"name":        {Type: "string"},
+			"size":        {Type: "integer", Format: "int64"},
+			"contentType": {Type: "string"},
+			"userId":      {Type: "string"},
+			"createdAt":   {Type: "string", Format: "date-time"},
+			"updatedAt":   {Type: "string", Format: "date-time"},
+		},
+	}
+
+	bucket := &Parameter{Name: "bucket", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+	name := &Parameter{Name: "name", In: "path", Required: true, Description: "Object name; may contain slashes.", Schema: &Schema{Type: "string"}}
+
+	files := b.path("/storage/{bucket}")
+	files.Get = &Operation{
+		OperationID: "listFiles",
+		Summary:     "List files in a bucket",
+		Tags:        tags,
+		Parameters: []*Parameter{
+			bucket,
+			{Name: "prefix", In: "query", Schema: &Schema{Type: "string"}},
+			{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+			{Name: "offset", In: "query", Schema: &Schema{Type: "integer"}},
+		},
+		Responses: map[string]*Response{
+			"200": jsonResponse("Files.", &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"items":      {Type: "array", Items: ref("StorageObject")},
+					"totalItems": {Type: "integer"},
+				},
+			}),
+		},
+		Security: b.optionalSecurity(),
+	}
+	files.Post = &Operation{
+		OperationID: "uploadFile",
+		Summary:     "Upload a file",
+		Tags:        tags,
+		Parameters:  []*Parameter{bucket},
+		RequestBody: &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{"multipart/form-data": {Schema: &Schema{
+				Type:     "object",
+				Required: []string{"file"},
+				Properties: map[string]*Schema{
+					"file": {Type: "string", Format: "binary"},
+					"name": {Type: "string", Description: "Object name; defaults to the uploaded file name."},
+				},
+			}}},
+		},
+		Responses: map[string]*Response{
+			"201": jsonResponse("The stored file.", ref("StorageObject")),
+			"400": errorResponse("Invalid bucket, name or form."),
+		},
+		Security: b.optionalSecurity(),
+	}
+
+	file := b.path("/storage/{bucket}/{name}")
+	file.Get = &Operation{
+		OperationID: "getFile",
+		Summary:     "Download a file",
+		Tags:        tags,
+		Parameters: []*Parameter{
+			bucket, name,
+			{Name: "exp", In: "query", Description: "Signed URL expiry.", Schema: &Schema{Type: "string"}},
+			{Name: "sig", In: "query", Description: "Signed URL signature.", Schema: &Schema{Type: "string"}},
+		},
+		Responses: map[string]*Response{
+			"200": {Description: "The file contents.", Content: map[string]*MediaType{"application/octet-stream": {Schema: &Schema{Type: "string", Format: "binary"}}}},
+			"403": errorResponse("Invalid or expired signed URL."),
+			"404": errorResponse("File not found."),
+		},
+		Security: b.optionalSecurity(),
+	}
+	file.Delete = &Operation{
+		OperationID: "deleteFile",
+		Summary:     "Delete a file",
+		Tags:        tags,
+		Parameters:  []*Parameter{bucket, name},
+		Responses: map[string]*Response{
+			"204": {Description: "Deleted."},
+			"404": errorResponse("File not found."),
+		},
+		Security: b.optionalSecurity(),
+	}
+
+	b.path("/storage/{bucket}/{name}/sign").Post = &Operation{
+		OperationID: "signFile",
+		Summary:     "Create a signed download URL",
+		Tags:        tags,
+		Parameters:  []*Parameter{bucket, name},
+		RequestBody: jsonBody("", &Schema{Type: "object", Properties: map[string]*Schema{"expiresIn": {Type: "integer", Description: "Seconds until expiry (default 3600)."}}}),
+		Responses: map[string]*Response{
+			"200": jsonResponse("The signed URL.", &Schema{Type: "object", Properties: map[string]*Schema{"url": {Type: "string"}}}),
+		},
+		Security: b.optionalSecurity(),
+	}
+}
@@ -18,12 +18,18 @@ import (
 // Handler serves the SSE realtime endpoint.
 type Handler struct {
 	hub         *Hub
-	pool        *pgxpool.Pool    // nil when RLS filtering unavailable
-	authSvc     *auth.Service    // nil when auth disabled
+	pool        *pgxpool.Pool // nil when RLS filtering unavailable
+	authSvc     *auth.Service // nil when auth disabled
 	schemaCache *schema.CacheHolder
 	logger      *slog.Logger
+	viewRule    ViewRuleFunc // nil when access rules are not applied
 }
 
+// ViewRuleFunc renders a table's view rule for a client with the given claims
+// (nil if unauthenticated), as a condition with placeholders numbered from
+// argOffset+1. It returns "" when the table has no view rule.
+type ViewRuleFunc func(sc *schema.SchemaCache, tbl *schema.Table, claims *auth.Claims, argOffset int) (string, []any, error)
+
 // NewHandler creates a new realtime SSE handler.
 // pool may be nil; when non-nil, events are filtered per-client via RLS.
 func NewHandler(hub *Hub, pool *pgxpool.Pool, authSvc *auth.Service, schemaCache *schema.CacheHolder, logger *slog.Logger) *Handler {
@@ -36,6 +42,12 @@ func NewHandler(hub *Hub, pool *pgxpool.Pool, authSvc *auth.Service, schemaCache
 	}
 }
 
+// SetViewRule makes the handler only send a client the records that match the
+// table's view rule, in addition to its RLS policies.
+func (h *Handler) SetViewRule(fn ViewRuleFunc) {
+	h.viewRule = fn
+}
+
 // ServeHTTP handles GET /api/realtime with Server-Sent Events.
 //
 // Query parameters:
@@ -78,9 +90,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if name == "" {
 			continue
 		}
-		if sc != nil && sc.TableByName(name) == nil {
-			httputil.WriteError(w, http.StatusBadRequest, "unknown table: "+name)
-			return
+		if sc != nil {
+			tbl := sc.TableByName(name)
+			if tbl == nil {
+				httputil.WriteError(w, http.StatusBadRequest, "unknown table: "+name)
+				return
+			}
+			// Events name tables the way the API addresses them, so
+			// "public.posts" receives the events of "posts".
+			name = sc.CollectionName(tbl)
 		}
 		tables[name] = true
 	}
@@ -118,6 +136,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if !h.canSeeRecord(ctx, claims, event) {
 				continue
 			}
+			event = h.visibleEvent(claims, event)
 			data, err := json.Marshal(event)
 			if err != nil {
 				h.logger.Error("failed to marshal event", "error", err, "clientID", client.ID)
@@ -130,13 +149,17 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // canSeeRecord checks whether the authenticated user can see the event's record
-// via an RLS-scoped SELECT. Returns true when:
+// via an RLS-scoped SELECT, restricted by the table's view rule if it has one.
+// Returns true when:
 //   - no pool is available (RLS filtering disabled)
-//   - no claims (unauthenticated client, no RLS applies)
+//   - no claims (unauthenticated client, no RLS applies) and no view rule
 //   - the event is a delete (record is gone, can't verify)
 //   - the RLS-scoped SELECT finds the row
 func (h *Handler) canSeeRecord(ctx context.Context, claims *auth.Claims, event *Event) bool {
-	if h.pool == nil || claims == nil || event.Action == "delete" {
+	if h.pool == nil || event.Action == "delete" {
+		return true
+	}
+	if claims == nil && h.viewRule == nil {
 		return true
 	}
 
@@ -154,6 +177,24 @@ func (h *Handler) canSeeRecord(ctx context.Context, claims *auth.Claims, event *
 		return true // missing PK values in record
 	}
 
+	var ruleSQL string
+	if h.viewRule != nil {
+		var ruleArgs []any
+		var err error
+		ruleSQL, ruleArgs, err = h.viewRule(sc, tbl, claims, len(args))
+		if err != nil {
+			h.logger.Error("rls filter: view rule", "error", err, "table", tbl.Name)
+			return false // fail closed
+		}
+		if ruleSQL != "" {
+			query += " AND (" + ruleSQL + ")"
+			args = append(args, ruleArgs...)
+		}
+	}
+	if claims == nil && ruleSQL == "" {
+		return true
+	}
+
 	tx, err := h.pool.Begin(ctx)
 	if err != nil {
 		h.logger.Error("rls filter: begin tx", "error", err)
@@ -171,6 +212,29 @@ func (h *Handler) canSeeRecord(ctx context.Context, claims *auth.Claims, event *
 	return err == nil
 }
 
+// visibleEvent returns the event with the columns hidden from the client's
+// role left out of its record.
+func (h *Handler) visibleEvent(claims *auth.Claims, event *Event) *Event {
+	sc := h.schemaCache.Get()
+	if sc == nil {
+		return event
+	}
+	tbl := sc.ForRole(auth.RoleOf(claims)).TableByName(event.Table)
+	if tbl == nil || !tbl.HasHiddenColumns() {
+		return event
+	}
+	record := make(map[string]any, len(event.Record))
+	for k, v := range event.Record {
+		if tbl.ColumnByName(k) == nil && tbl.Unrestricted().ColumnByName(k) != nil {
+			continue
+		}
+		record[k] = v
+	}
+	visible := *event
+	visible.Record = record
+	return &visible
+}
+
 // buildVisibilityCheck builds a SELECT 1 query scoped to a row's PK.
 // Returns ("", nil) if the record is missing any PK column value.
 func buildVisibilityCheck(tbl *schema.Table, record map[string]any) (string, []any) {
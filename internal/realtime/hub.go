@@ -12,7 +12,7 @@ const eventBufferSize = 256
 
 // Event represents a data change on a table.
 type Event struct {
-	Action string         `json:"action"` // "create", "update", "delete"
+	Action string         `json:"action"` // "create", "update", "delete", "restore"
 	Table  string         `json:"table"`
 	Record map[string]any `json:"record"`
 }
@@ -0,0 +1,197 @@
+package schema
+
+import "slices"
+
+// ForRole returns the schema as seen by API requests made as role. Columns
+// hidden from the role are left out of their tables, along with the foreign
+// keys, indexes and relationships that use them, and Table.CanInsert and
+// Table.CanUpdate report the role's write access. An empty role restricts each
+// column as much as any role does, which is how the schema is described to
+// clients that are not admins.
+//
+// A cache without column restrictions is returned as is. Restricted caches
+// are built once per role and share everything else with sc.
+func (sc *SchemaCache) ForRole(role string) *SchemaCache {
+	if sc.full != nil {
+		return sc.full.ForRole(role)
+	}
+	if v, ok := sc.roles.Load(role); ok {
+		return v.(*SchemaCache)
+	}
+	v, _ := sc.roles.LoadOrStore(role, sc.restrict(role))
+	return v.(*SchemaCache)
+}
+
+// Unrestricted returns the cache with every column, as loaded from the
+// database.
+func (sc *SchemaCache) Unrestricted() *SchemaCache {
+	if sc == nil || sc.full == nil {
+		return sc
+	}
+	return sc.full
+}
+
+func (sc *SchemaCache) restrict(role string) *SchemaCache {
+	tables := make(map[string]*Table, len(sc.Tables))
+	changed := false
+	for key, t := range sc.Tables {
+		tables[key] = t.restrict(role)
+		changed = changed || tables[key] != t
+	}
+	if !changed {
+		return sc
+	}
+
+	// A relationship is only followed when the columns on both sides, and in
+	// the junction table, are visible.
+	for key, t := range tables {
+		rels := make([]*Relationship, 0, len(t.Relationships))
+		for _, rel := range t.Relationships {
+			if relationshipVisible(tables, t, rel) {
+				rels = append(rels, rel)
+			}
+		}
+		if len(rels) == len(t.Relationships) {
+			continue
+		}
+		if t.full == nil {
+			c := *t
+			c.full = t
+			t = &c
+			tables[key] = t
+		}
+		t.Relationships = rels
+	}
+
+	return &SchemaCache{
+		Tables:    tables,
+		Functions: sc.Functions,
+		Enums:     sc.Enums,
+		Schemas:   sc.Schemas,
+		BuiltAt:   sc.BuiltAt,
+		full:      sc,
+	}
+}
+
+func relationshipVisible(tables map[string]*Table, from *Table, rel *Relationship) bool {
+	if !hasColumns(from, rel.FromColumns) {
+		return false
+	}
+	if to := tables[rel.ToSchema+"."+rel.ToTable]; to != nil && !hasColumns(to, rel.ToColumns) {
+		return false
+	}
+	if rel.JunctionTable != "" {
+		j := tables[rel.JunctionSchema+"."+rel.JunctionTable]
+		if j != nil && (!hasColumns(j, rel.JunctionFromColumns) || !hasColumns(j, rel.JunctionToColumns)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasColumns(t *Table, cols []string) bool {
+	for _, c := range cols {
+		if t.ColumnByName(c) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// restrict returns t as seen by role, or t itself if role has no restrictions
+// on it.
+func (t *Table) restrict(role string) *Table {
+	access := t.accessFor(role)
+	if len(access) == 0 {
+		return t
+	}
+
+	c := *t
+	c.full = t
+	c.access = access
+	c.Columns = make([]*Column, 0, len(t.Columns))
+	for _, col := range t.Columns {
+		if access[col.Name] != AccessHidden {
+			c.Columns = append(c.Columns, col)
+		}
+	}
+	c.ForeignKeys = nil
+	for _, fk := range t.ForeignKeys {
+		if hasColumns(&c, fk.Columns) {
+			c.ForeignKeys = append(c.ForeignKeys, fk)
+		}
+	}
+	c.Indexes = nil
+	for _, idx := range t.Indexes {
+		// Expression entries are "" and say nothing about hidden columns.
+		cols := slices.DeleteFunc(slices.Clone(idx.Columns), func(col string) bool { return col == "" })
+		if hasColumns(&c, cols) {
+			c.Indexes = append(c.Indexes, idx)
+		}
+	}
+	return &c
+}
+
+// accessRank orders the access levels from least to most restrictive.
+var accessRank = map[string]int{AccessInsertOnly: 1, AccessReadOnly: 2, AccessHidden: 3}
+
+// accessFor resolves t's column restrictions for role. Entries for the role
+// override entries for every role ("*"); with an empty role, the most
+// restrictive entry wins. Primary key columns address records, so hiding one
+// only makes it read-only.
+func (t *Table) accessFor(role string) map[string]string {
+	if len(t.ColumnAccess) == 0 {
+		return nil
+	}
+	access := make(map[string]string)
+	exact := make(map[string]bool)
+	for _, ca := range t.ColumnAccess {
+		col := t.ColumnByName(ca.Column)
+		if col == nil || accessRank[ca.Access] == 0 {
+			continue
+		}
+		switch {
+		case role == "":
+			if accessRank[ca.Access] <= accessRank[access[ca.Column]] {
+				continue
+			}
+		case ca.Role == role:
+			exact[ca.Column] = true
+		case ca.Role != "*" || exact[ca.Column]:
+			continue
+		}
+		level := ca.Access
+		if level == AccessHidden && col.IsPrimaryKey {
+			level = AccessReadOnly
+		}
+		access[ca.Column] = level
+	}
+	return access
+}
+
+// Unrestricted returns the table with every column, as loaded from the
+// database.
+func (t *Table) Unrestricted() *Table {
+	if t.full == nil {
+		return t
+	}
+	return t.full
+}
+
+// HasHiddenColumns reports whether columns are hidden from the role the table
+// was restricted to, so that selecting * would return them.
+func (t *Table) HasHiddenColumns() bool {
+	return t.full != nil && len(t.Columns) < len(t.full.Columns)
+}
+
+// CanInsert reports whether inserts may set column col. The soft-delete
+// column is only set by deletes and restores.
+func (t *Table) CanInsert(col string) bool {
+	a := t.access[col]
+	return a != AccessHidden && a != AccessReadOnly && col != t.SoftDeleteColumn
+}
+
+// CanUpdate reports whether updates may set column col.
+func (t *Table) CanUpdate(col string) bool {
+	return t.access[col] == "" && col != t.SoftDeleteColumn
+}
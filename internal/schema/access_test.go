@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func accessTestSchema() *SchemaCache {
+	users := &Table{
+		Schema: "public", Name: "users", Kind: "table",
+		Columns: []*Column{
+			{Name: "id", IsPrimaryKey: true},
+			{Name: "email"},
+			{Name: "password_hint"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	products := &Table{
+		Schema: "public", Name: "products", Kind: "table",
+		Columns: []*Column{
+			{Name: "id", IsPrimaryKey: true},
+			{Name: "name"},
+			{Name: "cost"},
+			{Name: "sku"},
+			{Name: "created_by"},
+			{Name: "supplier_id"},
+		},
+		PrimaryKey: []string{"id"},
+		ForeignKeys: []*ForeignKey{
+			{ConstraintName: "products_supplier_id_fkey", Columns: []string{"supplier_id"}, ReferencedSchema: "public", ReferencedTable: "users", ReferencedColumns: []string{"id"}},
+		},
+		Indexes: []*Index{
+			{Name: "products_sku_key", IsUnique: true, Columns: []string{"sku"}},
+			{Name: "products_lower_name", Columns: []string{""}},
+		},
+		Relationships: []*Relationship{
+			{Name: "supplier", Type: "many-to-one", FromSchema: "public", FromTable: "products", FromColumns: []string{"supplier_id"}, ToSchema: "public", ToTable: "users", ToColumns: []string{"id"}, FieldName: "supplier"},
+			{Name: "creator", Type: "many-to-one", FromSchema: "public", FromTable: "products", FromColumns: []string{"created_by"}, ToSchema: "public", ToTable: "users", ToColumns: []string{"email"}, FieldName: "creator"},
+		},
+		ColumnAccess: []*ColumnAccess{
+			{Column: "cost", Role: "*", Access: AccessHidden},
+			{Column: "cost", Role: "authenticated", Access: AccessReadOnly},
+			{Column: "sku", Role: "*", Access: AccessInsertOnly},
+			{Column: "supplier_id", Role: "anon", Access: AccessHidden},
+			{Column: "id", Role: "*", Access: AccessHidden},
+			{Column: "missing", Role: "*", Access: AccessHidden},
+		},
+	}
+	return &SchemaCache{Tables: map[string]*Table{"public.users": users, "public.products": products}}
+}
+
+func columnNames(t *Table) []string {
+	names := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func TestForRole(t *testing.T) {
+	sc := accessTestSchema()
+
+	anon := sc.ForRole("anon")
+	products := anon.Tables["public.products"]
+	testutil.Equal(t, len(products.Columns), 4)
+	testutil.True(t, products.ColumnByName("cost") == nil, "cost should be hidden")
+	testutil.True(t, products.ColumnByName("supplier_id") == nil, "supplier_id should be hidden")
+	testutil.True(t, products.HasHiddenColumns(), "expected hidden columns")
+	testutil.SliceLen(t, products.ForeignKeys, 0)
+	testutil.SliceLen(t, products.Indexes, 2)
+	testutil.SliceLen(t, products.Relationships, 1)
+	testutil.Equal(t, products.Relationships[0].Name, "creator")
+
+	// Primary keys cannot be hidden, only made read-only.
+	testutil.NotNil(t, products.ColumnByName("id"))
+	testutil.False(t, products.CanInsert("id"), "id should be read-only")
+	testutil.True(t, products.CanInsert("sku"), "sku should be insertable")
+	testutil.False(t, products.CanUpdate("sku"), "sku should be insert-only")
+	testutil.True(t, products.CanUpdate("name"), "name should be writable")
+
+	// Tables without restrictions are shared.
+	testutil.True(t, anon.Tables["public.users"] == sc.Tables["public.users"], "users should be shared")
+	testutil.True(t, products.Unrestricted() == sc.Tables["public.products"], "Unrestricted should return the loaded table")
+	testutil.True(t, anon.Unrestricted() == sc, "Unrestricted should return the loaded cache")
+	testutil.True(t, sc.ForRole("anon") == anon, "ForRole should be memoized")
+	testutil.True(t, anon.ForRole("authenticated") == sc.ForRole("authenticated"), "ForRole of a restricted cache")
+
+	// Entries for the role override entries for every role.
+	authed := sc.ForRole("authenticated").Tables["public.products"]
+	testutil.NotNil(t, authed.ColumnByName("cost"))
+	testutil.False(t, authed.CanInsert("cost"), "cost should be read-only")
+	testutil.NotNil(t, authed.ColumnByName("supplier_id"))
+	testutil.SliceLen(t, authed.Relationships, 2)
+	testutil.False(t, authed.HasHiddenColumns(), "expected no hidden columns")
+
+	// The empty role takes the most restrictive entry.
+	public := sc.ForRole("").Tables["public.products"]
+	testutil.Equal(t, len(public.Columns), 4)
+	testutil.True(t, public.ColumnByName("cost") == nil, "cost should be hidden")
+
+	// The loaded table is unrestricted.
+	full := sc.Tables["public.products"]
+	testutil.Equal(t, len(full.Columns), 6)
+	testutil.True(t, full.CanInsert("cost") && full.CanUpdate("sku"), "loaded table should be writable")
+}
+
+func TestForRoleDropsRelationshipsToHiddenColumns(t *testing.T) {
+	sc := accessTestSchema()
+	sc.Tables["public.users"].ColumnAccess = []*ColumnAccess{{Column: "email", Role: "*", Access: AccessHidden}}
+
+	products := sc.ForRole("authenticated").Tables["public.products"]
+	testutil.SliceLen(t, products.Relationships, 1)
+	testutil.Equal(t, products.Relationships[0].Name, "supplier")
+	testutil.True(t, products.Unrestricted() == sc.Tables["public.products"], "Unrestricted should return the loaded table")
+	testutil.Equal(t, columnNames(sc.ForRole("authenticated").Tables["public.users"])[1], "password_hint")
+}
+
+func TestForRoleWithoutRestrictions(t *testing.T) {
+	sc := &SchemaCache{Tables: map[string]*Table{"public.notes": {Schema: "public", Name: "notes"}}}
+	testutil.True(t, sc.ForRole("anon") == sc, "unrestricted caches should be returned as is")
+	testutil.True(t, (*SchemaCache)(nil).Unrestricted() == nil, "nil cache")
+}
@@ -20,6 +20,8 @@ type CacheHolder struct {
 	pool    *pgxpool.Pool
 	logger  *slog.Logger
 	ready   chan struct{} // closed after the first successful load
+
+	exposure Exposure // the schemas and tables loaded; see SetExposure
 }
 
 // NewCacheHolder creates a CacheHolder. Call Load() to perform the initial introspection.
@@ -31,6 +33,12 @@ func NewCacheHolder(pool *pgxpool.Pool, logger *slog.Logger) *CacheHolder {
 	}
 }
 
+// SetExposure limits the schemas and tables the cache loads, and so the ones
+// the API serves. Call it before Load.
+func (h *CacheHolder) SetExposure(exp Exposure) {
+	h.exposure = exp
+}
+
 // Ready returns a channel that is closed once the first schema load completes.
 func (h *CacheHolder) Ready() <-chan struct{} {
 	return h.ready
@@ -69,7 +77,7 @@ func (h *CacheHolder) Reload(ctx context.Context) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	sc, err := BuildCache(ctx, h.pool)
+	sc, err := BuildExposedCache(ctx, h.pool, h.exposure)
 	if err != nil {
 		return fmt.Errorf("building schema cache: %w", err)
 	}
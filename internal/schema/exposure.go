@@ -0,0 +1,106 @@
+package schema
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// Exposure limits the schemas and tables the API serves, on top of the
+// system schemas and _ayb_ tables, which are never served. The zero value
+// serves everything else.
+//
+// Table patterns match "schema.table" when they contain a dot and the table
+// name alone otherwise, and may use the wildcards of path.Match, as in
+// "internal.*" or "*_archive".
+type Exposure struct {
+	// Schemas lists the schemas whose tables and functions are served; empty
+	// serves every schema.
+	Schemas []string
+	// IncludeTables, when set, limits the served tables to those matching
+	// one of its patterns.
+	IncludeTables []string
+	// ExcludeTables hides the tables matching any of its patterns.
+	ExcludeTables []string
+	// NumericStrings serves bigint, numeric and money values as JSON strings,
+	// which clients that read numbers as doubles cannot round. Their columns
+	// and computed fields get the "string" JSON type.
+	NumericStrings bool
+}
+
+// schemaExposed reports whether the API serves the objects of schema name.
+func (e Exposure) schemaExposed(name string) bool {
+	return len(e.Schemas) == 0 || slices.Contains(e.Schemas, name)
+}
+
+// tableExposed reports whether the API serves table name of schema.
+func (e Exposure) tableExposed(schema, name string) bool {
+	if !e.schemaExposed(schema) {
+		return false
+	}
+	if len(e.IncludeTables) > 0 && !matchesAny(e.IncludeTables, schema, name) {
+		return false
+	}
+	return !matchesAny(e.ExcludeTables, schema, name)
+}
+
+func matchesAny(patterns []string, schema, name string) bool {
+	for _, p := range patterns {
+		subject := name
+		if strings.Contains(p, ".") {
+			subject = schema + "." + name
+		}
+		if ok, _ := path.Match(p, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// exposeTables drops the tables and schemas e does not serve. It runs before
+// relationships are built, so that none leads to a hidden table.
+func (e Exposure) exposeTables(tables map[string]*Table, schemas []string) []string {
+	for key, tbl := range tables {
+		if !e.tableExposed(tbl.Schema, tbl.Name) {
+			delete(tables, key)
+		}
+	}
+	return slices.DeleteFunc(schemas, func(s string) bool { return !e.schemaExposed(s) })
+}
+
+// exposeFunctions drops the functions of the schemas e does not serve.
+func (e Exposure) exposeFunctions(functions []*Function) []*Function {
+	return slices.DeleteFunc(functions, func(fn *Function) bool { return !e.schemaExposed(fn.Schema) })
+}
+
+// numericStringTypes are the types NumericStrings serves as strings: the
+// numeric ones a double cannot hold exactly.
+var numericStringTypes = map[string]bool{
+	"bigint": true, "int8": true, "numeric": true, "decimal": true, "money": true,
+}
+
+// IsNumericString reports whether values of typeName, from format_type(),
+// are served as strings when NumericStrings is set. Arrays are not.
+func IsNumericString(typeName string) bool {
+	return !strings.HasSuffix(typeName, "[]") && numericStringTypes[baseTypeName(typeName)]
+}
+
+// exposeTypes gives the columns and computed fields of NumericStrings types
+// the "string" JSON type, if e sets NumericStrings.
+func (e Exposure) exposeTypes(tables map[string]*Table) {
+	if !e.NumericStrings {
+		return
+	}
+	for _, tbl := range tables {
+		for _, col := range tbl.Columns {
+			if IsNumericString(col.TypeName) {
+				col.JSONType = "string"
+			}
+		}
+		for _, cf := range tbl.ComputedFields {
+			if IsNumericString(cf.TypeName) {
+				cf.JSONType = "string"
+			}
+		}
+	}
+}
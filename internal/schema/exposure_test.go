@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func TestExposureTableExposed(t *testing.T) {
+	tests := []struct {
+		name   string
+		exp    Exposure
+		schema string
+		table  string
+		want   bool
+	}{
+		{"zero value serves everything", Exposure{}, "internal", "jobs", true},
+		{"schema listed", Exposure{Schemas: []string{"public", "app"}}, "app", "jobs", true},
+		{"schema not listed", Exposure{Schemas: []string{"public"}}, "internal", "jobs", false},
+		{"excluded by name in any schema", Exposure{ExcludeTables: []string{"jobs"}}, "app", "jobs", false},
+		{"excluded by qualified name", Exposure{ExcludeTables: []string{"internal.jobs"}}, "app", "jobs", true},
+		{"excluded by schema wildcard", Exposure{ExcludeTables: []string{"internal.*"}}, "internal", "jobs", false},
+		{"excluded by name wildcard", Exposure{ExcludeTables: []string{"*_archive"}}, "public", "posts_archive", false},
+		{"included", Exposure{IncludeTables: []string{"posts", "app.*"}}, "app", "jobs", true},
+		{"not included", Exposure{IncludeTables: []string{"posts"}}, "public", "users", false},
+		{"exclude wins over include", Exposure{IncludeTables: []string{"*"}, ExcludeTables: []string{"users"}}, "public", "users", false},
+		{"include does not reach unlisted schemas", Exposure{Schemas: []string{"public"}, IncludeTables: []string{"internal.jobs"}}, "internal", "jobs", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equal(t, tt.exp.tableExposed(tt.schema, tt.table), tt.want)
+		})
+	}
+}
+
+func TestExposeTables(t *testing.T) {
+	tables := map[string]*Table{
+		"public.posts":   {Schema: "public", Name: "posts"},
+		"internal.jobs":  {Schema: "internal", Name: "jobs"},
+		"internal.locks": {Schema: "internal", Name: "locks"},
+	}
+	schemas := Exposure{Schemas: []string{"public"}}.exposeTables(tables, []string{"internal", "public"})
+	testutil.MapLen(t, tables, 1)
+	testutil.NotNil(t, tables["public.posts"])
+	testutil.SliceLen(t, schemas, 1)
+	testutil.Equal(t, schemas[0], "public")
+
+	functions := []*Function{
+		{Schema: "public", Name: "stats"},
+		{Schema: "internal", Name: "tick"},
+	}
+	functions = Exposure{Schemas: []string{"public"}}.exposeFunctions(functions)
+	testutil.SliceLen(t, functions, 1)
+	testutil.Equal(t, functions[0].Name, "stats")
+}
+
+func TestBuildRelationshipsSkipsHiddenTables(t *testing.T) {
+	tables := map[string]*Table{
+		"public.posts": {
+			Schema: "public", Name: "posts",
+			ForeignKeys: []*ForeignKey{{
+				ConstraintName: "posts_job_fk", Columns: []string{"job_id"},
+				ReferencedSchema: "internal", ReferencedTable: "jobs", ReferencedColumns: []string{"id"},
+			}},
+		},
+	}
+	buildRelationships(tables)
+	testutil.SliceLen(t, tables["public.posts"].Relationships, 0)
+}
+
+func TestExposeTypesNumericStrings(t *testing.T) {
+	newTables := func() map[string]*Table {
+		return map[string]*Table{"public.ledger": {
+			Schema: "public", Name: "ledger",
+			Columns: []*Column{
+				{Name: "id", TypeName: "bigint", JSONType: "integer"},
+				{Name: "amount", TypeName: "numeric(12,2)", JSONType: "number"},
+				{Name: "fee", TypeName: "money", JSONType: "number"},
+				{Name: "count", TypeName: "integer", JSONType: "integer"},
+				{Name: "ratio", TypeName: "double precision", JSONType: "number"},
+				{Name: "ids", TypeName: "bigint[]", JSONType: "array", IsArray: true},
+			},
+			ComputedFields: []*ComputedField{{Name: "total", TypeName: "numeric", JSONType: "number"}},
+		}}
+	}
+
+	tables := newTables()
+	Exposure{}.exposeTypes(tables)
+	testutil.Equal(t, tables["public.ledger"].Columns[0].JSONType, "integer")
+
+	tables = newTables()
+	Exposure{NumericStrings: true}.exposeTypes(tables)
+	tbl := tables["public.ledger"]
+	for i, want := range []string{"string", "string", "string", "integer", "number", "array"} {
+		testutil.Equal(t, tbl.Columns[i].JSONType, want)
+	}
+	testutil.Equal(t, tbl.ComputedFields[0].JSONType, "string")
+}
@@ -3,6 +3,8 @@ package schema
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,6 +16,12 @@ var excludedSchemas = []string{"information_schema", "pg_catalog", "pg_toast"}
 
 // BuildCache introspects the database and returns a complete SchemaCache.
 func BuildCache(ctx context.Context, pool *pgxpool.Pool) (*SchemaCache, error) {
+	return BuildExposedCache(ctx, pool, Exposure{})
+}
+
+// BuildExposedCache is BuildCache, leaving out the tables and functions exp
+// does not serve.
+func BuildExposedCache(ctx context.Context, pool *pgxpool.Pool, exp Exposure) (*SchemaCache, error) {
 	enums, err := loadEnums(ctx, pool)
 	if err != nil {
 		return nil, fmt.Errorf("loading enums: %w", err)
@@ -23,6 +31,7 @@ func BuildCache(ctx context.Context, pool *pgxpool.Pool) (*SchemaCache, error) {
 	if err != nil {
 		return nil, fmt.Errorf("loading tables: %w", err)
 	}
+	schemas = exp.exposeTables(tables, schemas)
 
 	if err := loadPrimaryKeys(ctx, pool, tables); err != nil {
 		return nil, fmt.Errorf("loading primary keys: %w", err)
@@ -38,10 +47,35 @@ func BuildCache(ctx context.Context, pool *pgxpool.Pool) (*SchemaCache, error) {
 
 	buildRelationships(tables)
 
-	functions, err := loadFunctions(ctx, pool)
+	overloads, err := loadFunctions(ctx, pool)
 	if err != nil {
 		return nil, fmt.Errorf("loading functions: %w", err)
 	}
+	overloads = exp.exposeFunctions(overloads)
+	functions := functionsByName(overloads)
+
+	searchPath, err := loadSearchPath(ctx, pool)
+	if err != nil {
+		return nil, fmt.Errorf("loading search path: %w", err)
+	}
+	buildComputedFields(tables, overloads, searchPath)
+	exp.exposeTypes(tables)
+
+	if err := loadRules(ctx, pool, tables); err != nil {
+		return nil, fmt.Errorf("loading access rules: %w", err)
+	}
+
+	if err := loadColumnAccess(ctx, pool, tables); err != nil {
+		return nil, fmt.Errorf("loading column access: %w", err)
+	}
+
+	if err := loadSoftDelete(ctx, pool, tables); err != nil {
+		return nil, fmt.Errorf("loading soft delete settings: %w", err)
+	}
+
+	if err := loadAudited(ctx, pool, tables); err != nil {
+		return nil, fmt.Errorf("loading audited tables: %w", err)
+	}
 
 	return &SchemaCache{
 		Tables:    tables,
@@ -114,7 +148,8 @@ func loadTablesAndColumns(ctx context.Context, pool *pgxpool.Pool, enums map[uin
 		       NOT a.attnotnull                       AS is_nullable,
 		       COALESCE(pg_get_expr(d.adbin, d.adrelid), '') AS column_default,
 		       COALESCE(col_description(c.oid, a.attnum), '') AS column_comment,
-		       t.typcategory::text                     AS type_category
+		       t.typcategory::text                     AS type_category,
+		       a.attidentity <> ''                    AS is_identity
 		FROM pg_attribute a
 		  JOIN pg_class c ON c.oid = a.attrelid
 		  JOIN pg_namespace n ON n.oid = c.relnamespace
@@ -141,14 +176,14 @@ func loadTablesAndColumns(ctx context.Context, pool *pgxpool.Pool, enums map[uin
 			colName, colType, colDefault, colComment        string
 			colPosition                                     int
 			typeOID                                         uint32
-			isNullable                                      bool
+			isNullable, isIdentity                          bool
 			typeCategory                                    string
 		)
 
 		if err := rows.Scan(
 			&tableSchema, &tableName, &tableKind, &tableComment,
 			&colName, &colPosition, &colType, &typeOID,
-			&isNullable, &colDefault, &colComment, &typeCategory,
+			&isNullable, &colDefault, &colComment, &typeCategory, &isIdentity,
 		); err != nil {
 			return nil, nil, fmt.Errorf("scanning column: %w", err)
 		}
@@ -170,6 +205,7 @@ func loadTablesAndColumns(ctx context.Context, pool *pgxpool.Pool, enums map[uin
 		isJSON := typeOID == 114 || typeOID == 3802 // json=114, jsonb=3802
 		isArray := typeCategory == "A"
 		isEnum := typeCategory == "E"
+		isComposite := typeCategory == "C"
 
 		col := &Column{
 			Name:        colName,
@@ -178,11 +214,13 @@ func loadTablesAndColumns(ctx context.Context, pool *pgxpool.Pool, enums map[uin
 			TypeOID:     typeOID,
 			IsNullable:  isNullable,
 			DefaultExpr: colDefault,
+			IsIdentity:  isIdentity,
 			Comment:     colComment,
 			IsJSON:      isJSON,
 			IsEnum:      isEnum,
 			IsArray:     isArray,
-			JSONType:    pgTypeToJSON(colType, isArray, isEnum, isJSON),
+			IsComposite: isComposite,
+			JSONType:    pgTypeToJSON(colType, isArray, isEnum, isJSON || isComposite),
 		}
 
 		// Populate enum values if applicable.
@@ -318,6 +356,136 @@ func loadForeignKeys(ctx context.Context, pool *pgxpool.Pool, tables map[string]
 	return rows.Err()
 }
 
+// loadRules attaches the rows of _ayb_collection_rules to their tables. The
+// table is created by a system migration, so it may not exist yet.
+func loadRules(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Table) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass('_ayb_collection_rules') IS NOT NULL").Scan(&exists); err != nil {
+		return fmt.Errorf("checking rules table: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT table_schema, table_name,
+		       COALESCE(list_rule, ''), COALESCE(view_rule, ''), COALESCE(create_rule, ''),
+		       COALESCE(update_rule, ''), COALESCE(delete_rule, '')
+		FROM _ayb_collection_rules`)
+	if err != nil {
+		return fmt.Errorf("querying rules: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, tableName string
+		var r AccessRules
+		if err := rows.Scan(&schema, &tableName, &r.List, &r.View, &r.Create, &r.Update, &r.Delete); err != nil {
+			return fmt.Errorf("scanning rules: %w", err)
+		}
+		if tbl, ok := tables[schema+"."+tableName]; ok {
+			tbl.Rules = &r
+		}
+	}
+	return rows.Err()
+}
+
+// loadColumnAccess attaches the rows of _ayb_column_access to their tables.
+// Like _ayb_collection_rules, the table may not exist yet.
+func loadColumnAccess(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Table) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass('_ayb_column_access') IS NOT NULL").Scan(&exists); err != nil {
+		return fmt.Errorf("checking column access table: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT table_schema, table_name, column_name, role, access
+		FROM _ayb_column_access
+		ORDER BY table_schema, table_name, column_name, role`)
+	if err != nil {
+		return fmt.Errorf("querying column access: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, tableName string
+		var ca ColumnAccess
+		if err := rows.Scan(&schema, &tableName, &ca.Column, &ca.Role, &ca.Access); err != nil {
+			return fmt.Errorf("scanning column access: %w", err)
+		}
+		if tbl, ok := tables[schema+"."+tableName]; ok {
+			tbl.ColumnAccess = append(tbl.ColumnAccess, &ca)
+		}
+	}
+	return rows.Err()
+}
+
+// loadSoftDelete sets the soft-delete column of the tables listed in
+// _ayb_soft_delete, which may not exist yet. Entries naming a column that is
+// missing or not a timestamp are ignored.
+func loadSoftDelete(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Table) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass('_ayb_soft_delete') IS NOT NULL").Scan(&exists); err != nil {
+		return fmt.Errorf("checking soft delete table: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, "SELECT table_schema, table_name, column_name FROM _ayb_soft_delete")
+	if err != nil {
+		return fmt.Errorf("querying soft delete settings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, tableName, column string
+		if err := rows.Scan(&schema, &tableName, &column); err != nil {
+			return fmt.Errorf("scanning soft delete settings: %w", err)
+		}
+		tbl, ok := tables[schema+"."+tableName]
+		if !ok {
+			continue
+		}
+		if col := tbl.ColumnByName(column); col != nil && strings.HasPrefix(col.TypeName, "timestamp") {
+			tbl.SoftDeleteColumn = column
+		}
+	}
+	return rows.Err()
+}
+
+// loadAudited marks the tables listed in _ayb_audit_tables, which may not
+// exist yet.
+func loadAudited(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Table) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass('_ayb_audit_tables') IS NOT NULL").Scan(&exists); err != nil {
+		return fmt.Errorf("checking audited tables: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, "SELECT table_schema, table_name FROM _ayb_audit_tables")
+	if err != nil {
+		return fmt.Errorf("querying audited tables: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, tableName string
+		if err := rows.Scan(&schema, &tableName); err != nil {
+			return fmt.Errorf("scanning audited tables: %w", err)
+		}
+		if tbl, ok := tables[schema+"."+tableName]; ok {
+			tbl.Audited = true
+		}
+	}
+	return rows.Err()
+}
+
 func loadIndexes(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Table) error {
 	filter, args := schemaFilter("tn", 1)
 
@@ -326,7 +494,15 @@ func loadIndexes(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Tab
 		       tn.nspname, tc.relname,
 		       i.indisunique, i.indisprimary,
 		       am.amname,
-		       pg_get_indexdef(i.indexrelid, 0, true)
+		       pg_get_indexdef(i.indexrelid, 0, true),
+		       i.indpred IS NOT NULL,
+		       ARRAY(
+		         SELECT COALESCE(a.attname, '')
+		         FROM unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+		           LEFT JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		         WHERE k.ord <= i.indnkeyatts
+		         ORDER BY k.ord
+		       )::text[]
 		FROM pg_index i
 		  JOIN pg_class ic ON ic.oid = i.indexrelid
 		  JOIN pg_class tc ON tc.oid = i.indrelid
@@ -346,8 +522,10 @@ func loadIndexes(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Tab
 			indexName, schema, tableName string
 			isUnique, isPrimary         bool
 			method, definition          string
+			isPartial                   bool
+			columns                     []string
 		)
-		if err := rows.Scan(&indexName, &schema, &tableName, &isUnique, &isPrimary, &method, &definition); err != nil {
+		if err := rows.Scan(&indexName, &schema, &tableName, &isUnique, &isPrimary, &method, &definition, &isPartial, &columns); err != nil {
 			return fmt.Errorf("scanning index: %w", err)
 		}
 
@@ -363,12 +541,16 @@ func loadIndexes(ctx context.Context, pool *pgxpool.Pool, tables map[string]*Tab
 			IsPrimary:  isPrimary,
 			Method:     method,
 			Definition: definition,
+			Columns:    columns,
+			IsPartial:  isPartial,
 		})
 	}
 	return rows.Err()
 }
 
-func loadFunctions(ctx context.Context, pool *pgxpool.Pool) (map[string]*Function, error) {
+// loadFunctions returns every function, overloads included, in schema and name
+// order.
+func loadFunctions(ctx context.Context, pool *pgxpool.Pool) ([]*Function, error) {
 	filter, args := schemaFilter("n", 1)
 
 	query := fmt.Sprintf(`
@@ -383,13 +565,20 @@ func loadFunctions(ctx context.Context, pool *pgxpool.Pool) (map[string]*Functio
 		         '{}'
 		       )                                     AS arg_types,
 		       format_type(p.prorettype, NULL)        AS return_type,
-		       p.proretset                           AS returns_set
+		       p.proretset                           AS returns_set,
+		       COALESCE(
+		         (SELECT rn.nspname || '.' || rc.relname
+		          FROM pg_class rc
+		            JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+		          WHERE p.pronargs = 1 AND rc.reltype = p.proargtypes[0]),
+		         ''
+		       )                                     AS row_table
 		FROM pg_proc p
 		  JOIN pg_namespace n ON n.oid = p.pronamespace
 		WHERE p.prokind = 'f'
 		  AND p.prorettype != 'trigger'::regtype
 		  AND %s
-		ORDER BY n.nspname, p.proname`, filter)
+		ORDER BY n.nspname, p.proname, p.oid`, filter)
 
 	rows, err := pool.Query(ctx, query, args...)
 	if err != nil {
@@ -397,7 +586,7 @@ func loadFunctions(ctx context.Context, pool *pgxpool.Pool) (map[string]*Functio
 	}
 	defer rows.Close()
 
-	functions := make(map[string]*Function)
+	var functions []*Function
 	for rows.Next() {
 		var (
 			funcSchema, funcName, funcComment string
@@ -405,11 +594,12 @@ func loadFunctions(ctx context.Context, pool *pgxpool.Pool) (map[string]*Functio
 			argTypes                          []string
 			returnType                        string
 			returnsSet                        bool
+			rowTable                          string
 		)
 		if err := rows.Scan(
 			&funcSchema, &funcName, &funcComment,
 			&argNames, &argTypes,
-			&returnType, &returnsSet,
+			&returnType, &returnsSet, &rowTable,
 		); err != nil {
 			return nil, fmt.Errorf("scanning function: %w", err)
 		}
@@ -427,8 +617,7 @@ func loadFunctions(ctx context.Context, pool *pgxpool.Pool) (map[string]*Functio
 			}
 		}
 
-		key := funcSchema + "." + funcName
-		functions[key] = &Function{
+		functions = append(functions, &Function{
 			Schema:     funcSchema,
 			Name:       funcName,
 			Comment:    funcComment,
@@ -436,13 +625,86 @@ func loadFunctions(ctx context.Context, pool *pgxpool.Pool) (map[string]*Functio
 			ReturnType: returnType,
 			ReturnsSet: returnsSet,
 			IsVoid:     returnType == "void",
-		}
+			RowTable:   rowTable,
+		})
 	}
 	return functions, rows.Err()
 }
 
+// functionsByName keys functions by "schema.name" for RPC. Of overloaded
+// functions, the last loaded is kept.
+func functionsByName(overloads []*Function) map[string]*Function {
+	functions := make(map[string]*Function, len(overloads))
+	for _, fn := range overloads {
+		functions[fn.Schema+"."+fn.Name] = fn
+	}
+	return functions
+}
+
+// loadSearchPath returns the schemas of the connection's search path, in order.
+func loadSearchPath(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	var schemas []string
+	err := pool.QueryRow(ctx, "SELECT current_schemas(false)::text[]").Scan(&schemas)
+	return schemas, err
+}
+
+// buildComputedFields adds a computed field to each table for every function
+// that takes the table's row type and returns a single value. Columns take
+// precedence over functions of the same name. Of functions of the same name in
+// several schemas, the one in the table's own schema wins, then the one
+// earliest in searchPath.
+func buildComputedFields(tables map[string]*Table, functions []*Function, searchPath []string) {
+	rank := func(fn *Function) int {
+		if tbl := tables[fn.RowTable]; tbl != nil && fn.Schema == tbl.Schema {
+			return 0
+		}
+		if i := slices.Index(searchPath, fn.Schema); i >= 0 {
+			return i + 1
+		}
+		return len(searchPath) + 1
+	}
+	candidates := slices.Clone(functions)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		return a.Schema < b.Schema
+	})
+
+	for _, fn := range candidates {
+		if fn.RowTable == "" || fn.ReturnsSet || fn.IsVoid {
+			continue
+		}
+		tbl := tables[fn.RowTable]
+		if tbl == nil || tbl.ColumnByName(fn.Name) != nil || tbl.ComputedFieldByName(fn.Name) != nil {
+			continue
+		}
+
+		base := strings.TrimSuffix(fn.ReturnType, "[]")
+		isArray := base != fn.ReturnType
+		isJSON := !isArray && (base == "json" || base == "jsonb")
+		tbl.ComputedFields = append(tbl.ComputedFields, &ComputedField{
+			Name:           fn.Name,
+			FunctionSchema: fn.Schema,
+			TypeName:       fn.ReturnType,
+			JSONType:       pgTypeToJSON(base, isArray, false, isJSON),
+			IsJSON:         isJSON,
+			IsArray:        isArray,
+			Comment:        fn.Comment,
+		})
+	}
+
+	for _, tbl := range tables {
+		sort.Slice(tbl.ComputedFields, func(i, j int) bool {
+			return tbl.ComputedFields[i].Name < tbl.ComputedFields[j].Name
+		})
+	}
+}
+
 // buildRelationships derives forward (many-to-one) and reverse (one-to-many)
-// relationships from foreign keys.
+// relationships from foreign keys, and many-to-many relationships through
+// junction tables.
 func buildRelationships(tables map[string]*Table) {
 	for _, tbl := range tables {
 		for _, fk := range tbl.ForeignKeys {
@@ -460,24 +722,72 @@ func buildRelationships(tables map[string]*Table) {
 				ToColumns:   fk.ReferencedColumns,
 				FieldName:   deriveFieldName(fk.Columns, fk.ReferencedTable),
 			}
+			// Tables that are not served cannot be followed.
+			refTbl, ok := tables[refKey]
+			if !ok {
+				continue
+			}
 			tbl.Relationships = append(tbl.Relationships, forward)
 
 			// Reverse: one-to-many (referenced table -> this table).
-			if refTbl, ok := tables[refKey]; ok {
-				reverse := &Relationship{
-					Name:        fk.ConstraintName,
-					Type:        "one-to-many",
-					FromSchema:  fk.ReferencedSchema,
-					FromTable:   fk.ReferencedTable,
-					FromColumns: fk.ReferencedColumns,
-					ToSchema:    tbl.Schema,
-					ToTable:     tbl.Name,
-					ToColumns:   fk.Columns,
-					FieldName:   tbl.Name,
-				}
-				refTbl.Relationships = append(refTbl.Relationships, reverse)
+			reverse := &Relationship{
+				Name:        fk.ConstraintName,
+				Type:        "one-to-many",
+				FromSchema:  fk.ReferencedSchema,
+				FromTable:   fk.ReferencedTable,
+				FromColumns: fk.ReferencedColumns,
+				ToSchema:    tbl.Schema,
+				ToTable:     tbl.Name,
+				ToColumns:   fk.Columns,
+				FieldName:   tbl.Name,
 			}
+			refTbl.Relationships = append(refTbl.Relationships, reverse)
+		}
+	}
+
+	// Many-to-many: each side of a junction table reaches the other.
+	for _, tbl := range tables {
+		if !isJunctionTable(tbl) {
+			continue
+		}
+		a, b := tbl.ForeignKeys[0], tbl.ForeignKeys[1]
+		aTbl := tables[a.ReferencedSchema+"."+a.ReferencedTable]
+		bTbl := tables[b.ReferencedSchema+"."+b.ReferencedTable]
+		if aTbl == nil || bTbl == nil || aTbl == bTbl {
+			continue
 		}
+		aTbl.Relationships = append(aTbl.Relationships, manyToMany(tbl, a, b))
+		bTbl.Relationships = append(bTbl.Relationships, manyToMany(tbl, b, a))
+	}
+}
+
+// isJunctionTable reports whether tbl links two tables: it has exactly two
+// foreign keys, and its primary key consists of their columns.
+func isJunctionTable(tbl *Table) bool {
+	if len(tbl.ForeignKeys) != 2 || len(tbl.PrimaryKey) == 0 {
+		return false
+	}
+	fkCols := append(append([]string{}, tbl.ForeignKeys[0].Columns...), tbl.ForeignKeys[1].Columns...)
+	return sameColumns(tbl.PrimaryKey, fkCols)
+}
+
+// manyToMany builds the relationship from the table referenced by from to the
+// table referenced by to, through the junction table.
+func manyToMany(junction *Table, from, to *ForeignKey) *Relationship {
+	return &Relationship{
+		Name:                to.ConstraintName,
+		Type:                "many-to-many",
+		FromSchema:          from.ReferencedSchema,
+		FromTable:           from.ReferencedTable,
+		FromColumns:         from.ReferencedColumns,
+		ToSchema:            to.ReferencedSchema,
+		ToTable:             to.ReferencedTable,
+		ToColumns:           to.ReferencedColumns,
+		FieldName:           to.ReferencedTable,
+		JunctionSchema:      junction.Schema,
+		JunctionTable:       junction.Name,
+		JunctionFromColumns: from.Columns,
+		JunctionToColumns:   to.Columns,
 	}
 }
 
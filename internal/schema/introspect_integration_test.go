@@ -249,6 +249,15 @@ func TestBuildCacheIndexes(t *testing.T) {
 	testutil.NotNil(t, authorIdx)
 	testutil.False(t, authorIdx.IsUnique, "idx_posts_author should not be unique")
 	testutil.False(t, authorIdx.IsPrimary, "idx_posts_author should not be primary")
+	testutil.SliceLen(t, authorIdx.Columns, 1)
+	testutil.Equal(t, authorIdx.Columns[0], "author_id")
+	testutil.False(t, authorIdx.IsPartial, "idx_posts_author should not be partial")
+
+	for _, idx := range posts.Indexes {
+		if idx.Name == "idx_posts_published" {
+			testutil.True(t, idx.IsPartial, "idx_posts_published should be partial")
+		}
+	}
 }
 
 func TestBuildCacheRelationships(t *testing.T) {
@@ -349,3 +358,27 @@ func TestBuildCacheExcludesAYBTables(t *testing.T) {
 		testutil.False(t, key == "public._ayb_test", "should exclude _ayb_ tables")
 	}
 }
+
+func TestBuildCacheComputedFieldOverloads(t *testing.T) {
+	ctx := context.Background()
+	resetDB(t, ctx)
+	createTestSchema(t, ctx)
+
+	_, err := sharedPG.Pool.Exec(ctx, `
+		CREATE FUNCTION label(users) RETURNS text AS $$ SELECT $1.name $$ LANGUAGE sql STABLE;
+		CREATE FUNCTION label(posts) RETURNS text AS $$ SELECT $1.title $$ LANGUAGE sql STABLE;
+		CREATE FUNCTION label(text) RETURNS text AS $$ SELECT $1 $$ LANGUAGE sql STABLE;
+		CREATE FUNCTION app.label(users) RETURNS integer AS $$ SELECT $1.id $$ LANGUAGE sql STABLE`)
+	testutil.NoError(t, err)
+
+	cache, err := schema.BuildCache(ctx, sharedPG.Pool)
+	testutil.NoError(t, err)
+
+	// Each overload taking a row type adds a field to its own table, and the
+	// table's own schema wins over others.
+	users := cache.Tables["public.users"].ComputedFieldByName("label")
+	testutil.NotNil(t, users)
+	testutil.Equal(t, users.FunctionSchema, "public")
+	testutil.Equal(t, users.TypeName, "text")
+	testutil.NotNil(t, cache.Tables["public.posts"].ComputedFieldByName("label"))
+}
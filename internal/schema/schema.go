@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"sync"
 	"time"
 )
 
@@ -12,20 +13,38 @@ type SchemaCache struct {
 	Enums     map[uint32]*EnumType `json:"-"`          // lookup by OID (internal)
 	Schemas   []string             `json:"schemas"`
 	BuiltAt   time.Time            `json:"builtAt"`
+
+	full  *SchemaCache // the unrestricted cache, for caches returned by ForRole
+	roles sync.Map     // role -> *SchemaCache, memoizing ForRole
 }
 
-// TableByName returns a table by unqualified name, defaulting to the public schema.
-// Falls back to scanning all schemas if not found in public.
+// TableByName returns a table by name, as the API addresses it: "schema.table"
+// names that table, and an unqualified name defaults to the public schema,
+// falling back to the first schema in name order with such a table.
 func (sc *SchemaCache) TableByName(name string) *Table {
+	if t, ok := sc.Tables[name]; ok {
+		return t
+	}
 	if t, ok := sc.Tables["public."+name]; ok {
 		return t
 	}
+	var found *Table
 	for _, t := range sc.Tables {
-		if t.Name == name {
-			return t
+		if t.Name == name && (found == nil || t.Schema < found.Schema) {
+			found = t
 		}
 	}
-	return nil
+	return found
+}
+
+// CollectionName returns the name the API addresses t by: its unqualified
+// name when that resolves to t, and "schema.table" otherwise. Realtime events
+// name tables the same way.
+func (sc *SchemaCache) CollectionName(t *Table) string {
+	if u := sc.TableByName(t.Name); u != nil && u.Schema == t.Schema {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
 }
 
 // TableList returns all tables as a sorted slice.
@@ -48,6 +67,49 @@ type Table struct {
 	ForeignKeys   []*ForeignKey   `json:"foreignKeys,omitempty"`
 	Indexes       []*Index        `json:"indexes,omitempty"`
 	Relationships []*Relationship `json:"relationships,omitempty"`
+	// ComputedFields are virtual fields backed by functions that take the
+	// table's row type.
+	ComputedFields []*ComputedField `json:"computedFields,omitempty"`
+	// Rules are the access rules stored for the table, or nil if it has none.
+	Rules *AccessRules `json:"-"`
+	// ColumnAccess lists the column restrictions stored for the table.
+	ColumnAccess []*ColumnAccess `json:"-"`
+	// SoftDeleteColumn is the timestamp column that API deletes set instead
+	// of removing the row, stored in _ayb_soft_delete. It is "" for tables
+	// without soft delete.
+	SoftDeleteColumn string `json:"softDeleteColumn,omitempty"`
+	// Audited reports whether changes to the table are recorded in
+	// _ayb_audit, as listed in _ayb_audit_tables.
+	Audited bool `json:"audited,omitempty"`
+
+	full   *Table            // the unrestricted table, for tables returned by ForRole
+	access map[string]string // column -> access level for the role of a restricted table
+}
+
+// AccessRules restrict the API actions on a collection with filter
+// expressions, stored in _ayb_collection_rules. An empty rule leaves its
+// action unrestricted.
+type AccessRules struct {
+	List   string
+	View   string
+	Create string
+	Update string
+	Delete string
+}
+
+// Column access levels, stored in _ayb_column_access.
+const (
+	AccessHidden     = "hidden"      // neither read nor written through the API
+	AccessReadOnly   = "read_only"   // read, but never written
+	AccessInsertOnly = "insert_only" // read, and written only by inserts
+)
+
+// ColumnAccess restricts API access to a column for requests made as Role, or
+// as any role when Role is "*". See SchemaCache.ForRole.
+type ColumnAccess struct {
+	Column string
+	Role   string
+	Access string
 }
 
 // ColumnByName returns a column by name, or nil if not found.
@@ -60,6 +122,51 @@ func (t *Table) ColumnByName(name string) *Column {
 	return nil
 }
 
+// ComputedFieldByName returns a computed field by name, or nil if not found.
+func (t *Table) ComputedFieldByName(name string) *ComputedField {
+	for _, f := range t.ComputedFields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// HasUniqueKey reports whether cols (in any order) are exactly the primary key
+// or the columns of a non-partial unique index, so they can be used as an
+// ON CONFLICT target.
+func (t *Table) HasUniqueKey(cols []string) bool {
+	if len(cols) == 0 {
+		return false
+	}
+	if sameColumns(t.PrimaryKey, cols) {
+		return true
+	}
+	for _, idx := range t.Indexes {
+		if idx.IsUnique && !idx.IsPartial && sameColumns(idx.Columns, cols) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, c := range a {
+		set[c] = true
+	}
+	for _, c := range b {
+		if !set[c] {
+			return false
+		}
+		delete(set, c)
+	}
+	return true
+}
+
 // Column represents a database column.
 type Column struct {
 	Name         string   `json:"name"`
@@ -68,15 +175,23 @@ type Column struct {
 	TypeOID      uint32   `json:"-"`
 	IsNullable   bool     `json:"nullable"`
 	DefaultExpr  string   `json:"default,omitempty"`
+	IsIdentity   bool     `json:"identity,omitempty"`
 	Comment      string   `json:"comment,omitempty"`
 	IsPrimaryKey bool     `json:"isPrimaryKey"`
 	IsJSON       bool     `json:"-"`
 	IsEnum       bool     `json:"-"`
 	IsArray      bool     `json:"-"`
+	IsComposite  bool     `json:"-"`
 	JSONType     string   `json:"jsonType"`
 	EnumValues   []string `json:"enumValues,omitempty"`
 }
 
+// HasDefault reports whether the database fills in the column when an insert
+// leaves it out, from a default expression or an identity sequence.
+func (c *Column) HasDefault() bool {
+	return c.DefaultExpr != "" || c.IsIdentity
+}
+
 // ForeignKey represents a foreign key constraint.
 type ForeignKey struct {
 	ConstraintName    string   `json:"constraintName"`
@@ -95,6 +210,9 @@ type Index struct {
 	IsPrimary  bool   `json:"isPrimary"`
 	Method     string `json:"method"`
 	Definition string `json:"definition"`
+	// Columns lists the key columns in index order. Expression entries are "".
+	Columns   []string `json:"columns,omitempty"`
+	IsPartial bool     `json:"isPartial,omitempty"`
 }
 
 // EnumType represents a PostgreSQL enum type.
@@ -108,7 +226,7 @@ type EnumType struct {
 // Relationship represents a detected relationship between tables.
 type Relationship struct {
 	Name        string   `json:"name"`
-	Type        string   `json:"type"` // many-to-one, one-to-many
+	Type        string   `json:"type"` // many-to-one, one-to-many, many-to-many
 	FromSchema  string   `json:"fromSchema"`
 	FromTable   string   `json:"fromTable"`
 	FromColumns []string `json:"fromColumns"`
@@ -116,6 +234,26 @@ type Relationship struct {
 	ToTable     string   `json:"toTable"`
 	ToColumns   []string `json:"toColumns"`
 	FieldName   string   `json:"fieldName"`
+
+	// Many-to-many only: the junction table and its FK columns referencing
+	// FromColumns and ToColumns respectively.
+	JunctionSchema      string   `json:"junctionSchema,omitempty"`
+	JunctionTable       string   `json:"junctionTable,omitempty"`
+	JunctionFromColumns []string `json:"junctionFromColumns,omitempty"`
+	JunctionToColumns   []string `json:"junctionToColumns,omitempty"`
+}
+
+// ComputedField is a virtual field whose value is computed by a function taking
+// the table's row type, following the PostgREST convention: for example,
+// full_name(users) RETURNS text adds a full_name field to users.
+type ComputedField struct {
+	Name           string `json:"name"` // the function name
+	FunctionSchema string `json:"functionSchema"`
+	TypeName       string `json:"type"`
+	JSONType       string `json:"jsonType"`
+	IsJSON         bool   `json:"-"`
+	IsArray        bool   `json:"-"`
+	Comment        string `json:"comment,omitempty"`
 }
 
 // Function represents a PostgreSQL function discoverable via RPC.
@@ -127,6 +265,9 @@ type Function struct {
 	ReturnType string      `json:"returnType"` // e.g. "integer", "SETOF record", "void"
 	ReturnsSet bool        `json:"returnsSet"`
 	IsVoid     bool        `json:"-"`
+	// RowTable is the "schema.table" key of the table whose row type is the
+	// function's only parameter, if any.
+	RowTable string `json:"-"`
 }
 
 // FuncParam represents a parameter of a PostgreSQL function.
@@ -146,20 +287,32 @@ func (f *Function) ParamByName(name string) *FuncParam {
 	return nil
 }
 
-// FunctionByName returns a function by unqualified name, defaulting to the public schema.
+// FunctionByName returns a function by name, resolved like TableByName.
 func (sc *SchemaCache) FunctionByName(name string) *Function {
 	if sc.Functions == nil {
 		return nil
 	}
+	if f, ok := sc.Functions[name]; ok {
+		return f
+	}
 	if f, ok := sc.Functions["public."+name]; ok {
 		return f
 	}
+	var found *Function
 	for _, f := range sc.Functions {
-		if f.Name == name {
-			return f
+		if f.Name == name && (found == nil || f.Schema < found.Schema) {
+			found = f
 		}
 	}
-	return nil
+	return found
+}
+
+// FunctionName returns the name the API addresses fn by, like CollectionName.
+func (sc *SchemaCache) FunctionName(fn *Function) string {
+	if g := sc.FunctionByName(fn.Name); g != nil && g.Schema == fn.Schema {
+		return fn.Name
+	}
+	return fn.Schema + "." + fn.Name
 }
 
 // relkindToString converts pg_class.relkind to a human-readable string.
@@ -84,6 +84,60 @@ func TestTableByName(t *testing.T) {
 		testutil.NotNil(t, tbl)
 		testutil.Equal(t, tbl.Schema, "public")
 	})
+
+	t.Run("finds schema-qualified table", func(t *testing.T) {
+		sc2 := &SchemaCache{
+			Tables: map[string]*Table{
+				"public.data": {Schema: "public", Name: "data"},
+				"other.data":  {Schema: "other", Name: "data"},
+			},
+		}
+		tbl := sc2.TableByName("other.data")
+		testutil.NotNil(t, tbl)
+		testutil.Equal(t, tbl.Schema, "other")
+		testutil.True(t, sc2.TableByName("missing.data") == nil, "expected nil for unknown schema")
+	})
+
+	t.Run("falls back to the first schema by name", func(t *testing.T) {
+		sc2 := &SchemaCache{
+			Tables: map[string]*Table{
+				"zeta.data":  {Schema: "zeta", Name: "data"},
+				"alpha.data": {Schema: "alpha", Name: "data"},
+			},
+		}
+		for range 10 {
+			testutil.Equal(t, sc2.TableByName("data").Schema, "alpha")
+		}
+	})
+}
+
+func TestCollectionName(t *testing.T) {
+	sc := &SchemaCache{
+		Tables: map[string]*Table{
+			"public.data": {Schema: "public", Name: "data"},
+			"other.data":  {Schema: "other", Name: "data"},
+			"other.items": {Schema: "other", Name: "items"},
+		},
+	}
+	testutil.Equal(t, sc.CollectionName(sc.Tables["public.data"]), "data")
+	testutil.Equal(t, sc.CollectionName(sc.Tables["other.data"]), "other.data")
+	testutil.Equal(t, sc.CollectionName(sc.Tables["other.items"]), "items")
+	// Tables restricted to a role are copies, and are named alike.
+	c := *sc.Tables["other.data"]
+	testutil.Equal(t, sc.CollectionName(&c), "other.data")
+}
+
+func TestFunctionByName(t *testing.T) {
+	sc := &SchemaCache{
+		Functions: map[string]*Function{
+			"public.stats": {Schema: "public", Name: "stats"},
+			"admin.stats":  {Schema: "admin", Name: "stats"},
+		},
+	}
+	testutil.Equal(t, sc.FunctionByName("stats").Schema, "public")
+	testutil.Equal(t, sc.FunctionByName("admin.stats").Schema, "admin")
+	testutil.Equal(t, sc.FunctionName(sc.Functions["admin.stats"]), "admin.stats")
+	testutil.Equal(t, sc.FunctionName(sc.Functions["public.stats"]), "stats")
 }
 
 func TestColumnByName(t *testing.T) {
@@ -196,6 +250,65 @@ func TestBuildRelationships(t *testing.T) {
 	testutil.Equal(t, users.Relationships[0].FieldName, "posts")
 }
 
+func TestBuildRelationshipsManyToMany(t *testing.T) {
+	tables := map[string]*Table{
+		"public.posts": {Schema: "public", Name: "posts", PrimaryKey: []string{"id"}},
+		"public.tags":  {Schema: "public", Name: "tags", PrimaryKey: []string{"id"}},
+		"public.post_tags": {
+			Schema:     "public",
+			Name:       "post_tags",
+			PrimaryKey: []string{"post_id", "tag_id"},
+			ForeignKeys: []*ForeignKey{
+				{ConstraintName: "post_tags_post_id_fkey", Columns: []string{"post_id"},
+					ReferencedSchema: "public", ReferencedTable: "posts", ReferencedColumns: []string{"id"}},
+				{ConstraintName: "post_tags_tag_id_fkey", Columns: []string{"tag_id"},
+					ReferencedSchema: "public", ReferencedTable: "tags", ReferencedColumns: []string{"id"}},
+			},
+		},
+	}
+
+	buildRelationships(tables)
+
+	// posts: one-to-many to post_tags, many-to-many to tags.
+	posts := tables["public.posts"]
+	testutil.SliceLen(t, posts.Relationships, 2)
+	var m2m *Relationship
+	for _, rel := range posts.Relationships {
+		if rel.Type == "many-to-many" {
+			m2m = rel
+		}
+	}
+	testutil.True(t, m2m != nil, "expected many-to-many relationship on posts")
+	testutil.Equal(t, m2m.FieldName, "tags")
+	testutil.Equal(t, m2m.ToTable, "tags")
+	testutil.Equal(t, m2m.JunctionTable, "post_tags")
+	testutil.Equal(t, m2m.JunctionFromColumns[0], "post_id")
+	testutil.Equal(t, m2m.JunctionToColumns[0], "tag_id")
+
+	// tags: the reverse direction.
+	tags := tables["public.tags"]
+	var reverse *Relationship
+	for _, rel := range tags.Relationships {
+		if rel.Type == "many-to-many" {
+			reverse = rel
+		}
+	}
+	testutil.True(t, reverse != nil, "expected many-to-many relationship on tags")
+	testutil.Equal(t, reverse.FieldName, "posts")
+	testutil.Equal(t, reverse.JunctionFromColumns[0], "tag_id")
+}
+
+func TestIsJunctionTable(t *testing.T) {
+	fks := []*ForeignKey{
+		{Columns: []string{"post_id"}, ReferencedTable: "posts"},
+		{Columns: []string{"tag_id"}, ReferencedTable: "tags"},
+	}
+	testutil.True(t, isJunctionTable(&Table{PrimaryKey: []string{"tag_id", "post_id"}, ForeignKeys: fks}), "composite PK of both FKs")
+	testutil.False(t, isJunctionTable(&Table{PrimaryKey: []string{"id"}, ForeignKeys: fks}), "surrogate PK")
+	testutil.False(t, isJunctionTable(&Table{ForeignKeys: fks}), "no PK")
+	testutil.False(t, isJunctionTable(&Table{PrimaryKey: []string{"post_id"}, ForeignKeys: fks[:1]}), "one FK")
+}
+
 func TestSchemaFilter(t *testing.T) {
 	clause, args := schemaFilter("n", 1)
 
@@ -226,3 +339,109 @@ func TestSchemaFilterParamOffset(t *testing.T) {
 	testutil.Contains(t, clause, "s.nspname NOT LIKE $8")
 	testutil.True(t, len(args) == 4, "expected 4 args")
 }
+
+func TestHasUniqueKey(t *testing.T) {
+	tbl := &Table{
+		Name:       "users",
+		PrimaryKey: []string{"id"},
+		Indexes: []*Index{
+			{Name: "users_pkey", IsUnique: true, IsPrimary: true, Columns: []string{"id"}},
+			{Name: "users_email_key", IsUnique: true, Columns: []string{"email"}},
+			{Name: "users_org_slug_key", IsUnique: true, Columns: []string{"org_id", "slug"}},
+			{Name: "users_name_idx", Columns: []string{"name"}},
+			{Name: "users_active_handle_key", IsUnique: true, IsPartial: true, Columns: []string{"handle"}},
+			{Name: "users_lower_email_key", IsUnique: true, Columns: []string{""}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		cols []string
+		want bool
+	}{
+		{"primary key", []string{"id"}, true},
+		{"unique index", []string{"email"}, true},
+		{"composite in any order", []string{"slug", "org_id"}, true},
+		{"prefix of composite", []string{"org_id"}, false},
+		{"duplicate columns", []string{"org_id", "org_id"}, false},
+		{"non-unique index", []string{"name"}, false},
+		{"partial unique index", []string{"handle"}, false},
+		{"unknown column", []string{"nope"}, false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equal(t, tbl.HasUniqueKey(tt.cols), tt.want)
+		})
+	}
+}
+
+func TestBuildComputedFields(t *testing.T) {
+	tables := map[string]*Table{
+		"public.users": {
+			Schema:  "public",
+			Name:    "users",
+			Columns: []*Column{{Name: "id"}, {Name: "name"}},
+		},
+		"public.posts": {Schema: "public", Name: "posts", Columns: []*Column{{Name: "id"}}},
+		"app.orders":   {Schema: "app", Name: "orders", Columns: []*Column{{Name: "id"}}},
+	}
+	functions := []*Function{
+		{Schema: "other", Name: "full_name", ReturnType: "integer", RowTable: "public.users"},
+		{Schema: "public", Name: "full_name", ReturnType: "text", RowTable: "public.users"},
+		{Schema: "public", Name: "full_name", ReturnType: "text", RowTable: "public.posts"},
+		{Schema: "public", Name: "full_name", ReturnType: "text"},
+		{Schema: "public", Name: "nicknames", ReturnType: "text[]", RowTable: "public.users"},
+		{Schema: "public", Name: "profile", ReturnType: "jsonb", RowTable: "public.users"},
+		{Schema: "public", Name: "name", ReturnType: "text", RowTable: "public.users"},
+		{Schema: "public", Name: "all_posts", ReturnType: "posts", ReturnsSet: true, RowTable: "public.users"},
+		{Schema: "public", Name: "touch", ReturnType: "void", IsVoid: true, RowTable: "public.users"},
+		{Schema: "public", Name: "add", ReturnType: "integer"},
+		{Schema: "public", Name: "orphan_fn", ReturnType: "text", RowTable: "public.gone"},
+		{Schema: "ext", Name: "total", ReturnType: "numeric", RowTable: "app.orders"},
+		{Schema: "public", Name: "total", ReturnType: "integer", RowTable: "app.orders"},
+		{Schema: "audit", Name: "total", ReturnType: "text", RowTable: "app.orders"},
+	}
+
+	buildComputedFields(tables, functions, []string{"public", "ext"})
+
+	users := tables["public.users"]
+	testutil.SliceLen(t, users.ComputedFields, 3)
+
+	// The function in the table's own schema wins over other schemas.
+	full := users.ComputedFieldByName("full_name")
+	testutil.NotNil(t, full)
+	testutil.Equal(t, full.FunctionSchema, "public")
+	testutil.Equal(t, full.JSONType, "string")
+
+	// Overloads for other argument types are not lost.
+	posts := tables["public.posts"]
+	testutil.SliceLen(t, posts.ComputedFields, 1)
+	testutil.Equal(t, posts.ComputedFields[0].Name, "full_name")
+
+	// Otherwise the search path decides.
+	total := tables["app.orders"].ComputedFieldByName("total")
+	testutil.NotNil(t, total)
+	testutil.Equal(t, total.FunctionSchema, "public")
+
+	nick := users.ComputedFieldByName("nicknames")
+	testutil.True(t, nick.IsArray)
+	testutil.Equal(t, nick.JSONType, "array")
+
+	profile := users.ComputedFieldByName("profile")
+	testutil.True(t, profile.IsJSON)
+	testutil.Equal(t, profile.JSONType, "object")
+
+	// A column of the same name takes precedence.
+	testutil.True(t, users.ComputedFieldByName("name") == nil)
+}
+
+func TestFunctionsByName(t *testing.T) {
+	functions := functionsByName([]*Function{
+		{Schema: "public", Name: "add", ReturnType: "integer"},
+		{Schema: "public", Name: "add", ReturnType: "numeric"},
+		{Schema: "other", Name: "add", ReturnType: "text"},
+	})
+	testutil.MapLen(t, functions, 2)
+	testutil.Equal(t, functions["public.add"].ReturnType, "numeric")
+}
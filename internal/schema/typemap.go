@@ -15,15 +15,7 @@ func pgTypeToJSON(typeName string, isArray bool, isEnum bool, isJSON bool) strin
 		return "string"
 	}
 
-	// Normalize: strip modifiers like (255), (10,2) for matching.
-	base := strings.ToLower(typeName)
-	if idx := strings.Index(base, "("); idx > 0 {
-		base = strings.TrimSpace(base[:idx])
-	}
-	// Strip trailing [] if present (shouldn't happen since isArray is checked above).
-	base = strings.TrimSuffix(base, "[]")
-
-	switch base {
+	switch baseTypeName(typeName) {
 	// Boolean
 	case "boolean", "bool":
 		return "boolean"
@@ -53,3 +45,23 @@ func pgTypeToJSON(typeName string, isArray bool, isEnum bool, isJSON bool) strin
 		return "string"
 	}
 }
+
+// baseTypeName normalizes a type name for matching: lowercased, without
+// modifiers like (255) and (10,2), and without a trailing [].
+func baseTypeName(typeName string) string {
+	base := strings.ToLower(typeName)
+	if idx := strings.Index(base, "("); idx > 0 {
+		base = strings.TrimSpace(base[:idx])
+	}
+	return strings.TrimSuffix(base, "[]")
+}
+
+// JSONTypeOf maps a type name from format_type() to a JSON type string when no
+// column metadata is at hand, as for array elements and function return types.
+// Names ending in "[]" map to "array"; enums map to "string".
+func JSONTypeOf(typeName string) string {
+	if strings.HasSuffix(typeName, "[]") {
+		return "array"
+	}
+	return pgTypeToJSON(typeName, false, false, false)
+}
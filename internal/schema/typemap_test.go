@@ -95,3 +95,11 @@ func TestPgTypeToJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONTypeOf(t *testing.T) {
+	testutil.Equal(t, JSONTypeOf("integer"), "integer")
+	testutil.Equal(t, JSONTypeOf("numeric(10,2)"), "number")
+	testutil.Equal(t, JSONTypeOf("jsonb"), "object")
+	testutil.Equal(t, JSONTypeOf("text[]"), "array")
+	testutil.Equal(t, JSONTypeOf("mood"), "string")
+}
@@ -71,17 +71,30 @@ func (s *Server) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// adminTokenHeader carries the admin token on API requests whose bearer token
+// is a user's, since user auth only accepts user tokens.
+const adminTokenHeader = "X-Admin-Token"
+
+// isAdmin reports whether r carries a valid admin token, in adminTokenHeader
+// or as its bearer token. When admin.password is not set, no request does:
+// without admin auth nobody is known to be an admin, so admin-only data such
+// as soft-deleted records stays hidden.
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.adminAuth == nil {
+		return false
+	}
+	if token := r.Header.Get(adminTokenHeader); token != "" {
+		return s.adminAuth.validateToken(token)
+	}
+	token, ok := httputil.ExtractBearerToken(r)
+	return ok && s.adminAuth.validateToken(token)
+}
+
 // requireAdminToken returns middleware that requires a valid admin token.
 // When admin.password is not set, all requests pass through.
 func (s *Server) requireAdminToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.adminAuth == nil {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		token, ok := httputil.ExtractBearerToken(r)
-		if !ok || !s.adminAuth.validateToken(token) {
+		if s.adminAuth != nil && !s.isAdmin(r) {
 			httputil.WriteError(w, http.StatusUnauthorized, "admin authentication required")
 			return
 		}
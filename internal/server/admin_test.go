@@ -1,6 +1,7 @@
 package server_test
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log/slog"
@@ -8,11 +9,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/allyourbase/ayb/internal/auth"
 	"github.com/allyourbase/ayb/internal/config"
 	"github.com/allyourbase/ayb/internal/schema"
 	"github.com/allyourbase/ayb/internal/server"
 	"github.com/allyourbase/ayb/internal/testutil"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func newTestServerWithPassword(t *testing.T, password string) *server.Server {
@@ -104,3 +109,147 @@ func TestAdminTokenConsistency(t *testing.T) {
 	testutil.Equal(t, t1, t2)
 	testutil.True(t, len(t1) == 64, "expected 64 hex chars")
 }
+
+func TestSchemaEndpointHidesColumnsFromNonAdmins(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admin.Password = "pass"
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := server.New(cfg, logger, newCacheHolderWithSchema(&schema.SchemaCache{
+		Tables: map[string]*schema.Table{
+			"public.products": {
+				Schema: "public", Name: "products", Kind: "table",
+				Columns: []*schema.Column{{Name: "id", IsPrimaryKey: true}, {Name: "name"}, {Name: "cost"}},
+				ColumnAccess: []*schema.ColumnAccess{
+					{Column: "cost", Role: "anon", Access: schema.AccessHidden},
+				},
+			},
+		},
+	}), nil, nil, nil)
+
+	columns := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/schema", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Router().ServeHTTP(w, req)
+		testutil.Equal(t, w.Code, http.StatusOK)
+		var body struct {
+			Tables map[string]struct {
+				Columns []struct{ Name string }
+			}
+		}
+		testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		var names []string
+		for _, col := range body.Tables["public.products"].Columns {
+			names = append(names, col.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	testutil.Equal(t, columns(""), "id,name")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/auth", strings.NewReader(`{"password":"pass"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.Router().ServeHTTP(w, req)
+	var login map[string]string
+	testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	testutil.Equal(t, columns(login["token"]), "id,name,cost")
+}
+
+const testJWTSecret = "test-secret-that-is-at-least-32-characters-long"
+
+// newAPITestServer returns a server with the CRUD API mounted, and user auth
+// when withAuth is set. Its pool never connects and its schema is not loaded,
+// so requests that get past authentication end in 503.
+func newAPITestServer(t *testing.T, password string, withAuth bool) *server.Server {
+	t.Helper()
+	pool, err := pgxpool.New(context.Background(), "postgres://localhost:1/none")
+	testutil.NoError(t, err)
+	t.Cleanup(pool.Close)
+	cfg := config.Default()
+	cfg.Admin.Password = password
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var authSvc *auth.Service
+	if withAuth {
+		authSvc = auth.NewService(nil, testJWTSecret, time.Hour, 7*24*time.Hour, logger)
+	}
+	return server.New(cfg, logger, newCacheHolderWithSchema(nil), pool, authSvc, nil)
+}
+
+func adminToken(t *testing.T, srv *server.Server, password string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/auth", strings.NewReader(`{"password":"`+password+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.Router().ServeHTTP(w, req)
+	testutil.Equal(t, w.Code, http.StatusOK)
+	var body map[string]string
+	testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body["token"]
+}
+
+func userToken() string {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-123",
+		"iat": jwt.NewNumericDate(now),
+		"exp": jwt.NewNumericDate(now.Add(time.Hour)),
+	})
+	signed, _ := token.SignedString([]byte(testJWTSecret))
+	return signed
+}
+
+// getWithTokens requests path with a bearer token and an X-Admin-Token
+// header, each unless empty, and returns the status code.
+func getWithTokens(srv *server.Server, path, bearer, admin string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	if admin != "" {
+		req.Header.Set("X-Admin-Token", admin)
+	}
+	w := httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestWithDeletedWithoutAdminPassword(t *testing.T) {
+	srv := newAPITestServer(t, "", false)
+
+	// Without admin auth nobody is an admin.
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", "", ""), http.StatusForbidden)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", "anything", "anything"), http.StatusForbidden)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/", "", ""), http.StatusServiceUnavailable)
+
+	// Nor is the audit log served.
+	testutil.Equal(t, getWithTokens(srv, "/api/admin/audit", "", ""), http.StatusNotFound)
+}
+
+func TestWithDeletedWithAdminPassword(t *testing.T) {
+	srv := newAPITestServer(t, "pass", false)
+	admin := adminToken(t, srv, "pass")
+
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", admin, ""), http.StatusServiceUnavailable)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", "", admin), http.StatusServiceUnavailable)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", "", "not-"+admin), http.StatusForbidden)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", "", ""), http.StatusForbidden)
+
+	testutil.Equal(t, getWithTokens(srv, "/api/admin/audit", "", ""), http.StatusUnauthorized)
+	testutil.Equal(t, getWithTokens(srv, "/api/admin/audit", "", "not-"+admin), http.StatusUnauthorized)
+}
+
+func TestWithDeletedWithAdminPasswordAndUserAuth(t *testing.T) {
+	srv := newAPITestServer(t, "pass", true)
+	admin := adminToken(t, srv, "pass")
+
+	// User auth still requires a user token; the admin token only unlocks
+	// withDeleted, in its own header.
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", userToken(), admin), http.StatusServiceUnavailable)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", userToken(), ""), http.StatusForbidden)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/?withDeleted=true", "", admin), http.StatusUnauthorized)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/", admin, ""), http.StatusUnauthorized)
+	testutil.Equal(t, getWithTokens(srv, "/api/collections/posts/", userToken(), ""), http.StatusServiceUnavailable)
+}
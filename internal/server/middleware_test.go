@@ -30,6 +30,8 @@ func TestCORSHeaders(t *testing.T) {
 	testutil.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "DELETE")
 	testutil.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
 	testutil.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+	testutil.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "If-Match")
+	testutil.Equal(t, w.Header().Get("Access-Control-Expose-Headers"), "ETag")
 }
 
 func TestCORSPreflight(t *testing.T) {
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/allyourbase/ayb/internal/httputil"
+	"github.com/allyourbase/ayb/internal/openapi"
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// openapiSpec is the encoded OpenAPI document for one schema cache.
+type openapiSpec struct {
+	sc   *schema.SchemaCache
+	body []byte
+}
+
+// handleOpenAPI serves the OpenAPI document for the current schema, without
+// the columns hidden from any role. Each reload swaps in a new schema cache,
+// so the document is regenerated on the first request after a reload and
+// reused until the next one.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	sc := s.schema.Get()
+	if sc == nil {
+		httputil.WriteError(w, http.StatusServiceUnavailable, "schema cache not ready")
+		return
+	}
+	sc = sc.ForRole("")
+
+	spec := s.openapi.Load()
+	if spec == nil || spec.sc != sc {
+		body, err := json.Marshal(openapi.Build(sc, s.openapiOpts))
+		if err != nil {
+			s.logger.Error("openapi encode error", "error", err)
+			httputil.WriteError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		spec = &openapiSpec{sc: sc, body: body}
+		s.openapi.Store(spec)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spec.body)
+}
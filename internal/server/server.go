@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/allyourbase/ayb/internal/api"
 	"github.com/allyourbase/ayb/internal/auth"
 	"github.com/allyourbase/ayb/internal/config"
 	"github.com/allyourbase/ayb/internal/httputil"
+	"github.com/allyourbase/ayb/internal/openapi"
 	"github.com/allyourbase/ayb/internal/realtime"
 	"github.com/allyourbase/ayb/internal/schema"
 	"github.com/allyourbase/ayb/internal/storage"
@@ -30,6 +32,9 @@ type Server struct {
 	authRL    *auth.RateLimiter // nil when auth disabled
 	hub       *realtime.Hub
 	adminAuth *adminAuth // nil when admin.password not set
+
+	openapiOpts openapi.Options
+	openapi     atomic.Pointer[openapiSpec] // built for the current schema cache
 }
 
 // New creates a new Server with middleware and routes configured.
@@ -56,14 +61,33 @@ func New(cfg *config.Config, logger *slog.Logger, schemaCache *schema.CacheHolde
 	if cfg.Admin.Password != "" {
 		s.adminAuth = newAdminAuth(cfg.Admin.Password)
 	}
+	s.openapiOpts = openapi.Options{Auth: authSvc != nil, Storage: storageSvc != nil}
+	if authSvc != nil {
+		for name, p := range cfg.Auth.OAuth {
+			if p.Enabled {
+				s.openapiOpts.OAuthProviders = append(s.openapiOpts.OAuthProviders, name)
+			}
+		}
+	}
 
 	// Health check (no content-type restriction).
 	r.Get("/health", s.handleHealth)
 
+	var apiHandler *api.Handler
+	if pool != nil {
+		apiHandler = api.NewHandler(pool, schemaCache, logger, hub)
+		apiHandler.SetAdminCheck(s.isAdmin)
+	}
+
 	r.Route("/api", func(r chi.Router) {
 		// Admin auth endpoints (no content-type enforcement — login needs JSON, status is GET).
 		r.Get("/admin/status", s.handleAdminStatus)
 		r.Post("/admin/auth", s.handleAdminLogin)
+		// The audit log holds full row images of every audited table, so it is
+		// only served when there is an admin to authenticate.
+		if apiHandler != nil && s.adminAuth != nil {
+			r.With(s.requireAdminToken).Get("/admin/audit", apiHandler.HandleAudit)
+		}
 
 		// Storage routes accept multipart/form-data, mounted outside JSON content-type enforcement.
 		if storageSvc != nil {
@@ -76,6 +100,18 @@ func New(cfg *config.Config, logger *slog.Logger, schemaCache *schema.CacheHolde
 			})
 		}
 
+		// Collection imports also take CSV and NDJSON, so they are mounted
+		// outside JSON content-type enforcement.
+		if apiHandler != nil {
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.AllowContentType("application/json", "text/csv", "application/x-ndjson"))
+				if authSvc != nil {
+					r.Use(auth.RequireAuth(authSvc))
+				}
+				r.Post("/collections/{table}/import", apiHandler.HandleImport)
+			})
+		}
+
 		// JSON API routes get content-type enforcement.
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.AllowContentType("application/json"))
@@ -103,14 +139,15 @@ func New(cfg *config.Config, logger *slog.Logger, schemaCache *schema.CacheHolde
 			}
 
 			r.Get("/schema", s.handleSchema)
+			r.Get("/openapi.json", s.handleOpenAPI)
 
 			// Realtime SSE (handles its own auth for EventSource compatibility).
 			rtHandler := realtime.NewHandler(hub, pool, authSvc, schemaCache, logger)
+			rtHandler.SetViewRule(api.ViewRule)
 			r.Get("/realtime", rtHandler.ServeHTTP)
 
 			// Mount auto-generated CRUD API.
-			if pool != nil {
-				apiHandler := api.NewHandler(pool, schemaCache, logger, hub)
+			if apiHandler != nil {
 				if authSvc != nil {
 					r.Group(func(r chi.Router) {
 						r.Use(auth.RequireAuth(authSvc))
@@ -183,5 +220,8 @@ func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
 		httputil.WriteError(w, http.StatusServiceUnavailable, "schema cache not ready")
 		return
 	}
+	if !s.isAdmin(r) {
+		sc = sc.ForRole("")
+	}
 	httputil.WriteJSON(w, http.StatusOK, sc)
 }
@@ -1,11 +1,13 @@
 package server_test
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/allyourbase/ayb/internal/schema"
 	"github.com/allyourbase/ayb/internal/server"
 	"github.com/allyourbase/ayb/internal/testutil"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func newTestServer(t *testing.T, schemaCache *schema.CacheHolder) *server.Server {
@@ -117,6 +120,28 @@ func TestRouterSetup(t *testing.T) {
 	testutil.Equal(t, w.Code, http.StatusNotFound)
 }
 
+func TestImportAloneAcceptsCSV(t *testing.T) {
+	// The pool never connects: the schema is not loaded, so handlers stop at 503.
+	pool, err := pgxpool.New(context.Background(), "postgres://localhost:1/none")
+	testutil.NoError(t, err)
+	t.Cleanup(pool.Close)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := server.New(config.Default(), logger, newCacheHolderWithSchema(nil), pool, nil, nil)
+
+	post := func(path, contentType string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("id,name\n1,a\n"))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		srv.Router().ServeHTTP(w, req)
+		return w.Code
+	}
+	testutil.Equal(t, post("/api/collections/posts/import", "text/csv"), http.StatusServiceUnavailable)
+	testutil.Equal(t, post("/api/collections/posts/import", "application/x-ndjson"), http.StatusServiceUnavailable)
+	testutil.Equal(t, post("/api/collections/posts/", "text/csv"), http.StatusUnsupportedMediaType)
+	testutil.Equal(t, post("/api/collections/posts/batch", "application/x-ndjson"), http.StatusUnsupportedMediaType)
+	testutil.Equal(t, post("/api/collections/posts/", "application/json"), http.StatusServiceUnavailable)
+}
+
 func TestHealthEndpointReturnsJSON(t *testing.T) {
 	ch := newCacheHolderWithSchema(nil)
 	srv := newTestServer(t, ch)
@@ -180,3 +205,55 @@ func TestCacheHolderReadyChannel(t *testing.T) {
 	}
 }
 
+
+func TestOpenAPIEndpointNotReady(t *testing.T) {
+	srv := newTestServer(t, newCacheHolderWithSchema(nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	w := httptest.NewRecorder()
+	srv.Router().ServeHTTP(w, req)
+
+	testutil.Equal(t, w.Code, http.StatusServiceUnavailable)
+}
+
+func TestOpenAPIEndpointFollowsReloads(t *testing.T) {
+	ch := newCacheHolderWithSchema(&schema.SchemaCache{
+		Tables: map[string]*schema.Table{
+			"public.users": {Schema: "public", Name: "users", Kind: "table"},
+		},
+		Schemas: []string{"public"},
+	})
+	srv := newTestServer(t, ch)
+
+	getPaths := func() map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+		w := httptest.NewRecorder()
+		srv.Router().ServeHTTP(w, req)
+		testutil.Equal(t, w.Code, http.StatusOK)
+		testutil.Equal(t, w.Header().Get("Content-Type"), "application/json")
+
+		var doc struct {
+			OpenAPI string         `json:"openapi"`
+			Paths   map[string]any `json:"paths"`
+		}
+		testutil.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		testutil.Equal(t, doc.OpenAPI, "3.0.3")
+		return doc.Paths
+	}
+
+	paths := getPaths()
+	testutil.NotNil(t, paths["/collections/users"])
+	testutil.True(t, paths["/collections/posts"] == nil, "posts should not exist yet")
+
+	// A reload swaps in a new cache; the next request sees it.
+	ch.SetForTesting(&schema.SchemaCache{
+		Tables: map[string]*schema.Table{
+			"public.posts": {Schema: "public", Name: "posts", Kind: "table"},
+		},
+		Schemas: []string{"public"},
+	})
+	paths = getPaths()
+	testutil.NotNil(t, paths["/collections/posts"])
+	testutil.True(t, paths["/collections/users"] == nil, "users should be gone after reload")
+}
@@ -0,0 +1,192 @@
+package typegen
+
+import (
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// Go generates a Go source file in package pkg for sc: a string type with
+// constants per enum, a record struct per collection, Insert and Update
+// structs per table, and an Args struct per function. Nullable columns are
+// pointers; Insert and Update fields that may be left out are tagged
+// omitempty, so only the fields that are set are sent.
+func Go(sc *schema.SchemaCache, pkg string) ([]byte, error) {
+	m := newModel(sc)
+	g := &goGen{m: m, imports: map[string]bool{}}
+
+	for _, e := range m.enums {
+		name := pascalCase(e.name, true)
+		g.printf("\n// %s is the %s enum.\ntype %s string\n\nconst (\n", name, e.name, name)
+		for _, v := range e.values {
+			g.printf("\t%s %s = %s\n", name+pascalCase(v, true), name, strconv.Quote(v))
+		}
+		g.printf(")\n")
+	}
+
+	for _, tbl := range m.tables {
+		g.record(tbl)
+	}
+
+	for _, fn := range m.functions {
+		g.args(fn)
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "// %s\n\npackage %s\n", Header, pkg)
+	if len(g.imports) > 0 {
+		out.WriteString("\nimport (\n")
+		for _, path := range []string{"encoding/json", "time"} {
+			if g.imports[path] {
+				fmt.Fprintf(&out, "\t%q\n", path)
+			}
+		}
+		out.WriteString(")\n")
+	}
+	out.WriteString(g.sb.String())
+
+	src, err := format.Source([]byte(out.String()))
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated Go: %w", err)
+	}
+	return src, nil
+}
+
+type goGen struct {
+	m       *model
+	sb      strings.Builder
+	imports map[string]bool
+}
+
+func (g *goGen) printf(format string, args ...any) {
+	fmt.Fprintf(&g.sb, format, args...)
+}
+
+// record writes the record struct of a collection, and its Insert and Update
+// structs when it is a table.
+func (g *goGen) record(tbl *schema.Table) {
+	name := pascalCase(tbl.Name, true)
+
+	g.printf("\n// %s is a record of the %s %s.\n", name, tbl.Name, strings.ReplaceAll(tbl.Kind, "_", " "))
+	g.comment("", tbl.Comment, true)
+	g.printf("type %s struct {\n", name)
+	for _, col := range tbl.Columns {
+		g.comment("\t", col.Comment, false)
+		g.field(col.Name, g.typeOf(col.TypeName, col.JSONType), col.IsNullable, false)
+	}
+	for _, cf := range tbl.ComputedFields {
+		g.comment("\t", cf.Comment, false)
+		g.field(cf.Name, g.typeOf(cf.TypeName, cf.JSONType), true, true)
+	}
+	g.printf("}\n")
+
+	if !writable(tbl) {
+		return
+	}
+	g.printf("\n// %sInsert holds the fields of a new record in the %s table.\ntype %sInsert struct {\n", name, tbl.Name, name)
+	for _, col := range tbl.Columns {
+		optional := insertOptional(col)
+		g.field(col.Name, g.typeOf(col.TypeName, col.JSONType), optional, optional)
+	}
+	g.printf("}\n")
+	g.printf("\n// %sUpdate holds the changes to a record of the %s table.\ntype %sUpdate struct {\n", name, tbl.Name, name)
+	for _, col := range tbl.Columns {
+		g.field(col.Name, g.typeOf(col.TypeName, col.JSONType), true, true)
+	}
+	g.printf("}\n")
+}
+
+// args writes the struct of a function's named arguments.
+func (g *goGen) args(fn *schema.Function) {
+	name := pascalCase(fn.Name, true) + "Args"
+	returns := "nothing"
+	if !isVoid(fn) {
+		returns = fn.ReturnType
+		if fn.ReturnsSet {
+			returns = "setof " + returns
+		}
+	}
+	g.printf("\n// %s are the arguments of the %s function, which returns %s.\n", name, fn.Name, returns)
+	g.comment("", fn.Comment, true)
+	g.printf("type %s struct {\n", name)
+	for _, p := range fn.Parameters {
+		if p.Name != "" {
+			g.field(p.Name, g.typeOf(p.Type, schema.JSONTypeOf(p.Type)), false, false)
+		}
+	}
+	g.printf("}\n")
+}
+
+// field writes a struct field. Nullable fields are pointers, except for types
+// that are already nil-able.
+func (g *goGen) field(name, typ string, nullable, omitEmpty bool) {
+	if nullable && !strings.HasPrefix(typ, "[]") && typ != "json.RawMessage" {
+		typ = "*" + typ
+	}
+	tag := name
+	if omitEmpty {
+		tag += ",omitempty"
+	}
+	g.printf("\t%s %s `json:%s`\n", pascalCase(name, true), typ, strconv.Quote(tag))
+}
+
+func (g *goGen) comment(indent, text string, paragraph bool) {
+	if text == "" {
+		return
+	}
+	if paragraph {
+		g.printf("%s//\n", indent)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		g.printf("%s// %s\n", indent, strings.TrimSpace(line))
+	}
+}
+
+// typeOf returns the Go type of values of a Postgres type.
+func (g *goGen) typeOf(typeName, jsonType string) string {
+	if elem, ok := strings.CutSuffix(typeName, "[]"); ok {
+		return "[]" + g.typeOf(elem, schema.JSONTypeOf(elem))
+	}
+	if e := g.m.enumOf(typeName); e != nil {
+		return pascalCase(e.name, true)
+	}
+	if tbl := g.m.tableOf(typeName); tbl != nil {
+		return pascalCase(tbl.Name, true)
+	}
+
+	base := strings.ToLower(baseName(typeName))
+	switch jsonType {
+	case "integer":
+		switch base {
+		case "smallint", "int2", "smallserial", "serial2":
+			return "int16"
+		case "bigint", "int8", "bigserial", "serial8":
+			return "int64"
+		case "oid":
+			return "uint32"
+		}
+		return "int32"
+	case "number":
+		if base == "real" || base == "float4" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "object", "array":
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	if base == "date" || strings.HasPrefix(base, "timestamp") {
+		g.imports["time"] = true
+		return "time.Time"
+	}
+	if base == "record" {
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	return "string"
+}
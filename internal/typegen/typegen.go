@@ -0,0 +1,147 @@
+// Package typegen generates TypeScript and Go definitions for the records,
+// enums and functions in the schema cache, so client code can be type-checked
+// against the database instead of against hand-written copies of it.
+package typegen
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// Header is the first line of every generated file.
+const Header = "Code generated by ayb gen types. DO NOT EDIT."
+
+// enum is an enum type used by a column or function.
+type enum struct {
+	name   string // the Postgres type name, without schema
+	values []string
+}
+
+// model is the part of the schema that is generated, in a stable order.
+type model struct {
+	sc        *schema.SchemaCache
+	tables    []*schema.Table
+	functions []*schema.Function
+	enums     []*enum
+	enumNames map[string]*enum
+}
+
+// newModel collects the collections and functions served by the API, sorted by
+// name, and the enums they use. It only relies on fields that are part of the
+// /api/schema response, so it works the same on a cache fetched from a server.
+func newModel(sc *schema.SchemaCache) *model {
+	m := &model{sc: sc, enumNames: map[string]*enum{}}
+	for _, tbl := range sc.Tables {
+		if sc.TableByName(tbl.Name) == tbl {
+			m.tables = append(m.tables, tbl)
+		}
+	}
+	sort.Slice(m.tables, func(i, j int) bool { return m.tables[i].Name < m.tables[j].Name })
+	for _, fn := range sc.Functions {
+		if sc.FunctionByName(fn.Name) == fn {
+			m.functions = append(m.functions, fn)
+		}
+	}
+	sort.Slice(m.functions, func(i, j int) bool { return m.functions[i].Name < m.functions[j].Name })
+
+	for _, e := range sc.Enums {
+		m.addEnum(e.Name, e.Values)
+	}
+	for _, tbl := range m.tables {
+		for _, col := range tbl.Columns {
+			if len(col.EnumValues) > 0 {
+				m.addEnum(strings.TrimSuffix(baseName(col.TypeName), "[]"), col.EnumValues)
+			}
+		}
+	}
+	sort.Slice(m.enums, func(i, j int) bool { return m.enums[i].name < m.enums[j].name })
+	return m
+}
+
+func (m *model) addEnum(name string, values []string) {
+	if m.enumNames[name] != nil {
+		return
+	}
+	e := &enum{name: name, values: values}
+	m.enums = append(m.enums, e)
+	m.enumNames[name] = e
+}
+
+// enumOf returns the enum a type name refers to, if any.
+func (m *model) enumOf(typeName string) *enum {
+	return m.enumNames[baseName(typeName)]
+}
+
+// tableOf returns the collection whose row type a type name refers to, if any.
+func (m *model) tableOf(typeName string) *schema.Table {
+	name := baseName(typeName)
+	for _, tbl := range m.tables {
+		if tbl.Name == name {
+			return tbl
+		}
+	}
+	return nil
+}
+
+// baseName strips the schema qualifier, quotes and type modifiers from a type
+// name from format_type(), keeping a trailing "[]".
+func baseName(typeName string) string {
+	elem, isArray := strings.CutSuffix(typeName, "[]")
+	if i := strings.Index(elem, "("); i > 0 {
+		elem = strings.TrimSpace(elem[:i])
+	}
+	if i := strings.LastIndex(elem, "."); i >= 0 {
+		elem = elem[i+1:]
+	}
+	elem = strings.Trim(elem, `"`)
+	if isArray {
+		elem += "[]"
+	}
+	return elem
+}
+
+// writable reports whether records can be created and updated in tbl.
+func writable(tbl *schema.Table) bool {
+	return tbl.Kind == "table" || tbl.Kind == "partitioned_table"
+}
+
+// insertOptional reports whether a column can be left out when creating a
+// record.
+func insertOptional(col *schema.Column) bool {
+	return col.IsNullable || col.HasDefault()
+}
+
+// isVoid reports whether a function returns nothing.
+func isVoid(fn *schema.Function) bool {
+	return fn.IsVoid || fn.ReturnType == "void"
+}
+
+// commonInitialisms are written in capitals in Go names, as golint expects.
+var commonInitialisms = map[string]bool{
+	"api": true, "css": true, "dns": true, "html": true, "http": true, "https": true,
+	"id": true, "ip": true, "json": true, "sql": true, "ssh": true, "tls": true,
+	"ttl": true, "ui": true, "uid": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// pascalCase turns a snake_case name into PascalCase. With initialisms, words
+// like "id" and "url" are written in capitals, as in Go.
+func pascalCase(name string, initialisms bool) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	var sb strings.Builder
+	for _, w := range words {
+		if initialisms && commonInitialisms[strings.ToLower(w)] {
+			sb.WriteString(strings.ToUpper(w))
+			continue
+		}
+		sb.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	s := sb.String()
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "X" + s
+	}
+	return s
+}
@@ -0,0 +1,178 @@
+package typegen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/allyourbase/ayb/internal/schema"
+	"github.com/allyourbase/ayb/internal/testutil"
+)
+
+func testSchema() *schema.SchemaCache {
+	authors := &schema.Table{
+		Schema: "public", Name: "authors", Kind: "table",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "bigint", JSONType: "integer", IsPrimaryKey: true, DefaultExpr: "nextval('authors_id_seq'::regclass)"},
+			{Name: "name", TypeName: "text", JSONType: "string"},
+			{Name: "homepage_url", TypeName: "character varying(200)", JSONType: "string", IsNullable: true},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	posts := &schema.Table{
+		Schema: "public", Name: "blog_posts", Kind: "table", Comment: "Blog posts",
+		Columns: []*schema.Column{
+			{Name: "id", TypeName: "uuid", JSONType: "string", IsPrimaryKey: true, DefaultExpr: "gen_random_uuid()"},
+			{Name: "title", TypeName: "text", JSONType: "string", Comment: "Headline"},
+			{Name: "status", TypeName: "post_status", JSONType: "string", IsEnum: true, IsNullable: true, EnumValues: []string{"draft", "in_review", "published"}},
+			{Name: "tags", TypeName: "text[]", JSONType: "array", IsArray: true, IsNullable: true},
+			{Name: "meta", TypeName: "jsonb", JSONType: "object", IsJSON: true, IsNullable: true},
+			{Name: "score", TypeName: "real", JSONType: "number", IsNullable: true},
+			{Name: "views", TypeName: "smallint", JSONType: "integer", DefaultExpr: "0"},
+			{Name: "published", TypeName: "boolean", JSONType: "boolean", DefaultExpr: "false"},
+			{Name: "created_at", TypeName: "timestamp with time zone", JSONType: "string", DefaultExpr: "now()"},
+			{Name: "author_id", TypeName: "bigint", JSONType: "integer", IsNullable: true},
+			{Name: "display-name", TypeName: "text", JSONType: "string", IsNullable: true},
+		},
+		PrimaryKey: []string{"id"},
+		ComputedFields: []*schema.ComputedField{
+			{Name: "word_count", FunctionSchema: "public", TypeName: "integer", JSONType: "integer"},
+		},
+	}
+	feed := &schema.Table{
+		Schema: "public", Name: "feed", Kind: "view",
+		Columns: []*schema.Column{{Name: "title", TypeName: "text", JSONType: "string", IsNullable: true}},
+	}
+	shadowed := &schema.Table{
+		Schema: "private", Name: "feed", Kind: "table",
+		Columns: []*schema.Column{{Name: "secret", TypeName: "text", JSONType: "string"}},
+	}
+
+	return &schema.SchemaCache{
+		Tables: map[string]*schema.Table{
+			"public.authors":    authors,
+			"public.blog_posts": posts,
+			"public.feed":       feed,
+			"private.feed":      shadowed,
+		},
+		Functions: map[string]*schema.Function{
+			"public.recent_posts": {
+				Schema: "public", Name: "recent_posts", ReturnType: "blog_posts", ReturnsSet: true,
+				Parameters: []*schema.FuncParam{{Name: "since", Type: "timestamp with time zone", Position: 1}},
+			},
+			"public.cleanup": {Schema: "public", Name: "cleanup", ReturnType: "void"},
+			"public.add": {Schema: "public", Name: "add", ReturnType: "integer", Parameters: []*schema.FuncParam{
+				{Name: "a", Type: "integer", Position: 1}, {Name: "b", Type: "integer", Position: 2},
+			}},
+			"public.statuses": {Schema: "public", Name: "statuses", ReturnType: "post_status[]"},
+		},
+		Schemas: []string{"public", "private"},
+	}
+}
+
+func TestTypeScript(t *testing.T) {
+	out := string(TypeScript(testSchema()))
+
+	testutil.True(t, strings.HasPrefix(out, "// "+Header+"\n"), "missing header:\n%s", out)
+	testutil.Contains(t, out, `export type PostStatus = "draft" | "in_review" | "published";`)
+	for _, want := range []string{
+		"/** Blog posts */\nexport type BlogPosts = {\n  id: string;\n  /** Headline */\n  title: string;\n",
+		"  status: PostStatus | null;\n",
+		"  tags: string[] | null;\n",
+		"  meta: Json | null;\n",
+		"  views: number;\n",
+		"  published: boolean;\n",
+		"  \"display-name\": string | null;\n",
+		"  word_count?: number | null;\n",
+		"export type BlogPostsInsert = {\n  id?: string;\n  title: string;\n  status?: PostStatus | null;\n",
+		"export type BlogPostsUpdate = {\n  id?: string;\n  title?: string;\n",
+		"export type Feed = {\n  title: string | null;\n};\n",
+		"  blog_posts: { Row: BlogPosts; Insert: BlogPostsInsert; Update: BlogPostsUpdate };\n",
+		"  feed: { Row: Feed };\n",
+		"  add: { Args: { a: number; b: number }; Returns: number };\n",
+		"  cleanup: { Args: Record<string, never>; Returns: void };\n",
+		"  recent_posts: { Args: { since: string }; Returns: BlogPosts[] };\n",
+		"  statuses: { Args: Record<string, never>; Returns: PostStatus[] };\n",
+	} {
+		testutil.Contains(t, out, want)
+	}
+	testutil.False(t, strings.Contains(out, "FeedInsert"), "views should have no Insert type")
+	testutil.False(t, strings.Contains(out, "secret"), "shadowed tables should be left out")
+}
+
+func TestGo(t *testing.T) {
+	src, err := Go(testSchema(), "models")
+	testutil.NoError(t, err)
+	out := string(src)
+
+	f, err := parser.ParseFile(token.NewFileSet(), "types.go", src, parser.ParseComments)
+	testutil.NoError(t, err)
+	testutil.Equal(t, f.Name.Name, "models")
+	testutil.True(t, ast.IsGenerated(f), "file should be marked as generated")
+
+	for _, want := range []string{
+		"import (\n\t\"encoding/json\"\n\t\"time\"\n)",
+		"type PostStatus string",
+		"PostStatusInReview PostStatus = \"in_review\"",
+		"// BlogPosts is a record of the blog_posts table.\n//\n// Blog posts\ntype BlogPosts struct {",
+		"\t// Headline\n\tTitle string `json:\"title\"`",
+		"\tID string `json:\"id\"`",
+		"\tStatus *PostStatus `json:\"status\"`",
+		"\tTags []string `json:\"tags\"`",
+		"\tMeta json.RawMessage `json:\"meta\"`",
+		"\tScore *float32 `json:\"score\"`",
+		"\tViews int16 `json:\"views\"`",
+		"\tCreatedAt time.Time `json:\"created_at\"`",
+		"\tDisplayName *string `json:\"display-name\"`",
+		"\tWordCount *int32 `json:\"word_count,omitempty\"`",
+		"\tHomepageURL *string `json:\"homepage_url\"`",
+		"// Feed is a record of the feed view.",
+		"\tAuthorID *int64 `json:\"author_id,omitempty\"`",
+		"\tTitle string `json:\"title\"`",
+		"// RecentPostsArgs are the arguments of the recent_posts function, which returns setof blog_posts.",
+		"\tSince time.Time `json:\"since\"`",
+		"// CleanupArgs are the arguments of the cleanup function, which returns nothing.",
+	} {
+		testutil.Contains(t, strings.Join(strings.Fields(out), " "), strings.Join(strings.Fields(want), " "))
+	}
+	testutil.False(t, strings.Contains(out, "FeedInsert"), "views should have no Insert struct")
+}
+
+func TestGoWithoutImports(t *testing.T) {
+	sc := &schema.SchemaCache{Tables: map[string]*schema.Table{
+		"public.notes": {Schema: "public", Name: "notes", Kind: "table", Columns: []*schema.Column{
+			{Name: "id", TypeName: "integer", JSONType: "integer", DefaultExpr: "nextval('notes_id_seq'::regclass)"},
+		}},
+	}}
+	src, err := Go(sc, "db")
+	testutil.NoError(t, err)
+	testutil.False(t, strings.Contains(string(src), "import"), "unexpected imports:\n%s", src)
+	testutil.Contains(t, string(src), "ID *int32 `json:\"id,omitempty\"`")
+}
+
+func TestPascalCase(t *testing.T) {
+	tests := []struct {
+		name        string
+		initialisms bool
+		want        string
+	}{
+		{"blog_posts", false, "BlogPosts"},
+		{"user_id", false, "UserId"},
+		{"user_id", true, "UserID"},
+		{"api_keys", true, "APIKeys"},
+		{"display-name", true, "DisplayName"},
+		{"2fa_codes", true, "X2faCodes"},
+		{"", true, "X"},
+	}
+	for _, tt := range tests {
+		testutil.Equal(t, pascalCase(tt.name, tt.initialisms), tt.want)
+	}
+}
+
+func TestBaseName(t *testing.T) {
+	testutil.Equal(t, baseName("character varying(200)"), "character varying")
+	testutil.Equal(t, baseName(`other."Mood"`), "Mood")
+	testutil.Equal(t, baseName("other.mood[]"), "mood[]")
+}
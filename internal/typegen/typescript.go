@@ -0,0 +1,179 @@
+package typegen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/allyourbase/ayb/internal/schema"
+)
+
+// TypeScript generates TypeScript definitions for sc: an enum type per enum, a
+// record type per collection, Insert and Update types per table, and the
+// Collections and Functions maps. The record types are type aliases rather
+// than interfaces so they can be passed where the SDK expects
+// Record<string, unknown>, as in ayb.records.create<Posts>("posts", data).
+func TypeScript(sc *schema.SchemaCache) []byte {
+	m := newModel(sc)
+	g := &tsGen{m: m}
+
+	g.printf("// %s\n\n", Header)
+	g.printf("export type Json = string | number | boolean | null | Json[] | { [key: string]: Json };\n")
+
+	for _, e := range m.enums {
+		values := make([]string, len(e.values))
+		for i, v := range e.values {
+			values[i] = strconv.Quote(v)
+		}
+		g.printf("\nexport type %s = %s;\n", pascalCase(e.name, false), strings.Join(values, " | "))
+	}
+
+	for _, tbl := range m.tables {
+		g.record(tbl)
+	}
+
+	g.printf("\n/** The record types of each collection. */\nexport interface Collections {\n")
+	for _, tbl := range m.tables {
+		name := pascalCase(tbl.Name, false)
+		if writable(tbl) {
+			g.printf("  %s: { Row: %s; Insert: %sInsert; Update: %sUpdate };\n", tsKey(tbl.Name), name, name, name)
+		} else {
+			g.printf("  %s: { Row: %s };\n", tsKey(tbl.Name), name)
+		}
+	}
+	g.printf("}\n")
+
+	g.printf("\n/** The arguments and results of the functions served at /api/rpc. */\nexport interface Functions {\n")
+	for _, fn := range m.functions {
+		var args []string
+		for _, p := range fn.Parameters {
+			if p.Name != "" {
+				args = append(args, tsKey(p.Name)+": "+g.typeOf(p.Type))
+			}
+		}
+		argType := "Record<string, never>"
+		if len(args) > 0 {
+			argType = "{ " + strings.Join(args, "; ") + " }"
+		}
+		g.printf("  %s: { Args: %s; Returns: %s };\n", tsKey(fn.Name), argType, g.returnType(fn))
+	}
+	g.printf("}\n")
+	return []byte(g.sb.String())
+}
+
+type tsGen struct {
+	m  *model
+	sb strings.Builder
+}
+
+func (g *tsGen) printf(format string, args ...any) {
+	fmt.Fprintf(&g.sb, format, args...)
+}
+
+// record writes the record type of a collection, and its Insert and Update
+// types when it is a table.
+func (g *tsGen) record(tbl *schema.Table) {
+	name := pascalCase(tbl.Name, false)
+
+	g.printf("\n")
+	g.comment("", tbl.Comment)
+	g.printf("export type %s = {\n", name)
+	for _, col := range tbl.Columns {
+		g.comment("  ", col.Comment)
+		g.printf("  %s: %s;\n", tsKey(col.Name), g.columnType(col))
+	}
+	for _, cf := range tbl.ComputedFields {
+		g.comment("  ", cf.Comment)
+		g.printf("  %s?: %s | null;\n", tsKey(cf.Name), g.typeOf(cf.TypeName))
+	}
+	g.printf("};\n")
+
+	if !writable(tbl) {
+		return
+	}
+	g.printf("\nexport type %sInsert = {\n", name)
+	for _, col := range tbl.Columns {
+		opt := ""
+		if insertOptional(col) {
+			opt = "?"
+		}
+		g.printf("  %s%s: %s;\n", tsKey(col.Name), opt, g.columnType(col))
+	}
+	g.printf("};\n")
+	g.printf("\nexport type %sUpdate = {\n", name)
+	for _, col := range tbl.Columns {
+		g.printf("  %s?: %s;\n", tsKey(col.Name), g.columnType(col))
+	}
+	g.printf("};\n")
+}
+
+func (g *tsGen) comment(indent, text string) {
+	if text != "" {
+		g.printf("%s/** %s */\n", indent, strings.ReplaceAll(text, "*/", "* /"))
+	}
+}
+
+func (g *tsGen) columnType(col *schema.Column) string {
+	t := g.typeOf(col.TypeName)
+	if col.JSONType == "object" {
+		t = "Json"
+	}
+	if col.IsNullable {
+		t += " | null"
+	}
+	return t
+}
+
+// typeOf returns the TypeScript type of values of a Postgres type.
+func (g *tsGen) typeOf(typeName string) string {
+	if elem, ok := strings.CutSuffix(typeName, "[]"); ok {
+		t := g.typeOf(elem)
+		if strings.Contains(t, " ") {
+			t = "(" + t + ")"
+		}
+		return t + "[]"
+	}
+	if e := g.m.enumOf(typeName); e != nil {
+		return pascalCase(e.name, false)
+	}
+	if tbl := g.m.tableOf(typeName); tbl != nil {
+		return pascalCase(tbl.Name, false)
+	}
+	switch schema.JSONTypeOf(typeName) {
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "object":
+		return "Json"
+	}
+	if baseName(typeName) == "record" {
+		return "Record<string, Json>"
+	}
+	return "string"
+}
+
+func (g *tsGen) returnType(fn *schema.Function) string {
+	if isVoid(fn) {
+		return "void"
+	}
+	t := g.typeOf(fn.ReturnType)
+	if fn.ReturnsSet {
+		if strings.Contains(t, " ") {
+			t = "(" + t + ")"
+		}
+		t += "[]"
+	}
+	return t
+}
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// tsKey returns a property name, quoted when it is not an identifier.
+func tsKey(name string) string {
+	if tsIdentifier.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
@@ -61,6 +61,13 @@ describe("records", () => {
     expect(url).toContain("filter=active%3Dtrue");
   });
 
+  it("list sends empty cursor for the first keyset page", async () => {
+    await client.records.list("posts", { cursor: "", perPage: 50 });
+    const url = (fetchFn as ReturnType<typeof vi.fn>).mock.calls[0][0] as string;
+    expect(url).toContain("cursor=");
+    expect(url).toContain("perPage=50");
+  });
+
   it("list with no params", async () => {
     await client.records.list("posts");
     const url = (fetchFn as ReturnType<typeof vi.fn>).mock.calls[0][0] as string;
@@ -103,6 +110,23 @@ describe("records", () => {
     expect(call[0]).toContain("/api/collections/posts/42");
     expect(call[1].method).toBe("DELETE");
   });
+
+  it("restore sends POST to /restore", async () => {
+    fetchFn = mockFetch(200, { id: "42", title: "restored" });
+    client = new AYBClient("http://localhost:8090", { fetch: fetchFn });
+    await client.records.restore("posts", "42");
+    const call = (fetchFn as ReturnType<typeof vi.fn>).mock.calls[0];
+    expect(call[0]).toContain("/api/collections/posts/42/restore");
+    expect(call[1].method).toBe("POST");
+  });
+
+  it("history sends GET to /history with paging", async () => {
+    fetchFn = mockFetch(200, { items: [], page: 2, perPage: 10, totalItems: 0, totalPages: 0 });
+    client = new AYBClient("http://localhost:8090", { fetch: fetchFn });
+    await client.records.history("posts", "42", { page: 2, perPage: 10 });
+    const call = (fetchFn as ReturnType<typeof vi.fn>).mock.calls[0];
+    expect(call[0]).toContain("/api/collections/posts/42/history?page=2&perPage=10");
+  });
 });
 
 describe("auth", () => {
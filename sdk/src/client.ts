@@ -1,8 +1,10 @@
 import { AYBError } from "./errors";
 import type {
+  AuditEntry,
   AuthResponse,
   ClientOptions,
   GetParams,
+  HistoryParams,
   ListParams,
   ListResponse,
   RealtimeEvent,
@@ -208,6 +210,7 @@ class RecordsClient {
     if (params?.fields) qs.set("fields", params.fields);
     if (params?.expand) qs.set("expand", params.expand);
     if (params?.skipTotal) qs.set("skipTotal", "true");
+    if (params?.cursor !== undefined) qs.set("cursor", params.cursor);
     const suffix = qs.toString() ? `?${qs}` : "";
     return this.client.request(`/api/collections/${collection}${suffix}`);
   }
@@ -256,6 +259,29 @@ class RecordsClient {
       method: "DELETE",
     });
   }
+
+  /** Restore a soft-deleted record. */
+  async restore<T = Record<string, unknown>>(
+    collection: string,
+    id: string,
+  ): Promise<T> {
+    return this.client.request(`/api/collections/${collection}/${id}/restore`, {
+      method: "POST",
+    });
+  }
+
+  /** List the changes to a record of an audited collection, newest first. */
+  async history(
+    collection: string,
+    id: string,
+    params?: HistoryParams,
+  ): Promise<ListResponse<AuditEntry>> {
+    const qs = new URLSearchParams();
+    if (params?.page) qs.set("page", String(params.page));
+    if (params?.perPage) qs.set("perPage", String(params.perPage));
+    const suffix = qs.toString() ? `?${qs}` : "";
+    return this.client.request(`/api/collections/${collection}/${id}/history${suffix}`);
+  }
 }
 
 class StorageClient {
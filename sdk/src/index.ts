@@ -1,9 +1,11 @@
 export { AYBClient } from "./client";
 export { AYBError } from "./errors";
 export type {
+  AuditEntry,
   AuthResponse,
   ClientOptions,
   GetParams,
+  HistoryParams,
   ListParams,
   ListResponse,
   RealtimeEvent,
@@ -1,10 +1,15 @@
 /** List response envelope returned by collection endpoints. */
 export interface ListResponse<T = Record<string, unknown>> {
   items: T[];
-  page: number;
+  /** Omitted when paginating with a cursor. */
+  page?: number;
   perPage: number;
   totalItems: number;
   totalPages: number;
+  /** Cursor for the following page, when paginating with a cursor. */
+  nextCursor?: string;
+  /** Cursor for the preceding page, when paginating with a cursor. */
+  prevCursor?: string;
 }
 
 /** Parameters for listing records. */
@@ -16,6 +21,8 @@ export interface ListParams {
   fields?: string;
   expand?: string;
   skipTotal?: boolean;
+  /** Keyset pagination cursor. Pass "" for the first page, then nextCursor/prevCursor. */
+  cursor?: string;
 }
 
 /** Parameters for reading a single record. */
@@ -24,6 +31,29 @@ export interface GetParams {
   expand?: string;
 }
 
+/** One recorded change to a record of an audited collection. */
+export interface AuditEntry {
+  id: number;
+  schema: string;
+  table: string;
+  /** Primary key values, joined by commas. */
+  recordId?: string;
+  action: "create" | "update" | "delete" | "restore";
+  /** The row before the change; null for creates. */
+  old: Record<string, unknown> | null;
+  /** The row after the change; null for deletes. */
+  new: Record<string, unknown> | null;
+  /** The user the change was made as, if any. */
+  userId?: string;
+  createdAt: string;
+}
+
+/** Parameters for paging through a record's history. */
+export interface HistoryParams {
+  page?: number;
+  perPage?: number;
+}
+
 /** Auth tokens returned by login/register. */
 export interface AuthResponse {
   token: string;
@@ -42,7 +72,7 @@ export interface User {
 
 /** Realtime event from SSE stream. */
 export interface RealtimeEvent {
-  action: "create" | "update" | "delete";
+  action: "create" | "update" | "delete" | "restore";
   table: string;
   record: Record<string, unknown>;
 }
@@ -65,6 +65,47 @@ export function SchemaView({ table }: { table: Table }) {
         </div>
       </section>
 
+      {/* Computed Fields */}
+      {table.computedFields && table.computedFields.length > 0 && (
+        <section>
+          <h2 className="text-sm font-semibold mb-3 text-gray-700">
+            Computed Fields
+          </h2>
+          <div className="border rounded-lg overflow-hidden">
+            <table className="w-full text-sm">
+              <thead className="bg-gray-50">
+                <tr>
+                  <th className="px-4 py-2 text-left font-medium text-gray-600">
+                    Name
+                  </th>
+                  <th className="px-4 py-2 text-left font-medium text-gray-600">
+                    Type
+                  </th>
+                  <th className="px-4 py-2 text-left font-medium text-gray-600">
+                    Function
+                  </th>
+                </tr>
+              </thead>
+              <tbody>
+                {table.computedFields.map((cf) => (
+                  <tr key={cf.name} className="border-t">
+                    <td className="px-4 py-2 font-medium">{cf.name}</td>
+                    <td className="px-4 py-2">
+                      <code className="text-xs px-1.5 py-0.5 rounded bg-blue-50 text-blue-700">
+                        {cf.type}
+                      </code>
+                    </td>
+                    <td className="px-4 py-2 font-mono text-xs text-gray-500">
+                      {cf.functionSchema}.{cf.name}({table.name})
+                    </td>
+                  </tr>
+                ))}
+              </tbody>
+            </table>
+          </div>
+        </section>
+      )}
+
       {/* Foreign Keys */}
       {table.foreignKeys && table.foreignKeys.length > 0 && (
         <section>
@@ -171,6 +212,7 @@ export function SchemaView({ table }: { table: Table }) {
                 </div>
                 <div className="text-xs text-gray-400 mt-1">
                   {rel.fromTable}({rel.fromColumns.join(", ")}) &rarr;{" "}
+                  {rel.junctionTable && <>{rel.junctionTable} &rarr; </>}
                   {rel.toTable}({rel.toColumns.join(", ")})
                 </div>
               </div>
@@ -16,6 +16,7 @@ export interface Table {
   foreignKeys?: ForeignKey[];
   indexes?: Index[];
   relationships?: Relationship[];
+  computedFields?: ComputedField[];
 }
 
 export interface Column {
@@ -58,6 +59,18 @@ export interface Relationship {
   toTable: string;
   toColumns: string[];
   fieldName: string;
+  junctionSchema?: string;
+  junctionTable?: string;
+  junctionFromColumns?: string[];
+  junctionToColumns?: string[];
+}
+
+export interface ComputedField {
+  name: string;
+  functionSchema: string;
+  type: string;
+  jsonType: string;
+  comment?: string;
 }
 
 // API list response envelope.